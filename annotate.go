@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// annotation is a note pinned to a point of the rendered image, given as a
+// fraction of its width and height from the lower left, so that it marks
+// the same pixel in every viewer's window.
+type annotation struct {
+	X    float32 `json:"x"`
+	Y    float32 `json:"y"`
+	Text string  `json:"text"`
+}
+
+// maxAnnotations is the number of annotations drawn, the size of the
+// markers array of annotationFrag.
+const maxAnnotations = 64
+
+const annotationFrag = `#version 330 core
+uniform vec2 markers[64];
+uniform int count;
+uniform int hover;
+uniform vec2 size;
+
+in vec2 uv;
+out vec4 color;
+
+void main() {
+	vec2 p = uv * size;
+	for (int i = 0; i < count; i++) {
+		float d = distance(p, markers[i] * size);
+		// a ring, filled when hovered
+		if (d < 7 && (d > 5 || i == hover)) {
+			color = vec4(1, 0.2, 0.6, 0.9);
+			return;
+		}
+	}
+	discard;
+}
+`
+
+type annotator struct {
+	prog       gx.Program
+	markersLoc int32
+	countLoc   int32
+	hoverLoc   int32
+	sizeLoc    int32
+}
+
+func newAnnotator() (*annotator, error) {
+	var a annotator
+	err := buildBuiltin(&builtinSlot{name: "annotation", src: annotationFrag, prog: &a.prog, locate: func() {
+		a.markersLoc = gl.GetUniformLocation(uint32(a.prog), gl.Str("markers\x00"))
+		a.countLoc = gl.GetUniformLocation(uint32(a.prog), gl.Str("count\x00"))
+		a.hoverLoc = gl.GetUniformLocation(uint32(a.prog), gl.Str("hover\x00"))
+		a.sizeLoc = gl.GetUniformLocation(uint32(a.prog), gl.Str("size\x00"))
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// loadAnnotations reads the annotations saved at path, if any.
+func loadAnnotations(path string) ([]annotation, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var notes []annotation
+	err = json.Unmarshal(b, &notes)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return notes, nil
+}
+
+func saveAnnotations(path string, notes []annotation) error {
+	b, err := json.MarshalIndent(notes, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, append(b, '\n'), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// hoveredAnnotation returns the index of the annotation within a few pixels
+// of x, y in an image width by height, or -1.
+func hoveredAnnotation(notes []annotation, x, y float32, width, height int32) int {
+	for i, n := range notes {
+		dx, dy := n.X*float32(width)-x, n.Y*float32(height)-y
+		if dx*dx+dy*dy < 7*7 {
+			return i
+		}
+	}
+	return -1
+}
+
+// drawAnnotations marks the annotations over the current viewport.
+func drawAnnotations(a *annotator, notes []annotation, hover int, width, height int32) {
+	if len(notes) == 0 {
+		return
+	}
+	if n := len(notes) - maxAnnotations; n > 0 {
+		notes = notes[n:]
+		hover -= n
+	}
+
+	markers := make([]float32, 0, 2*len(notes))
+	for _, n := range notes {
+		markers = append(markers, n.X, n.Y)
+	}
+
+	gl.Enable(gl.BLEND)
+	defer gl.Disable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	defer gl.BlendFunc(gl.ONE, gl.ZERO)
+
+	var prev int32
+	gl.GetIntegerv(gl.CURRENT_PROGRAM, &prev)
+	defer gl.UseProgram(uint32(prev))
+
+	a.prog.Bind()
+	gl.Uniform2fv(a.markersLoc, int32(len(notes)), &markers[0])
+	gl.Uniform1i(a.countLoc, int32(len(notes)))
+	gl.Uniform1i(a.hoverLoc, int32(hover))
+	gl.Uniform2f(a.sizeLoc, float32(width), float32(height))
+
+	drawFullscreen()
+}
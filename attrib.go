@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// checkAttribs compares the active attributes of a linked program against the
+// streams a model supplies, describing every attribute that would silently
+// read zeros or garbage.
+func checkAttribs(prog uint32, m *model) []string {
+	var res []string
+	for _, a := range gx.ActiveAttribs(prog) {
+		if strings.HasPrefix(a.Name, "gl_") {
+			continue
+		}
+
+		stream, ok := m.streams[a.Name]
+		if !ok {
+			res = append(res, fmt.Sprintf("shader expects %v %v, mesh supplies none", gx.TypeStr(a.Type), a.Name))
+			continue
+		}
+
+		wantBase, wantN := gx.TypeComponents(a.Type)
+		haveBase, haveN := gx.TypeComponents(stream)
+		switch {
+		case wantBase != gl.FLOAT && haveBase == gl.FLOAT:
+			res = append(res, fmt.Sprintf("shader expects %v %v, mesh supplies float data (%v)", gx.TypeStr(a.Type), a.Name, gx.TypeStr(stream)))
+		case wantBase == gl.FLOAT && haveBase != gl.FLOAT:
+			res = append(res, fmt.Sprintf("shader expects %v %v, mesh supplies integer data (%v)", gx.TypeStr(a.Type), a.Name, gx.TypeStr(stream)))
+		case wantN > haveN:
+			// missing components are filled from (0, 0, 0, 1), which is
+			// usually intended for position but rarely for anything else
+			res = append(res, fmt.Sprintf("shader expects %v %v, mesh supplies only %v components (%v)", gx.TypeStr(a.Type), a.Name, haveN, gx.TypeStr(stream)))
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alotabits/shaderdev/internal/audio"
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+var audioPath = flag.String("audio", "", "sound file played in step with the time uniform and analysed into the audio texture as it plays, also when scrubbed, paused or exported; WAV is read directly, other formats decoded with ffmpeg")
+var audioPlayer = flag.String("audio-player", "ffplay -nodisp -autoexit -loglevel quiet -", "command playing the WAV stream on its input that -audio plays through, restarted whenever time jumps; empty to play nothing")
+var audioInCommand = flag.String("audio-in", "", "command writing mono signed 16-bit little-endian PCM to its output, analysed every frame into the audio texture instead of -audio; e.g. \"parec --raw --format=s16le --channels=1 -d @DEFAULT_MONITOR@\" for the system's sound or \"arecord -q -t raw -f S16_LE -c 1\" for the microphone")
+
+// audioSampler is the sampler uniform the audio texture is bound to: a
+// 512x2 texture as Shadertoy's audio channels, the spectrum in the first
+// row and the waveform in the second.
+const audioSampler = "audio"
+
+// audioInput is sound captured by a command or played from a file, and the
+// texture it is analysed into.
+type audioInput struct {
+	// the capture command and the samples it wrote since the last frame,
+	// at most audio.FFTSize
+	cmd     *exec.Cmd
+	mu      sync.Mutex
+	pending []float64
+
+	// or the track and its player, nil when paused
+	track  *audio.Track
+	player *trackPlayer
+
+	analyser *audio.Analyser
+	tex      uint32
+}
+
+// shellCommand runs a command line with the system's shell.
+func shellCommand(line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", line)
+	}
+	return exec.Command("sh", "-c", line)
+}
+
+func newAudioInput() *audioInput {
+	in := &audioInput{analyser: audio.NewAnalyser()}
+	in.tex = gx.CreateTexture2D(gl.R8, audio.Bins, 2, gl.RED, gl.UNSIGNED_BYTE, nil)
+	gx.Label(gl.TEXTURE, in.tex, "audio")
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return in
+}
+
+// startAudio starts the capture command.
+func startAudio(line string) (*audioInput, error) {
+	in := newAudioInput()
+	in.cmd = shellCommand(line)
+	in.cmd.Stderr = os.Stderr
+	out, err := in.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = in.cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	go readAudio(in, out)
+	return in, nil
+}
+
+// readAudio reads samples until the command ends, in chunks of 256.
+func readAudio(in *audioInput, r io.Reader) {
+	buf := make([]byte, 512)
+	for {
+		_, err := io.ReadFull(r, buf)
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				log.Println("audio:", err)
+			}
+			break
+		}
+		in.mu.Lock()
+		for i := 0; i < len(buf); i += 2 {
+			s := int16(binary.LittleEndian.Uint16(buf[i:]))
+			in.pending = append(in.pending, float64(s)/32768)
+		}
+		if n := len(in.pending); n > audio.FFTSize {
+			in.pending = append(in.pending[:0], in.pending[n-audio.FFTSize:]...)
+		}
+		in.mu.Unlock()
+	}
+	err := in.cmd.Wait()
+	if err != nil {
+		log.Println("audio:", err)
+	} else {
+		log.Println("audio: capture ended")
+	}
+}
+
+// openAudioTrack decodes a sound file.
+func openAudioTrack(path string) (*audioInput, error) {
+	var r io.Reader
+	if strings.ToLower(filepath.Ext(path)) == ".wav" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		var errs bytes.Buffer
+		cmd := exec.Command("ffmpeg", "-v", "error", "-i", path, "-f", "wav", "-acodec", "pcm_s16le", "-")
+		cmd.Stderr = &errs
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%v: decoding with ffmpeg: %v %v", path, err, strings.TrimSpace(errs.String()))
+		}
+		r = bytes.NewReader(out)
+	}
+
+	tr, err := audio.DecodeWAV(r)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	in := newAudioInput()
+	in.track = tr
+	return in, nil
+}
+
+// stopAudio ends the capture command or the player.
+func stopAudio(in *audioInput) {
+	if in.cmd != nil && in.cmd.Process != nil {
+		in.cmd.Process.Kill()
+	}
+	if in.player != nil {
+		stopTrackPlayer(in.player)
+		in.player = nil
+	}
+}
+
+// trackPlayer plays a track from a time through -audio-player, feeding it
+// at the pace it plays so that where it is can be told from the wall clock.
+type trackPlayer struct {
+	cmd     *exec.Cmd
+	from    time.Duration
+	started time.Time
+	done    chan struct{}
+}
+
+// playerLead is how far ahead of the wall clock the player is fed.
+const playerLead = 100 * time.Millisecond
+
+func startTrackPlayer(tr *audio.Track, from time.Duration) (*trackPlayer, error) {
+	pl := &trackPlayer{cmd: shellCommand(*audioPlayer), from: from, done: make(chan struct{})}
+	pl.cmd.Stderr = os.Stderr
+	w, err := pl.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = pl.cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	pl.started = time.Now()
+
+	go func() {
+		defer w.Close()
+		err := audio.WriteWAVHeader(w, tr.Rate, tr.Channels, -1)
+		if err != nil {
+			return
+		}
+		chunk := tr.Rate / 50
+		buf := make([]byte, 2*chunk*tr.Channels)
+		for f := tr.Frame(from); f < tr.Frames(); f += chunk {
+			ahead := time.Duration(f-tr.Frame(from))*time.Second/time.Duration(tr.Rate) - time.Since(pl.started)
+			if ahead > playerLead {
+				select {
+				case <-pl.done:
+					return
+				case <-time.After(ahead - playerLead):
+				}
+			}
+			samples := tr.Samples[f*tr.Channels:]
+			if len(samples) > chunk*tr.Channels {
+				samples = samples[:chunk*tr.Channels]
+			}
+			for i, s := range samples {
+				binary.LittleEndian.PutUint16(buf[2*i:], uint16(s))
+			}
+			_, err := w.Write(buf[:2*len(samples)])
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return pl, nil
+}
+
+func stopTrackPlayer(pl *trackPlayer) {
+	close(pl.done)
+	pl.cmd.Process.Kill()
+	go pl.cmd.Wait()
+}
+
+// playerTime returns where the player is in the track.
+func playerTime(pl *trackPlayer, now time.Time) time.Duration {
+	return pl.from + now.Sub(pl.started)
+}
+
+// maxAudioDrift is how far the clock may be from the player before the
+// player is restarted where the clock is.
+const maxAudioDrift = 50 * time.Millisecond
+
+// syncAudio keeps the player in step with a clock just ticked: the clock
+// follows the player while it plays, and the player restarts wherever the
+// clock jumps to, stopping while it is paused, scaled or stepped by fixed
+// amounts.
+func syncAudio(in *audioInput, c *clock, now time.Time) {
+	if in.track == nil || *audioPlayer == "" {
+		return
+	}
+	playing := !c.paused && c.scale == 1 && c.fixed == 0 && c.elapsed < in.track.Duration()
+	if !playing {
+		if in.player != nil {
+			stopTrackPlayer(in.player)
+			in.player = nil
+		}
+		return
+	}
+
+	if in.player != nil {
+		t := playerTime(in.player, now)
+		if d := c.elapsed - t; math.Abs(float64(d)) <= float64(maxAudioDrift) {
+			c.elapsed = t
+			return
+		}
+		stopTrackPlayer(in.player)
+		in.player = nil
+	}
+	pl, err := startTrackPlayer(in.track, c.elapsed)
+	if err != nil {
+		log.Println("audio:", err)
+		*audioPlayer = ""
+		return
+	}
+	in.player = pl
+}
+
+// updateAudio analyses the samples read since the last frame, or the
+// track at time t, into the texture.
+func updateAudio(in *audioInput, t time.Duration) {
+	if in.track != nil {
+		in.analyser.Write(in.track.Window(t))
+	} else {
+		in.mu.Lock()
+		in.analyser.Write(in.pending)
+		in.pending = in.pending[:0]
+		in.mu.Unlock()
+	}
+
+	pix := append(in.analyser.Spectrum(), in.analyser.Waveform()...)
+	gl.BindTexture(gl.TEXTURE_2D, in.tex)
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, audio.Bins, 2, gl.RED, gl.UNSIGNED_BYTE, gl.Ptr(pix))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// bindAudio binds the texture to the unit of the audio sampler, if there is
+// audio and the program has the sampler.
+func bindAudio(p *program, in *audioInput) {
+	if in != nil {
+		bindAudioTexture(p, in.tex)
+	}
+}
+
+func unbindAudio(p *program, in *audioInput) {
+	if in != nil {
+		bindAudioTexture(p, 0)
+	}
+}
+
+func bindAudioTexture(p *program, tex uint32) {
+	for _, s := range p.samplers {
+		if s.name == audioSampler {
+			gx.ActiveTexture(s.unit)
+			gl.BindTexture(gl.TEXTURE_2D, tex)
+			gx.ActiveTexture(0)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	backgroundNone = iota
+	backgroundGradient
+	backgroundChecker
+	backgroundEnv
+)
+
+const backgroundFrag = `#version 330 core
+uniform int mode;
+uniform vec4 viewport;
+uniform mat4 invViewProjection;
+uniform sampler2D env;
+
+in vec2 uv;
+out vec4 color;
+
+const float pi = 3.14159265358979;
+
+void main() {
+	if (mode == 1) {
+		color = vec4(mix(vec3(0.1, 0.1, 0.12), vec3(0.35, 0.38, 0.42), uv.y), 1);
+	} else if (mode == 2) {
+		ivec2 cell = ivec2(floor((gl_FragCoord.xy - viewport.xy) / 16));
+		color = vec4(vec3((cell.x + cell.y) % 2 == 0 ? 0.4 : 0.6), 1);
+	} else {
+		vec2 ndc = uv*2 - 1;
+		vec4 near = invViewProjection * vec4(ndc, -1, 1);
+		vec4 far = invViewProjection * vec4(ndc, 1, 1);
+		vec3 dir = normalize(far.xyz/far.w - near.xyz/near.w);
+		vec2 st = vec2(atan(dir.z, dir.x) / (2*pi) + 0.5, asin(dir.y) / pi + 0.5);
+		color = vec4(texture(env, st).rgb, 1);
+	}
+}
+`
+
+// background is drawn behind the model, after clearing.
+type background struct {
+	mode int
+
+	// transparent clears to zero alpha instead of opaque black
+	transparent bool
+
+	prog    gx.Program
+	envTex  gx.Texture
+	modeLoc int32
+	vpLoc   int32
+	ivpLoc  int32
+	envLoc  int32
+}
+
+// newBackground creates a background from a specification of black,
+// transparent, gradient, checker or env:path/to/image.
+func newBackground(spec string) (*background, error) {
+	var bg background
+	err := setBackground(&bg, spec)
+	if err != nil {
+		return nil, err
+	}
+	return &bg, nil
+}
+
+// setBackground switches bg to a specification, as newBackground reads it,
+// leaving it as it was on error. Its program is built the first time a
+// specification needs it.
+func setBackground(bg *background, spec string) error {
+	mode, transparent := backgroundNone, false
+	var envTex gx.Texture
+	switch {
+	case spec == "black":
+	case spec == "transparent":
+		transparent = true
+	case spec == "gradient":
+		mode = backgroundGradient
+	case spec == "checker":
+		mode = backgroundChecker
+	case strings.HasPrefix(spec, "env:"):
+		mode = backgroundEnv
+		path, err := resolvePath(spec[len("env:"):], "")
+		if err != nil {
+			return err
+		}
+		// mipmaps would seam where the longitude wraps
+		tex, err := loadTexture(path, "off")
+		if err != nil {
+			return err
+		}
+		tex.Bind(gl.TEXTURE_2D)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+		envTex = tex
+	default:
+		return fmt.Errorf("unknown background %v", spec)
+	}
+
+	if mode != backgroundNone && bg.prog == 0 {
+		err := buildBuiltin(&builtinSlot{name: "background", src: backgroundFrag, prog: &bg.prog, locate: func() {
+			bg.modeLoc = gl.GetUniformLocation(uint32(bg.prog), gl.Str("mode\x00"))
+			bg.vpLoc = gl.GetUniformLocation(uint32(bg.prog), gl.Str("viewport\x00"))
+			bg.ivpLoc = gl.GetUniformLocation(uint32(bg.prog), gl.Str("invViewProjection\x00"))
+			bg.envLoc = gl.GetUniformLocation(uint32(bg.prog), gl.Str("env\x00"))
+		}})
+		if err != nil {
+			envTex.Delete()
+			return err
+		}
+	}
+
+	bg.envTex.Delete()
+	bg.mode, bg.transparent, bg.envTex = mode, transparent, envTex
+	return nil
+}
+
+func clearBackground(bg *background) {
+	if bg.transparent {
+		gl.ClearColor(0, 0, 0, 0)
+	} else {
+		gl.ClearColor(0, 0, 0, 1)
+	}
+}
+
+// drawBackground fills the viewport without touching depth.
+func drawBackground(bg *background, viewport [4]float32, viewProjection mgl32.Mat4) {
+	if bg.mode == backgroundNone {
+		return
+	}
+
+	gl.DepthMask(false)
+	defer gl.DepthMask(true)
+
+	var prev int32
+	gl.GetIntegerv(gl.CURRENT_PROGRAM, &prev)
+	defer gl.UseProgram(uint32(prev))
+
+	bg.prog.Bind()
+	gl.Uniform1i(bg.modeLoc, int32(bg.mode))
+	gl.Uniform4fv(bg.vpLoc, 1, &viewport[0])
+	ivp := viewProjection.Inv()
+	gl.UniformMatrix4fv(bg.ivpLoc, 1, false, &ivp[0])
+
+	if bg.mode == backgroundEnv {
+		gx.ActiveTexture(0)
+		bg.envTex.Bind(gl.TEXTURE_2D)
+		defer gl.BindTexture(gl.TEXTURE_2D, 0)
+		gl.Uniform1i(bg.envLoc, 0)
+	}
+
+	drawFullscreen()
+}
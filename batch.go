@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/alotabits/shaderdev/internal/toml"
+)
+
+// batchJob is one [[job]] of a batch file: a shaderdev command line rendered
+// with -export.
+type batchJob struct {
+	name   string
+	args   []string
+	export string
+	frames int64
+	// extra environment, e.g. DRI_PRIME=1 to pick a GPU
+	env []string
+	// working directory the args are relative to, if not the batch file's
+	dir string
+}
+
+func stringList(v interface{}) ([]string, bool) {
+	a, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	res := make([]string, len(a))
+	for i, e := range a {
+		res[i], ok = e.(string)
+		if !ok {
+			return nil, false
+		}
+	}
+	return res, true
+}
+
+func loadJobs(path string) ([]batchJob, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	doc, err := toml.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	tables, _ := doc["job"].([]map[string]interface{})
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("%v: no [[job]] entries", path)
+	}
+
+	var jobs []batchJob
+	for i, t := range tables {
+		var j batchJob
+		var ok bool
+		j.name, _ = t["name"].(string)
+		if j.name == "" {
+			j.name = fmt.Sprintf("job%v", i+1)
+		}
+		if j.args, ok = stringList(t["args"]); !ok {
+			return nil, fmt.Errorf("%v: %v: args must be a list of strings", path, j.name)
+		}
+		if j.export, ok = t["export"].(string); !ok {
+			return nil, fmt.Errorf("%v: %v: missing export directory", path, j.name)
+		}
+		if j.frames, ok = t["frames"].(int64); !ok || j.frames <= 0 {
+			return nil, fmt.Errorf("%v: %v: frames must be a positive integer", path, j.name)
+		}
+		if t["env"] != nil {
+			if j.env, ok = stringList(t["env"]); !ok {
+				return nil, fmt.Errorf("%v: %v: env must be a list of strings", path, j.name)
+			}
+		}
+		j.dir, _ = t["dir"].(string)
+		if !filepath.IsAbs(j.dir) {
+			j.dir = filepath.Join(filepath.Dir(path), j.dir)
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, nil
+}
+
+// batchMain renders every job of a batch file in turn, each in its own
+// shaderdev process logging to its own file, and prints a summary.
+func batchMain(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	logs := fs.String("logs", "", "directory for the per job logs, by default the batch file's")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("batch requires a single jobs file")
+	}
+
+	path := fs.Arg(0)
+	jobs, err := loadJobs(path)
+	if err != nil {
+		return err
+	}
+	if *logs == "" {
+		*logs = filepath.Dir(path)
+	}
+	err = os.MkdirAll(*logs, 0755)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	results := make([]string, len(jobs))
+	for i, j := range jobs {
+		start := time.Now()
+		err := runJob(exe, j, filepath.Join(*logs, j.name+".log"))
+		status := "ok"
+		if err != nil {
+			status = err.Error()
+			failed++
+		}
+		results[i] = fmt.Sprintf("%-20v %8v  %v", j.name, time.Since(start).Round(time.Second), status)
+		fmt.Fprintln(os.Stderr, results[i])
+	}
+
+	fmt.Printf("\n%v of %v jobs succeeded\n", len(jobs)-failed, len(jobs))
+	for _, r := range results {
+		fmt.Println(r)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%v jobs failed", failed)
+	}
+	return nil
+}
+
+func runJob(exe string, j batchJob, logPath string) error {
+	out, err := os.Create(logPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// flags must come before the shader specifications
+	args := append([]string{"-export", j.export, "-frames", fmt.Sprint(j.frames)}, j.args...)
+	cmd := exec.Command(exe, args...)
+	cmd.Dir = j.dir
+	cmd.Env = append(os.Environ(), j.env...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	return cmd.Run()
+}
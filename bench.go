@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+)
+
+var benchOut = flag.String("bench-out", "", "measure rendering with a hidden window and no vsync, as fast as frames can be drawn, writing the times of -frames frames, or those of -bench-seconds, to this JSON file; see the bench subcommand")
+var benchSeconds = flag.Float64("bench-seconds", 0, "seconds of frames to measure with -bench-out, instead of -frames")
+
+// benchWarmup frames are drawn before measuring, while drivers compile
+// and caches fill.
+const benchWarmup = 10
+
+// benchSample is the time of a frame in milliseconds: between its start
+// and the next's, on the CPU up to the swap, on the GPU, negative if not
+// known, and on the GPU by pass.
+type benchSample struct {
+	Interval float64            `json:"interval"`
+	CPU      float64            `json:"cpu"`
+	GPU      float64            `json:"gpu"`
+	Passes   map[string]float64 `json:"passes,omitempty"`
+}
+
+// benchRun collects the samples of a -bench-out run.
+type benchRun struct {
+	seen    int
+	start   time.Time
+	samples []benchSample
+}
+
+// benchFrame records the sample of st whose GPU times were just read back,
+// returning whether the run is over.
+func benchFrame(b *benchRun, st *frameStats, i int, now time.Time) bool {
+	if i < 0 {
+		return false
+	}
+	b.seen++
+	if b.seen <= benchWarmup {
+		return false
+	}
+	if b.start.IsZero() {
+		b.start = now
+	}
+
+	s := benchSample{Interval: float64(st.interval[i]), CPU: float64(st.cpu[i]), GPU: float64(st.gpu[i])}
+	for name, t := range passTimers {
+		if t.last >= 0 {
+			if s.Passes == nil {
+				s.Passes = make(map[string]float64)
+			}
+			s.Passes[name] = t.last
+		}
+	}
+	b.samples = append(b.samples, s)
+
+	if *benchSeconds > 0 {
+		return now.Sub(b.start).Seconds() >= *benchSeconds
+	}
+	return len(b.samples) >= *exportFrames
+}
+
+func writeBench(b *benchRun, path string) error {
+	buf, err := json.Marshal(b.samples)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf, 0644)
+}
+
+// benchMain runs shaderdev with -bench-out in its own process and prints
+// the minimum, mean and 95th percentile of each time it measured.
+func benchMain(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	frames := fs.Int("frames", 300, "frames to measure")
+	seconds := fs.Float64("seconds", 0, "seconds to measure, instead of -frames")
+	res := fs.String("resolution", "1280x720", "size to render at")
+	asJSON := fs.Bool("json", false, "print the summary as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: shaderdev bench [flags] [-- shaderdev flags] shaders...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *frames <= 0 && *seconds <= 0 {
+		return fmt.Errorf("bench: -frames or -seconds must be positive")
+	}
+	w, h, err := parseResolution(*res)
+	if err != nil {
+		return fmt.Errorf("bench: %v", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	out, err := ioutil.TempFile("", "shaderdev-bench-*.json")
+	if err != nil {
+		return err
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	// flags must come before the shader specifications
+	runArgs := []string{"-bench-out", out.Name(), "-frames", fmt.Sprint(*frames), "-bench-seconds", fmt.Sprint(*seconds), "-resolution", *res}
+	cmd := exec.Command(exe, append(runArgs, fs.Args()...)...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err = cmd.Run()
+	if err != nil {
+		os.Stderr.Write(output.Bytes())
+		return fmt.Errorf("bench: %v", err)
+	}
+
+	buf, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		return err
+	}
+	var samples []benchSample
+	err = json.Unmarshal(buf, &samples)
+	if err != nil {
+		return fmt.Errorf("bench: %v", err)
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("bench: no frames measured")
+	}
+
+	rows := benchSummary(samples)
+	if *asJSON {
+		b, err := json.MarshalIndent(map[string]interface{}{"frames": len(samples), "width": w, "height": h, "times": rows}, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	fmt.Printf("%v frames at %vx%v, in milliseconds\n", len(samples), w, h)
+	fmt.Printf("%-14v %9v %9v %9v\n", "", "min", "avg", "p95")
+	for _, r := range rows {
+		fmt.Printf("%-14v %9.3f %9.3f %9.3f\n", r.Name, r.Min, r.Avg, r.P95)
+	}
+	return nil
+}
+
+// benchTimes summarizes one of the times of the samples.
+type benchTimes struct {
+	Name string  `json:"name"`
+	Min  float64 `json:"min"`
+	Avg  float64 `json:"avg"`
+	P95  float64 `json:"p95"`
+}
+
+// benchSummary summarizes the frame, CPU and GPU times of samples, then the
+// GPU time of each pass as "pass NAME", leaving out times never known.
+func benchSummary(samples []benchSample) []benchTimes {
+	times := map[string][]float64{}
+	var passes []string
+	for _, s := range samples {
+		times["frame"] = append(times["frame"], s.Interval)
+		times["cpu"] = append(times["cpu"], s.CPU)
+		if s.GPU >= 0 {
+			times["gpu"] = append(times["gpu"], s.GPU)
+		}
+		for name, ms := range s.Passes {
+			if times["pass "+name] == nil {
+				passes = append(passes, name)
+			}
+			times["pass "+name] = append(times["pass "+name], ms)
+		}
+	}
+	sort.Strings(passes)
+
+	var rows []benchTimes
+	keys := []string{"frame", "cpu", "gpu"}
+	for _, name := range passes {
+		keys = append(keys, "pass "+name)
+	}
+	for _, key := range keys {
+		v := times[key]
+		if len(v) == 0 {
+			continue
+		}
+		sort.Float64s(v)
+		sum := 0.0
+		for _, x := range v {
+			sum += x
+		}
+		// the nearest rank
+		p95 := v[int(math.Ceil(0.95*float64(len(v))))-1]
+		rows = append(rows, benchTimes{key, v[0], sum / float64(len(v)), p95})
+	}
+	return rows
+}
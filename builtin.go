@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+	"gopkg.in/fsnotify.v1"
+)
+
+// fullscreenVert covers the viewport with a single triangle when drawn with
+// drawFullscreen, passing viewport coordinates in [0, 1] as uv.
+const fullscreenVert = `#version 330 core
+out vec2 uv;
+
+void main() {
+	uv = vec2((gl_VertexID << 1) & 2, gl_VertexID & 2);
+	gl_Position = vec4(uv*2 - 1, 0, 1);
+}
+`
+
+// buildProgram compiles and links one of shaderdev's own programs, labeled
+// name.
+func buildProgram(name, vs, fs string) (gx.Program, error) {
+	if gles {
+		vs, fs = esSource(vs), esSource(fs)
+	}
+	prog := gx.NewProgram()
+	prog.Label(name)
+	for _, s := range []struct {
+		stage uint32
+		src   string
+	}{{gl.VERTEX_SHADER, vs}, {gl.FRAGMENT_SHADER, fs}} {
+		sha := gx.NewShader(s.stage)
+		defer sha.Delete()
+		sha.Label(name + " " + gx.StageStr(s.stage))
+
+		err := gx.CompileSource(uint32(sha), [][]byte{[]byte(s.src)})
+		if err != nil {
+			prog.Delete()
+			return 0, err
+		}
+		gl.AttachShader(uint32(prog), uint32(sha))
+	}
+
+	err := gx.LinkProgram(uint32(prog))
+	if err != nil {
+		prog.Delete()
+		return 0, err
+	}
+
+	return prog, nil
+}
+
+// fullscreenVAO is an attribute-less vertex array, since core profiles
+// cannot draw without one bound.
+var fullscreenVAO gx.VertexArray
+
+func drawFullscreen() {
+	if fullscreenVAO == 0 {
+		fullscreenVAO = gx.NewVertexArray()
+		fullscreenVAO.Label("fullscreen")
+	}
+
+	fullscreenVAO.Bind()
+	defer gl.BindVertexArray(0)
+	gl.DrawArrays(gl.TRIANGLES, 0, 3)
+}
+
+// builtinSlot is one of shaderdev's own programs, whose fragment shader may
+// be replaced by a user file that reloads when it changes, e.g. to restyle
+// the overlay. The slot rebuilds the program in place in its owner.
+type builtinSlot struct {
+	name string
+	// the built-in fragment shader, and the file replacing it, if any
+	src  string
+	path string
+	// prepare, if set, turns the source into the one compiled, e.g. to add
+	// depth functions
+	prepare func([]byte) []byte
+	// prog is the owner's field holding the program, and locate looks up
+	// the uniforms of a new one
+	prog   *gx.Program
+	locate func()
+}
+
+// builtinNames are the slots -builtin may replace.
+var builtinNames = []string{"annotation", "background", "crt", "cut", "dof", "fade", "overlay", "panel", "stats", "taa", "wipe"}
+
+// builtinPaths are the files replacing slots, by name, given with -builtin.
+var builtinPaths = make(map[string]string)
+
+// builtinSlots are the slots built so far, to reload.
+var builtinSlots []*builtinSlot
+
+// parseBuiltinSpecs resolves the NAME=PATH values of -builtin into
+// builtinPaths.
+func parseBuiltinSpecs(specs []string) error {
+	for _, spec := range specs {
+		i := strings.Index(spec, "=")
+		if i < 0 {
+			return fmt.Errorf("invalid -builtin %v, expected NAME=PATH", spec)
+		}
+		name := spec[:i]
+		known := false
+		for _, n := range builtinNames {
+			known = known || n == name
+		}
+		if !known {
+			return fmt.Errorf("unknown builtin %v, expected one of %v", name, strings.Join(builtinNames, ", "))
+		}
+		path, err := resolvePath(spec[i+1:], "")
+		if err != nil {
+			return err
+		}
+		builtinPaths[name] = path
+	}
+	return nil
+}
+
+// buildBuiltin builds the program of a slot, from the file given for it
+// with -builtin if its path isn't set, and keeps the slot for reloading.
+func buildBuiltin(s *builtinSlot) error {
+	if s.path == "" {
+		s.path = builtinPaths[s.name]
+	}
+	err := rebuildBuiltin(s)
+	if err != nil {
+		return err
+	}
+	builtinSlots = append(builtinSlots, s)
+	return nil
+}
+
+func rebuildBuiltin(s *builtinSlot) error {
+	src := []byte(s.src)
+	if s.path != "" {
+		b, err := ioutil.ReadFile(s.path)
+		if err != nil {
+			return fmt.Errorf("%v: %v", s.name, err)
+		}
+		src = b
+	}
+	if s.prepare != nil {
+		src = s.prepare(src)
+	}
+
+	prog, err := buildProgram("builtin "+s.name, fullscreenVert, string(src))
+	if err != nil {
+		if s.path != "" {
+			return fmt.Errorf("%v: %v: %v", s.name, s.path, err)
+		}
+		return fmt.Errorf("%v: %v", s.name, err)
+	}
+	s.prog.Delete()
+	*s.prog = prog
+	s.locate()
+	return nil
+}
+
+// setBuiltinPath replaces the slots of a name with the file at path, or
+// restores them for "", rebuilding those built so far.
+func setBuiltinPath(name, path string) error {
+	if path == "" {
+		delete(builtinPaths, name)
+	} else {
+		builtinPaths[name] = path
+	}
+	for _, s := range builtinSlots {
+		if s.name != name {
+			continue
+		}
+		s.path = path
+		err := rebuildBuiltin(s)
+		if err != nil {
+			return err
+		}
+		from := path
+		if from == "" {
+			from = "its built-in shader"
+		}
+		log.Printf("rebuilt %v from %v", name, from)
+	}
+	return nil
+}
+
+// builtinChanged rebuilds the slots whose file is path, keeping the last
+// program that built when one fails, and reports whether any were.
+func builtinChanged(path string) bool {
+	found := false
+	for _, s := range builtinSlots {
+		if s.path == "" || filepath.Clean(s.path) != path {
+			continue
+		}
+		found = true
+		err := rebuildBuiltin(s)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		log.Printf("reloaded %v from %v", s.name, path)
+	}
+	return found
+}
+
+// watchBuiltins watches the directories of the files replacing slots.
+func watchBuiltins(w *fsnotify.Watcher) error {
+	for _, s := range builtinSlots {
+		if s.path == "" {
+			continue
+		}
+		err := w.Add(filepath.Dir(s.path))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bundleManifest is stored as shaderdev.json at the root of a bundle, with
+// every path relative to the root. A project is carried with the files it
+// refers to where they were relative to it, so it needs no rewriting.
+type bundleManifest struct {
+	Flags   []string `json:"flags"`
+	Shaders []string `json:"shaders"`
+	Project string   `json:"project,omitempty"`
+}
+
+const manifestName = "shaderdev.json"
+
+// pathFlags are the flags naming files to carry in a bundle, with the prefix
+// of their value preceding the path.
+var pathFlags = map[string]string{
+	"model":       "",
+	"background":  "env:",
+	"taa-resolve": "",
+	"layout":      "",
+	"audio":       "",
+}
+
+// bundleListPaths are the repeated flags naming files, with the separator
+// preceding the path in their values.
+var bundleListPaths = map[string]string{
+	"builtin": "=",
+}
+
+// bundleDir is where the bundle being run was extracted, removed on exit.
+var bundleDir string
+
+func removeBundle() {
+	if bundleDir != "" {
+		os.RemoveAll(bundleDir)
+	}
+}
+
+func isBundle(path string) bool {
+	return strings.HasSuffix(path, ".zip") || strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// bundleArgs extracts a bundle into bundleDir, a temporary directory, and
+// returns the command line it holds with its paths resolved there, and the
+// given flags placed after its own so they take precedence. The working
+// directory is left alone, for the paths of the given flags.
+func bundleArgs(path string, flags []string) ([]string, error) {
+	dir, err := ioutil.TempDir("", "shaderdev-bundle")
+	if err != nil {
+		return nil, err
+	}
+	bundleDir = dir
+
+	if strings.HasSuffix(path, ".zip") {
+		err = extractZip(path, dir)
+	} else {
+		err = extractTarGz(path, dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	var m bundleManifest
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v: %v", path, manifestName, err)
+	}
+
+	var args []string
+	if m.Project != "" {
+		args = append(args, "-project="+filepath.Join(dir, filepath.FromSlash(m.Project)))
+	}
+	for _, f := range m.Flags {
+		args = append(args, bundleFlag(dir, f))
+	}
+	args = append(args, flags...)
+	for _, s := range m.Shaders {
+		parts := strings.SplitN(s, ":", 2)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("%v: invalid shader %v", path, s)
+		}
+		args = append(args, parts[0]+":"+filepath.Join(dir, filepath.FromSlash(parts[1])))
+	}
+	return args, nil
+}
+
+// bundleFlag resolves the path of a -name=value flag of a manifest in dir.
+func bundleFlag(dir, f string) string {
+	parts := strings.SplitN(strings.TrimPrefix(f, "-"), "=", 2)
+	if len(parts) < 2 {
+		return f
+	}
+	name, v := parts[0], parts[1]
+	if prefix, ok := pathFlags[name]; ok && strings.HasPrefix(v, prefix) && v != prefix {
+		return "-" + name + "=" + prefix + filepath.Join(dir, filepath.FromSlash(v[len(prefix):]))
+	}
+	if sep, ok := bundleListPaths[name]; ok {
+		if i := strings.Index(v, sep); i >= 0 {
+			return "-" + name + "=" + v[:i+len(sep)] + filepath.Join(dir, filepath.FromSlash(v[i+len(sep):]))
+		}
+	}
+	return f
+}
+
+// bundleTarget returns where name may be extracted under dir, refusing
+// entries that would land outside it.
+func bundleTarget(dir, name string) (string, error) {
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	if !strings.HasPrefix(p, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("entry %v escapes the bundle", name)
+	}
+	return p, nil
+}
+
+func extractFile(p string, r io.Reader) error {
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func extractZip(path, dir string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		p, err := bundleTarget(dir, zf.Name)
+		if err != nil {
+			return err
+		}
+		r, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = extractFile(p, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTarGz(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		p, err := bundleTarget(dir, h.Name)
+		if err != nil {
+			return err
+		}
+		err = extractFile(p, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// packProject adds a project and every local file it refers to, returning
+// the project's name in the bundle. They are stored under project/ where
+// they were relative to their common directory, so the relative paths of
+// the project still hold; URLs are left to be downloaded.
+func packProject(p *project, used map[string]string) (string, error) {
+	var files []string
+	add := func(path string) {
+		if !isURL(path) {
+			files = append(files, path)
+		}
+	}
+	for _, s := range p.shaders {
+		_, path, err := parseShaderSpec(s)
+		if err == nil {
+			add(path)
+		}
+	}
+	for _, t := range p.textures {
+		if isSequence(t.path) {
+			paths, err := sequencePaths(t.path)
+			if err != nil {
+				return "", err
+			}
+			for _, path := range paths {
+				add(path)
+			}
+			continue
+		}
+		add(t.path)
+	}
+	for name, vals := range p.flags {
+		prefix, isPath := pathFlags[name]
+		sep, isList := bundleListPaths[name]
+		for _, v := range vals {
+			switch {
+			case isPath && strings.HasPrefix(v, prefix) && v != prefix:
+				add(v[len(prefix):])
+			case isList && strings.Contains(v, sep):
+				add(v[strings.Index(v, sep)+len(sep):])
+			}
+		}
+	}
+
+	projPath, err := filepath.Abs(p.path)
+	if err != nil {
+		return "", err
+	}
+	root := filepath.Dir(projPath)
+	var abs []string
+	for _, f := range files {
+		a, err := filepath.Abs(f)
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(a); err != nil {
+			return "", err
+		}
+		abs = append(abs, a)
+		for root != filepath.Dir(root) && !strings.HasPrefix(a, root+string(filepath.Separator)) {
+			root = filepath.Dir(root)
+		}
+	}
+
+	name := func(path string) string {
+		rel, _ := filepath.Rel(root, path)
+		n := "project/" + filepath.ToSlash(rel)
+		used[n] = path
+		return n
+	}
+	for _, a := range abs {
+		name(a)
+	}
+	return name(projPath), nil
+}
+
+// bundleName chooses where a file is stored in a bundle: relative paths
+// inside the working directory keep their place, others go to assets/.
+func bundleName(path string, used map[string]string) string {
+	name := filepath.ToSlash(filepath.Clean(path))
+	if filepath.IsAbs(path) || strings.HasPrefix(name, "../") {
+		name = "assets/" + filepath.Base(path)
+	}
+
+	// distinct files of the same name
+	base := name
+	for i := 2; used[name] != "" && used[name] != path; i++ {
+		ext := filepath.Ext(base)
+		name = fmt.Sprintf("%v-%v%v", strings.TrimSuffix(base, ext), i, ext)
+	}
+	used[name] = path
+	return name
+}
+
+// packMain writes the current command line and the files it refers to into
+// a bundle, along with the project, if any, and the files it refers to.
+// Flags set by the project are left to it.
+func packMain(args []string, proj *project, fromProject map[string]bool) error {
+	if len(args) < 1 || !isBundle(args[0]) || len(args) < 2 && proj == nil {
+		return fmt.Errorf("pack requires an output .zip, .tar.gz or .tgz and shader specifications, or a project")
+	}
+
+	used := make(map[string]string)
+	var m bundleManifest
+
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		if err != nil || fromProject[f.Name] {
+			return
+		}
+		if l, ok := f.Value.(*listFlag); ok {
+			// search roots are resolved below and not needed in the bundle
+			if f.Name == "I" {
+				return
+			}
+			sep, isPath := bundleListPaths[f.Name]
+			for _, v := range *l {
+				if i := strings.Index(v, sep); isPath && i >= 0 {
+					var p string
+					p, err = resolvePath(v[i+len(sep):], "")
+					if err != nil {
+						return
+					}
+					v = v[:i+len(sep)] + bundleName(p, used)
+				}
+				m.Flags = append(m.Flags, "-"+f.Name+"="+v)
+			}
+			return
+		}
+
+		v := f.Value.String()
+		if prefix, ok := pathFlags[f.Name]; ok && strings.HasPrefix(v, prefix) && v != prefix {
+			var p string
+			p, err = resolvePath(strings.TrimPrefix(v, prefix), "")
+			if err != nil {
+				return
+			}
+			v = prefix + bundleName(p, used)
+		}
+		m.Flags = append(m.Flags, "-"+f.Name+"="+v)
+	})
+	if err != nil {
+		return err
+	}
+
+	if proj != nil {
+		m.Project, err = packProject(proj, used)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the model has a default worth carrying too
+	if flag.Lookup("model").Value.String() == flag.Lookup("model").DefValue && !fromProject["model"] {
+		p, err := resolvePath(*modelPath, "")
+		if err != nil {
+			return err
+		}
+		m.Flags = append(m.Flags, "-model="+bundleName(p, used))
+	}
+
+	for _, arg := range args[1:] {
+		_, path, err := parseShaderSpec(arg)
+		if err != nil {
+			return err
+		}
+		path, err = resolvePath(path, "")
+		if err != nil {
+			return err
+		}
+		prefix := strings.SplitN(arg, ":", 2)[0]
+		m.Shaders = append(m.Shaders, prefix+":"+bundleName(path, used))
+	}
+
+	manifest, err := json.MarshalIndent(&m, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if strings.HasSuffix(args[0], ".zip") {
+		err = writeZip(out, manifest, used)
+	} else {
+		err = writeTarGz(out, manifest, used)
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %v", args[0], err)
+	}
+	return out.Close()
+}
+
+func writeZip(w io.Writer, manifest []byte, files map[string]string) error {
+	zw := zip.NewWriter(w)
+	mw, err := zw.Create(manifestName)
+	if err != nil {
+		return err
+	}
+	_, err = mw.Write(manifest)
+	if err != nil {
+		return err
+	}
+
+	for name, path := range files {
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		err = copyFile(fw, path)
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, manifest []byte, files map[string]string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err := tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0644, Size: int64(len(manifest)), Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(manifest)
+	if err != nil {
+		return err
+	}
+
+	for name, path := range files {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: fi.Size(), ModTime: fi.ModTime(), Typeflag: tar.TypeReg})
+		if err != nil {
+			return err
+		}
+		err = copyFile(tw, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-gl/gl/all-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// sensorHeight is the height of the simulated film, in meters, that
+// relates the field of view to a focal length: full frame 35mm.
+const sensorHeight = 0.024
+
+// camera holds the projection and physical lens parameters.
+// Distances are in world units, which models are scaled to as meters.
+type camera struct {
+	// vertical field of view in radians, applied to the shorter side of
+	// the viewport
+	fovy float32
+	near float32
+	far  float32
+
+	eye    mgl32.Vec3
+	target mgl32.Vec3
+
+	depth depthMode
+
+	// f-number of the aperture
+	aperture      float32
+	focusDistance float32
+}
+
+func newCamera() *camera {
+	var c camera
+	c.fovy = 2 * float32(math.Atan(0.75/20))
+	c.near = 20
+	c.far = 24
+	c.eye = mgl32.Vec3{0, 22 * float32(math.Sin(math.Pi/8)), 22 * float32(math.Cos(math.Pi/8))}
+	c.aperture = 2.8
+	c.focusDistance = 22
+	return &c
+}
+
+// focalLength returns the focal length, in meters, giving the camera's field
+// of view on the simulated sensor.
+func focalLength(c *camera) float32 {
+	return sensorHeight / 2 / float32(math.Tan(float64(c.fovy)/2))
+}
+
+func cameraProjection(c *camera, aspect float32) mgl32.Mat4 {
+	h := c.near * float32(math.Tan(float64(c.fovy)/2))
+	var m mgl32.Mat4
+	if aspect > 1 {
+		m = mgl32.Frustum(-h*aspect, h*aspect, -h, h, c.near, c.far)
+	} else {
+		m = mgl32.Frustum(-h, h, -h/aspect, h/aspect, c.near, c.far)
+	}
+
+	if c.depth == depthReversed {
+		// map near to 1 and far to 0 in a [0, 1] clip range
+		m[10] = c.near / (c.far - c.near)
+		m[14] = c.near * c.far / (c.far - c.near)
+	}
+	return m
+}
+
+func cameraView(c *camera) mgl32.Mat4 {
+	return mgl32.LookAtV(c.eye, c.target, mgl32.Vec3{0, 1, 0})
+}
+
+// parseVec3 parses a comma separated point, e.g. "0,1.5,-2".
+func parseVec3(s string) (mgl32.Vec3, error) {
+	var v mgl32.Vec3
+	_, err := fmt.Sscanf(s, "%g,%g,%g", &v[0], &v[1], &v[2])
+	if err != nil {
+		return v, fmt.Errorf("invalid point %v, expected X,Y,Z", s)
+	}
+	return v, nil
+}
+
+// fitCamera moves the camera along its view direction to frame the model,
+// which is drawn centered on the origin, and fits the clip planes and focus
+// around it. What was set with flags, on the command line or by defaults or
+// the project, is kept, and the rest fitted around it.
+func fitCamera(c *camera, m *model) {
+	r := m.radius * m.scale
+	if r <= 0 {
+		return
+	}
+	// leave some slack so the clip planes don't graze the model
+	r *= 1.01
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	if !set["target"] {
+		c.target = mgl32.Vec3{}
+	}
+	dist := c.eye.Sub(c.target).Len()
+	if !set["eye"] {
+		dir := c.eye.Sub(c.target).Normalize()
+		dist = r / float32(math.Sin(float64(c.fovy)/2))
+		c.eye = c.target.Add(dir.Mul(dist))
+	}
+	if !set["near"] {
+		c.near = float32(math.Max(float64(dist-r), float64(dist/1000)))
+	}
+	if !set["far"] {
+		c.far = dist + r
+	}
+	if !set["focus-distance"] {
+		c.focusDistance = dist
+	}
+}
+
+// parseCamera returns a copy of base moved to the view given as EYE or
+// EYE@TARGET, e.g. "10,0,0@0,1,0".
+func parseCamera(base *camera, s string) (*camera, error) {
+	c := *base
+	eye, target := s, ""
+	if i := strings.Index(s, "@"); i >= 0 {
+		eye, target = s[:i], s[i+1:]
+	}
+
+	var err error
+	c.eye, err = parseVec3(eye)
+	if err != nil {
+		return nil, err
+	}
+	if target != "" {
+		c.target, err = parseVec3(target)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.eye.ApproxEqual(c.target) {
+		return nil, fmt.Errorf("camera %v: eye and target must differ", s)
+	}
+
+	return &c, nil
+}
+
+// pipRect returns the picture-in-picture inset in the bottom right quarter
+// of the viewport.
+func pipRect(viewport [4]float32) [4]float32 {
+	w, h := float32(int32(viewport[2]/4)), float32(int32(viewport[3]/4))
+	margin := float32(int32(viewport[3] / 32))
+	return [4]float32{viewport[0] + viewport[2] - w - margin, viewport[1] + margin, w, h}
+}
+
+// setCameraUniforms feeds the camera to the current program.
+func setCameraUniforms(p *program, c *camera, projection, view mgl32.Mat4) {
+	if p.focalLengthLoc >= 0 {
+		gl.Uniform1f(p.focalLengthLoc, focalLength(c))
+	}
+
+	if p.apertureLoc >= 0 {
+		gl.Uniform1f(p.apertureLoc, c.aperture)
+	}
+
+	if p.focusDistanceLoc >= 0 {
+		gl.Uniform1f(p.focusDistanceLoc, c.focusDistance)
+	}
+
+	if p.nearFarLoc >= 0 {
+		gl.Uniform2f(p.nearFarLoc, c.near, c.far)
+	}
+
+	if p.projectionLoc >= 0 {
+		gl.UniformMatrix4fv(p.projectionLoc, 1, false, &projection[0])
+	}
+
+	if p.viewLoc >= 0 {
+		gl.UniformMatrix4fv(p.viewLoc, 1, false, &view[0])
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+var captureScale = flag.Float64("capture-scale", 0.5, "size of the frames kept by -capture-seconds relative to the window, 1 for full size")
+var captureMB = flag.Int("capture-mb", 512, "most memory in MiB the frames kept by -capture-seconds may use, the oldest being dropped past it")
+
+// captureDelay is how many frames a read back waits before it is mapped, so
+// the GPU has finished it and mapping doesn't stall.
+const captureDelay = 3
+
+type captureFrame struct {
+	width  int32
+	height int32
+	pix    []byte
+}
+
+// captureRing keeps the most recent frames read back from the window, to be
+// dumped after the fact. Frames are downscaled on the GPU and read into pixel
+// buffers, mapped captureDelay frames later, so capture doesn't wait on the
+// GPU every frame.
+type captureRing struct {
+	// oldest first, at most max frames and maxBytes of pixels
+	frames   []captureFrame
+	bytes    int
+	max      int
+	maxBytes int
+	scale    float64
+
+	small *target
+	pbos  [captureDelay]gx.Buffer
+	// the size of the read pending in each buffer, zero if none
+	sizes [captureDelay][2]int32
+	next  int
+}
+
+// newCaptureRing creates a ring keeping up to n frames of at most maxBytes
+// in all, scaled by scale.
+func newCaptureRing(n, maxBytes int, scale float64) *captureRing {
+	r := &captureRing{max: n, maxBytes: maxBytes, scale: scale}
+	for i := range r.pbos {
+		r.pbos[i] = gx.NewBuffer()
+		r.pbos[i].Label(fmt.Sprintf("capture %v", i))
+	}
+	return r
+}
+
+// readFramebuffer reads the default framebuffer into f, reusing its memory
+// when the size hasn't changed.
+func readFramebuffer(f *captureFrame, width, height int32) {
+	readPixels(f, 0, width, height)
+}
+
+// readTarget reads the color of t into f, as readFramebuffer does.
+func readTarget(f *captureFrame, t *target) {
+	readPixels(f, t.fbo, t.width, t.height)
+}
+
+func readPixels(f *captureFrame, fbo uint32, width, height int32) {
+	n := int(width * height * 4)
+	if len(f.pix) != n {
+		f.pix = make([]byte, n)
+	}
+	f.width, f.height = width, height
+
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, fbo)
+	defer gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	gl.ReadPixels(0, 0, width, height, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(f.pix))
+}
+
+// captureFramebuffer downscales the default framebuffer and starts reading
+// it back, keeping the frame read captureDelay frames ago.
+func captureFramebuffer(r *captureRing, width, height int32) {
+	w := int32(float64(width) * r.scale)
+	h := int32(float64(height) * r.scale)
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	if r.small == nil || r.small.width != w || r.small.height != h {
+		if r.small != nil {
+			deleteTarget(r.small)
+		}
+		var err error
+		r.small, err = newTarget("capture", w, h, gl.RGBA8)
+		if err != nil {
+			// capture is a convenience, rendering carries on without it
+			r.small = nil
+			return
+		}
+	}
+
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	gl.BindFramebuffer(gl.DRAW_FRAMEBUFFER, r.small.fbo)
+	gl.BlitFramebuffer(0, 0, width, height, 0, 0, w, h, gl.COLOR_BUFFER_BIT, gl.LINEAR)
+	gl.BindFramebuffer(gl.DRAW_FRAMEBUFFER, 0)
+
+	mapCapture(r, r.next)
+
+	pbo := r.pbos[r.next]
+	pbo.SetData(int(w*h*4), nil, gl.STREAM_READ)
+	pbo.Bind(gl.PIXEL_PACK_BUFFER)
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, r.small.fbo)
+	gl.ReadPixels(0, 0, w, h, gl.RGBA, gl.UNSIGNED_BYTE, gl.PtrOffset(0))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
+	r.sizes[r.next] = [2]int32{w, h}
+
+	r.next = (r.next + 1) % captureDelay
+}
+
+// mapCapture copies the read pending in the ith pixel buffer, if any, into
+// the ring.
+func mapCapture(r *captureRing, i int) {
+	w, h := r.sizes[i][0], r.sizes[i][1]
+	if w == 0 {
+		return
+	}
+	r.sizes[i] = [2]int32{}
+
+	f := addCaptureFrame(r, w, h)
+	r.pbos[i].Bind(gl.PIXEL_PACK_BUFFER)
+	defer gl.BindBuffer(gl.PIXEL_PACK_BUFFER, 0)
+	p := gl.MapBufferRange(gl.PIXEL_PACK_BUFFER, 0, len(f.pix), gl.MAP_READ_BIT)
+	if p == nil {
+		return
+	}
+	copy(f.pix, (*[1 << 30]byte)(p)[:len(f.pix):len(f.pix)])
+	gl.UnmapBuffer(gl.PIXEL_PACK_BUFFER)
+}
+
+// addCaptureFrame appends a frame to the ring, dropping the oldest frames
+// past its limits and reusing the memory of one if it is the same size.
+func addCaptureFrame(r *captureRing, width, height int32) *captureFrame {
+	n := int(width * height * 4)
+	var pix []byte
+	for len(r.frames) > 0 && (len(r.frames) >= r.max || r.bytes+n > r.maxBytes) {
+		old := r.frames[0]
+		r.frames = r.frames[1:]
+		r.bytes -= len(old.pix)
+		if len(old.pix) == n {
+			pix = old.pix
+		}
+	}
+	if pix == nil {
+		pix = make([]byte, n)
+	}
+	r.frames = append(r.frames, captureFrame{width, height, pix})
+	r.bytes += n
+	return &r.frames[len(r.frames)-1]
+}
+
+// takeCaptureRing returns the captured frames oldest first, including those
+// still being read, and empties the ring, so the frames can be written out
+// while capture carries on.
+func takeCaptureRing(r *captureRing) []captureFrame {
+	for k := 0; k < captureDelay; k++ {
+		mapCapture(r, (r.next+k)%captureDelay)
+	}
+	res := r.frames
+	r.frames = nil
+	r.bytes = 0
+	return res
+}
+
+// writeCapture writes frames as a numbered PNG sequence into dir.
+func writeCapture(frames []captureFrame, dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	for i, f := range frames {
+		err := writeFrame(f, filepath.Join(dir, fmt.Sprintf("frame%05d.png", i)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFrame writes a single frame as a PNG.
+func writeFrame(f captureFrame, path string) error {
+	img := image.NewNRGBA(image.Rect(0, 0, int(f.width), int(f.height)))
+	stride := int(f.width) * 4
+	// rows come bottom up from GL
+	for y := 0; y < int(f.height); y++ {
+		src := f.pix[(int(f.height)-1-y)*stride:]
+		copy(img.Pix[y*img.Stride:y*img.Stride+stride], src[:stride])
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(out, img)
+	out.Close()
+	if err != nil {
+		return fmt.Errorf("%v: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// frameStep is the amount of time a single transport step moves the clock.
+const frameStep = time.Second / 60
+
+// clock tracks the elapsed time fed to the time uniform, which can be
+// paused, stepped and reset independently of the wall clock.
+type clock struct {
+	elapsed time.Duration
+	delta   time.Duration
+	start   time.Duration
+	last    time.Time
+	paused  bool
+	scale   float64
+
+	// when non-zero, every tick advances by fixed rather than wall time
+	fixed time.Duration
+}
+
+func newClock(now time.Time, start time.Duration, scale float64) *clock {
+	var c clock
+	c.elapsed = start
+	c.start = start
+	c.last = now
+	c.scale = scale
+	return &c
+}
+
+// tickClock advances the clock by the wall time passed since the last tick,
+// or its fixed step if set, multiplied by the clock's scale, unless the clock
+// is paused.
+// The amount advanced is kept as the clock's delta.
+func tickClock(c *clock, now time.Time) {
+	c.delta = 0
+	if !c.paused {
+		d := now.Sub(c.last)
+		if c.fixed > 0 {
+			d = c.fixed
+		}
+		c.delta = time.Duration(float64(d) * c.scale)
+		c.elapsed += c.delta
+	}
+	c.last = now
+}
+
+func scaleClock(c *clock, factor float64) {
+	c.scale *= factor
+}
+
+func togglePause(c *clock) {
+	c.paused = !c.paused
+}
+
+// stepClock moves the clock by d, which may be negative.
+// The clock never goes before zero.
+func stepClock(c *clock, d time.Duration) {
+	c.elapsed += d
+	if c.elapsed < 0 {
+		c.elapsed = 0
+	}
+}
+
+// resetClock returns the clock to its start time.
+func resetClock(c *clock) {
+	c.elapsed = c.start
+}
+
+// parseSeconds parses a number of seconds given either as a decimal, e.g.
+// "0.5", or as a fraction, e.g. "1/60".
+func parseSeconds(s string) (time.Duration, error) {
+	num, den := s, "1"
+	if i := strings.Index(s, "/"); i >= 0 {
+		num, den = s[:i], s[i+1:]
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, err
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil {
+		return 0, err
+	}
+	if d == 0 {
+		return 0, fmt.Errorf("%v: division by zero", s)
+	}
+
+	return time.Duration(n / d * float64(time.Second)), nil
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+var compareFlag = flag.String("compare", "", "render a second version of the shaders beside the first to see what a change does: split, for two half-width views side by side, or wipe, for one view showing the second version right of a divider dragged with shift and the left button; B cycles split, wipe and off")
+var compareRef = flag.String("compare-ref", "", "git revision the second version's shader files are read from, e.g. HEAD~1; HEAD unless -compare-defines is given, which alone compares the files on disk")
+var compareDefines = flag.String("compare-defines", "", "NAME[=VALUE] macros, comma separated, defined in the second version in addition to the first's, to compare permutations")
+
+type compareMode int
+
+const (
+	compareOff compareMode = iota
+	compareSplit
+	compareWipe
+)
+
+var compareModeNames = []string{"off", "split", "wipe"}
+
+// compare is a second program drawn beside the main one, built from the
+// same stages at a git revision, with more defines, or both.
+type compare struct {
+	mode compareMode
+	prog *program
+	rev  string
+	// the lines defining the macros of -compare-defines
+	defines string
+	// where the files at rev are written, to be read as any other
+	dir string
+	// whether the program last linked, and the error logged if not
+	ok  bool
+	err string
+	// the divider of the wipe, as a fraction of the width, and whether
+	// it follows the cursor
+	wipe     float32
+	dragging bool
+	// the mode and divider of the last frame drawn, compareOff when only
+	// the first version was drawn
+	drawnMode compareMode
+	drawnWipe float32
+}
+
+// newCompare parses the -compare flags, returning nil without -compare.
+func newCompare() (*compare, error) {
+	if *compareFlag == "" {
+		if *compareRef != "" || *compareDefines != "" {
+			return nil, fmt.Errorf("-compare-ref and -compare-defines need -compare")
+		}
+		return nil, nil
+	}
+
+	c := &compare{rev: *compareRef, wipe: 0.5}
+	for i, name := range compareModeNames {
+		if name == *compareFlag && compareMode(i) != compareOff {
+			c.mode = compareMode(i)
+		}
+	}
+	if c.mode == compareOff {
+		return nil, fmt.Errorf("invalid -compare %v, expected split or wipe", *compareFlag)
+	}
+
+	if *compareDefines != "" {
+		var b strings.Builder
+		for _, def := range strings.Split(*compareDefines, ",") {
+			name, value := strings.TrimSpace(def), ""
+			if i := strings.Index(name, "="); i >= 0 {
+				name, value = strings.TrimSpace(name[:i]), strings.TrimSpace(name[i+1:])
+			}
+			if name == "" {
+				return nil, fmt.Errorf("invalid -compare-defines %v, expected NAME[=VALUE][,...]", *compareDefines)
+			}
+			// macros of the first version, e.g. from the project, are
+			// replaced rather than redefined
+			fmt.Fprintf(&b, "#undef %v\n#define %v %v\n", name, name, value)
+		}
+		c.defines = b.String()
+	} else if c.rev == "" {
+		c.rev = "HEAD"
+	}
+
+	if c.rev != "" {
+		dir, err := ioutil.TempDir("", "shaderdev-compare")
+		if err != nil {
+			return nil, err
+		}
+		c.dir = dir
+	}
+
+	c.prog = newProgram()
+	c.prog.id.Label("compare program")
+	if *spirvOut != "" {
+		c.prog.spirvOut = filepath.Join(*spirvOut, "compare")
+		err := os.MkdirAll(c.prog.spirvOut, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// closeCompare removes the files written for the revision.
+func closeCompare(c *compare) {
+	if c != nil && c.dir != "" {
+		os.RemoveAll(c.dir)
+	}
+}
+
+// compareName describes the second version, e.g. HEAD or FOO=1.
+func compareName(c *compare) string {
+	var parts []string
+	if c.rev != "" {
+		parts = append(parts, c.rev)
+	}
+	if *compareDefines != "" {
+		parts = append(parts, *compareDefines)
+	}
+	return strings.Join(parts, " ")
+}
+
+// comparing returns whether the second version is drawn.
+func comparing(c *compare) bool {
+	return c != nil && c.mode != compareOff && c.ok
+}
+
+// showFile writes the file at path as of a revision to dir, returning the
+// path written. Revisions are looked up in the repository of the file,
+// relative to its directory, so its path in the repository doesn't matter.
+func showFile(rev, path, dir string, i int) (string, error) {
+	cmd := exec.Command("git", "show", rev+":./"+filepath.Base(path))
+	cmd.Dir = filepath.Dir(path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	b, err := cmd.Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("%v at %v: %s", path, rev, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return "", err
+	}
+	// the index keeps files of the same name apart, the name keeps the
+	// extension, which WGSL is recognized by
+	out := filepath.Join(dir, fmt.Sprintf("%v-%v", i, filepath.Base(path)))
+	return out, ioutil.WriteFile(out, b, 0644)
+}
+
+// syncCompare gives the second program the stages and defines of p, reading
+// the files again at the revision, which may have moved since, e.g. after
+// a commit.
+func syncCompare(c *compare, p *program) error {
+	var stages []int
+	for stage := range p.shaderByStage {
+		stages = append(stages, int(stage))
+	}
+	sort.Ints(stages)
+
+	// every file is read before any stage changes, so a file missing at
+	// the revision leaves the program as it was
+	paths := make(map[uint32][]string)
+	n := 0
+	for _, stage := range stages {
+		for _, path := range p.shaderByStage[uint32(stage)].paths {
+			if c.rev != "" {
+				var err error
+				path, err = showFile(c.rev, path, c.dir, n)
+				if err != nil {
+					return err
+				}
+				n++
+			}
+			paths[uint32(stage)] = append(paths[uint32(stage)], path)
+		}
+	}
+
+	for stage := range c.prog.shaderByStage {
+		if _, ok := paths[stage]; !ok {
+			removeStage(c.prog, stage)
+		}
+	}
+	for stage, ps := range paths {
+		setStagePaths(c.prog, stage, ps)
+	}
+
+	c.prog.defines = p.defines + c.defines
+	for _, s := range c.prog.shaderByStage {
+		s.update = true
+	}
+	c.prog.update = true
+	return nil
+}
+
+// updateCompare links the second program if it changed.
+func updateCompare(c *compare) {
+	if c.prog.update {
+		reportCompare(c, updateProgram(c.prog))
+	}
+}
+
+// reportCompare notes whether the second version can be drawn, logging why
+// not once per error.
+func reportCompare(c *compare, err error) {
+	c.ok = err == nil
+	if err == nil {
+		c.err = ""
+		return
+	}
+	if err.Error() != c.err {
+		log.Printf("compare %v: %v", compareName(c), err)
+	}
+	c.err = err.Error()
+}
+
+// compareLayoutChanged returns whether the versions are laid out differently
+// than in the last frame it was called for, so the history of passes
+// accumulating frames no longer matches.
+func compareLayoutChanged(c *compare) bool {
+	mode := compareOff
+	if comparing(c) {
+		mode = c.mode
+	}
+	changed := mode != c.drawnMode || (mode == compareWipe && c.wipe != c.drawnWipe)
+	c.drawnMode, c.drawnWipe = mode, c.wipe
+	return changed
+}
+
+// copyUniforms sets the uniforms of the current program, to, to the values
+// the same uniforms have in from, samplers included, so both versions are
+// drawn with the same time, camera and settings.
+func copyUniforms(from, to *program) {
+	for name, v := range to.active {
+		if fv, ok := from.active[name]; !ok || fv.Type != v.Type {
+			continue
+		}
+		vals, err := uniformValues(from, name)
+		if err != nil {
+			continue
+		}
+		if m, ok := to.blockMembers[name]; ok {
+			packMember(m, vals)
+			continue
+		}
+		if !gx.IsValidUniformLoc(v.Location) {
+			continue
+		}
+		if target, _ := gx.SamplerTarget(v.Type); target != 0 {
+			units := make([]int32, len(vals))
+			for i, x := range vals {
+				units[i] = int32(x)
+			}
+			gl.Uniform1iv(v.Location, int32(len(units)), &units[0])
+			continue
+		}
+		setUniform(v, vals)
+	}
+}
+
+// compareRects returns the rectangles the first and second versions are
+// drawn in, viewports of their own when split, and scissors of the one
+// viewport either side of the divider when wiped.
+func compareRects(c *compare, width, height int32) [2][4]float32 {
+	x := float32(width / 2)
+	if c.mode == compareWipe {
+		x = float32(int32(c.wipe * float32(width)))
+	}
+	return [2][4]float32{
+		{0, 0, x, float32(height)},
+		{x, 0, float32(width) - x, float32(height)},
+	}
+}
+
+// dragWipe moves the divider of the wipe to the cursor while dragging.
+func dragWipe(c *compare, x float64, width int32) {
+	if !c.dragging || width <= 0 {
+		return
+	}
+	c.wipe = float32(x) / float32(width)
+	if c.wipe < 0 {
+		c.wipe = 0
+	} else if c.wipe > 1 {
+		c.wipe = 1
+	}
+}
+
+// drawCompareDivider draws a line between the two versions, leaving the
+// clear color as it was.
+func drawCompareDivider(c *compare, width, height int32) {
+	x := int32(compareRects(c, width, height)[1][0])
+	var clear [4]float32
+	gl.GetFloatv(gl.COLOR_CLEAR_VALUE, &clear[0])
+	defer gl.ClearColor(clear[0], clear[1], clear[2], clear[3])
+
+	gl.Enable(gl.SCISSOR_TEST)
+	defer gl.Disable(gl.SCISSOR_TEST)
+	gl.Scissor(x-1, 0, 2, height)
+	gl.ClearColor(1, 1, 1, 1)
+	gl.Clear(gl.COLOR_BUFFER_BIT)
+}
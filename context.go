@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-gl/glfw/v3.1/glfw"
+)
+
+var glVersionFlag = flag.String("gl", "", "GL context version to ask for, e.g. 4.6 or 3.3, falling back to older ones down to what the shaders need; by default the oldest they need, from 3.3")
+var glCompat = flag.Bool("gl-compat", false, "ask for a compatibility profile instead of core, for shaders using deprecated built-ins, falling back to core where there is none, e.g. on macOS")
+var glDebugContext = flag.Bool("gl-debug-context", false, "ask for a debug context, in which drivers check more and report more through debug output")
+var glesFlag = flag.String("gles", "", "run on an OpenGL ES context of this version, 3.0, 3.1 or 3.2, instead of desktop GL, as the driver or an ANGLE build installed as its GLES library provides, to check shaders for mobile and WebGL 2 with their semantics; shaders are expected to be #version 300 es or later, and shaderdev's own are translated")
+
+// contextProfile is the kind of context shaderdev runs on.
+type contextProfile int
+
+const (
+	profileCore contextProfile = iota
+	profileCompat
+	profileES
+)
+
+// gles is whether the context is OpenGL ES, which lacks what desktop GL
+// keeps for tools, e.g. polygon modes and timestamp queries.
+var gles bool
+
+// contextVersions are the desktop context versions shaderdev can run on,
+// newest first, and esVersions the ES ones.
+var contextVersions = [][2]int{{4, 6}, {4, 5}, {4, 4}, {4, 3}, {4, 2}, {4, 1}, {4, 0}, {3, 3}}
+var esVersions = [][2]int{{3, 2}, {3, 1}, {3, 0}}
+
+// parseGLVersion parses a version of -gl or -gles, one of versions.
+func parseGLVersion(flagName, s string, versions [][2]int) (int, int, error) {
+	var major, minor int
+	_, err := fmt.Sscanf(s, "%d.%d", &major, &minor)
+	if err == nil && fmt.Sprintf("%v.%v", major, minor) == s {
+		for _, v := range versions {
+			if v[0] == major && v[1] == minor {
+				return major, minor, nil
+			}
+		}
+	}
+	last := versions[len(versions)-1]
+	return 0, 0, fmt.Errorf("invalid %v %v, expected a version from %v.%v to %v.%v", flagName, s, last[0], last[1], versions[0][0], versions[0][1])
+}
+
+// esEquivalent returns the first ES version with what a desktop version is
+// required for, and tessellation if tess: tessellation came with 3.2, and
+// program interface queries, from 4.3, with 3.1. Tessellation is asked for
+// apart, as desktop versions from 4.3 have both, but ES 3.1 only the queries.
+func esEquivalent(major, minor int, tess bool) (int, int) {
+	switch {
+	case tess:
+		return 3, 2
+	case major == 4 && minor >= 3:
+		return 3, 1
+	}
+	return 3, 0
+}
+
+// createMainWindow creates the window of the -gl or -gles version if
+// given, which must be at least major.minor, what the shaders need, and
+// have tessellation if tess, or of major.minor. Versions the driver refuses fall back to the next older one
+// down to major.minor, and the compatibility profile to core.
+func createMainWindow(major, minor int, tess, visible bool) (*glfw.Window, error) {
+	flagName, versionFlag, versions := "-gl", *glVersionFlag, contextVersions
+	profiles := []contextProfile{profileCore}
+	if *glCompat {
+		profiles = []contextProfile{profileCompat, profileCore}
+	}
+	if *glesFlag != "" {
+		if *glVersionFlag != "" || *glCompat {
+			return nil, fmt.Errorf("-gles can't be combined with -gl or -gl-compat")
+		}
+		major, minor = esEquivalent(major, minor, tess)
+		flagName, versionFlag, versions = "-gles", *glesFlag, esVersions
+		profiles = []contextProfile{profileES}
+	}
+
+	want := [2]int{major, minor}
+	if versionFlag != "" {
+		wantMajor, wantMinor, err := parseGLVersion(flagName, versionFlag, versions)
+		if err != nil {
+			return nil, err
+		}
+		if wantMajor < major || wantMajor == major && wantMinor < minor {
+			return nil, fmt.Errorf("%v %v is older than the %v.%v the shaders need", flagName, versionFlag, major, minor)
+		}
+		want = [2]int{wantMajor, wantMinor}
+	}
+
+	var err error
+	for _, profile := range profiles {
+		for _, v := range versions {
+			if v[0] > want[0] || v[0] == want[0] && v[1] > want[1] {
+				continue
+			}
+			if v[0] < major || v[0] == major && v[1] < minor {
+				break
+			}
+			var window *glfw.Window
+			window, err = createContextWindow(v[0], v[1], profile, *glDebugContext, visible)
+			if err == nil {
+				if v != want || profile != profiles[0] {
+					log.Printf("no %v context, fell back to %v", contextName(want[0], want[1], profiles[0]), contextName(v[0], v[1], profile))
+				}
+				return window, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+// contextName describes a context version and profile, e.g. 4.1 core.
+func contextName(major, minor int, profile contextProfile) string {
+	switch profile {
+	case profileCompat:
+		return fmt.Sprintf("%v.%v compatibility", major, minor)
+	case profileES:
+		return fmt.Sprintf("ES %v.%v", major, minor)
+	}
+	return fmt.Sprintf("%v.%v core", major, minor)
+}
+
+// esHeader replaces the #version line of shaderdev's own shaders on ES
+// contexts. ES has no default precision for floats in fragment shaders, nor
+// for these samplers in any.
+const esHeader = `#version 300 es
+precision highp float;
+precision highp int;
+precision highp sampler3D;
+precision highp sampler2DArray;
+precision highp sampler2DShadow;
+`
+
+// esSource translates one of shaderdev's own shaders, written for 330 core,
+// to GLSL ES 3.00, which is close enough to need only the header.
+func esSource(src string) string {
+	const version = "#version 330 core\n"
+	if !strings.HasPrefix(src, version) {
+		return src
+	}
+	return esHeader + src[len(version):]
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/toml"
+	"github.com/go-gl/glfw/v3.1/glfw"
+)
+
+// defaults are personal settings shared by every project, read from
+// defaultsPath:
+//
+//	[flags]     # defaults for command line flags not given explicitly
+//	fov = 30
+//	camera = ["10,0,0", "0,10,0"]
+//
+//	[uniforms]  # values for active uniforms after every link
+//	tint = [1, 0.5, 0]
+//
+//	[keys]      # actions bound to other keys, see keyActions
+//	pause = "P"
+//
+//	[midi]      # controls of -midi driving uniforms, see midiMapping
+//	cc74 = "cutoff 0..5"
+//
+// Uniforms, keys and MIDI mappings are reloaded when the file changes,
+// flags on restart.
+type defaults struct {
+	// the file they were read from, for errors
+	path     string
+	flags    map[string][]string
+	uniforms map[string][]float64
+	keys     map[glfw.Key]glfw.Key
+	// by control as given
+	midi map[string]midiMapping
+}
+
+// keyActions names the actions of the built-in keys, for rebinding.
+var keyActions = map[string]glfw.Key{
+	"pause":          glfw.KeySpace,
+	"step-forward":   glfw.KeyRight,
+	"step-back":      glfw.KeyLeft,
+	"reset":          glfw.KeyR,
+	"faster":         glfw.KeyEqual,
+	"slower":         glfw.KeyMinus,
+	"aspect":         glfw.KeyA,
+	"safe-area":      glfw.KeyS,
+	"cull":           glfw.KeyC,
+	"front-face":     glfw.KeyF,
+	"focus-nearer":   glfw.KeyLeftBracket,
+	"focus-farther":  glfw.KeyRightBracket,
+	"aperture-open":  glfw.KeyComma,
+	"aperture-close": glfw.KeyPeriod,
+	"capture":        glfw.KeyD,
+	"wireframe":      glfw.KeyW,
+	"camera":         glfw.KeyV,
+	"pip":            glfw.KeyP,
+	"solo-part":      glfw.KeyG,
+	"annotate":       glfw.KeyN,
+	"panel":          glfw.KeyTab,
+	"stats":          glfw.KeyI,
+}
+
+var namedKeys = map[string]glfw.Key{
+	"space":     glfw.KeySpace,
+	"enter":     glfw.KeyEnter,
+	"tab":       glfw.KeyTab,
+	"backspace": glfw.KeyBackspace,
+	"insert":    glfw.KeyInsert,
+	"delete":    glfw.KeyDelete,
+	"left":      glfw.KeyLeft,
+	"right":     glfw.KeyRight,
+	"up":        glfw.KeyUp,
+	"down":      glfw.KeyDown,
+	"pageup":    glfw.KeyPageUp,
+	"pagedown":  glfw.KeyPageDown,
+	"home":      glfw.KeyHome,
+	"end":       glfw.KeyEnd,
+}
+
+// keyByName parses key names: a printable character, e.g. "P" or "[", F1 to
+// F12, or one of namedKeys.
+func keyByName(name string) (glfw.Key, bool) {
+	lower := strings.ToLower(name)
+	if k, ok := namedKeys[lower]; ok {
+		return k, true
+	}
+
+	var n int
+	if _, err := fmt.Sscanf(lower, "f%d", &n); err == nil && n >= 1 && n <= 12 && lower == fmt.Sprintf("f%d", n) {
+		return glfw.KeyF1 + glfw.Key(n-1), true
+	}
+
+	// printable keys are their upper case ASCII
+	if len(name) == 1 && name[0] > ' ' && name[0] < 127 {
+		return glfw.Key(strings.ToUpper(name)[0]), true
+	}
+
+	return glfw.KeyUnknown, false
+}
+
+// defaultsPath returns the location of the user's defaults file, usually
+// ~/.config/shaderdev/defaults.toml.
+func defaultsPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "shaderdev", "defaults.toml")
+}
+
+func newDefaults(path string) *defaults {
+	return &defaults{
+		path:     path,
+		flags:    make(map[string][]string),
+		uniforms: make(map[string][]float64),
+		keys:     make(map[glfw.Key]glfw.Key),
+		midi:     make(map[string]midiMapping),
+	}
+}
+
+// loadDefaults reads a defaults file. A missing file gives empty defaults.
+func loadDefaults(path string) (*defaults, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return newDefaults(path), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	doc, err := toml.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return decodeDefaults(doc, path)
+}
+
+// decodeDefaults reads the flags, uniforms, keys and midi tables of a
+// decoded file.
+func decodeDefaults(doc map[string]interface{}, path string) (*defaults, error) {
+	d := newDefaults(path)
+	flags, _ := doc["flags"].(map[string]interface{})
+	for name, v := range flags {
+		if a, ok := v.([]interface{}); ok {
+			for _, e := range a {
+				d.flags[name] = append(d.flags[name], fmt.Sprint(e))
+			}
+		} else {
+			d.flags[name] = []string{fmt.Sprint(v)}
+		}
+	}
+
+	uniforms, _ := doc["uniforms"].(map[string]interface{})
+	for name, v := range uniforms {
+		vals, err := numbers(v)
+		if err != nil {
+			return nil, fmt.Errorf("%v: uniform %v: %v", path, name, err)
+		}
+		d.uniforms[name] = vals
+	}
+
+	keys, _ := doc["keys"].(map[string]interface{})
+	for action, v := range keys {
+		builtin, ok := keyActions[action]
+		if !ok {
+			return nil, fmt.Errorf("%v: unknown key action %v", path, action)
+		}
+		name, _ := v.(string)
+		k, ok := keyByName(name)
+		if !ok {
+			return nil, fmt.Errorf("%v: %v: unknown key %v", path, action, v)
+		}
+		d.keys[k] = builtin
+	}
+
+	mappings, _ := doc["midi"].(map[string]interface{})
+	for control, v := range mappings {
+		m, err := parseMIDIMapping(control, v)
+		if err != nil {
+			return nil, fmt.Errorf("%v: midi %v", path, err)
+		}
+		d.midi[control] = m
+	}
+
+	return d, nil
+}
+
+// numbers flattens a number, boolean or nested array of those.
+func numbers(v interface{}) ([]float64, error) {
+	switch v := v.(type) {
+	case int64:
+		return []float64{float64(v)}, nil
+	case float64:
+		return []float64{v}, nil
+	case bool:
+		if v {
+			return []float64{1}, nil
+		}
+		return []float64{0}, nil
+	case []interface{}:
+		var res []float64
+		for _, e := range v {
+			n, err := numbers(e)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, n...)
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("expected numbers, have %v", v)
+	}
+}
+
+// applyFlagDefaults sets every flag from the defaults that wasn't given on
+// the command line.
+func applyFlagDefaults(d *defaults) error {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	names := make([]string, 0, len(d.flags))
+	for name := range d.flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if given[name] {
+			continue
+		}
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("%v: unknown flag %v", d.path, name)
+		}
+		for _, v := range d.flags[name] {
+			err := flag.Set(name, v)
+			if err != nil {
+				return fmt.Errorf("%v: flag %v: %v", d.path, name, err)
+			}
+		}
+	}
+
+	return nil
+}
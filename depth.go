@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/glsl"
+	"github.com/go-gl/gl/all-core/gl"
+	"github.com/go-gl/glfw/v3.1/glfw"
+)
+
+// depthMode is the convention the main pass stores depth with.
+// Shaders see it as one of the DEPTH_STANDARD, DEPTH_REVERSED or DEPTH_LOG
+// defines.
+type depthMode int
+
+const (
+	// depth increases from 0 at near to 1 at far, through the usual [-1, 1]
+	// clip range
+	depthStandard depthMode = iota
+	// depth decreases from 1 at near to 0 at far, through a [0, 1] clip
+	// range, into a float depth buffer
+	depthReversed
+	// the projection is standard, but fragment shaders write
+	// log2(1 + w) / log2(1 + far) to gl_FragDepth
+	depthLog
+)
+
+var depthModes = []struct {
+	name   string
+	define string
+}{
+	{"standard", "DEPTH_STANDARD"},
+	{"reversed", "DEPTH_REVERSED"},
+	{"log", "DEPTH_LOG"},
+}
+
+func parseDepthMode(s string) (depthMode, error) {
+	for i, m := range depthModes {
+		if m.name == s {
+			return depthMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown depth mode %v, expected standard, reversed or log", s)
+}
+
+// depthDefines returns the preprocessor lines announcing the mode to shaders.
+func depthDefines(mode depthMode) string {
+	return "#define " + depthModes[mode].define + "\n"
+}
+
+// setupDepth sets the clip range, depth test and clear value for the mode.
+func setupDepth(mode depthMode) error {
+	if mode != depthReversed {
+		return nil
+	}
+
+	if !glfw.ExtensionSupported("GL_ARB_clip_control") {
+		return fmt.Errorf("reversed depth requires GL_ARB_clip_control")
+	}
+	gl.ClipControl(gl.LOWER_LEFT, gl.ZERO_TO_ONE)
+	gl.DepthFunc(gl.GREATER)
+	gl.ClearDepth(0)
+	return nil
+}
+
+// depthFuncs decodes depth buffer values of the main pass in built-in post
+// passes, following whichever DEPTH_ define precedes it.
+const depthFuncs = `
+uniform vec2 nearFar;
+
+// linearDepth returns the view space distance of a depth buffer value.
+float linearDepth(float d) {
+	float n = nearFar.x, f = nearFar.y;
+#if defined(DEPTH_REVERSED)
+	return n*f / (d*(f - n) + n);
+#elif defined(DEPTH_LOG)
+	return exp2(d * log2(1 + f)) - 1;
+#else
+	return 2*n*f / (f + n - (d*2 - 1)*(f - n));
+#endif
+}
+
+// clipDepth returns the clip space z, with w of 1, of a depth buffer value,
+// for unprojecting through the inverse projection.
+float clipDepth(float d) {
+#if defined(DEPTH_REVERSED)
+	return d;
+#elif defined(DEPTH_LOG)
+	float n = nearFar.x, f = nearFar.y;
+	return (f + n)/(f - n) - 2*f*n/((f - n)*linearDepth(d));
+#else
+	return d*2 - 1;
+#endif
+}
+
+// isFar reports whether a depth buffer value is the cleared value, with
+// nothing drawn.
+bool isFar(float d) {
+#if defined(DEPTH_REVERSED)
+	return d <= 0;
+#else
+	return d >= 1;
+#endif
+}
+`
+
+// insertAfterVersion inserts text after the #version line of src, if any,
+// restoring the line numbering of the rest of the source.
+func insertAfterVersion(src []byte, text string) []byte {
+	s := string(src)
+	end, line, ok := glsl.VersionEnd(src)
+	if !ok {
+		return []byte(text + "#line 1\n" + s)
+	}
+
+	if end == len(s) && !strings.HasSuffix(s, "\n") {
+		return []byte(s + "\n" + text)
+	}
+	return []byte(s[:end] + text + fmt.Sprintf("#line %v\n", line) + s[end:])
+}
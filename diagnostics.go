@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alotabits/shaderdev/internal/glsl"
+	"github.com/alotabits/shaderdev/internal/gx"
+)
+
+var (
+	diagnosticsFormat = flag.String("diagnostics", "", "report every build of the program, with the file, line, column, severity, stage and message of each compile and link error, for editors to mark errors as they happen: json, a line each")
+	diagnosticsAddr   = flag.String("diagnostics-addr", "", "send -diagnostics to the editors connected to this address, e.g. :7072 or unix:/tmp/shaderdev.sock, rather than standard output")
+)
+
+type diagnostic struct {
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	// the stage the compiler reported it for, or "link"
+	Stage string `json:"stage,omitempty"`
+}
+
+// diagnosticsEvent is a line of JSON reporting a build. Every build is
+// reported, so editors clear what they show when one succeeds.
+type diagnosticsEvent struct {
+	Time        time.Time    `json:"time"`
+	OK          bool         `json:"ok"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+// diagnosticsSink writes events to standard output, or to the editors
+// connected to its listener, which are sent the last event as they
+// connect.
+type diagnosticsSink struct {
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+	last  []byte
+}
+
+func openDiagnostics(format, addr string) (*diagnosticsSink, error) {
+	if format != "json" {
+		return nil, fmt.Errorf("-diagnostics: unknown format %q, expected json", format)
+	}
+	d := &diagnosticsSink{}
+	if addr == "" {
+		return d, nil
+	}
+
+	network := "tcp"
+	if strings.HasPrefix(addr, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+		os.Remove(addr)
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("diagnostics on", ln.Addr())
+	d.conns = make(map[net.Conn]bool)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				log.Println("diagnostics:", err)
+				return
+			}
+			d.mu.Lock()
+			d.conns[conn] = true
+			if d.last != nil {
+				writeDiagnostics(d, conn, d.last)
+			}
+			d.mu.Unlock()
+		}
+	}()
+	return d, nil
+}
+
+// writeDiagnostics writes b to an editor, dropping it if it fails or
+// doesn't keep up. d.mu must be held.
+func writeDiagnostics(d *diagnosticsSink, conn net.Conn, b []byte) {
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_, err := conn.Write(b)
+	if err != nil {
+		log.Printf("diagnostics: %v: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		delete(d.conns, conn)
+	}
+}
+
+// reportBuild sends the diagnostics of a build of the program that
+// returned err.
+func reportBuild(d *diagnosticsSink, err error) {
+	ev := diagnosticsEvent{time.Now(), err == nil, programDiagnostics(err)}
+	b, err := json.Marshal(&ev)
+	if err != nil {
+		log.Println("diagnostics:", err)
+		return
+	}
+	b = append(b, '\n')
+
+	if d.conns == nil {
+		os.Stdout.Write(b)
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.last = b
+	for conn := range d.conns {
+		writeDiagnostics(d, conn, b)
+	}
+}
+
+// programDiagnostics splits the error of a build into diagnostics, placing
+// those of a compiler's log in the files of the stage's source.
+func programDiagnostics(err error) []diagnostic {
+	ds := []diagnostic{}
+	switch err := err.(type) {
+	case nil:
+	case *compileError:
+		for _, l := range glsl.ParseLog(err.Error()) {
+			d := diagnostic{Line: l.Line, Column: l.Column, Severity: l.Severity, Message: l.Message, Stage: gx.StageStr(err.stage)}
+			if l.Line > 0 {
+				d.File, d.Line = sourceLine(err.shader, l.Line)
+			} else if len(err.shader.paths) == 1 {
+				d.File = err.shader.paths[0]
+			}
+			ds = append(ds, d)
+		}
+	case *linkError:
+		for _, l := range glsl.ParseLog(err.Error()) {
+			ds = append(ds, diagnostic{Severity: l.Severity, Message: l.Message, Stage: "link"})
+		}
+	case *os.PathError:
+		ds = append(ds, diagnostic{File: err.Path, Severity: "error", Message: err.Err.Error()})
+	default:
+		ds = append(ds, diagnostic{Severity: "error", Message: err.Error()})
+	}
+	return ds
+}
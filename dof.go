@@ -0,0 +1,135 @@
+package main
+
+import (
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// dofFrag is a reference thin lens depth of field, gathering a disc sized by
+// each pixel's circle of confusion. linearDepth comes from depthFuncs.
+const dofFrag = `#version 330 core
+uniform sampler2D image;
+uniform sampler2D depth;
+uniform float focalLength;
+uniform float aperture;
+uniform float focusDistance;
+uniform float pixelsPerMeter;
+
+in vec2 uv;
+out vec4 color;
+
+const float maxRadius = 24;
+const int samples = 48;
+
+// coc returns the circle of confusion diameter in pixels for a distance.
+float coc(float dist) {
+	float f = focalLength;
+	float a = f / aperture;
+	float s = focusDistance;
+	return abs(a * f * (dist - s) / (dist * (s - f))) * pixelsPerMeter;
+}
+
+void main() {
+	vec2 texel = 1.0 / vec2(textureSize(image, 0));
+	float radius = min(coc(linearDepth(texture(depth, uv).r)) / 2, maxRadius);
+
+	// vogel disc
+	vec4 sum = vec4(0);
+	for (int i = 0; i < samples; i++) {
+		float r = sqrt((float(i) + 0.5) / float(samples)) * radius;
+		float theta = float(i) * 2.39996323;
+		sum += texture(image, uv + vec2(cos(theta), sin(theta)) * r * texel);
+	}
+	color = sum / float(samples);
+}
+`
+
+// dof is a post pass blurring the main pass by the camera's lens parameters.
+type dof struct {
+	prog gx.Program
+
+	imageLoc          int32
+	depthLoc          int32
+	nearFarLoc        int32
+	focalLengthLoc    int32
+	apertureLoc       int32
+	focusDistanceLoc  int32
+	pixelsPerMeterLoc int32
+
+	out *target
+}
+
+func newDOF(mode depthMode) (*dof, error) {
+	var d dof
+	err := buildBuiltin(&builtinSlot{
+		name: "dof",
+		src:  dofFrag,
+		prepare: func(src []byte) []byte {
+			return insertAfterVersion(src, depthDefines(mode)+depthFuncs)
+		},
+		prog: &d.prog,
+		locate: func() {
+			d.imageLoc = gl.GetUniformLocation(uint32(d.prog), gl.Str("image\x00"))
+			d.depthLoc = gl.GetUniformLocation(uint32(d.prog), gl.Str("depth\x00"))
+			d.nearFarLoc = gl.GetUniformLocation(uint32(d.prog), gl.Str("nearFar\x00"))
+			d.focalLengthLoc = gl.GetUniformLocation(uint32(d.prog), gl.Str("focalLength\x00"))
+			d.apertureLoc = gl.GetUniformLocation(uint32(d.prog), gl.Str("aperture\x00"))
+			d.focusDistanceLoc = gl.GetUniformLocation(uint32(d.prog), gl.Str("focusDistance\x00"))
+			d.pixelsPerMeterLoc = gl.GetUniformLocation(uint32(d.prog), gl.Str("pixelsPerMeter\x00"))
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// drawDOF blurs color using the depth of the main pass and returns the
+// target holding the result.
+func drawDOF(d *dof, color *target, depth gx.Texture, cam *camera) (*target, error) {
+	if d.out == nil || d.out.width != color.width || d.out.height != color.height {
+		if d.out != nil {
+			deleteTarget(d.out)
+		}
+		t, err := newTarget("dof", color.width, color.height, gl.RGBA8)
+		if err != nil {
+			return nil, err
+		}
+		d.out = t
+	}
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, d.out.fbo)
+	defer gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	gl.Viewport(0, 0, d.out.width, d.out.height)
+
+	d.prog.Bind()
+	defer gl.UseProgram(0)
+
+	gx.ActiveTexture(0)
+	color.color.Bind(gl.TEXTURE_2D)
+	gl.Uniform1i(d.imageLoc, 0)
+	gx.ActiveTexture(1)
+	depth.Bind(gl.TEXTURE_2D)
+	gl.Uniform1i(d.depthLoc, 1)
+	defer func() {
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+		gx.ActiveTexture(0)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+	}()
+
+	// the sensor height maps to the shorter side of the image
+	short := color.height
+	if color.width < short {
+		short = color.width
+	}
+
+	gl.Uniform2f(d.nearFarLoc, cam.near, cam.far)
+	gl.Uniform1f(d.focalLengthLoc, focalLength(cam))
+	gl.Uniform1f(d.apertureLoc, cam.aperture)
+	gl.Uniform1f(d.focusDistanceLoc, cam.focusDistance)
+	gl.Uniform1f(d.pixelsPerMeterLoc, float32(short)/sensorHeight)
+
+	drawFullscreen()
+
+	return d.out, nil
+}
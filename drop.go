@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+const (
+	dropUnknown = iota
+	dropModel
+	dropTexture
+	dropVideo
+	dropShader
+)
+
+// extToStage infers the stage of a dropped shader from its extension.
+var extToStage = map[string]uint32{
+	".vert": gl.VERTEX_SHADER,
+	".vs":   gl.VERTEX_SHADER,
+	".geom": gl.GEOMETRY_SHADER,
+	".gs":   gl.GEOMETRY_SHADER,
+	".tesc": gl.TESS_CONTROL_SHADER,
+	".tcs":  gl.TESS_CONTROL_SHADER,
+	".tese": gl.TESS_EVALUATION_SHADER,
+	".tes":  gl.TESS_EVALUATION_SHADER,
+	".frag": gl.FRAGMENT_SHADER,
+	".fs":   gl.FRAGMENT_SHADER,
+}
+
+var imageExts = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+	".hdr":  true,
+}
+
+var videoExts = map[string]bool{
+	".mp4":  true,
+	".mov":  true,
+	".mkv":  true,
+	".webm": true,
+	".avi":  true,
+}
+
+// dropKind decides what a file dropped on the window should be used as, a
+// directory being an image sequence.
+func dropKind(path string) int {
+	ext := strings.ToLower(filepath.Ext(path))
+	fi, err := os.Stat(path)
+	switch {
+	case err == nil && fi.IsDir():
+		return dropTexture
+	case ext == ".obj", ext == ".gltf", ext == ".glb":
+		return dropModel
+	case imageExts[ext]:
+		return dropTexture
+	case videoExts[ext]:
+		return dropVideo
+	case extToStage[ext] != 0:
+		return dropShader
+	default:
+		return dropUnknown
+	}
+}
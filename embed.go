@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// Embedding lets a host application, such as an editor or engine tool,
+// drive shaderdev from its own window: the host asks for frames over a
+// connection and shaderdev renders each with a hidden window, sending back
+// its pixels for the host to upload into a framebuffer of its own. The GL
+// bindings have no EXT_memory_object, so textures can't be shared across
+// processes, and the pixels travel over the connection instead.
+
+// embedRequest is a line of JSON sent by the host, asking for a frame of
+// Width by Height pixels, both required. Anything else left out keeps its
+// value from the last frame.
+type embedRequest struct {
+	Width    int32                `json:"width"`
+	Height   int32                `json:"height"`
+	Uniforms map[string][]float64 `json:"uniforms,omitempty"`
+	Camera   *shareCamera         `json:"camera,omitempty"`
+	Elapsed  *time.Duration       `json:"elapsed,omitempty"`
+	Frame    *int32               `json:"frame,omitempty"`
+}
+
+// embedFrame is a line of JSON answering a request, followed by Size bytes
+// of RGBA pixels, rows bottom up as GL reads and uploads them. A frame that
+// failed, e.g. because the program doesn't link, has Error set and no
+// pixels.
+type embedFrame struct {
+	Width  int32  `json:"width"`
+	Height int32  `json:"height"`
+	Frame  int32  `json:"frame"`
+	Size   int    `json:"size"`
+	Error  string `json:"error,omitempty"`
+}
+
+// embedClient is the connection to the host. A tick is sent for every
+// request, after the request, so the main loop renders a frame for each.
+// Both close when the host does.
+type embedClient struct {
+	conn     net.Conn
+	w        *bufio.Writer
+	requests chan embedRequest
+	ticks    chan time.Time
+}
+
+// dialEmbed connects to the host at addr, a TCP address or unix:path for a
+// unix socket.
+func dialEmbed(addr string) (*embedClient, error) {
+	network := "tcp"
+	if strings.HasPrefix(addr, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+	}
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("embedded in host at", addr)
+
+	e := &embedClient{conn: conn, w: bufio.NewWriter(conn), requests: make(chan embedRequest, 1), ticks: make(chan time.Time)}
+	go func() {
+		defer close(e.ticks)
+		defer close(e.requests)
+		dec := json.NewDecoder(conn)
+		for {
+			var r embedRequest
+			err := dec.Decode(&r)
+			if err == io.EOF {
+				log.Println("embed: host closed the connection")
+				return
+			}
+			if err != nil {
+				log.Println("embed:", err)
+				return
+			}
+			if r.Width <= 0 || r.Height <= 0 {
+				log.Printf("embed: invalid frame size %vx%v", r.Width, r.Height)
+				continue
+			}
+			e.requests <- r
+			e.ticks <- time.Now()
+		}
+	}()
+	return e, nil
+}
+
+// sendEmbedFrame answers a request with f, or with err if the frame failed.
+func sendEmbedFrame(e *embedClient, f *captureFrame, frame int32, err error) error {
+	h := embedFrame{Frame: frame}
+	if err != nil {
+		h.Error = err.Error()
+	} else {
+		h.Width, h.Height, h.Size = f.width, f.height, len(f.pix)
+	}
+	b, err := json.Marshal(&h)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(b, '\n'))
+	if err == nil && h.Size > 0 {
+		_, err = e.w.Write(f.pix)
+	}
+	if err == nil {
+		err = e.w.Flush()
+	}
+	return err
+}
+
+func closeEmbed(e *embedClient) {
+	e.conn.Close()
+}
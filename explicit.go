@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/glsl"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// attribLocations are the locations given to the attributes the model
+// supplies. Other vertex inputs follow, in order of name.
+var attribLocations = map[string]int{
+	"position": 0,
+	"color":    1,
+	"normal":   2,
+	"texcoord": 3,
+	"tangent":  4,
+	"joints":   5,
+	"weights":  6,
+}
+
+// glslVersion returns the number of a #version directive's arguments, e.g.
+// 330 for "330 core", or 110, the version of sources without one. ES
+// versions return the desktop version first with their layouts, vertex
+// input locations for 300 es and bindings for 310 es.
+func glslVersion(f *glsl.File) int {
+	v := glsl.Version(f)
+	if v == "" {
+		return 110
+	}
+	fields := strings.Fields(v)
+	n, _ := strconv.Atoi(fields[0])
+	if len(fields) > 1 && fields[1] == "es" {
+		if n >= 310 {
+			return 420
+		}
+		return 330
+	}
+	return n
+}
+
+func isSamplerType(t string) bool {
+	t = strings.TrimLeft(t, "iu")
+	return strings.HasPrefix(t, "sampler")
+}
+
+// samplerBindings assigns texture units to the sampler uniforms declared by
+// the sources of a program, in order of name like assignSamplers, keeping
+// those that already have a binding. Sampler arrays take consecutive units.
+func samplerBindings(p *program) map[string]uint32 {
+	sizes := make(map[string]uint32)
+	bindings := make(map[string]uint32)
+	for _, s := range p.shaderByStage {
+		f, err := glsl.Parse(s.source)
+		if err != nil {
+			continue
+		}
+		for _, d := range glsl.Uniforms(f) {
+			if !isSamplerType(d.Type) {
+				continue
+			}
+			for _, v := range d.Vars {
+				size := uint32(1)
+				if v.ArraySize != nil {
+					if n, err := strconv.ParseUint(*v.ArraySize, 10, 32); err == nil {
+						size = uint32(n)
+					}
+				}
+				sizes[v.Name] = size
+				for _, q := range d.Layout {
+					if n, err := strconv.ParseUint(q.Value, 10, 32); q.Name == "binding" && err == nil {
+						bindings[v.Name] = uint32(n)
+					}
+				}
+			}
+		}
+	}
+
+	// units taken by samplers bound in the source
+	taken := make(map[uint32]bool)
+	for name, b := range bindings {
+		for i := uint32(0); i < sizes[name]; i++ {
+			taken[b+i] = true
+		}
+	}
+
+	var names []string
+	for name := range sizes {
+		if _, ok := bindings[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	unit := uint32(0)
+	for _, name := range names {
+	search:
+		for {
+			for i := uint32(0); i < sizes[name]; i++ {
+				if taken[unit+i] {
+					unit += i + 1
+					continue search
+				}
+			}
+			break
+		}
+		bindings[name] = unit
+		unit += sizes[name]
+	}
+	return bindings
+}
+
+// locationCount returns the number of locations a vertex input of a type
+// takes: one per column of a matrix, and per element of an array.
+func locationCount(typ string, arraySize *string) int {
+	n := 1
+	if cols := strings.TrimPrefix(strings.TrimPrefix(typ, "d"), "mat"); cols != typ && cols != "" {
+		// matN and matNxM have N columns
+		n, _ = strconv.Atoi(cols[:1])
+	}
+	if arraySize != nil {
+		if size, err := strconv.Atoi(*arraySize); err == nil {
+			n *= size
+		}
+	}
+	return n
+}
+
+// explicitLayout injects location qualifiers into the vertex inputs of a
+// vertex stage source and binding qualifiers into the sampler uniforms of
+// any stage, where the source's GLSL version allows them, and otherwise
+// returns a note of what it left out.
+func explicitLayout(src []byte, stage uint32, bindings map[string]uint32) ([]byte, string, error) {
+	f, err := glsl.Parse(src)
+	if err != nil {
+		return nil, "", err
+	}
+	version := glslVersion(f)
+
+	layouts := make(map[string]glsl.LayoutQualifier)
+	var missed []string
+	if stage == gl.VERTEX_SHADER {
+		var others []string
+		counts := make(map[string]int)
+		next := len(attribLocations)
+		for _, d := range f.Decls {
+			d, ok := d.(*glsl.VarDecl)
+			if !ok || !hasQualifier(d.Qualifiers, "in") && !hasQualifier(d.Qualifiers, "attribute") {
+				continue
+			}
+			for _, v := range d.Vars {
+				if _, ok := attribLocations[v.Name]; !ok {
+					others = append(others, v.Name)
+				}
+				counts[v.Name] = locationCount(d.Type, v.ArraySize)
+				// inputs already located keep their location, and don't
+				// move the others
+				for _, q := range d.Layout {
+					n, err := strconv.Atoi(q.Value)
+					if q.Name == "location" && err == nil && n+counts[v.Name] > next {
+						next = n + counts[v.Name]
+					}
+				}
+			}
+		}
+		if len(counts) > 0 && version < 330 {
+			missed = append(missed, "vertex input locations need 330")
+			others = nil
+		}
+		sort.Strings(others)
+		for name, loc := range attribLocations {
+			if version < 330 {
+				break
+			}
+			layouts[name] = glsl.LayoutQualifier{Name: "location", Value: strconv.Itoa(loc)}
+		}
+		for _, name := range others {
+			layouts[name] = glsl.LayoutQualifier{Name: "location", Value: strconv.Itoa(next)}
+			next += counts[name]
+		}
+	}
+
+	if version >= 420 {
+		for name, b := range bindings {
+			layouts[name] = glsl.LayoutQualifier{Name: "binding", Value: fmt.Sprint(b)}
+		}
+	} else {
+		for _, d := range glsl.Uniforms(f) {
+			if isSamplerType(d.Type) {
+				missed = append(missed, "sampler bindings need 420")
+				break
+			}
+		}
+	}
+
+	var note string
+	if len(missed) > 0 {
+		note = fmt.Sprintf("GLSL %v allows no explicit layouts where needed: %v", version, strings.Join(missed, " and "))
+	}
+	return glsl.SetLayout(src, f, layouts), note, nil
+}
+
+func hasQualifier(qs []string, q string) bool {
+	for _, x := range qs {
+		if x == q {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-gl/gl/all-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const checkpointName = "checkpoint.json"
+
+// checkpoint is the state needed to carry on an interrupted export at the
+// frame after the last one written, so the frames are those of an export
+// never interrupted.
+type checkpoint struct {
+	Frame   int32
+	Elapsed time.Duration
+	Seed    uint32
+	Angle   float32
+	// the hash of the flags and shaders the export was started with, which
+	// it must resume with
+	Settings string
+	// the TAA history as of Frame, with -taa
+	TAA *taaCheckpoint `json:",omitempty"`
+}
+
+// taaCheckpoint is the state of a TAA resolve, its latest history saved as
+// half floats to File next to the checkpoint, one per frame.
+type taaCheckpoint struct {
+	File               string
+	Width, Height      int32
+	PrevViewProjection mgl32.Mat4
+	PrevModel          mgl32.Mat4
+	Valid              bool
+}
+
+// exportSettings hashes the values of every flag and the sources of the
+// program's stages, to tell whether an export resumes as it started. -frames
+// is left out, so an export can be resumed to be made longer.
+func exportSettings(p *program) (string, error) {
+	h := sha256.New()
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name != "frames" {
+			fmt.Fprintf(h, "-%v=%q\n", f.Name, f.Value)
+		}
+	})
+
+	var stages []int
+	for stage := range p.shaderByStage {
+		stages = append(stages, int(stage))
+	}
+	sort.Ints(stages)
+	for _, stage := range stages {
+		for _, path := range p.shaderByStage[uint32(stage)].paths {
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "%v %v %v\n", stage, path, len(b))
+			h.Write(b)
+		}
+	}
+	fmt.Fprintf(h, "%q\n", p.defines)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// taaHistoryName is the file the TAA history of a frame is saved to.
+func taaHistoryName(frame int32) string {
+	return fmt.Sprintf("taa-history-%05d.raw", frame)
+}
+
+// saveTAAHistory writes the latest history of a to dir as of frame.
+func saveTAAHistory(a *taa, dir string, frame int32) (*taaCheckpoint, error) {
+	t := a.history[a.cur]
+	pix := make([]byte, t.width*t.height*8)
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, t.fbo)
+	gl.ReadPixels(0, 0, t.width, t.height, gl.RGBA, gl.HALF_FLOAT, gl.Ptr(pix))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+
+	c := &taaCheckpoint{
+		File:               taaHistoryName(frame),
+		Width:              t.width,
+		Height:             t.height,
+		PrevViewProjection: a.prevViewProjection,
+		PrevModel:          a.prevModel,
+		Valid:              a.valid,
+	}
+	return c, ioutil.WriteFile(filepath.Join(dir, c.File), pix, 0644)
+}
+
+// loadTAAHistory reads the history saved with a checkpoint, to be restored
+// by resizeTAA once the history targets are created at the same size.
+func loadTAAHistory(a *taa, dir string, c *taaCheckpoint) error {
+	pix, err := ioutil.ReadFile(filepath.Join(dir, c.File))
+	if err != nil {
+		return err
+	}
+	if len(pix) != int(c.Width*c.Height*8) {
+		return fmt.Errorf("%v: expected %vx%v half float RGBA pixels", c.File, c.Width, c.Height)
+	}
+	a.restore, a.restorePix = c, pix
+	return nil
+}
+
+// writeCheckpoint saves the checkpoint of an export directory, with the
+// history of a if not nil, and removes the history of the frame before.
+func writeCheckpoint(dir string, c *checkpoint, a *taa) error {
+	if a != nil {
+		var err error
+		c.TAA, err = saveTAAHistory(a, dir, c.Frame)
+		if err != nil {
+			return err
+		}
+	}
+	err := saveCheckpoint(dir, c)
+	if err != nil {
+		return err
+	}
+	if a != nil {
+		os.Remove(filepath.Join(dir, taaHistoryName(c.Frame-1)))
+	}
+	return nil
+}
+
+// loadCheckpoint reads the checkpoint of an export directory, returning nil
+// if the export hasn't started.
+func loadCheckpoint(dir string) (*checkpoint, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, checkpointName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var c checkpoint
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", checkpointName, err)
+	}
+	return &c, nil
+}
+
+// saveCheckpoint replaces the checkpoint of an export directory, never
+// leaving a partially written one behind.
+func saveCheckpoint(dir string, c *checkpoint) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, checkpointName+".tmp")
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, checkpointName))
+}
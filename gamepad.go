@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+
+	"github.com/go-gl/glfw/v3.1/glfw"
+)
+
+// Sizes of the gamepadAxes and gamepadButtons uniform arrays.
+const (
+	maxGamepadAxes    = 8
+	maxGamepadButtons = 32
+)
+
+// gamepad holds the polled state of a joystick, zeroed while none is present.
+type gamepad struct {
+	joy     glfw.Joystick
+	present bool
+	axes    [maxGamepadAxes]float32
+	buttons [maxGamepadButtons]int32
+}
+
+func pollGamepad(g *gamepad) {
+	present := glfw.JoystickPresent(g.joy)
+	if present != g.present {
+		if present {
+			log.Println("gamepad connected:", glfw.GetJoystickName(g.joy))
+		} else {
+			log.Println("gamepad disconnected")
+		}
+		g.present = present
+	}
+
+	g.axes = [maxGamepadAxes]float32{}
+	g.buttons = [maxGamepadButtons]int32{}
+	if !present {
+		return
+	}
+
+	copy(g.axes[:], glfw.GetJoystickAxes(g.joy))
+	for i, b := range glfw.GetJoystickButtons(g.joy) {
+		if i >= maxGamepadButtons {
+			break
+		}
+		g.buttons[i] = int32(b)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-gl/gl/all-core/gl"
+	"github.com/go-gl/glfw/v3.1/glfw"
+)
+
+var infoFlag = flag.Bool("info", false, "print the GL renderer, versions, extensions and limits of the newest context available, and exit, e.g. for bug reports")
+
+// glLimit is an implementation limit printed by -info, queried only from
+// contexts of at least its version. Indexed limits have a value per index,
+// e.g. per dimension of compute work groups.
+type glLimit struct {
+	name    string
+	pname   uint32
+	n       int
+	indexed bool
+	major   int
+	minor   int
+}
+
+var glLimits = []glLimit{
+	{"MAX_TEXTURE_SIZE", gl.MAX_TEXTURE_SIZE, 1, false, 3, 3},
+	{"MAX_3D_TEXTURE_SIZE", gl.MAX_3D_TEXTURE_SIZE, 1, false, 3, 3},
+	{"MAX_CUBE_MAP_TEXTURE_SIZE", gl.MAX_CUBE_MAP_TEXTURE_SIZE, 1, false, 3, 3},
+	{"MAX_ARRAY_TEXTURE_LAYERS", gl.MAX_ARRAY_TEXTURE_LAYERS, 1, false, 3, 3},
+	{"MAX_TEXTURE_IMAGE_UNITS", gl.MAX_TEXTURE_IMAGE_UNITS, 1, false, 3, 3},
+	{"MAX_VERTEX_TEXTURE_IMAGE_UNITS", gl.MAX_VERTEX_TEXTURE_IMAGE_UNITS, 1, false, 3, 3},
+	{"MAX_COMBINED_TEXTURE_IMAGE_UNITS", gl.MAX_COMBINED_TEXTURE_IMAGE_UNITS, 1, false, 3, 3},
+	{"MAX_TEXTURE_MAX_ANISOTROPY", gl.MAX_TEXTURE_MAX_ANISOTROPY, 1, false, 4, 6},
+	{"MAX_RENDERBUFFER_SIZE", gl.MAX_RENDERBUFFER_SIZE, 1, false, 3, 3},
+	{"MAX_VIEWPORT_DIMS", gl.MAX_VIEWPORT_DIMS, 2, false, 3, 3},
+	{"MAX_SAMPLES", gl.MAX_SAMPLES, 1, false, 3, 3},
+	{"MAX_COLOR_ATTACHMENTS", gl.MAX_COLOR_ATTACHMENTS, 1, false, 3, 3},
+	{"MAX_DRAW_BUFFERS", gl.MAX_DRAW_BUFFERS, 1, false, 3, 3},
+	{"MAX_VERTEX_ATTRIBS", gl.MAX_VERTEX_ATTRIBS, 1, false, 3, 3},
+	{"MAX_VERTEX_UNIFORM_COMPONENTS", gl.MAX_VERTEX_UNIFORM_COMPONENTS, 1, false, 3, 3},
+	{"MAX_FRAGMENT_UNIFORM_COMPONENTS", gl.MAX_FRAGMENT_UNIFORM_COMPONENTS, 1, false, 3, 3},
+	{"MAX_VARYING_COMPONENTS", gl.MAX_VARYING_COMPONENTS, 1, false, 3, 3},
+	{"MAX_UNIFORM_BLOCK_SIZE", gl.MAX_UNIFORM_BLOCK_SIZE, 1, false, 3, 3},
+	{"MAX_UNIFORM_BUFFER_BINDINGS", gl.MAX_UNIFORM_BUFFER_BINDINGS, 1, false, 3, 3},
+	{"MAX_COMBINED_UNIFORM_BLOCKS", gl.MAX_COMBINED_UNIFORM_BLOCKS, 1, false, 3, 3},
+	{"MAX_GEOMETRY_OUTPUT_VERTICES", gl.MAX_GEOMETRY_OUTPUT_VERTICES, 1, false, 3, 3},
+	{"MAX_PATCH_VERTICES", gl.MAX_PATCH_VERTICES, 1, false, 4, 0},
+	{"MAX_TESS_GEN_LEVEL", gl.MAX_TESS_GEN_LEVEL, 1, false, 4, 0},
+	{"MAX_SHADER_STORAGE_BLOCK_SIZE", gl.MAX_SHADER_STORAGE_BLOCK_SIZE, 1, false, 4, 3},
+	{"MAX_SHADER_STORAGE_BUFFER_BINDINGS", gl.MAX_SHADER_STORAGE_BUFFER_BINDINGS, 1, false, 4, 3},
+	{"MAX_COMPUTE_WORK_GROUP_COUNT", gl.MAX_COMPUTE_WORK_GROUP_COUNT, 3, true, 4, 3},
+	{"MAX_COMPUTE_WORK_GROUP_SIZE", gl.MAX_COMPUTE_WORK_GROUP_SIZE, 3, true, 4, 3},
+	{"MAX_COMPUTE_WORK_GROUP_INVOCATIONS", gl.MAX_COMPUTE_WORK_GROUP_INVOCATIONS, 1, false, 4, 3},
+	{"MAX_COMPUTE_SHARED_MEMORY_SIZE", gl.MAX_COMPUTE_SHARED_MEMORY_SIZE, 1, false, 4, 3},
+}
+
+// infoMain prints what the newest context available supports.
+func infoMain(w io.Writer) error {
+	err := glfw.Init()
+	if err != nil {
+		return err
+	}
+	defer glfw.Terminate()
+
+	var window *glfw.Window
+	var major, minor int
+	for _, v := range contextVersions {
+		window, err = createWindow(v[0], v[1], false)
+		if err == nil {
+			major, minor = v[0], v[1]
+			break
+		}
+	}
+	if window == nil {
+		return fmt.Errorf("no context of at least 3.3: %v", err)
+	}
+	defer window.Destroy()
+
+	fmt.Fprintln(w, "vendor:  ", gl.GoStr(gl.GetString(gl.VENDOR)))
+	fmt.Fprintln(w, "renderer:", gl.GoStr(gl.GetString(gl.RENDERER)))
+	fmt.Fprintln(w, "version: ", gl.GoStr(gl.GetString(gl.VERSION)))
+	fmt.Fprintln(w, "glsl:    ", gl.GoStr(gl.GetString(gl.SHADING_LANGUAGE_VERSION)))
+	fmt.Fprintf(w, "context:  %v.%v core\n", major, minor)
+	if major > 4 || major == 4 && minor >= 3 {
+		var n int32
+		gl.GetIntegerv(gl.NUM_SHADING_LANGUAGE_VERSIONS, &n)
+		var vs []string
+		for i := int32(0); i < n; i++ {
+			if v := gl.GoStr(gl.GetStringi(gl.SHADING_LANGUAGE_VERSION, uint32(i))); v != "" {
+				vs = append(vs, v)
+			}
+		}
+		fmt.Fprintln(w, "glsl versions:", strings.Join(vs, ", "))
+	}
+
+	fmt.Fprintln(w, "\nlimits:")
+	for _, l := range glLimits {
+		if major < l.major || major == l.major && minor < l.minor {
+			continue
+		}
+		vals := make([]int64, l.n)
+		if l.indexed {
+			for i := range vals {
+				gl.GetInteger64i_v(l.pname, uint32(i), &vals[i])
+			}
+		} else {
+			gl.GetInteger64v(l.pname, &vals[0])
+		}
+		s := make([]string, len(vals))
+		for i, v := range vals {
+			s[i] = fmt.Sprint(v)
+		}
+		fmt.Fprintf(w, "  %-36v %v\n", l.name, strings.Join(s, " "))
+	}
+
+	var n int32
+	gl.GetIntegerv(gl.NUM_EXTENSIONS, &n)
+	exts := make([]string, n)
+	for i := range exts {
+		exts[i] = gl.GoStr(gl.GetStringi(gl.EXTENSIONS, uint32(i)))
+	}
+	sort.Strings(exts)
+	fmt.Fprintf(w, "\nextensions (%v):\n", n)
+	for _, e := range exts {
+		fmt.Fprintln(w, " ", e)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Package audio analyses sound into the spectrum and waveform Shadertoy
+// gives its audio channels, following Web Audio's AnalyserNode with its
+// default settings: a 1024 sample Blackman window, spectra smoothed over
+// time and decibels from -100 to -30 mapped to bytes.
+package audio
+
+import (
+	"math"
+)
+
+const (
+	// FFTSize is the number of samples analysed.
+	FFTSize = 1024
+	// Bins is the number of frequency bins of the spectrum, and of samples
+	// of the waveform.
+	Bins = FFTSize / 2
+
+	smoothing  = 0.8
+	minDecibel = -100
+	maxDecibel = -30
+)
+
+// Analyser keeps the latest samples written to it.
+type Analyser struct {
+	samples []float64
+	smooth  []float64
+	window  []float64
+}
+
+func NewAnalyser() *Analyser {
+	a := &Analyser{
+		samples: make([]float64, FFTSize),
+		smooth:  make([]float64, Bins),
+		window:  make([]float64, FFTSize),
+	}
+	for i := range a.window {
+		x := 2 * math.Pi * float64(i) / FFTSize
+		a.window[i] = 0.42 - 0.5*math.Cos(x) + 0.08*math.Cos(2*x)
+	}
+	return a
+}
+
+// Write appends samples in -1..1, keeping the latest FFTSize.
+func (a *Analyser) Write(samples []float64) {
+	if len(samples) >= FFTSize {
+		copy(a.samples, samples[len(samples)-FFTSize:])
+		return
+	}
+	copy(a.samples, a.samples[len(samples):])
+	copy(a.samples[FFTSize-len(samples):], samples)
+}
+
+// Spectrum analyses the latest samples and returns the magnitude of each
+// bin, lowest frequency first, smoothed with those of earlier calls.
+func (a *Analyser) Spectrum() []byte {
+	re := make([]float64, FFTSize)
+	im := make([]float64, FFTSize)
+	for i, s := range a.samples {
+		re[i] = s * a.window[i]
+	}
+	FFT(re, im)
+
+	res := make([]byte, Bins)
+	for i := range res {
+		mag := math.Hypot(re[i], im[i]) / FFTSize
+		a.smooth[i] = smoothing*a.smooth[i] + (1-smoothing)*mag
+		db := 20 * math.Log10(a.smooth[i])
+		v := 255 * (db - minDecibel) / (maxDecibel - minDecibel)
+		res[i] = byte(math.Max(0, math.Min(255, v)))
+	}
+	return res
+}
+
+// Waveform returns the latest Bins samples, oldest first, with silence at
+// 128.
+func (a *Analyser) Waveform() []byte {
+	res := make([]byte, Bins)
+	for i, s := range a.samples[FFTSize-Bins:] {
+		v := 128 * (1 + s)
+		res[i] = byte(math.Max(0, math.Min(255, v)))
+	}
+	return res
+}
+
+// FFT transforms the complex values re and im in place. Their length must
+// be a power of two.
+func FFT(re, im []float64) {
+	n := len(re)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j |= bit
+		if i < j {
+			re[i], re[j] = re[j], re[i]
+			im[i], im[j] = im[j], im[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := -2 * math.Pi / float64(size)
+		for start := 0; start < n; start += size {
+			for k := 0; k < size/2; k++ {
+				wr, wi := math.Cos(step*float64(k)), math.Sin(step*float64(k))
+				a, b := start+k, start+k+size/2
+				tr := re[b]*wr - im[b]*wi
+				ti := re[b]*wi + im[b]*wr
+				re[b], im[b] = re[a]-tr, im[a]-ti
+				re[a], im[a] = re[a]+tr, im[a]+ti
+			}
+		}
+	}
+}
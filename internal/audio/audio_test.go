@@ -0,0 +1,105 @@
+package audio
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFFT(t *testing.T) {
+	const n = 16
+	re := make([]float64, n)
+	im := make([]float64, n)
+	for i := range re {
+		re[i] = math.Cos(2 * math.Pi * 3 * float64(i) / n)
+	}
+	FFT(re, im)
+	for k := range re {
+		mag := math.Hypot(re[k], im[k])
+		expected := 0.0
+		if k == 3 || k == n-3 {
+			expected = n / 2
+		}
+		if math.Abs(mag-expected) > 1e-9 {
+			t.Errorf("bin %v: expected %v, got %v", k, expected, mag)
+		}
+	}
+}
+
+func TestAnalyser(t *testing.T) {
+	a := NewAnalyser()
+	for _, b := range a.Waveform() {
+		if b != 128 {
+			t.Fatalf("expected silence at 128, got %v", b)
+		}
+	}
+
+	samples := make([]float64, 3*FFTSize)
+	for i := range samples {
+		samples[i] = 0.01 * math.Sin(2*math.Pi*64*float64(i)/FFTSize)
+	}
+	a.Write(samples[:100])
+	a.Write(samples[100:])
+	var spectrum []byte
+	for i := 0; i < 50; i++ {
+		spectrum = a.Spectrum()
+	}
+	peak := 0
+	for i, v := range spectrum {
+		if v > spectrum[peak] {
+			peak = i
+		}
+	}
+	if peak != 64 || spectrum[peak] == 255 {
+		t.Errorf("expected an unclipped peak at bin 64, got %v at %v", spectrum[peak], peak)
+	}
+	if spectrum[200] != 0 {
+		t.Errorf("expected nothing at bin 200, got %v", spectrum[200])
+	}
+
+	w := a.Waveform()
+	if w[0] != byte(128*(1+samples[len(samples)-Bins])) {
+		t.Errorf("expected the waveform to start %v samples from the end", Bins)
+	}
+}
+
+func TestWAV(t *testing.T) {
+	for _, frames := range []int{3, -1} {
+		var b bytes.Buffer
+		err := WriteWAVHeader(&b, 8000, 2, frames)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write([]byte{1, 0, 0xff, 0xff, 2, 0, 0xfe, 0xff, 0, 0x80, 0xff, 0x7f})
+
+		tr, err := DecodeWAV(&b)
+		if err != nil {
+			t.Fatalf("%v frames: %v", frames, err)
+		}
+		expected := []int16{1, -1, 2, -2, -32768, 32767}
+		if tr.Rate != 8000 || tr.Channels != 2 || !reflect.DeepEqual(tr.Samples, expected) {
+			t.Errorf("%v frames: got %v Hz, %v channels, %v", frames, tr.Rate, tr.Channels, tr.Samples)
+		}
+	}
+
+	if _, err := DecodeWAV(bytes.NewReader([]byte("RIFF\x00\x00\x00\x00AVI "))); err == nil {
+		t.Error("expected an error for a RIFF file other than WAV")
+	}
+}
+
+func TestWindow(t *testing.T) {
+	tr := &Track{Rate: 1000, Channels: 2, Samples: make([]int16, 2*2000)}
+	for i := range tr.Samples {
+		tr.Samples[i] = 16384
+	}
+	if tr.Duration() != 2*time.Second {
+		t.Errorf("expected 2s, got %v", tr.Duration())
+	}
+	w := tr.Window(time.Second / 2)
+	// half a second in, the window starts 524 frames before the track
+	if w[523] != 0 || w[524] != 0.5 || w[FFTSize-1] != 0.5 {
+		t.Errorf("expected silence before the track and 0.5 in it, got %v, %v, %v", w[523], w[524], w[FFTSize-1])
+	}
+}
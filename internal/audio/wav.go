@@ -0,0 +1,158 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// Track is decoded sound, 16-bit samples with the channels of each frame
+// interleaved.
+type Track struct {
+	Rate     int
+	Channels int
+	Samples  []int16
+}
+
+// Frames returns the number of frames of the track.
+func (t *Track) Frames() int {
+	return len(t.Samples) / t.Channels
+}
+
+// Duration returns the length of the track.
+func (t *Track) Duration() time.Duration {
+	return time.Duration(t.Frames()) * time.Second / time.Duration(t.Rate)
+}
+
+// Frame returns the frame playing at time at.
+func (t *Track) Frame(at time.Duration) int {
+	return int(at * time.Duration(t.Rate) / time.Second)
+}
+
+// Window returns the FFTSize frames before time at mixed to mono, in
+// -1..1, with silence outside the track.
+func (t *Track) Window(at time.Duration) []float64 {
+	res := make([]float64, FFTSize)
+	end := t.Frame(at)
+	for i := range res {
+		f := end - FFTSize + i
+		if f < 0 || f >= t.Frames() {
+			continue
+		}
+		var sum float64
+		for _, s := range t.Samples[f*t.Channels : (f+1)*t.Channels] {
+			sum += float64(s)
+		}
+		res[i] = sum / float64(t.Channels) / 32768
+	}
+	return res
+}
+
+// streamSize is the size the RIFF and data chunks of a stream of unknown
+// length are given, as ffmpeg does.
+const streamSize = 0xffffffff
+
+// DecodeWAV reads a WAV file of 16-bit PCM. A data chunk of size 0 or
+// 0xffffffff, as written to pipes, lasts until the end of r.
+func DecodeWAV(r io.Reader) (*Track, error) {
+	var riff [12]byte
+	_, err := io.ReadFull(r, riff[:])
+	if err != nil {
+		return nil, err
+	}
+	if string(riff[:4]) != "RIFF" || string(riff[8:]) != "WAVE" {
+		return nil, fmt.Errorf("not a WAV file")
+	}
+
+	t := &Track{}
+	for {
+		var hdr [8]byte
+		_, err := io.ReadFull(r, hdr[:])
+		if err != nil {
+			return nil, fmt.Errorf("no data chunk: %v", err)
+		}
+		id, size := string(hdr[:4]), binary.LittleEndian.Uint32(hdr[4:])
+
+		switch id {
+		case "fmt ":
+			b := make([]byte, size+size%2)
+			_, err := io.ReadFull(r, b)
+			if err != nil {
+				return nil, err
+			}
+			if len(b) < 16 {
+				return nil, fmt.Errorf("short fmt chunk")
+			}
+			format := binary.LittleEndian.Uint16(b)
+			t.Channels = int(binary.LittleEndian.Uint16(b[2:]))
+			t.Rate = int(binary.LittleEndian.Uint32(b[4:]))
+			bits := binary.LittleEndian.Uint16(b[14:])
+			// 0xfffe is WAVE_FORMAT_EXTENSIBLE, PCM when written by ffmpeg
+			if format != 1 && format != 0xfffe || bits != 16 {
+				return nil, fmt.Errorf("format %#x of %v bits, expected 16-bit PCM", format, bits)
+			}
+			if t.Channels < 1 || t.Rate < 1 {
+				return nil, fmt.Errorf("%v channels at %v Hz", t.Channels, t.Rate)
+			}
+
+		case "data":
+			if t.Channels == 0 {
+				return nil, fmt.Errorf("data chunk before fmt chunk")
+			}
+			var data []byte
+			if size == 0 || size == streamSize {
+				data, err = ioutil.ReadAll(r)
+			} else {
+				data = make([]byte, size)
+				_, err = io.ReadFull(r, data)
+			}
+			if err != nil {
+				return nil, err
+			}
+			frame := 2 * t.Channels
+			data = data[:len(data)/frame*frame]
+			t.Samples = make([]int16, len(data)/2)
+			for i := range t.Samples {
+				t.Samples[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+			}
+			return t, nil
+
+		default:
+			_, err := io.CopyN(ioutil.Discard, r, int64(size+size%2))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// WriteWAVHeader writes the header of a WAV file of 16-bit PCM whose data
+// follows, of unknown length if frames is negative.
+func WriteWAVHeader(w io.Writer, rate, channels, frames int) error {
+	size := uint32(streamSize)
+	if frames >= 0 {
+		size = uint32(frames * channels * 2)
+	}
+	riffSize := size
+	if frames >= 0 {
+		riffSize = 36 + size
+	}
+
+	b := make([]byte, 44)
+	copy(b, "RIFF")
+	binary.LittleEndian.PutUint32(b[4:], riffSize)
+	copy(b[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(b[16:], 16)
+	binary.LittleEndian.PutUint16(b[20:], 1)
+	binary.LittleEndian.PutUint16(b[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(b[24:], uint32(rate))
+	binary.LittleEndian.PutUint32(b[28:], uint32(rate*channels*2))
+	binary.LittleEndian.PutUint16(b[32:], uint16(channels*2))
+	binary.LittleEndian.PutUint16(b[34:], 16)
+	copy(b[36:], "data")
+	binary.LittleEndian.PutUint32(b[40:], size)
+	_, err := w.Write(b)
+	return err
+}
@@ -0,0 +1,187 @@
+// Package cache keeps downloaded resources in a local content-addressed
+// store, so they can be used again without the network.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// entry is what the index remembers about a URL.
+type entry struct {
+	Hash string `json:"hash"`
+	ETag string `json:"etag,omitempty"`
+}
+
+// Cache stores the contents of URLs under dir/objects by the SHA-256 of
+// their content, with dir/index.json mapping each URL to its latest content.
+type Cache struct {
+	dir string
+
+	// Offline disables the network, serving only what was cached before.
+	Offline bool
+	Client  *http.Client
+	// NewRequest, if not nil, makes the GET request for a URL, e.g. to
+	// authorize it.
+	NewRequest func(url string) (*http.Request, error)
+
+	mu    sync.Mutex
+	index map[string]entry
+}
+
+// Open opens the cache in dir, creating it if needed.
+func Open(dir string) (*Cache, error) {
+	err := os.MkdirAll(filepath.Join(dir, "objects"), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{dir: dir, Client: http.DefaultClient, index: make(map[string]entry)}
+	b, err := ioutil.ReadFile(c.indexPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		err = json.Unmarshal(b, &c.index)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", c.indexPath(), err)
+		}
+	}
+	return c, nil
+}
+
+// Dir returns the directory of the cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+func (c *Cache) indexPath() string {
+	return filepath.Join(c.dir, "index.json")
+}
+
+// Path returns where content with the given hash is stored.
+func (c *Cache) Path(hash string) string {
+	return filepath.Join(c.dir, "objects", hash[:2], hash[2:])
+}
+
+// Put stores data and returns its hash.
+func (c *Cache) Put(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	p := c.Path(hash)
+	if _, err := os.Stat(p); err == nil {
+		return hash, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return "", err
+	}
+	tmp := p + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return "", err
+	}
+	return hash, os.Rename(tmp, p)
+}
+
+// Fetch downloads url into the cache and returns the path of its content.
+// Content already cached is revalidated with its ETag where the server gave
+// one. When offline, or when the download fails, the last cached content is
+// returned instead, and only if there is none is the error returned.
+func (c *Cache) Fetch(url string) (string, error) {
+	c.mu.Lock()
+	e, cached := c.index[url]
+	c.mu.Unlock()
+	if cached {
+		if _, err := os.Stat(c.Path(e.Hash)); err != nil {
+			cached = false
+		}
+	}
+
+	if c.Offline {
+		if !cached {
+			return "", fmt.Errorf("%v: not cached and offline", url)
+		}
+		return c.Path(e.Hash), nil
+	}
+
+	e2, err := c.download(url, e, cached)
+	if err != nil {
+		if cached {
+			return c.Path(e.Hash), nil
+		}
+		return "", err
+	}
+	if e2 != e {
+		err = c.setEntry(url, e2)
+		if err != nil {
+			return "", err
+		}
+	}
+	return c.Path(e2.Hash), nil
+}
+
+func (c *Cache) download(url string, e entry, cached bool) (entry, error) {
+	newRequest := c.NewRequest
+	if newRequest == nil {
+		newRequest = func(url string) (*http.Request, error) {
+			return http.NewRequest("GET", url, nil)
+		}
+	}
+	req, err := newRequest(url)
+	if err != nil {
+		return e, err
+	}
+	if cached && e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return e, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached {
+		return e, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return e, fmt.Errorf("%v: %v", url, resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return e, fmt.Errorf("%v: %v", url, err)
+	}
+	hash, err := c.Put(b)
+	if err != nil {
+		return e, err
+	}
+	return entry{Hash: hash, ETag: resp.Header.Get("ETag")}, nil
+}
+
+// setEntry records the entry for url, writing the index atomically.
+func (c *Cache) setEntry(url string, e entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.index[url] = e
+	b, err := json.MarshalIndent(c.index, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := c.indexPath() + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.indexPath())
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func readString(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestFetch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	body := "void main() {}"
+	var requests, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` && body == "void main() {}" {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(body))
+	}))
+
+	c, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.Fetch(srv.URL + "/a.glsl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := readString(t, p); s != body {
+		t.Errorf("expected %q, got %q", body, s)
+	}
+
+	// revalidated, and stored once per content
+	p2, err := c.Fetch(srv.URL + "/a.glsl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p2 != p || notModified != 1 {
+		t.Errorf("expected a not modified revalidation to %v, got %v after %v", p, p2, notModified)
+	}
+
+	// another process sees the index, and falls back to it without a server
+	srv.Close()
+	c, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p3, err := c.Fetch(srv.URL + "/a.glsl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p3 != p {
+		t.Errorf("expected fallback to %v, got %v", p, p3)
+	}
+
+	c.Offline = true
+	_, err = c.Fetch(srv.URL + "/b.glsl")
+	if err == nil {
+		t.Error("expected an error for an uncached url when offline")
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %v", requests)
+	}
+}
+
+func TestPut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h1, err := c.Put([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := c.Put([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1 != h2 || h1 != "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb" {
+		t.Errorf("unexpected hashes %v, %v", h1, h2)
+	}
+}
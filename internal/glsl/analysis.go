@@ -0,0 +1,298 @@
+package glsl
+
+import (
+	"strings"
+)
+
+// Includes returns the #include directives of f.
+func Includes(f *File) []*Directive {
+	var ds []*Directive
+	for _, d := range f.Decls {
+		if d, ok := d.(*Directive); ok && d.Name == "include" {
+			ds = append(ds, d)
+		}
+	}
+	return ds
+}
+
+// IncludePath returns the path of an #include "path" or #include <path>.
+func IncludePath(d *Directive) (string, bool) {
+	a := d.Args
+	if len(a) < 2 {
+		return "", false
+	}
+	if a[0] == '"' && a[len(a)-1] == '"' || a[0] == '<' && a[len(a)-1] == '>' {
+		return a[1 : len(a)-1], true
+	}
+	return "", false
+}
+
+// Version returns the arguments of the #version directive of f, e.g.
+// "330 core", or "" if it has none.
+func Version(f *File) string {
+	for _, d := range f.Decls {
+		if d, ok := d.(*Directive); ok && d.Name == "version" {
+			return d.Args
+		}
+	}
+	return ""
+}
+
+func hasQualifier(qs []string, q string) bool {
+	for _, x := range qs {
+		if x == q {
+			return true
+		}
+	}
+	return false
+}
+
+// Uniforms returns the declarations of uniforms outside of blocks.
+func Uniforms(f *File) []*VarDecl {
+	var ds []*VarDecl
+	for _, d := range f.Decls {
+		if d, ok := d.(*VarDecl); ok && hasQualifier(d.Qualifiers, "uniform") && len(d.Vars) > 0 {
+			ds = append(ds, d)
+		}
+	}
+	return ds
+}
+
+// Blocks returns the interface blocks with the given storage qualifier,
+// e.g. uniform or buffer.
+func Blocks(f *File, storage string) []*Block {
+	var bs []*Block
+	for _, d := range f.Decls {
+		if b, ok := d.(*Block); ok && hasQualifier(b.Qualifiers, storage) {
+			bs = append(bs, b)
+		}
+	}
+	return bs
+}
+
+// Funcs returns the function definitions of f by name. Overloads share a
+// name, so each name maps to all of its definitions.
+func Funcs(f *File) map[string][]*Func {
+	fs := make(map[string][]*Func)
+	for _, d := range f.Decls {
+		if fn, ok := d.(*Func); ok && fn.Body != nil {
+			fs[fn.Name] = append(fs[fn.Name], fn)
+		}
+	}
+	return fs
+}
+
+// idents adds the identifiers of toks to set, skipping the names of fields
+// and swizzles after a dot.
+func idents(toks []Token, set map[string]bool) {
+	for i, t := range toks {
+		if t.Kind == Ident && (i == 0 || toks[i-1].Text != ".") {
+			set[t.Text] = true
+		}
+	}
+}
+
+// Used returns the identifiers referenced by the named entry functions,
+// following calls to the other functions of f and the initializers of the
+// globals they use. Identifiers of f not in the result are dead code as
+// far as the entry points are concerned.
+//
+// Local variables that shadow globals are not told apart from them, so a
+// global may be reported as used when it isn't, but never the opposite.
+func Used(f *File, entries ...string) map[string]bool {
+	funcs := Funcs(f)
+	inits := make(map[string][]Token)
+	for _, d := range f.Decls {
+		var vars []Var
+		switch d := d.(type) {
+		case *VarDecl:
+			vars = d.Vars
+		case *Struct:
+			vars = d.Vars
+		}
+		for _, v := range vars {
+			inits[v.Name] = v.Init
+		}
+	}
+
+	used := make(map[string]bool)
+	var queue []string
+	visit := func(name string) {
+		if !used[name] {
+			used[name] = true
+			queue = append(queue, name)
+		}
+	}
+	for _, e := range entries {
+		visit(e)
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		refs := make(map[string]bool)
+		for _, fn := range funcs[name] {
+			idents(fn.Body, refs)
+			for _, p := range fn.Params {
+				if p.ArraySize != nil {
+					refs[*p.ArraySize] = true
+				}
+			}
+		}
+		idents(inits[name], refs)
+		for r := range refs {
+			visit(r)
+		}
+	}
+	return used
+}
+
+// needsSpace reports whether a and b would lex differently written without
+// space between them.
+func needsSpace(a, b Token) bool {
+	word := func(k Kind) bool { return k == Ident || k == Number }
+	if word(a.Kind) && word(b.Kind) {
+		return true
+	}
+	if a.Kind == Number && b.Text == "." || a.Text == "." && b.Kind == Number {
+		return true
+	}
+	if a.Kind == Punct && b.Kind == Punct {
+		joined := a.Text + b.Text
+		for _, p := range puncts {
+			if len(p) > len(a.Text) && strings.HasPrefix(joined, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Minify removes the comments and all whitespace that doesn't separate
+// tokens from src, keeping directives on their own lines.
+func Minify(src []byte) ([]byte, error) {
+	toks, err := Lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	var prev *Token
+	for i, t := range toks {
+		switch t.Kind {
+		case Comment:
+			continue
+		case Preproc:
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+				b.WriteByte('\n')
+			}
+			b.WriteString(strings.TrimSpace(t.Text))
+			b.WriteByte('\n')
+			prev = nil
+			continue
+		}
+		if prev != nil && needsSpace(*prev, t) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.Text)
+		prev = &toks[i]
+	}
+	return []byte(b.String()), nil
+}
+
+// VersionEnd returns the offset just past the line of the #version
+// directive of src, and the number of the line that follows, skipping any
+// comments before it. It returns false if src has no #version directive.
+func VersionEnd(src []byte) (int, int, bool) {
+	l := newLexer(src)
+	for {
+		t, ok, err := l.next()
+		if err != nil || !ok {
+			return 0, 0, false
+		}
+		if t.Kind == Comment {
+			continue
+		}
+		if t.Kind != Preproc || parseDirective(t).Name != "version" {
+			return 0, 0, false
+		}
+		end := t.Pos + len(t.Text)
+		line := t.Line + strings.Count(t.Text, "\n")
+		if end < len(src) {
+			// the newline ending the directive
+			end++
+		}
+		return end, line + 1, true
+	}
+}
+
+func formatLayout(layout []LayoutQualifier) string {
+	entries := make([]string, len(layout))
+	for i, q := range layout {
+		entries[i] = q.Name
+		if q.Value != "" {
+			entries[i] += " = " + q.Value
+		}
+	}
+	return "layout(" + strings.Join(entries, ", ") + ")"
+}
+
+// SetLayout returns src with a layout qualifier added to the declaration of
+// each top-level variable named in layouts, unless it already has one of
+// the same name, e.g. location = 0 to in vec3 position. f is src parsed.
+// Declarations of several variables are split so each can have its own,
+// keeping the lines of the rest of the source where they were.
+func SetLayout(src []byte, f *File, layouts map[string]LayoutQualifier) []byte {
+	var b strings.Builder
+	last := 0
+	for _, d := range f.Decls {
+		d, ok := d.(*VarDecl)
+		if !ok {
+			continue
+		}
+		found := false
+		for _, v := range d.Vars {
+			_, ok := layouts[v.Name]
+			found = found || ok
+		}
+		if !found {
+			continue
+		}
+
+		b.Write(src[last:d.Pos])
+		for i, v := range d.Vars {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			layout := d.Layout
+			if q, ok := layouts[v.Name]; ok {
+				has := false
+				for _, l := range d.Layout {
+					has = has || l.Name == q.Name
+				}
+				if !has {
+					layout = append(layout[:len(layout):len(layout)], q)
+				}
+			}
+			if len(layout) > 0 {
+				b.WriteString(formatLayout(layout) + " ")
+			}
+			for _, q := range d.Qualifiers {
+				b.WriteString(q + " ")
+			}
+			b.WriteString(d.Type + " " + v.Name)
+			if v.ArraySize != nil {
+				b.WriteString("[" + *v.ArraySize + "]")
+			}
+			if v.Init != nil {
+				b.WriteString(" = " + joinTokens(v.Init))
+			}
+			b.WriteByte(';')
+		}
+		// keep the line numbers of what follows
+		b.WriteString(strings.Repeat("\n", strings.Count(string(src[d.Pos:d.End]), "\n")))
+		last = d.End
+	}
+	b.Write(src[last:])
+	return []byte(b.String())
+}
@@ -0,0 +1,320 @@
+package glsl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSource = `// a test shader
+#version 330 core
+#include "common.glsl"
+
+precision highp float;
+
+// light direction, in view space
+uniform vec3 lightDir;
+uniform float gain = 1.0, unused[2]; // gain and unused
+/* not attached */
+
+uniform sampler2D image;
+
+layout(std140) uniform Lights {
+	vec4 colors[4];
+	mat4 transform;
+} lights;
+
+struct Material {
+	vec3 diffuse;
+	float shininess;
+};
+
+in vec3 normal;
+layout(location = 0) out vec4 color;
+
+float shade(vec3 n, Material m);
+
+float shade(vec3 n, Material m) {
+	// comments and #ifdefs in bodies are skipped
+#ifdef SHARP
+	return max(dot(n, lightDir), 0.0);
+#else
+	return m.shininess * dot(n, lightDir);
+#endif
+}
+
+void main() {
+	Material m;
+	m.diffuse = lights.colors[0].rgb;
+	color = vec4(m.diffuse * shade(normal, m) * gain, 1);
+}
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse([]byte(testSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := Version(f); v != "330 core" {
+		t.Errorf("version %q", v)
+	}
+
+	incs := Includes(f)
+	if len(incs) != 1 {
+		t.Fatalf("%v includes", len(incs))
+	}
+	if p, ok := IncludePath(incs[0]); !ok || p != "common.glsl" || incs[0].Line != 3 {
+		t.Errorf("include %q line %v", p, incs[0].Line)
+	}
+
+	us := Uniforms(f)
+	var names, comments []string
+	for _, u := range us {
+		for _, v := range u.Vars {
+			names = append(names, u.Type+" "+v.Name)
+		}
+		comments = append(comments, u.Comment)
+	}
+	if want := []string{"vec3 lightDir", "float gain", "float unused", "sampler2D image"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("uniforms %q, want %q", names, want)
+	}
+	if want := []string{"light direction, in view space", "gain and unused", ""}; !reflect.DeepEqual(comments, want) {
+		t.Errorf("comments %q, want %q", comments, want)
+	}
+	if v := us[1].Vars[1]; v.ArraySize == nil || *v.ArraySize != "2" {
+		t.Errorf("unused array size %v", v.ArraySize)
+	}
+	if init := joinTokens(us[1].Vars[0].Init); init != "1.0" {
+		t.Errorf("gain init %q", init)
+	}
+
+	bs := Blocks(f, "uniform")
+	if len(bs) != 1 {
+		t.Fatalf("%v blocks", len(bs))
+	}
+	b := bs[0]
+	if b.Name != "Lights" || b.Instance != "lights" || len(b.Members) != 2 || b.Layout[0].Name != "std140" {
+		t.Errorf("block %+v", b)
+	}
+
+	var out *VarDecl
+	for _, d := range f.Decls {
+		if d, ok := d.(*VarDecl); ok && hasQualifier(d.Qualifiers, "out") {
+			out = d
+		}
+	}
+	if out == nil || !reflect.DeepEqual(out.Layout, []LayoutQualifier{{"location", "0"}}) {
+		t.Errorf("out %+v", out)
+	}
+
+	fs := Funcs(f)
+	if len(fs["shade"]) != 1 || len(fs["main"]) != 1 {
+		t.Fatalf("funcs %v", fs)
+	}
+	shade := fs["shade"][0]
+	if shade.Return != "float" || len(shade.Params) != 2 || shade.Params[1].Type != "Material" || shade.Params[1].Name != "m" {
+		t.Errorf("shade %+v", shade)
+	}
+}
+
+func TestUsed(t *testing.T) {
+	f, err := Parse([]byte(testSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used := Used(f, "main")
+	for _, name := range []string{"shade", "lightDir", "gain", "lights", "normal", "color"} {
+		if !used[name] {
+			t.Errorf("%v not used", name)
+		}
+	}
+	for _, name := range []string{"unused", "image", "diffuse", "colors"} {
+		if used[name] {
+			t.Errorf("%v used", name)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		"uniform vec3 a",
+		"void main() {",
+		"}",
+		"/* open",
+		"uniform vec3 @;",
+		"uniform 3 a;",
+	} {
+		if _, err := Parse([]byte(src)); err == nil {
+			t.Errorf("%q: no error", src)
+		}
+	}
+}
+
+func TestMinify(t *testing.T) {
+	src := `#version 330 core
+// comment
+uniform float a; /* b */
+void main() {
+	float x = a - -a + .5;
+	x++ + +x;
+#ifdef A
+	x = 1.0e-3;
+#endif
+}
+`
+	want := `#version 330 core
+uniform float a;void main(){float x=a- -a+.5;x+++ +x;
+#ifdef A
+x=1.0e-3;
+#endif
+}`
+	b, err := Minify([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != want {
+		t.Errorf("got\n%v\nwant\n%v", string(b), want)
+	}
+
+	again, err := Minify(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != want {
+		t.Errorf("minifying again changed it to\n%v", string(again))
+	}
+}
+
+func TestVersionEnd(t *testing.T) {
+	tests := []struct {
+		src  string
+		end  int
+		line int
+		ok   bool
+	}{
+		{"#version 330\nvoid main() {}", 13, 2, true},
+		{"// hi\n/* there\n*/ #version 330 core\nx", 36, 4, true},
+		{"#version 330", 12, 2, true},
+		{"void main() {}\n#version 330\n", 0, 0, false},
+		{"#define A\n#version 330\n", 0, 0, false},
+	}
+	for _, test := range tests {
+		end, line, ok := VersionEnd([]byte(test.src))
+		if end != test.end || line != test.line || ok != test.ok {
+			t.Errorf("%q: got %v, %v, %v, want %v, %v, %v", test.src, end, line, ok, test.end, test.line, test.ok)
+		}
+	}
+}
+
+func TestLexDirectiveContinuation(t *testing.T) {
+	toks, err := Lex([]byte("#define A(x) \\\n\t(x + 1)\nA(2);\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toks[0].Kind != Preproc || !strings.HasSuffix(toks[0].Text, "(x + 1)") {
+		t.Errorf("directive %q", toks[0].Text)
+	}
+	if toks[1].Text != "A" || toks[1].Line != 3 {
+		t.Errorf("after directive %q on line %v", toks[1].Text, toks[1].Line)
+	}
+}
+
+func TestSetLayout(t *testing.T) {
+	src := `#version 420 core
+in vec3 position;
+layout(location = 7) in vec3 normal;
+uniform sampler2D a,
+	b[2];
+layout(std140) uniform float x;
+void main() {}
+`
+	f, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(SetLayout([]byte(src), f, map[string]LayoutQualifier{
+		"position": {"location", "0"},
+		"normal":   {"location", "2"},
+		"b":        {"binding", "3"},
+	}))
+	want := `#version 420 core
+layout(location = 0) in vec3 position;
+layout(location = 7) in vec3 normal;
+uniform sampler2D a; layout(binding = 3) uniform sampler2D b[2];
+
+layout(std140) uniform float x;
+void main() {}
+`
+	if got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+	if _, err := Parse([]byte(got)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTweaks(t *testing.T) {
+	src := `#version 330 core
+#pragma shaderdev uniform float roughness 0..1 = 0.5
+#pragma optimize(off)
+#pragma shaderdev uniform vec3 tint = 1, 0.5, 0 color
+#pragma shaderdev uniform bool sharp = true
+uniform float roughness;
+`
+	tws, err := Tweaks([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Tweak{
+		{Type: "float", Name: "roughness", Min: 0, Max: 1, Default: []float64{0.5}, Line: 2},
+		{Type: "vec3", Name: "tint", Default: []float64{1, 0.5, 0}, Widget: "color", Line: 4},
+		{Type: "bool", Name: "sharp", Default: []float64{1}, Line: 5},
+	}
+	if !reflect.DeepEqual(tws, want) {
+		for _, tw := range tws {
+			t.Logf("%+v", *tw)
+		}
+		t.Errorf("wrong tweaks")
+	}
+
+	for _, bad := range []string{
+		"#pragma shaderdev uniform float\n",
+		"#pragma shaderdev uniform float x 1..0\n",
+		"#pragma shaderdev uniform float x = a\n",
+		"#pragma shaderdev uniform float x knob\n",
+	} {
+		if _, err := Tweaks([]byte(bad)); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestIsIdent(t *testing.T) {
+	for s, expected := range map[string]bool{
+		"albedo": true, "_tex0": true, "a": true,
+		"": false, "0tex": false, "C:": false, "http": true, "a-b": false,
+	} {
+		if IsIdent(s) != expected {
+			t.Errorf("IsIdent(%q): expected %v", s, expected)
+		}
+	}
+}
+
+func TestParseLog(t *testing.T) {
+	log := "0:12(5): error: `x' undeclared\n" +
+		"0(7) : warning C7050: \"c\" might be used before being initialized\n" +
+		"ERROR: 0:3: 'y' : undeclared identifier\n" +
+		"ERROR: 1 compilation errors.  No code generated.\n" +
+		"error: vertex shader lacks `main'\x00"
+	want := []Diagnostic{
+		{0, 12, 5, "error", "`x' undeclared"},
+		{0, 7, 0, "warning", "\"c\" might be used before being initialized"},
+		{0, 3, 0, "error", "'y' : undeclared identifier"},
+		{0, 0, 0, "error", "error: vertex shader lacks `main'"},
+	}
+	if ds := ParseLog(log); !reflect.DeepEqual(ds, want) {
+		t.Errorf("expected %+v, got %+v", want, ds)
+	}
+}
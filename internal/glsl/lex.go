@@ -0,0 +1,217 @@
+// Package glsl parses GLSL sources into their top-level declarations, for
+// tools that need to know what a shader declares and uses without
+// compiling it: include resolution, uniform annotations, dead uniform
+// detection and minification.
+//
+// Function bodies and initializers are kept as tokens rather than parsed
+// into expressions, which is all these tools need.
+package glsl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind is the kind of a token.
+type Kind int
+
+const (
+	Ident Kind = iota
+	Number
+	Punct
+	// a whole preprocessor line, including continuations
+	Preproc
+	// a // or /* */ comment
+	Comment
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Ident:
+		return "identifier"
+	case Number:
+		return "number"
+	case Punct:
+		return "punctuation"
+	case Preproc:
+		return "preprocessor line"
+	case Comment:
+		return "comment"
+	default:
+		return "unknown"
+	}
+}
+
+// Token is a lexical token of a source.
+type Token struct {
+	Kind Kind
+	Text string
+	// byte offset and 1-based line of the start of the token
+	Pos  int
+	Line int
+}
+
+// puncts lists the operators and punctuation, longest first so the lexer
+// can take the first match.
+var puncts = []string{
+	"<<=", ">>=",
+	"++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||", "^^",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=",
+	"(", ")", "[", "]", "{", "}", ".", ",", ";", ":", "?",
+	"+", "-", "*", "/", "%", "<", ">", "=", "!", "~", "&", "|", "^",
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// IsIdent reports whether s is an identifier.
+func IsIdent(s string) bool {
+	if s == "" || !isIdentStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isIdentStart(s[i]) && !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Lex splits src into tokens, keeping comments and directives.
+func Lex(src []byte) ([]Token, error) {
+	l := newLexer(src)
+	var toks []Token
+	for {
+		t, ok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return toks, nil
+		}
+		toks = append(toks, t)
+	}
+}
+
+type lexer struct {
+	s    string
+	i    int
+	line int
+	// whether only whitespace and comments precede i on its line, where a
+	// directive may start
+	lineStart bool
+}
+
+func newLexer(src []byte) *lexer {
+	return &lexer{s: string(src), line: 1, lineStart: true}
+}
+
+// next returns the next token, or false at the end of the source.
+func (l *lexer) next() (Token, bool, error) {
+	s := l.s
+	for l.i < len(s) {
+		c := s[l.i]
+		if c == '\n' {
+			l.line++
+			l.lineStart = true
+		} else if c != ' ' && c != '\t' && c != '\r' && c != '\f' && c != '\v' {
+			break
+		}
+		l.i++
+	}
+	if l.i == len(s) {
+		return Token{}, false, nil
+	}
+
+	i, c := l.i, s[l.i]
+	start, startLine := i, l.line
+	var kind Kind
+	switch {
+	case c == '#' && l.lineStart:
+		kind = Preproc
+		for i < len(s) && s[i] != '\n' {
+			if s[i] == '\\' && i+1 < len(s) && s[i+1] == '\n' {
+				l.line++
+				i++
+			}
+			i++
+		}
+	case strings.HasPrefix(s[i:], "//"):
+		kind = Comment
+		for i < len(s) && s[i] != '\n' {
+			i++
+		}
+	case strings.HasPrefix(s[i:], "/*"):
+		kind = Comment
+		end := strings.Index(s[i+2:], "*/")
+		if end < 0 {
+			return Token{}, false, fmt.Errorf("%v: unterminated comment", l.line)
+		}
+		l.line += strings.Count(s[i:i+2+end+2], "\n")
+		i += 2 + end + 2
+	case isIdentStart(c):
+		kind = Ident
+		for i < len(s) && (isIdentStart(s[i]) || isDigit(s[i])) {
+			i++
+		}
+	case isDigit(c) || c == '.' && i+1 < len(s) && isDigit(s[i+1]):
+		kind = Number
+		i = lexNumber(s, i)
+	default:
+		kind = Punct
+		for _, p := range puncts {
+			if strings.HasPrefix(s[i:], p) {
+				i += len(p)
+				break
+			}
+		}
+		if i == start {
+			return Token{}, false, fmt.Errorf("%v: unexpected character %q", l.line, c)
+		}
+	}
+
+	// a comment before a directive doesn't stop it being one
+	if kind != Comment {
+		l.lineStart = false
+	}
+	l.i = i
+	return Token{kind, s[start:i], start, startLine}, true, nil
+}
+
+// lexNumber returns the end of the number starting at i: decimal, octal or
+// hexadecimal integers and floats, with their suffixes.
+func lexNumber(s string, i int) int {
+	if strings.HasPrefix(s[i:], "0x") || strings.HasPrefix(s[i:], "0X") {
+		i += 2
+		for i < len(s) && strings.IndexByte("0123456789abcdefABCDEF", s[i]) >= 0 {
+			i++
+		}
+	} else {
+		for i < len(s) && (isDigit(s[i]) || s[i] == '.') {
+			i++
+		}
+		if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+			j := i + 1
+			if j < len(s) && (s[j] == '+' || s[j] == '-') {
+				j++
+			}
+			if j < len(s) && isDigit(s[j]) {
+				i = j
+				for i < len(s) && isDigit(s[i]) {
+					i++
+				}
+			}
+		}
+	}
+	for _, suffix := range []string{"lf", "LF", "u", "U", "f", "F"} {
+		if strings.HasPrefix(s[i:], suffix) {
+			return i + len(suffix)
+		}
+	}
+	return i
+}
@@ -0,0 +1,72 @@
+package glsl
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is a message of a compiler or linker log. Line and Column are
+// 0 if the message gives none.
+type Diagnostic struct {
+	// the index of the source string the driver was given
+	Source   int
+	Line     int
+	Column   int
+	Severity string
+	Message  string
+}
+
+// The formats drivers write messages in, with the groups of each.
+var (
+	// Mesa: 0:12(5): error: `x' undeclared
+	mesaLog = regexp.MustCompile(`^(\d+):(\d+)\((\d+)\): ([a-z ]+): (.*)$`)
+	// NVIDIA: 0(12) : error C1008: undefined variable "x"
+	nvidiaLog = regexp.MustCompile(`^(\d+)\((\d+)\) : ([a-z ]+) \w+: (.*)$`)
+	// AMD, Apple and ANGLE: ERROR: 0:12: 'x' : undeclared identifier
+	glslangLog = regexp.MustCompile(`^(ERROR|WARNING|INFO): (\d+):(\d+): (.*)$`)
+	// summaries such as ERROR: 1 compilation errors.  No code generated.
+	summaryLog = regexp.MustCompile(`^(ERROR|WARNING): \d+ compilation (errors|warnings)\.`)
+)
+
+// ParseLog splits a compiler or linker log into its messages, giving those
+// in none of the formats of the common drivers whole, as errors.
+func ParseLog(log string) []Diagnostic {
+	var res []Diagnostic
+	for _, l := range strings.Split(log, "\n") {
+		l = strings.TrimRight(l, "\r\x00 ")
+		if l == "" || summaryLog.MatchString(l) {
+			continue
+		}
+		var d Diagnostic
+		if m := mesaLog.FindStringSubmatch(l); m != nil {
+			d = Diagnostic{atoi(m[1]), atoi(m[2]), atoi(m[3]), severity(m[4]), m[5]}
+		} else if m := nvidiaLog.FindStringSubmatch(l); m != nil {
+			d = Diagnostic{atoi(m[1]), atoi(m[2]), 0, severity(m[3]), m[4]}
+		} else if m := glslangLog.FindStringSubmatch(l); m != nil {
+			d = Diagnostic{atoi(m[2]), atoi(m[3]), 0, severity(m[1]), m[4]}
+		} else {
+			d = Diagnostic{Severity: "error", Message: l}
+		}
+		res = append(res, d)
+	}
+	return res
+}
+
+// severity returns "error", "warning" or "info" for what a driver calls a
+// message.
+func severity(s string) string {
+	s = strings.ToLower(s)
+	switch {
+	case strings.Contains(s, "warning"):
+		return "warning"
+	case strings.Contains(s, "info"), strings.Contains(s, "note"):
+		return "info"
+	}
+	return "error"
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,668 @@
+package glsl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// File is a parsed source, as its top-level declarations in order.
+type File struct {
+	Decls []Decl
+}
+
+// Decl is one of *Directive, *Precision, *Struct, *VarDecl, *Block or
+// *Func.
+type Decl interface {
+	decl()
+}
+
+// Directive is a preprocessor line, e.g. #version 330 core.
+type Directive struct {
+	Name string
+	// the rest of the line, trimmed, with continuations joined
+	Args string
+	Line int
+}
+
+// Precision is a default precision statement, e.g. precision highp float.
+type Precision struct {
+	Qualifier string
+	Type      string
+	Line      int
+}
+
+// LayoutQualifier is one entry of a layout(...) qualifier, with Value empty
+// for entries like std140.
+type LayoutQualifier struct {
+	Name  string
+	Value string
+}
+
+// Var is one variable of a declaration.
+type Var struct {
+	Name string
+	// the text inside the brackets of an array, e.g. "4", or "" for runtime
+	// sized arrays; nil if not an array
+	ArraySize *string
+	// initializer tokens after the =, nil if none
+	Init []Token
+}
+
+// VarDecl declares variables of one type, e.g. uniform vec3 a, b[2];.
+// Declarations with only qualifiers, e.g. layout(local_size_x = 8) in;,
+// have no Type or Vars.
+type VarDecl struct {
+	Layout     []LayoutQualifier
+	Qualifiers []string
+	Type       string
+	Vars       []Var
+	// the comment before the declaration, or after it on the same line,
+	// without its // or /* */ markers
+	Comment string
+	Line    int
+	// byte offsets of a top-level declaration in the source, from its
+	// first token to after its ;
+	Pos, End int
+}
+
+// Struct declares a struct type, and possibly variables of it.
+type Struct struct {
+	Qualifiers []string
+	Name       string
+	Members    []*VarDecl
+	Vars       []Var
+	Line       int
+}
+
+// Block is an interface block, e.g. uniform Lights { ... } lights;.
+type Block struct {
+	Layout     []LayoutQualifier
+	Qualifiers []string
+	Name       string
+	Members    []*VarDecl
+	// the instance name, or "" if the members are global
+	Instance  string
+	ArraySize *string
+	Comment   string
+	Line      int
+}
+
+// Param is a function parameter. Name is empty in prototypes that omit it.
+type Param struct {
+	Qualifiers []string
+	Type       string
+	Name       string
+	ArraySize  *string
+}
+
+// Func is a function definition, or a prototype if Body is nil.
+type Func struct {
+	Return string
+	Name   string
+	Params []Param
+	// tokens between the braces, without comments
+	Body []Token
+	Line int
+}
+
+func (*Directive) decl() {}
+func (*Precision) decl() {}
+func (*Struct) decl()    {}
+func (*VarDecl) decl()   {}
+func (*Block) decl()     {}
+func (*Func) decl()      {}
+
+// qualifiers are the keywords that may precede a type.
+var qualifiers = map[string]bool{
+	"const": true, "uniform": true, "buffer": true, "shared": true,
+	"attribute": true, "varying": true, "in": true, "out": true, "inout": true,
+	"centroid": true, "sample": true, "patch": true,
+	"smooth": true, "flat": true, "noperspective": true,
+	"invariant": true, "precise": true,
+	"highp": true, "mediump": true, "lowp": true,
+	"coherent": true, "volatile": true, "restrict": true,
+	"readonly": true, "writeonly": true, "subroutine": true,
+}
+
+type parser struct {
+	toks []Token
+	i    int
+}
+
+func (p *parser) peek() Token {
+	if p.i < len(p.toks) {
+		return p.toks[p.i]
+	}
+	return Token{Kind: Punct}
+}
+
+func (p *parser) is(text string) bool {
+	return p.i < len(p.toks) && p.toks[p.i].Kind != Number && p.toks[p.i].Text == text
+}
+
+func (p *parser) errorf(format string, v ...interface{}) error {
+	line := 0
+	if p.i < len(p.toks) {
+		line = p.toks[p.i].Line
+	} else if len(p.toks) > 0 {
+		line = p.toks[len(p.toks)-1].Line
+	}
+	return fmt.Errorf("%v: %v", line, fmt.Sprintf(format, v...))
+}
+
+func (p *parser) expect(text string) error {
+	if !p.is(text) {
+		if p.i >= len(p.toks) {
+			return p.errorf("expected %v, found end of source", text)
+		}
+		return p.errorf("expected %v, found %v", text, p.peek().Text)
+	}
+	p.i++
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.peek()
+	if p.i >= len(p.toks) || t.Kind != Ident {
+		if p.i >= len(p.toks) {
+			return "", p.errorf("expected identifier, found end of source")
+		}
+		return "", p.errorf("expected identifier, found %v", t.Text)
+	}
+	p.i++
+	return t.Text, nil
+}
+
+// balanced returns the tokens up to the close matching the open the parser
+// is at, and moves past the close.
+func (p *parser) balanced(open, close string) ([]Token, error) {
+	if err := p.expect(open); err != nil {
+		return nil, err
+	}
+	start := p.i
+	for depth := 1; p.i < len(p.toks); p.i++ {
+		switch {
+		case p.is(open):
+			depth++
+		case p.is(close):
+			depth--
+			if depth == 0 {
+				toks := p.toks[start:p.i]
+				p.i++
+				return toks, nil
+			}
+		}
+	}
+	return nil, p.errorf("unclosed %v", open)
+}
+
+// Parse parses the top-level declarations of src. Preprocessor directives
+// other than #version are not evaluated, so sources that only parse after
+// preprocessing, e.g. with macros around declarations, return an error.
+func Parse(src []byte) (*File, error) {
+	toks, err := Lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var f File
+	var p parser
+	depth := 0
+	// consecutive comments not yet attached to a declaration
+	var comments []Token
+	var last Decl
+	lastLine := 0
+	for _, t := range toks {
+		switch t.Kind {
+		case Comment:
+			if len(p.toks) > 0 {
+				continue
+			}
+			// a comment on the line a declaration ends describes it
+			if last != nil && t.Line == lastLine && setComment(last, []Token{t}) {
+				last = nil
+				continue
+			}
+			if len(comments) > 0 && commentEnd(comments[len(comments)-1]) < t.Line-1 {
+				comments = nil
+			}
+			comments = append(comments, t)
+			continue
+		case Preproc:
+			if len(p.toks) > 0 {
+				// directives within declarations, e.g. #ifdef around a
+				// function body, are left to the compiler
+				continue
+			}
+			f.Decls = append(f.Decls, parseDirective(t))
+			comments = nil
+			last = nil
+			continue
+		}
+
+		if len(p.toks) == 0 && len(comments) > 0 && commentEnd(comments[len(comments)-1]) < t.Line-1 {
+			comments = nil
+		}
+		p.toks = append(p.toks, t)
+
+		end := false
+		switch {
+		case t.Kind != Punct:
+		case t.Text == "{":
+			depth++
+		case t.Text == "}":
+			depth--
+			if depth < 0 {
+				p.i = len(p.toks) - 1
+				return nil, p.errorf("unexpected }")
+			}
+			end = depth == 0 && isFuncBody(p.toks)
+		case t.Text == ";":
+			end = depth == 0
+		}
+		if !end {
+			continue
+		}
+
+		p.i = 0
+		d, err := parseDecl(&p)
+		if err != nil {
+			return nil, err
+		}
+		if p.i != len(p.toks) {
+			return nil, p.errorf("unexpected %v", p.peek().Text)
+		}
+		if d, ok := d.(*VarDecl); ok {
+			d.Pos, d.End = p.toks[0].Pos, t.Pos+len(t.Text)
+		}
+		if len(comments) > 0 {
+			setComment(d, comments)
+		}
+		f.Decls = append(f.Decls, d)
+		last, lastLine = d, t.Line
+		comments = nil
+		p.toks = nil
+	}
+	if len(p.toks) > 0 {
+		p.i = len(p.toks)
+		return nil, p.errorf("unterminated declaration")
+	}
+	return &f, nil
+}
+
+func commentEnd(t Token) int {
+	return t.Line + strings.Count(t.Text, "\n")
+}
+
+// isFuncBody reports whether toks, ending with a }, are a function
+// definition rather than a struct or block still to be ended by a ;.
+func isFuncBody(toks []Token) bool {
+	for i, t := range toks {
+		if t.Text == "{" {
+			return i > 0 && toks[i-1].Text == ")"
+		}
+	}
+	return false
+}
+
+func parseDirective(t Token) *Directive {
+	text := strings.Replace(t.Text, "\\\n", "", -1)
+	text = strings.TrimSpace(strings.TrimPrefix(text, "#"))
+	name, args := text, ""
+	if i := strings.IndexAny(text, " \t(\"<"); i >= 0 {
+		name, args = text[:i], strings.TrimSpace(text[i:])
+	}
+	return &Directive{name, args, t.Line}
+}
+
+// setComment attaches comments to the declarations that keep one, and
+// reports whether it did.
+func setComment(d Decl, comments []Token) bool {
+	lines := make([]string, len(comments))
+	for i, t := range comments {
+		text := t.Text
+		if strings.HasPrefix(text, "//") {
+			text = text[2:]
+		} else {
+			text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		}
+		lines[i] = strings.TrimSpace(text)
+	}
+	text := strings.Join(lines, "\n")
+	switch d := d.(type) {
+	case *VarDecl:
+		d.Comment = text
+	case *Block:
+		d.Comment = text
+	default:
+		return false
+	}
+	return true
+}
+
+func parseLayout(p *parser) ([]LayoutQualifier, error) {
+	var layout []LayoutQualifier
+	for p.is("layout") {
+		p.i++
+		toks, err := p.balanced("(", ")")
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range splitTokens(toks, ",") {
+			if len(entry) == 0 {
+				continue
+			}
+			q := LayoutQualifier{Name: entry[0].Text}
+			if len(entry) > 2 && entry[1].Text == "=" {
+				q.Value = joinTokens(entry[2:])
+			}
+			layout = append(layout, q)
+		}
+	}
+	return layout, nil
+}
+
+func parseQualifiers(p *parser) []string {
+	var qs []string
+	for p.peek().Kind == Ident && qualifiers[p.peek().Text] {
+		qs = append(qs, p.peek().Text)
+		p.i++
+	}
+	return qs
+}
+
+func parseDecl(p *parser) (Decl, error) {
+	line := p.peek().Line
+
+	if p.is("precision") {
+		p.i++
+		var d Precision
+		d.Line = line
+		var err error
+		d.Qualifier, err = p.ident()
+		if err != nil {
+			return nil, err
+		}
+		d.Type, err = p.ident()
+		if err != nil {
+			return nil, err
+		}
+		return &d, p.expect(";")
+	}
+
+	layout, err := parseLayout(p)
+	if err != nil {
+		return nil, err
+	}
+	qs := parseQualifiers(p)
+
+	if p.is(";") {
+		p.i++
+		return &VarDecl{Layout: layout, Qualifiers: qs, Line: line}, nil
+	}
+
+	if p.is("struct") {
+		p.i++
+		var s Struct
+		s.Qualifiers = qs
+		s.Line = line
+		if p.peek().Kind == Ident {
+			s.Name, _ = p.ident()
+		}
+		s.Members, err = parseMembers(p)
+		if err != nil {
+			return nil, err
+		}
+		if !p.is(";") {
+			s.Vars, err = parseVars(p)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &s, p.expect(";")
+	}
+
+	typ, err := parseType(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.is("{") {
+		var b Block
+		b.Layout = layout
+		b.Qualifiers = qs
+		b.Name = typ
+		b.Line = line
+		b.Members, err = parseMembers(p)
+		if err != nil {
+			return nil, err
+		}
+		if !p.is(";") {
+			b.Instance, err = p.ident()
+			if err != nil {
+				return nil, err
+			}
+			b.ArraySize, err = parseArraySize(p)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &b, p.expect(";")
+	}
+
+	if p.i+1 < len(p.toks) && p.toks[p.i].Kind == Ident && p.toks[p.i+1].Text == "(" {
+		var fn Func
+		fn.Return = typ
+		fn.Name, _ = p.ident()
+		fn.Line = line
+		params, err := p.balanced("(", ")")
+		if err != nil {
+			return nil, err
+		}
+		fn.Params, err = parseParams(params)
+		if err != nil {
+			return nil, err
+		}
+		if p.is(";") {
+			p.i++
+			return &fn, nil
+		}
+		fn.Body, err = p.balanced("{", "}")
+		if err != nil {
+			return nil, err
+		}
+		if fn.Body == nil {
+			fn.Body = []Token{}
+		}
+		return &fn, nil
+	}
+
+	var d VarDecl
+	d.Layout = layout
+	d.Qualifiers = qs
+	d.Type = typ
+	d.Line = line
+	d.Vars, err = parseVars(p)
+	if err != nil {
+		return nil, err
+	}
+	return &d, p.expect(";")
+}
+
+// parseType parses a type name and any array size following it, as in
+// float[4] a.
+func parseType(p *parser) (string, error) {
+	typ, err := p.ident()
+	if err != nil {
+		return "", err
+	}
+	for p.is("[") {
+		size, err := p.balanced("[", "]")
+		if err != nil {
+			return "", err
+		}
+		typ += "[" + joinTokens(size) + "]"
+	}
+	return typ, nil
+}
+
+func parseArraySize(p *parser) (*string, error) {
+	if !p.is("[") {
+		return nil, nil
+	}
+	var sizes []string
+	for p.is("[") {
+		size, err := p.balanced("[", "]")
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, joinTokens(size))
+	}
+	size := strings.Join(sizes, "][")
+	return &size, nil
+}
+
+// parseVars parses a list of variables up to, but not including, the ;.
+func parseVars(p *parser) ([]Var, error) {
+	var vars []Var
+	for {
+		var v Var
+		var err error
+		v.Name, err = p.ident()
+		if err != nil {
+			return nil, err
+		}
+		v.ArraySize, err = parseArraySize(p)
+		if err != nil {
+			return nil, err
+		}
+		if p.is("=") {
+			p.i++
+			start := p.i
+			for depth := 0; p.i < len(p.toks); p.i++ {
+				t := p.peek().Text
+				if depth == 0 && (t == "," || t == ";") {
+					break
+				}
+				switch t {
+				case "(", "[", "{":
+					depth++
+				case ")", "]", "}":
+					depth--
+				}
+			}
+			v.Init = p.toks[start:p.i]
+		}
+		vars = append(vars, v)
+		if !p.is(",") {
+			return vars, nil
+		}
+		p.i++
+	}
+}
+
+// parseMembers parses the braced member declarations of a struct or block.
+func parseMembers(p *parser) ([]*VarDecl, error) {
+	toks, err := p.balanced("{", "}")
+	if err != nil {
+		return nil, err
+	}
+	var members []*VarDecl
+	for _, m := range splitTokens(toks, ";") {
+		if len(m) == 0 {
+			continue
+		}
+		mt := make([]Token, len(m), len(m)+1)
+		copy(mt, m)
+		mp := parser{toks: append(mt, Token{Kind: Punct, Text: ";", Line: m[len(m)-1].Line})}
+		var d VarDecl
+		d.Line = m[0].Line
+		d.Layout, err = parseLayout(&mp)
+		if err != nil {
+			return nil, err
+		}
+		d.Qualifiers = parseQualifiers(&mp)
+		d.Type, err = parseType(&mp)
+		if err != nil {
+			return nil, err
+		}
+		d.Vars, err = parseVars(&mp)
+		if err != nil {
+			return nil, err
+		}
+		if err := mp.expect(";"); err != nil {
+			return nil, err
+		}
+		members = append(members, &d)
+	}
+	return members, nil
+}
+
+func parseParams(toks []Token) ([]Param, error) {
+	if len(toks) == 1 && toks[0].Text == "void" {
+		return nil, nil
+	}
+	var params []Param
+	for _, t := range splitTokens(toks, ",") {
+		if len(t) == 0 {
+			continue
+		}
+		pp := parser{toks: t}
+		var param Param
+		var err error
+		param.Qualifiers = parseQualifiers(&pp)
+		param.Type, err = parseType(&pp)
+		if err != nil {
+			return nil, err
+		}
+		if pp.i < len(pp.toks) {
+			param.Name, err = pp.ident()
+			if err != nil {
+				return nil, err
+			}
+			param.ArraySize, err = parseArraySize(&pp)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if pp.i != len(pp.toks) {
+			return nil, pp.errorf("unexpected %v", pp.peek().Text)
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// splitTokens splits toks at sep outside of brackets.
+func splitTokens(toks []Token, sep string) [][]Token {
+	var parts [][]Token
+	start, depth := 0, 0
+	for i, t := range toks {
+		if t.Kind != Punct {
+			continue
+		}
+		switch t.Text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, toks[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, toks[start:])
+}
+
+func joinTokens(toks []Token) string {
+	var b strings.Builder
+	for i, t := range toks {
+		if i > 0 && needsSpace(toks[i-1], t) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.Text)
+	}
+	return b.String()
+}
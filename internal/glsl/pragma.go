@@ -0,0 +1,115 @@
+package glsl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tweak is a uniform declared tweakable by a pragma of the form
+//
+//	#pragma shaderdev uniform TYPE NAME [MIN..MAX] [= V[,V...]] [WIDGET]
+//
+// e.g. #pragma shaderdev uniform vec3 tint 0..1 = 1,0.5,0 color. Compilers
+// ignore pragmas they don't know.
+type Tweak struct {
+	Type string
+	Name string
+	// the range of every component, if Min < Max
+	Min, Max float64
+	// the values set when nothing else sets the uniform, if any
+	Default []float64
+	// how controls present it, one of Widgets, or "" to choose by type
+	Widget string
+	Line   int
+}
+
+// Widgets are the controls a tweak may ask for.
+var Widgets = []string{"slider", "drag", "color", "toggle"}
+
+// Tweaks returns the uniforms declared tweakable by pragmas in src.
+func Tweaks(src []byte) ([]*Tweak, error) {
+	toks, err := Lex(src)
+	if err != nil {
+		return nil, err
+	}
+	var res []*Tweak
+	for _, t := range toks {
+		if t.Kind != Preproc {
+			continue
+		}
+		d := parseDirective(t)
+		f := strings.Fields(d.Args)
+		if d.Name != "pragma" || len(f) < 2 || f[0] != "shaderdev" || f[1] != "uniform" {
+			continue
+		}
+		tw, err := parseTweak(f[2:])
+		if err != nil {
+			return nil, fmt.Errorf("%v: #pragma shaderdev uniform: %v", d.Line, err)
+		}
+		tw.Line = d.Line
+		res = append(res, tw)
+	}
+	return res, nil
+}
+
+func parseTweak(f []string) (*Tweak, error) {
+	if len(f) < 2 {
+		return nil, fmt.Errorf("expected TYPE NAME")
+	}
+	tw := &Tweak{Type: f[0], Name: f[1]}
+	f = f[2:]
+
+	if len(f) > 0 && strings.Contains(f[0], "..") {
+		i := strings.Index(f[0], "..")
+		min, err1 := strconv.ParseFloat(f[0][:i], 64)
+		max, err2 := strconv.ParseFloat(f[0][i+2:], 64)
+		if err1 != nil || err2 != nil || min >= max {
+			return nil, fmt.Errorf("invalid range %v, expected MIN..MAX", f[0])
+		}
+		tw.Min, tw.Max = min, max
+		f = f[1:]
+	}
+
+	if len(f) > 0 && strings.HasPrefix(f[0], "=") {
+		// the values may be spaced, up to the widget
+		s := strings.TrimPrefix(f[0], "=")
+		f = f[1:]
+		for len(f) > 0 && !isWidget(f[0]) {
+			s += f[0]
+			f = f[1:]
+		}
+		for _, v := range strings.Split(s, ",") {
+			switch v {
+			case "true":
+				tw.Default = append(tw.Default, 1)
+			case "false":
+				tw.Default = append(tw.Default, 0)
+			default:
+				x, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid default %v", v)
+				}
+				tw.Default = append(tw.Default, x)
+			}
+		}
+	}
+
+	if len(f) > 0 && isWidget(f[0]) {
+		tw.Widget = f[0]
+		f = f[1:]
+	}
+	if len(f) > 0 {
+		return nil, fmt.Errorf("unexpected %v, expected a range, = default or one of %v", f[0], strings.Join(Widgets, ", "))
+	}
+	return tw, nil
+}
+
+func isWidget(s string) bool {
+	for _, w := range Widgets {
+		if s == w {
+			return true
+		}
+	}
+	return false
+}
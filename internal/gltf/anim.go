@@ -0,0 +1,180 @@
+package gltf
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Clip is an animation, decoded to be sampled at any time.
+type Clip struct {
+	Name string
+	// the time of the last key, in seconds
+	Duration float32
+	channels []clipChannel
+}
+
+type clipChannel struct {
+	node   int
+	path   string
+	interp string
+	times  []float32
+	// values of n components for each key, or three times that for cubic
+	// splines, as in tangent, value and out tangent
+	values []float32
+	n      int
+}
+
+// Clip decodes the animation anim.
+func (d *Doc) Clip(anim int) (*Clip, error) {
+	if anim < 0 || anim >= len(d.Animations) {
+		return nil, fmt.Errorf("animation %v does not exist", anim)
+	}
+	a := d.Animations[anim]
+	c := &Clip{Name: a.Name}
+	if c.Name == "" {
+		c.Name = fmt.Sprintf("animation%v", anim)
+	}
+
+	for i, ch := range a.Channels {
+		if ch.Target.Node == nil {
+			// targets an extension
+			continue
+		}
+		if *ch.Target.Node < 0 || *ch.Target.Node >= len(d.Nodes) {
+			return nil, fmt.Errorf("%v channel %v: node %v does not exist", c.Name, i, *ch.Target.Node)
+		}
+		if ch.Sampler < 0 || ch.Sampler >= len(a.Samplers) {
+			return nil, fmt.Errorf("%v channel %v: sampler %v does not exist", c.Name, i, ch.Sampler)
+		}
+		s := a.Samplers[ch.Sampler]
+
+		cc := clipChannel{node: *ch.Target.Node, path: ch.Target.Path, interp: s.Interpolation}
+		if cc.interp == "" {
+			cc.interp = "LINEAR"
+		}
+		switch cc.interp {
+		case "LINEAR", "STEP", "CUBICSPLINE":
+		default:
+			return nil, fmt.Errorf("%v channel %v: unknown interpolation %v", c.Name, i, cc.interp)
+		}
+
+		var err error
+		cc.times, _, err = d.Floats(s.Input)
+		if err != nil {
+			return nil, fmt.Errorf("%v channel %v: %v", c.Name, i, err)
+		}
+		cc.values, _, err = d.Floats(s.Output)
+		if err != nil {
+			return nil, fmt.Errorf("%v channel %v: %v", c.Name, i, err)
+		}
+		if len(cc.times) == 0 {
+			continue
+		}
+		keys := len(cc.times)
+		if cc.interp == "CUBICSPLINE" {
+			keys *= 3
+		}
+		if len(cc.values)%keys != 0 {
+			return nil, fmt.Errorf("%v channel %v: %v values for %v keys", c.Name, i, len(cc.values), len(cc.times))
+		}
+		cc.n = len(cc.values) / keys
+
+		want := map[string]int{"translation": 3, "rotation": 4, "scale": 3}[cc.path]
+		if cc.path != "weights" && want == 0 {
+			return nil, fmt.Errorf("%v channel %v: unknown path %v", c.Name, i, cc.path)
+		}
+		if want != 0 && cc.n != want {
+			return nil, fmt.Errorf("%v channel %v: %v components for %v", c.Name, i, cc.n, cc.path)
+		}
+
+		if t := cc.times[len(cc.times)-1]; t > c.Duration {
+			c.Duration = t
+		}
+		c.channels = append(c.channels, cc)
+	}
+	return c, nil
+}
+
+// sample returns the value of a channel at time t, clamped to its keys.
+func (cc *clipChannel) sample(t float32) []float32 {
+	keys := len(cc.times)
+	// the value of key k, or for cubic splines its in tangent, value or out
+	// tangent by part
+	at := func(k, part int) []float32 {
+		if cc.interp == "CUBICSPLINE" {
+			k = k*3 + part
+		}
+		return cc.values[k*cc.n : k*cc.n+cc.n]
+	}
+
+	k := sort.Search(keys, func(i int) bool { return cc.times[i] > t }) - 1
+	if k < 0 {
+		return at(0, 1)
+	}
+	if k >= keys-1 {
+		return at(keys-1, 1)
+	}
+	dt := cc.times[k+1] - cc.times[k]
+	u := (t - cc.times[k]) / dt
+
+	res := make([]float32, cc.n)
+	switch cc.interp {
+	case "STEP":
+		copy(res, at(k, 1))
+	case "LINEAR":
+		a, b := at(k, 1), at(k+1, 1)
+		if cc.path == "rotation" {
+			q := mgl32.QuatSlerp(quat(a), quat(b), u)
+			return []float32{q.V[0], q.V[1], q.V[2], q.W}
+		}
+		for i := range res {
+			res[i] = a[i] + (b[i]-a[i])*u
+		}
+	case "CUBICSPLINE":
+		// hermite spline, tangents scaled by the key interval
+		u2, u3 := u*u, u*u*u
+		p0, m0 := at(k, 1), at(k, 2)
+		p1, m1 := at(k+1, 1), at(k+1, 0)
+		for i := range res {
+			res[i] = (2*u3-3*u2+1)*p0[i] + (u3-2*u2+u)*dt*m0[i] + (-2*u3+3*u2)*p1[i] + (u3-u2)*dt*m1[i]
+		}
+	}
+	if cc.path == "rotation" {
+		q := quat(res).Normalize()
+		return []float32{q.V[0], q.V[1], q.V[2], q.W}
+	}
+	return res
+}
+
+func quat(v []float32) mgl32.Quat {
+	return mgl32.Quat{W: v[3], V: mgl32.Vec3{v[0], v[1], v[2]}}
+}
+
+// Apply poses the nodes the clip animates as they are at time t, in
+// seconds, leaving the others as they are.
+func (c *Clip) Apply(pose []Transform, t float32) {
+	for i := range c.channels {
+		cc := &c.channels[i]
+		if cc.node >= len(pose) {
+			continue
+		}
+		v := cc.sample(t)
+		p := &pose[cc.node]
+		switch cc.path {
+		case "translation":
+			copy(p.T[:], v)
+		case "rotation":
+			p.R = quat(v)
+		case "scale":
+			copy(p.S[:], v)
+		case "weights":
+			p.Weights = append(p.Weights[:0], v...)
+		}
+		if cc.path != "weights" {
+			// animated nodes can't have a matrix
+			p.M = nil
+		}
+	}
+}
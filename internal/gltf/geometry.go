@@ -0,0 +1,497 @@
+package gltf
+
+import (
+	"fmt"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Transform is the local transform of a node, as posed by an animation.
+type Transform struct {
+	T mgl32.Vec3
+	R mgl32.Quat
+	S mgl32.Vec3
+	// M is the transform of nodes given as a matrix, which can't be
+	// animated, or nil
+	M *mgl32.Mat4
+	// morph target weights of the node's mesh
+	Weights []float32
+}
+
+func (t Transform) Mat4() mgl32.Mat4 {
+	if t.M != nil {
+		return *t.M
+	}
+	return mgl32.Translate3D(t.T[0], t.T[1], t.T[2]).Mul4(t.R.Mat4()).Mul4(mgl32.Scale3D(t.S[0], t.S[1], t.S[2]))
+}
+
+// RestPose returns the transforms of the nodes as given by the document.
+func (d *Doc) RestPose() []Transform {
+	pose := make([]Transform, len(d.Nodes))
+	for i, n := range d.Nodes {
+		t := Transform{R: mgl32.QuatIdent(), S: mgl32.Vec3{1, 1, 1}}
+		if len(n.Matrix) == 16 {
+			var m mgl32.Mat4
+			copy(m[:], n.Matrix)
+			t.M = &m
+		}
+		if len(n.Translation) == 3 {
+			copy(t.T[:], n.Translation)
+		}
+		if len(n.Rotation) == 4 {
+			t.R = mgl32.Quat{W: n.Rotation[3], V: mgl32.Vec3{n.Rotation[0], n.Rotation[1], n.Rotation[2]}}
+		}
+		if len(n.Scale) == 3 {
+			copy(t.S[:], n.Scale)
+		}
+		t.Weights = n.Weights
+		if t.Weights == nil && n.Mesh != nil && *n.Mesh >= 0 && *n.Mesh < len(d.Meshes) {
+			t.Weights = d.Meshes[*n.Mesh].Weights
+		}
+		t.Weights = append([]float32(nil), t.Weights...)
+		pose[i] = t
+	}
+	return pose
+}
+
+// roots returns the root nodes of the default scene, or of every node
+// without a parent if there are no scenes.
+func (d *Doc) roots() []int {
+	if len(d.Scenes) > 0 {
+		s := 0
+		if d.Scene != nil && *d.Scene >= 0 && *d.Scene < len(d.Scenes) {
+			s = *d.Scene
+		}
+		return d.Scenes[s].Nodes
+	}
+
+	child := make([]bool, len(d.Nodes))
+	for _, n := range d.Nodes {
+		for _, c := range n.Children {
+			if c >= 0 && c < len(child) {
+				child[c] = true
+			}
+		}
+	}
+	var res []int
+	for i := range d.Nodes {
+		if !child[i] {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// Globals returns the global transform of every node of the default scene
+// in a pose, and the identity for nodes outside it.
+func (d *Doc) Globals(pose []Transform) []mgl32.Mat4 {
+	res := make([]mgl32.Mat4, len(d.Nodes))
+	seen := make([]bool, len(d.Nodes))
+	for i := range res {
+		res[i] = mgl32.Ident4()
+	}
+	var visit func(n int, parent mgl32.Mat4)
+	visit = func(n int, parent mgl32.Mat4) {
+		if n < 0 || n >= len(d.Nodes) || seen[n] {
+			return
+		}
+		seen[n] = true
+		res[n] = parent.Mul4(pose[n].Mat4())
+		for _, c := range d.Nodes[n].Children {
+			visit(c, res[n])
+		}
+	}
+	for _, r := range d.roots() {
+		visit(r, mgl32.Ident4())
+	}
+	return res
+}
+
+// Joint is an entry of the joint palette of a Geometry: a node and the
+// inverse of its global transform at bind time.
+type Joint struct {
+	Node        int
+	InverseBind mgl32.Mat4
+}
+
+// Part is a range of the indices of a Geometry, drawn by a node.
+type Part struct {
+	Name  string
+	First int
+	Count int
+}
+
+// Target is a morph target of a Geometry, displacing the positions and
+// normals of its vertices when blended in.
+type Target struct {
+	Name string
+	Pos  [][3]float32
+	Nor  [][3]float32
+}
+
+// Geometry is the triangles of the meshes of the default scene, with the
+// attributes of each vertex. Vertices of meshes that aren't skinned are
+// transformed into the scene at rest, while skinned vertices stay in bind
+// space for the joint matrices to place.
+type Geometry struct {
+	Pos [][3]float32
+	Nor [][3]float32
+	// nil when no mesh has them
+	Tex [][2]float32
+	Col [][4]float32
+
+	// Joints index Palette, weighted by Weights. Vertices that aren't
+	// skinned have the identity, entry 0, with weight 1. Both are nil when
+	// no mesh is skinned.
+	Joints  [][4]uint32
+	Weights [][4]float32
+	Palette []Joint
+
+	Idx   []uint32
+	Parts []Part
+
+	// Targets are the morph targets of the meshes by index, zero for the
+	// vertices of meshes with fewer. They are blended by the weights of
+	// MorphNode, the first node drawn with any, or -1.
+	Targets   []Target
+	MorphNode int
+
+	// describes what was left out, e.g. primitives other than triangles
+	Warnings []string
+}
+
+// Geometry flattens the meshes of the default scene into one.
+func (d *Doc) Geometry() (*Geometry, error) {
+	g := &Geometry{Palette: []Joint{{Node: -1, InverseBind: mgl32.Ident4()}}, MorphNode: -1}
+	hasTex, hasCol := false, false
+	// palette index of the first joint of each skin
+	skinBase := make(map[int]int)
+
+	globals := d.Globals(d.RestPose())
+	seen := make([]bool, len(d.Nodes))
+	var visit func(n int) error
+	visit = func(n int) error {
+		if n < 0 || n >= len(d.Nodes) || seen[n] {
+			return nil
+		}
+		seen[n] = true
+		node := d.Nodes[n]
+		if node.Mesh != nil {
+			if *node.Mesh < 0 || *node.Mesh >= len(d.Meshes) {
+				return fmt.Errorf("node %v: mesh %v does not exist", n, *node.Mesh)
+			}
+			mesh := d.Meshes[*node.Mesh]
+			first := len(g.Idx)
+			for i, p := range mesh.Primitives {
+				if len(p.Targets) > 0 && g.MorphNode < 0 {
+					g.MorphNode = n
+				}
+				err := d.addPrimitive(g, n, p, mesh.Extras.TargetNames, globals[n], skinBase)
+				if err != nil {
+					return fmt.Errorf("mesh %v primitive %v: %v", *node.Mesh, i, err)
+				}
+				_, tex := p.Attributes["TEXCOORD_0"]
+				_, col := p.Attributes["COLOR_0"]
+				hasTex, hasCol = hasTex || tex, hasCol || col
+			}
+			name := node.Name
+			if name == "" {
+				name = mesh.Name
+			}
+			if name == "" {
+				name = fmt.Sprintf("node%v", n)
+			}
+			g.Parts = append(g.Parts, Part{name, first, len(g.Idx) - first})
+		}
+		for _, c := range node.Children {
+			err := visit(c)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, r := range d.roots() {
+		err := visit(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !hasTex {
+		g.Tex = nil
+	}
+	if !hasCol {
+		g.Col = nil
+	}
+	if len(g.Palette) == 1 {
+		g.Joints, g.Weights, g.Palette = nil, nil, nil
+	}
+	return g, nil
+}
+
+// attribute reads the accessor of an attribute of a primitive, or of one
+// of its morph targets, as floats of n components, or returns nil if there
+// is none.
+func (d *Doc) attribute(attrs map[string]int, name string, n, count int) ([]float32, error) {
+	a, ok := attrs[name]
+	if !ok {
+		return nil, nil
+	}
+	v, have, err := d.Floats(a)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+	if have != n && !(name == "COLOR_0" && have == 3) {
+		return nil, fmt.Errorf("%v: %v components, expected %v", name, have, n)
+	}
+	if len(v) != count*have {
+		return nil, fmt.Errorf("%v: %v elements, expected %v", name, len(v)/have, count)
+	}
+	return v, nil
+}
+
+func (d *Doc) addPrimitive(g *Geometry, node int, p Primitive, targetNames []string, global mgl32.Mat4, skinBase map[int]int) error {
+	if p.Mode != nil && *p.Mode != Triangles {
+		g.Warnings = append(g.Warnings, fmt.Sprintf("node %v: primitive mode %v skipped, only triangles are drawn", node, *p.Mode))
+		return nil
+	}
+
+	a, ok := p.Attributes["POSITION"]
+	if !ok {
+		return fmt.Errorf("no POSITION")
+	}
+	pos, n, err := d.Floats(a)
+	if err != nil {
+		return fmt.Errorf("POSITION: %v", err)
+	}
+	if n != 3 {
+		return fmt.Errorf("POSITION: %v components, expected 3", n)
+	}
+	count := len(pos) / 3
+
+	nor, err := d.attribute(p.Attributes, "NORMAL", 3, count)
+	if err != nil {
+		return err
+	}
+	tex, err := d.attribute(p.Attributes, "TEXCOORD_0", 2, count)
+	if err != nil {
+		return err
+	}
+	col, err := d.attribute(p.Attributes, "COLOR_0", 4, count)
+	if err != nil {
+		return err
+	}
+	weights, err := d.attribute(p.Attributes, "WEIGHTS_0", 4, count)
+	if err != nil {
+		return err
+	}
+
+	var joints []uint32
+	skin := d.Nodes[node].Skin
+	if j, ok := p.Attributes["JOINTS_0"]; ok && skin != nil && weights != nil {
+		joints, n, err = d.Uints(j)
+		if err != nil {
+			return fmt.Errorf("JOINTS_0: %v", err)
+		}
+		if n != 4 || len(joints) != count*4 {
+			return fmt.Errorf("JOINTS_0: expected %v elements of 4 components", count)
+		}
+	}
+
+	var idx []uint32
+	if p.Indices != nil {
+		idx, _, err = d.Uints(*p.Indices)
+		if err != nil {
+			return fmt.Errorf("indices: %v", err)
+		}
+	} else {
+		for i := 0; i < count; i++ {
+			idx = append(idx, uint32(i))
+		}
+	}
+	idx = idx[:len(idx)/3*3]
+	for _, i := range idx {
+		if int(i) >= count {
+			return fmt.Errorf("index %v exceeds the %v vertices", i, count)
+		}
+	}
+
+	// displacements of positions and normals by target
+	targets := make([][2][]float32, len(p.Targets))
+	for t, attrs := range p.Targets {
+		for k, name := range []string{"POSITION", "NORMAL"} {
+			targets[t][k], err = d.attribute(attrs, name, 3, count)
+			if err != nil {
+				return fmt.Errorf("target %v: %v", t, err)
+			}
+		}
+	}
+
+	base := 0
+	if joints != nil {
+		base, err = d.addSkin(g, *skin, skinBase)
+		if err != nil {
+			return err
+		}
+	} else {
+		// skinned vertices are placed by their joints instead
+		normal := global.Mat3().Inv().Transpose()
+		for i := 0; i < count; i++ {
+			v := global.Mul4x1(mgl32.Vec4{pos[i*3], pos[i*3+1], pos[i*3+2], 1})
+			copy(pos[i*3:], v[:3])
+			if nor != nil {
+				v := normal.Mul3x1(mgl32.Vec3{nor[i*3], nor[i*3+1], nor[i*3+2]}).Normalize()
+				copy(nor[i*3:], v[:])
+			}
+			for _, t := range targets {
+				if d := t[0]; d != nil {
+					v := global.Mat3().Mul3x1(mgl32.Vec3{d[i*3], d[i*3+1], d[i*3+2]})
+					copy(d[i*3:], v[:])
+				}
+				if d := t[1]; d != nil {
+					v := normal.Mul3x1(mgl32.Vec3{d[i*3], d[i*3+1], d[i*3+2]})
+					copy(d[i*3:], v[:])
+				}
+			}
+		}
+	}
+	if nor == nil {
+		nor = smoothNormals(pos, idx)
+	}
+
+	offset := uint32(len(g.Pos))
+	for i := 0; i < count; i++ {
+		g.Pos = append(g.Pos, [3]float32{pos[i*3], pos[i*3+1], pos[i*3+2]})
+		g.Nor = append(g.Nor, [3]float32{nor[i*3], nor[i*3+1], nor[i*3+2]})
+
+		var t [2]float32
+		if tex != nil {
+			t = [2]float32{tex[i*2], tex[i*2+1]}
+		}
+		g.Tex = append(g.Tex, t)
+
+		c := [4]float32{1, 1, 1, 1}
+		if n := len(col) / count; n > 0 {
+			copy(c[:], col[i*n:i*n+n])
+		}
+		g.Col = append(g.Col, c)
+
+		j, w := [4]uint32{}, [4]float32{1, 0, 0, 0}
+		if joints != nil {
+			for k := 0; k < 4; k++ {
+				j[k] = uint32(base) + joints[i*4+k]
+				w[k] = weights[i*4+k]
+			}
+		}
+		g.Joints = append(g.Joints, j)
+		g.Weights = append(g.Weights, w)
+	}
+	addTargets(g, count, targets, targetNames)
+	for _, i := range idx {
+		g.Idx = append(g.Idx, offset+i)
+	}
+	return nil
+}
+
+// addTargets appends the displacements of the last count vertices of g to
+// its morph targets, adding any the primitive has more of.
+func addTargets(g *Geometry, count int, targets [][2][]float32, names []string) {
+	before := len(g.Pos) - count
+	for len(g.Targets) < len(targets) {
+		g.Targets = append(g.Targets, Target{Pos: make([][3]float32, before), Nor: make([][3]float32, before)})
+	}
+	for i := range g.Targets {
+		t := &g.Targets[i]
+		if t.Name == "" && i < len(names) {
+			t.Name = names[i]
+		}
+		for v := 0; v < count; v++ {
+			var p, n [3]float32
+			if i < len(targets) && targets[i][0] != nil {
+				copy(p[:], targets[i][0][v*3:])
+			}
+			if i < len(targets) && targets[i][1] != nil {
+				copy(n[:], targets[i][1][v*3:])
+			}
+			t.Pos = append(t.Pos, p)
+			t.Nor = append(t.Nor, n)
+		}
+	}
+}
+
+// addSkin adds the joints of a skin to the palette the first time it's
+// used, returning the index of its first joint.
+func (d *Doc) addSkin(g *Geometry, skin int, skinBase map[int]int) (int, error) {
+	if base, ok := skinBase[skin]; ok {
+		return base, nil
+	}
+	if skin < 0 || skin >= len(d.Skins) {
+		return 0, fmt.Errorf("skin %v does not exist", skin)
+	}
+	s := d.Skins[skin]
+
+	var ibm []float32
+	if s.InverseBindMatrices != nil {
+		var err error
+		ibm, _, err = d.Floats(*s.InverseBindMatrices)
+		if err != nil {
+			return 0, fmt.Errorf("skin %v: %v", skin, err)
+		}
+		if len(ibm) != len(s.Joints)*16 {
+			return 0, fmt.Errorf("skin %v: %v inverse bind matrices for %v joints", skin, len(ibm)/16, len(s.Joints))
+		}
+	}
+
+	base := len(g.Palette)
+	for i, n := range s.Joints {
+		if n < 0 || n >= len(d.Nodes) {
+			return 0, fmt.Errorf("skin %v: joint node %v does not exist", skin, n)
+		}
+		j := Joint{Node: n, InverseBind: mgl32.Ident4()}
+		if ibm != nil {
+			copy(j.InverseBind[:], ibm[i*16:])
+		}
+		g.Palette = append(g.Palette, j)
+	}
+	skinBase[skin] = base
+	return base, nil
+}
+
+// smoothNormals averages the normals of the triangles around each vertex.
+func smoothNormals(pos []float32, idx []uint32) []float32 {
+	nor := make([]float32, len(pos))
+	at := func(i uint32) mgl32.Vec3 { return mgl32.Vec3{pos[i*3], pos[i*3+1], pos[i*3+2]} }
+	for t := 0; t+2 < len(idx); t += 3 {
+		a, b, c := at(idx[t]), at(idx[t+1]), at(idx[t+2])
+		// weighted by area
+		n := b.Sub(a).Cross(c.Sub(a))
+		for _, i := range idx[t : t+3] {
+			for k := 0; k < 3; k++ {
+				nor[int(i)*3+k] += n[k]
+			}
+		}
+	}
+	for i := 0; i+2 < len(nor); i += 3 {
+		n := mgl32.Vec3{nor[i], nor[i+1], nor[i+2]}
+		if l := n.Len(); l > 0 {
+			n = n.Mul(1 / l)
+		}
+		copy(nor[i:], n[:])
+	}
+	return nor
+}
+
+// JointMatrices returns the matrices of the palette of g in a pose, given
+// by Globals, for skinned vertices to be multiplied by.
+func (d *Doc) JointMatrices(g *Geometry, globals []mgl32.Mat4) []mgl32.Mat4 {
+	res := make([]mgl32.Mat4, len(g.Palette))
+	for i, j := range g.Palette {
+		if j.Node < 0 {
+			res[i] = mgl32.Ident4()
+			continue
+		}
+		res[i] = globals[j.Node].Mul4(j.InverseBind)
+	}
+	return res
+}
@@ -0,0 +1,396 @@
+// Package gltf loads the meshes, skins and animations of glTF 2.0 files,
+// both .gltf with external or embedded buffers and binary .glb.
+//
+// Materials, cameras, lights, sparse accessors and extensions are not read.
+package gltf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+type Doc struct {
+	Accessors   []Accessor   `json:"accessors"`
+	BufferViews []BufferView `json:"bufferViews"`
+	Buffers     []Buffer     `json:"buffers"`
+	Meshes      []Mesh       `json:"meshes"`
+	Nodes       []Node       `json:"nodes"`
+	Skins       []Skin       `json:"skins"`
+	Animations  []Animation  `json:"animations"`
+	Scenes      []Scene      `json:"scenes"`
+	Scene       *int         `json:"scene"`
+
+	// Files are the external buffers the document was loaded from.
+	Files []string `json:"-"`
+
+	// the contents of each buffer
+	data [][]byte
+}
+
+type Accessor struct {
+	BufferView    *int   `json:"bufferView"`
+	ByteOffset    int    `json:"byteOffset"`
+	ComponentType int    `json:"componentType"`
+	Normalized    bool   `json:"normalized"`
+	Count         int    `json:"count"`
+	Type          string `json:"type"`
+}
+
+type BufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+type Buffer struct {
+	URI        string `json:"uri"`
+	ByteLength int    `json:"byteLength"`
+}
+
+type Mesh struct {
+	Name       string      `json:"name"`
+	Primitives []Primitive `json:"primitives"`
+	// default morph target weights
+	Weights []float32 `json:"weights"`
+	Extras  struct {
+		// names of the morph targets, by the convention of most exporters
+		TargetNames []string `json:"targetNames"`
+	} `json:"extras"`
+}
+
+// Primitive modes
+const (
+	Points    = 0
+	Lines     = 1
+	Triangles = 4
+)
+
+type Primitive struct {
+	// accessors by attribute name, e.g. POSITION
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices"`
+	Mode       *int           `json:"mode"`
+	// morph targets, accessors of attribute displacements by name
+	Targets []map[string]int `json:"targets"`
+}
+
+type Node struct {
+	Name     string `json:"name"`
+	Children []int  `json:"children"`
+	Mesh     *int   `json:"mesh"`
+	Skin     *int   `json:"skin"`
+	// either a column major matrix or translation, rotation (a quaternion
+	// x, y, z, w) and scale, each defaulting to identity
+	Matrix      []float32 `json:"matrix"`
+	Translation []float32 `json:"translation"`
+	Rotation    []float32 `json:"rotation"`
+	Scale       []float32 `json:"scale"`
+	Weights     []float32 `json:"weights"`
+}
+
+type Skin struct {
+	Name                string `json:"name"`
+	InverseBindMatrices *int   `json:"inverseBindMatrices"`
+	Joints              []int  `json:"joints"`
+}
+
+type Animation struct {
+	Name     string             `json:"name"`
+	Channels []Channel          `json:"channels"`
+	Samplers []AnimationSampler `json:"samplers"`
+}
+
+type Channel struct {
+	Sampler int `json:"sampler"`
+	Target  struct {
+		Node *int `json:"node"`
+		// translation, rotation, scale or weights
+		Path string `json:"path"`
+	} `json:"target"`
+}
+
+type AnimationSampler struct {
+	// accessors of the key times and values
+	Input  int `json:"input"`
+	Output int `json:"output"`
+	// LINEAR, STEP or CUBICSPLINE, defaulting to LINEAR
+	Interpolation string `json:"interpolation"`
+}
+
+type Scene struct {
+	Name  string `json:"name"`
+	Nodes []int  `json:"nodes"`
+}
+
+// Load reads a .gltf or .glb file and the buffers it refers to.
+func Load(path string) (*Doc, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var bin []byte
+	if bytes.HasPrefix(b, []byte("glTF")) {
+		b, bin, err = splitGLB(b)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+	}
+
+	d, err := Decode(b, bin, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return d, nil
+}
+
+// splitGLB returns the JSON and binary chunks of a .glb.
+func splitGLB(b []byte) ([]byte, []byte, error) {
+	if len(b) < 20 {
+		return nil, nil, fmt.Errorf("truncated glb header")
+	}
+	if v := binary.LittleEndian.Uint32(b[4:]); v != 2 {
+		return nil, nil, fmt.Errorf("glb version %v, expected 2", v)
+	}
+	if n := binary.LittleEndian.Uint32(b[8:]); int(n) < len(b) {
+		b = b[:n]
+	}
+
+	var js, bin []byte
+	for p := 12; p+8 <= len(b); {
+		n := int(binary.LittleEndian.Uint32(b[p:]))
+		kind := string(b[p+4 : p+8])
+		p += 8
+		if p+n > len(b) {
+			return nil, nil, fmt.Errorf("truncated glb chunk %q", kind)
+		}
+		switch kind {
+		case "JSON":
+			js = b[p : p+n]
+		case "BIN\x00":
+			bin = b[p : p+n]
+		}
+		p += n
+	}
+	if js == nil {
+		return nil, nil, fmt.Errorf("glb without a JSON chunk")
+	}
+	return js, bin, nil
+}
+
+// Decode decodes a document from its JSON, with the binary chunk of a .glb
+// if any, reading external buffers relative to dir.
+func Decode(js, bin []byte, dir string) (*Doc, error) {
+	var d Doc
+	err := json.Unmarshal(js, &d)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, buf := range d.Buffers {
+		var b []byte
+		switch {
+		case buf.URI == "":
+			if i != 0 || bin == nil {
+				return nil, fmt.Errorf("buffer %v: no uri and no glb binary chunk", i)
+			}
+			b = bin
+		case strings.HasPrefix(buf.URI, "data:"):
+			j := strings.Index(buf.URI, ";base64,")
+			if j < 0 {
+				return nil, fmt.Errorf("buffer %v: data uri is not base64", i)
+			}
+			b, err = base64.StdEncoding.DecodeString(buf.URI[j+len(";base64,"):])
+			if err != nil {
+				return nil, fmt.Errorf("buffer %v: %v", i, err)
+			}
+		default:
+			path := filepath.Join(dir, filepath.FromSlash(buf.URI))
+			b, err = ioutil.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("buffer %v: %v", i, err)
+			}
+			d.Files = append(d.Files, path)
+		}
+		if len(b) < buf.ByteLength {
+			return nil, fmt.Errorf("buffer %v: %v bytes, expected %v", i, len(b), buf.ByteLength)
+		}
+		d.data = append(d.data, b)
+	}
+
+	return &d, nil
+}
+
+var typeComponents = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+	"MAT2":   4,
+	"MAT3":   9,
+	"MAT4":   16,
+}
+
+// component types
+const (
+	byteType   = 5120
+	ubyteType  = 5121
+	shortType  = 5122
+	ushortType = 5123
+	uintType   = 5125
+	floatType  = 5126
+)
+
+var componentSizes = map[int]int{
+	byteType:   1,
+	ubyteType:  1,
+	shortType:  2,
+	ushortType: 2,
+	uintType:   4,
+	floatType:  4,
+}
+
+// read calls f with each component of an accessor, as the bytes it's
+// stored in, returning the number of components per element.
+func (d *Doc) read(a int, f func(i int, b []byte)) (int, error) {
+	if a < 0 || a >= len(d.Accessors) {
+		return 0, fmt.Errorf("accessor %v does not exist", a)
+	}
+	acc := d.Accessors[a]
+	n, ok := typeComponents[acc.Type]
+	if !ok {
+		return 0, fmt.Errorf("accessor %v: unknown type %v", a, acc.Type)
+	}
+	size, ok := componentSizes[acc.ComponentType]
+	if !ok {
+		return 0, fmt.Errorf("accessor %v: unknown component type %v", a, acc.ComponentType)
+	}
+	if acc.BufferView == nil {
+		// all zeros
+		zero := make([]byte, size)
+		for i := 0; i < acc.Count*n; i++ {
+			f(i, zero)
+		}
+		return n, nil
+	}
+
+	if *acc.BufferView < 0 || *acc.BufferView >= len(d.BufferViews) {
+		return 0, fmt.Errorf("accessor %v: buffer view %v does not exist", a, *acc.BufferView)
+	}
+	view := d.BufferViews[*acc.BufferView]
+	if view.Buffer < 0 || view.Buffer >= len(d.data) {
+		return 0, fmt.Errorf("accessor %v: buffer %v does not exist", a, view.Buffer)
+	}
+	buf := d.data[view.Buffer]
+	if view.ByteOffset+view.ByteLength > len(buf) {
+		return 0, fmt.Errorf("accessor %v: buffer view %v exceeds its buffer", a, *acc.BufferView)
+	}
+	buf = buf[view.ByteOffset : view.ByteOffset+view.ByteLength]
+
+	stride := view.ByteStride
+	if stride == 0 {
+		stride = n * size
+	}
+	// columns of matrices of small components are padded to 4 bytes
+	rows, cols := n, 1
+	if acc.Type == "MAT2" || acc.Type == "MAT3" {
+		rows = int(math.Sqrt(float64(n)))
+		cols = rows
+	}
+	colStride := rows * size
+	if cols > 1 && colStride%4 != 0 {
+		colStride += 4 - colStride%4
+	}
+
+	if acc.Count > 0 {
+		end := acc.ByteOffset + (acc.Count-1)*stride + (cols-1)*colStride + rows*size
+		if end > len(buf) {
+			return 0, fmt.Errorf("accessor %v exceeds its buffer view", a)
+		}
+	}
+	for i := 0; i < acc.Count; i++ {
+		for c := 0; c < cols; c++ {
+			for r := 0; r < rows; r++ {
+				p := acc.ByteOffset + i*stride + c*colStride + r*size
+				f(i*n+c*rows+r, buf[p:p+size])
+			}
+		}
+	}
+	return n, nil
+}
+
+// Floats returns the elements of an accessor as floats, converting
+// normalized integers to [0, 1] or [-1, 1], and the number of components
+// of each.
+func (d *Doc) Floats(a int) ([]float32, int, error) {
+	if a < 0 || a >= len(d.Accessors) {
+		return nil, 0, fmt.Errorf("accessor %v does not exist", a)
+	}
+	acc := d.Accessors[a]
+	res := make([]float32, acc.Count*typeComponents[acc.Type])
+	n, err := d.read(a, func(i int, b []byte) {
+		var v float32
+		switch acc.ComponentType {
+		case floatType:
+			v = math.Float32frombits(binary.LittleEndian.Uint32(b))
+		case byteType:
+			v = float32(int8(b[0]))
+			if acc.Normalized {
+				v = float32(math.Max(float64(v)/127, -1))
+			}
+		case ubyteType:
+			v = float32(b[0])
+			if acc.Normalized {
+				v /= 255
+			}
+		case shortType:
+			v = float32(int16(binary.LittleEndian.Uint16(b)))
+			if acc.Normalized {
+				v = float32(math.Max(float64(v)/32767, -1))
+			}
+		case ushortType:
+			v = float32(binary.LittleEndian.Uint16(b))
+			if acc.Normalized {
+				v /= 65535
+			}
+		case uintType:
+			v = float32(binary.LittleEndian.Uint32(b))
+		}
+		res[i] = v
+	})
+	return res, n, err
+}
+
+// Uints returns the elements of an accessor of unsigned integers, e.g.
+// indices or joints, and the number of components of each.
+func (d *Doc) Uints(a int) ([]uint32, int, error) {
+	if a < 0 || a >= len(d.Accessors) {
+		return nil, 0, fmt.Errorf("accessor %v does not exist", a)
+	}
+	acc := d.Accessors[a]
+	switch acc.ComponentType {
+	case ubyteType, ushortType, uintType:
+	default:
+		return nil, 0, fmt.Errorf("accessor %v: component type %v is not an unsigned integer", a, acc.ComponentType)
+	}
+	res := make([]uint32, acc.Count*typeComponents[acc.Type])
+	n, err := d.read(a, func(i int, b []byte) {
+		switch len(b) {
+		case 1:
+			res[i] = uint32(b[0])
+		case 2:
+			res[i] = uint32(binary.LittleEndian.Uint16(b))
+		case 4:
+			res[i] = binary.LittleEndian.Uint32(b)
+		}
+	})
+	return res, n, err
+}
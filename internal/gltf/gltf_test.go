@@ -0,0 +1,293 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// testDoc returns a triangle skinned to two joints, the second a child of
+// the first raised by 1, and an animation turning the second a quarter turn
+// about z while stepping the first along x.
+func testDoc(t *testing.T, glb bool) *Doc {
+	var buf bytes.Buffer
+	put := func(v ...interface{}) int {
+		off := buf.Len()
+		for _, x := range v {
+			binary.Write(&buf, binary.LittleEndian, x)
+		}
+		return off
+	}
+	pos := put([]float32{0, 0, 0, 1, 0, 0, 0, 2, 0})
+	joints := put([]uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0})
+	weights := put([]float32{1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0})
+	idx := put([]uint16{0, 1, 2, 0})
+	// the inverse of the joints' bind transforms
+	ibm := put(mgl32.Ident4(), mgl32.Translate3D(0, -1, 0))
+	times := put([]float32{0, 1})
+	s := float32(math.Sqrt2 / 2)
+	rots := put([]float32{0, 0, 0, 1, 0, 0, s, s})
+	moves := put([]float32{0, 0, 0, 5, 0, 0})
+
+	uri := `"data:application/octet-stream;base64,` + base64.StdEncoding.EncodeToString(buf.Bytes()) + `"`
+	if glb {
+		uri = `""`
+	}
+	js := fmt.Sprintf(`{
+		"buffers": [{"uri": %v, "byteLength": %v}],
+		"bufferViews": [
+			{"buffer": 0, "byteOffset": %v, "byteLength": 36},
+			{"buffer": 0, "byteOffset": %v, "byteLength": 12},
+			{"buffer": 0, "byteOffset": %v, "byteLength": 48},
+			{"buffer": 0, "byteOffset": %v, "byteLength": 6},
+			{"buffer": 0, "byteOffset": %v, "byteLength": 128},
+			{"buffer": 0, "byteOffset": %v, "byteLength": 8},
+			{"buffer": 0, "byteOffset": %v, "byteLength": 32},
+			{"buffer": 0, "byteOffset": %v, "byteLength": 24}
+		],
+		"accessors": [
+			{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"},
+			{"bufferView": 1, "componentType": 5121, "count": 3, "type": "VEC4"},
+			{"bufferView": 2, "componentType": 5126, "count": 3, "type": "VEC4"},
+			{"bufferView": 3, "componentType": 5123, "count": 3, "type": "SCALAR"},
+			{"bufferView": 4, "componentType": 5126, "count": 2, "type": "MAT4"},
+			{"bufferView": 5, "componentType": 5126, "count": 2, "type": "SCALAR"},
+			{"bufferView": 6, "componentType": 5126, "count": 2, "type": "VEC4"},
+			{"bufferView": 7, "componentType": 5126, "count": 2, "type": "VEC3"}
+		],
+		"meshes": [{"name": "tri", "primitives": [
+			{"attributes": {"POSITION": 0, "JOINTS_0": 1, "WEIGHTS_0": 2}, "indices": 3},
+			{"attributes": {"POSITION": 0}, "mode": 1}
+		]}],
+		"skins": [{"inverseBindMatrices": 4, "joints": [1, 2]}],
+		"nodes": [
+			{"mesh": 0, "skin": 0},
+			{"name": "root", "children": [2]},
+			{"name": "tip", "translation": [0, 1, 0]}
+		],
+		"scenes": [{"nodes": [0, 1]}],
+		"animations": [{"name": "bend",
+			"samplers": [
+				{"input": 5, "output": 6},
+				{"input": 5, "output": 7, "interpolation": "STEP"}
+			],
+			"channels": [
+				{"sampler": 0, "target": {"node": 2, "path": "rotation"}},
+				{"sampler": 1, "target": {"node": 1, "path": "translation"}}
+			]
+		}]
+	}`, uri, buf.Len(), pos, joints, weights, idx, ibm, times, rots, moves)
+
+	if !glb {
+		d, err := Decode([]byte(js), nil, ".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	var b bytes.Buffer
+	chunk := func(kind string, data []byte, pad byte) {
+		for len(data)%4 != 0 {
+			data = append(data, pad)
+		}
+		binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+		b.WriteString(kind)
+		b.Write(data)
+	}
+	chunk("JSON", []byte(js), ' ')
+	chunk("BIN\x00", buf.Bytes(), 0)
+	var file bytes.Buffer
+	file.WriteString("glTF")
+	binary.Write(&file, binary.LittleEndian, []uint32{2, uint32(12 + b.Len())})
+	file.Write(b.Bytes())
+
+	js2, bin, err := splitGLB(file.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Decode(js2, bin, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func near(a, b []float32) bool {
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > 1e-5 {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+// skin returns where vertex i of g ends up in pose.
+func skin(d *Doc, g *Geometry, pose []Transform, i int) mgl32.Vec3 {
+	m := d.JointMatrices(g, d.Globals(pose))
+	var res mgl32.Vec4
+	p := g.Pos[i]
+	for k := 0; k < 4; k++ {
+		v := m[g.Joints[i][k]].Mul4x1(mgl32.Vec4{p[0], p[1], p[2], 1})
+		res = res.Add(v.Mul(g.Weights[i][k]))
+	}
+	return res.Vec3()
+}
+
+func TestGeometry(t *testing.T) {
+	for _, glb := range []bool{false, true} {
+		d := testDoc(t, glb)
+		g, err := d.Geometry()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(g.Pos) != 3 || len(g.Idx) != 3 {
+			t.Fatalf("glb %v: %v vertices, %v indices, expected 3 and 3", glb, len(g.Pos), len(g.Idx))
+		}
+		if len(g.Warnings) != 1 {
+			t.Errorf("glb %v: expected a warning for the lines, got %v", glb, g.Warnings)
+		}
+		if g.Tex != nil || g.Col != nil {
+			t.Errorf("glb %v: expected no texcoords or colors", glb)
+		}
+		// generated, facing z
+		if !near(g.Nor[0][:], []float32{0, 0, 1}) {
+			t.Errorf("glb %v: normal %v, expected 0 0 1", glb, g.Nor[0])
+		}
+		if len(g.Palette) != 3 || g.Palette[1].Node != 1 || g.Palette[2].Node != 2 {
+			t.Errorf("glb %v: palette %+v", glb, g.Palette)
+		}
+		if g.Joints[2] != [4]uint32{2, 1, 1, 1} {
+			t.Errorf("glb %v: joints %v, expected offset past the identity", glb, g.Joints[2])
+		}
+		if len(g.Parts) != 1 || g.Parts[0] != (Part{"tri", 0, 3}) {
+			t.Errorf("glb %v: parts %+v", glb, g.Parts)
+		}
+
+		// at rest the joint matrices undo the bind transforms
+		for i, want := range [][]float32{{0, 0, 0}, {1, 0, 0}, {0, 2, 0}} {
+			if v := skin(d, g, d.RestPose(), i); !near(v[:], want) {
+				t.Errorf("glb %v: vertex %v at rest is %v, expected %v", glb, i, v, want)
+			}
+		}
+	}
+}
+
+func TestClip(t *testing.T) {
+	d := testDoc(t, false)
+	g, err := d.Geometry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := d.Clip(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "bend" || c.Duration != 1 {
+		t.Errorf("clip %v lasting %v, expected bend lasting 1", c.Name, c.Duration)
+	}
+
+	cases := []struct {
+		time float32
+		tip  []float32
+	}{
+		// turned about the tip joint at 0 1 0, and not yet stepped
+		{0, []float32{0, 2, 0}},
+		{0.5, []float32{-float32(math.Sqrt2) / 2, 1 + float32(math.Sqrt2)/2, 0}},
+		// stepped along x at the last key, and clamped past it
+		{1, []float32{4, 1, 0}},
+		{2, []float32{4, 1, 0}},
+	}
+	for _, k := range cases {
+		pose := d.RestPose()
+		c.Apply(pose, k.time)
+		if v := skin(d, g, pose, 2); !near(v[:], k.tip) {
+			t.Errorf("at %v the tip is %v, expected %v", k.time, v, k.tip)
+		}
+	}
+}
+
+func TestCubicSpline(t *testing.T) {
+	cc := clipChannel{path: "translation", interp: "CUBICSPLINE", n: 1,
+		times: []float32{0, 2},
+		// in tangent, value and out tangent for each key
+		values: []float32{0, 0, 1, 1, 2, 0},
+	}
+	for _, k := range []struct{ time, want float32 }{{0, 0}, {1, 1}, {2, 2}} {
+		if v := cc.sample(k.time); !near(v, []float32{k.want}) {
+			t.Errorf("at %v: %v, expected %v", k.time, v, k.want)
+		}
+	}
+}
+
+func TestMorphTargets(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []float32{
+		// positions
+		0, 0, 0, 1, 0, 0, 0, 1, 0,
+		// displacements of the first vertex
+		0, 0, 1, 0, 0, 0, 0, 0, 0,
+		// key times and weights
+		0, 1, 0, 1,
+	})
+	js := fmt.Sprintf(`{
+		"buffers": [{"uri": "data:application/octet-stream;base64,%v", "byteLength": %v}],
+		"bufferViews": [
+			{"buffer": 0, "byteOffset": 0, "byteLength": 36},
+			{"buffer": 0, "byteOffset": 36, "byteLength": 36},
+			{"buffer": 0, "byteOffset": 72, "byteLength": 8},
+			{"buffer": 0, "byteOffset": 80, "byteLength": 8}
+		],
+		"accessors": [
+			{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"},
+			{"bufferView": 1, "componentType": 5126, "count": 3, "type": "VEC3"},
+			{"bufferView": 2, "componentType": 5126, "count": 2, "type": "SCALAR"},
+			{"bufferView": 3, "componentType": 5126, "count": 2, "type": "SCALAR"}
+		],
+		"meshes": [
+			{"primitives": [{"attributes": {"POSITION": 0}}]},
+			{"primitives": [{"attributes": {"POSITION": 0}, "targets": [{"POSITION": 1}]}],
+				"weights": [0.25], "extras": {"targetNames": ["raise"]}}
+		],
+		"nodes": [{"mesh": 0}, {"mesh": 1, "scale": [2, 2, 2]}],
+		"animations": [{
+			"samplers": [{"input": 2, "output": 3}],
+			"channels": [{"sampler": 0, "target": {"node": 1, "path": "weights"}}]
+		}]
+	}`, base64.StdEncoding.EncodeToString(buf.Bytes()), buf.Len())
+	d, err := Decode([]byte(js), nil, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := d.Geometry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Targets) != 1 || g.Targets[0].Name != "raise" || g.MorphNode != 1 {
+		t.Fatalf("targets %+v of node %v, expected raise of node 1", g.Targets, g.MorphNode)
+	}
+	pos := g.Targets[0].Pos
+	if len(pos) != 6 || pos[0] != [3]float32{} || pos[3] != [3]float32{0, 0, 2} {
+		t.Errorf("displacements %v, expected zeros for the first mesh and scaled by the node", pos)
+	}
+
+	pose := d.RestPose()
+	if !near(pose[1].Weights, []float32{0.25}) {
+		t.Errorf("rest weights %v, expected the mesh's 0.25", pose[1].Weights)
+	}
+	c, err := d.Clip(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Apply(pose, 0.5)
+	if !near(pose[1].Weights, []float32{0.5}) {
+		t.Errorf("weights %v halfway, expected 0.5", pose[1].Weights)
+	}
+}
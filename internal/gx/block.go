@@ -0,0 +1,205 @@
+package gx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// BlockMember is an active member of a uniform block and where it lies in
+// the block's buffer, as its offset and the strides between the elements of
+// an array and the columns of a matrix, or its rows if row major.
+type BlockMember struct {
+	Variable
+	Offset       int32
+	ArrayStride  int32
+	MatrixStride int32
+	RowMajor     bool
+}
+
+// UniformBlock is an active uniform block of a linked program.
+type UniformBlock struct {
+	Name     string
+	Index    uint32
+	DataSize int32
+	Members  []BlockMember
+}
+
+// ActiveUniformBlocks returns the active uniform blocks of a linked
+// program, with the members of each as ActiveUniforms names them.
+func ActiveUniformBlocks(prog uint32) []UniformBlock {
+	var n, maxlen int32
+	gl.GetProgramiv(prog, gl.ACTIVE_UNIFORM_BLOCKS, &n)
+	gl.GetProgramiv(prog, gl.ACTIVE_UNIFORM_BLOCK_MAX_NAME_LENGTH, &maxlen)
+	if n == 0 {
+		return nil
+	}
+
+	blocks := make([]UniformBlock, n)
+	buf := make([]byte, maxlen)
+	for i := range blocks {
+		b := &blocks[i]
+		var length int32
+		gl.GetActiveUniformBlockName(prog, uint32(i), maxlen, &length, &buf[0])
+		b.Name = string(buf[:length])
+		b.Index = uint32(i)
+		gl.GetActiveUniformBlockiv(prog, uint32(i), gl.UNIFORM_BLOCK_DATA_SIZE, &b.DataSize)
+	}
+
+	vars := ActiveUniforms(prog)
+	if len(vars) == 0 {
+		return blocks
+	}
+	indices := make([]uint32, len(vars))
+	for i := range indices {
+		indices[i] = uint32(i)
+	}
+	query := func(pname uint32) []int32 {
+		res := make([]int32, len(vars))
+		gl.GetActiveUniformsiv(prog, int32(len(vars)), &indices[0], pname, &res[0])
+		return res
+	}
+	block := query(gl.UNIFORM_BLOCK_INDEX)
+	offset := query(gl.UNIFORM_OFFSET)
+	arrayStride := query(gl.UNIFORM_ARRAY_STRIDE)
+	matrixStride := query(gl.UNIFORM_MATRIX_STRIDE)
+	rowMajor := query(gl.UNIFORM_IS_ROW_MAJOR)
+	for i, v := range vars {
+		if block[i] < 0 || int(block[i]) >= len(blocks) {
+			continue
+		}
+		b := &blocks[block[i]]
+		b.Members = append(b.Members, BlockMember{v, offset[i], arrayStride[i], matrixStride[i], rowMajor[i] != 0})
+	}
+	return blocks
+}
+
+// MatrixShape returns the columns and rows of a matrix type, or 1 and the
+// number of components of a scalar or vector type.
+func MatrixShape(xtype uint32) (int32, int32) {
+	switch xtype {
+	case gl.FLOAT_MAT2:
+		return 2, 2
+	case gl.FLOAT_MAT3:
+		return 3, 3
+	case gl.FLOAT_MAT4:
+		return 4, 4
+	case gl.FLOAT_MAT2x3:
+		return 2, 3
+	case gl.FLOAT_MAT2x4:
+		return 2, 4
+	case gl.FLOAT_MAT3x2:
+		return 3, 2
+	case gl.FLOAT_MAT3x4:
+		return 3, 4
+	case gl.FLOAT_MAT4x2:
+		return 4, 2
+	case gl.FLOAT_MAT4x3:
+		return 4, 3
+	}
+	_, n := TypeComponents(xtype)
+	return 1, n
+}
+
+// memberOffsets calls f with the index of each of the first n components
+// of a member, elements in turn and matrices column by column, and its
+// offset in the block's buffer.
+func memberOffsets(m BlockMember, n int, f func(i, off int)) {
+	cols, rows := MatrixShape(m.Type)
+	per := int(cols * rows)
+	for i := 0; i < n; i++ {
+		e, c, r := i/per, i%per/int(rows), i%int(rows)
+		off := int(m.Offset) + e*int(m.ArrayStride)
+		switch {
+		case cols == 1:
+			off += 4 * r
+		case m.RowMajor:
+			off += r*int(m.MatrixStride) + 4*c
+		default:
+			off += c*int(m.MatrixStride) + 4*r
+		}
+		f(i, off)
+	}
+}
+
+// checkMember returns an error if values can't be those of a member of a
+// block's buffer of size bytes.
+func checkMember(m BlockMember, n, size int) error {
+	base, per := TypeComponents(m.Type)
+	if per == 0 || base == gl.DOUBLE {
+		return fmt.Errorf("%v: cannot set %v uniforms", m.Name, TypeStr(m.Type))
+	}
+	if n == 0 || n%int(per) != 0 {
+		return fmt.Errorf("%v: %v needs a multiple of %v values, have %v", m.Name, TypeStr(m.Type), per, n)
+	}
+	if n/int(per) > int(m.Size) {
+		return fmt.Errorf("%v: %v values, more than the %v elements hold", m.Name, n, m.Size)
+	}
+	end := 0
+	memberOffsets(m, n, func(i, off int) {
+		if off+4 > end {
+			end = off + 4
+		}
+	})
+	if end > size {
+		return fmt.Errorf("%v: ends at byte %v of a block of %v", m.Name, end, size)
+	}
+	return nil
+}
+
+// PackUniform writes values into the buffer of a uniform block where a
+// member lies, filling as many elements of an array as the values cover,
+// with matrices given column by column. The strides lay the values out by
+// the block's layout, e.g. std140 pads vec3 array elements and the columns
+// of a mat3 to 16 bytes.
+func PackUniform(buf []byte, m BlockMember, vals []float64) error {
+	err := checkMember(m, len(vals), len(buf))
+	if err != nil {
+		return err
+	}
+	base, _ := TypeComponents(m.Type)
+	memberOffsets(m, len(vals), func(i, off int) {
+		var bits uint32
+		switch base {
+		case gl.FLOAT:
+			bits = math.Float32bits(float32(vals[i]))
+		case gl.UNSIGNED_INT:
+			bits = uint32(vals[i])
+		case gl.BOOL:
+			if vals[i] != 0 {
+				bits = 1
+			}
+		default:
+			bits = uint32(int32(vals[i]))
+		}
+		binary.LittleEndian.PutUint32(buf[off:], bits)
+	})
+	return nil
+}
+
+// UnpackUniform reads every element of a member from the buffer of a
+// uniform block, the inverse of PackUniform.
+func UnpackUniform(buf []byte, m BlockMember) ([]float64, error) {
+	_, per := TypeComponents(m.Type)
+	n := int(per * m.Size)
+	err := checkMember(m, n, len(buf))
+	if err != nil {
+		return nil, err
+	}
+	base, _ := TypeComponents(m.Type)
+	vals := make([]float64, n)
+	memberOffsets(m, n, func(i, off int) {
+		bits := binary.LittleEndian.Uint32(buf[off:])
+		switch base {
+		case gl.FLOAT:
+			vals[i] = float64(math.Float32frombits(bits))
+		case gl.UNSIGNED_INT:
+			vals[i] = float64(bits)
+		default:
+			vals[i] = float64(int32(bits))
+		}
+	})
+	return vals, nil
+}
@@ -0,0 +1,43 @@
+package gx
+
+import (
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// debugLabels is whether the context has KHR_debug, core since 4.3, which
+// labels and debug groups need.
+var debugLabels bool
+
+// EnableDebug turns Label, PushGroup and PopGroup on, for contexts with
+// KHR_debug, or off, making them do nothing.
+func EnableDebug(on bool) {
+	debugLabels = on
+}
+
+// Label names an object in debug messages and in captures, e.g. those of
+// RenderDoc or apitrace. kind is an identifier of glObjectLabel, e.g.
+// gl.TEXTURE. Names from the Gen functions only become objects once bound,
+// so those must be bound before they are labeled.
+func Label(kind, id uint32, name string) {
+	if !debugLabels || id == 0 {
+		return
+	}
+	gl.ObjectLabel(kind, id, int32(len(name)), gl.Str(name+"\x00"))
+}
+
+// PushGroup starts a debug group, nesting the commands up to the matching
+// PopGroup under name in captures.
+func PushGroup(name string) {
+	if !debugLabels {
+		return
+	}
+	gl.PushDebugGroup(gl.DEBUG_SOURCE_APPLICATION, 0, int32(len(name)), gl.Str(name+"\x00"))
+}
+
+// PopGroup ends the debug group started last.
+func PopGroup() {
+	if !debugLabels {
+		return
+	}
+	gl.PopDebugGroup()
+}
@@ -19,6 +19,10 @@ var LogProc = gl.DebugProc(
 		message string,
 		userParam unsafe.Pointer,
 	) {
+		// every debug group announces itself
+		if gltype == gl.DEBUG_TYPE_PUSH_GROUP || gltype == gl.DEBUG_TYPE_POP_GROUP {
+			return
+		}
 		log.Println(message)
 	},
 )
@@ -76,6 +80,193 @@ func StageEnum(stage uint32) string {
 	}
 }
 
+func TypeStr(xtype uint32) string {
+	switch xtype {
+	case gl.FLOAT:
+		return "float"
+	case gl.FLOAT_VEC2:
+		return "vec2"
+	case gl.FLOAT_VEC3:
+		return "vec3"
+	case gl.FLOAT_VEC4:
+		return "vec4"
+	case gl.DOUBLE:
+		return "double"
+	case gl.DOUBLE_VEC2:
+		return "dvec2"
+	case gl.DOUBLE_VEC3:
+		return "dvec3"
+	case gl.DOUBLE_VEC4:
+		return "dvec4"
+	case gl.INT:
+		return "int"
+	case gl.INT_VEC2:
+		return "ivec2"
+	case gl.INT_VEC3:
+		return "ivec3"
+	case gl.INT_VEC4:
+		return "ivec4"
+	case gl.UNSIGNED_INT:
+		return "uint"
+	case gl.UNSIGNED_INT_VEC2:
+		return "uvec2"
+	case gl.UNSIGNED_INT_VEC3:
+		return "uvec3"
+	case gl.UNSIGNED_INT_VEC4:
+		return "uvec4"
+	case gl.BOOL:
+		return "bool"
+	case gl.BOOL_VEC2:
+		return "bvec2"
+	case gl.BOOL_VEC3:
+		return "bvec3"
+	case gl.BOOL_VEC4:
+		return "bvec4"
+	case gl.FLOAT_MAT2:
+		return "mat2"
+	case gl.FLOAT_MAT3:
+		return "mat3"
+	case gl.FLOAT_MAT4:
+		return "mat4"
+	case gl.FLOAT_MAT2x3:
+		return "mat2x3"
+	case gl.FLOAT_MAT2x4:
+		return "mat2x4"
+	case gl.FLOAT_MAT3x2:
+		return "mat3x2"
+	case gl.FLOAT_MAT3x4:
+		return "mat3x4"
+	case gl.FLOAT_MAT4x2:
+		return "mat4x2"
+	case gl.FLOAT_MAT4x3:
+		return "mat4x3"
+	case gl.SAMPLER_1D:
+		return "sampler1D"
+	case gl.SAMPLER_2D:
+		return "sampler2D"
+	case gl.SAMPLER_3D:
+		return "sampler3D"
+	case gl.SAMPLER_CUBE:
+		return "samplerCube"
+	case gl.SAMPLER_1D_SHADOW:
+		return "sampler1DShadow"
+	case gl.SAMPLER_2D_SHADOW:
+		return "sampler2DShadow"
+	case gl.SAMPLER_1D_ARRAY:
+		return "sampler1DArray"
+	case gl.SAMPLER_2D_ARRAY:
+		return "sampler2DArray"
+	case gl.SAMPLER_2D_MULTISAMPLE:
+		return "sampler2DMS"
+	case gl.SAMPLER_BUFFER:
+		return "samplerBuffer"
+	case gl.SAMPLER_2D_RECT:
+		return "sampler2DRect"
+	case gl.INT_SAMPLER_2D:
+		return "isampler2D"
+	case gl.UNSIGNED_INT_SAMPLER_2D:
+		return "usampler2D"
+	case gl.IMAGE_2D:
+		return "image2D"
+	case gl.UNSIGNED_INT_ATOMIC_COUNTER:
+		return "atomic_uint"
+	default:
+		return "unknown"
+	}
+}
+
+// TypeComponents returns the scalar type and number of components of a
+// scalar, vector or matrix type. Matrices report their total number of
+// components, i.e. mat4 has 16. Other types return 0, 0.
+func TypeComponents(xtype uint32) (uint32, int32) {
+	switch xtype {
+	case gl.FLOAT, gl.DOUBLE, gl.INT, gl.UNSIGNED_INT, gl.BOOL:
+		return xtype, 1
+	case gl.FLOAT_VEC2:
+		return gl.FLOAT, 2
+	case gl.FLOAT_VEC3:
+		return gl.FLOAT, 3
+	case gl.FLOAT_VEC4:
+		return gl.FLOAT, 4
+	case gl.DOUBLE_VEC2:
+		return gl.DOUBLE, 2
+	case gl.DOUBLE_VEC3:
+		return gl.DOUBLE, 3
+	case gl.DOUBLE_VEC4:
+		return gl.DOUBLE, 4
+	case gl.INT_VEC2:
+		return gl.INT, 2
+	case gl.INT_VEC3:
+		return gl.INT, 3
+	case gl.INT_VEC4:
+		return gl.INT, 4
+	case gl.UNSIGNED_INT_VEC2:
+		return gl.UNSIGNED_INT, 2
+	case gl.UNSIGNED_INT_VEC3:
+		return gl.UNSIGNED_INT, 3
+	case gl.UNSIGNED_INT_VEC4:
+		return gl.UNSIGNED_INT, 4
+	case gl.BOOL_VEC2:
+		return gl.BOOL, 2
+	case gl.BOOL_VEC3:
+		return gl.BOOL, 3
+	case gl.BOOL_VEC4:
+		return gl.BOOL, 4
+	case gl.FLOAT_MAT2:
+		return gl.FLOAT, 4
+	case gl.FLOAT_MAT3:
+		return gl.FLOAT, 9
+	case gl.FLOAT_MAT4:
+		return gl.FLOAT, 16
+	case gl.FLOAT_MAT2x3, gl.FLOAT_MAT3x2:
+		return gl.FLOAT, 6
+	case gl.FLOAT_MAT2x4, gl.FLOAT_MAT4x2:
+		return gl.FLOAT, 8
+	case gl.FLOAT_MAT3x4, gl.FLOAT_MAT4x3:
+		return gl.FLOAT, 12
+	default:
+		return 0, 0
+	}
+}
+
+// SamplerTarget returns the texture target a sampler type reads from and the
+// parameter to query the texture bound to that target, or 0, 0 if xtype is
+// not a sampler type.
+func SamplerTarget(xtype uint32) (uint32, uint32) {
+	switch xtype {
+	case gl.SAMPLER_1D, gl.SAMPLER_1D_SHADOW, gl.INT_SAMPLER_1D, gl.UNSIGNED_INT_SAMPLER_1D:
+		return gl.TEXTURE_1D, gl.TEXTURE_BINDING_1D
+	case gl.SAMPLER_2D, gl.SAMPLER_2D_SHADOW, gl.INT_SAMPLER_2D, gl.UNSIGNED_INT_SAMPLER_2D:
+		return gl.TEXTURE_2D, gl.TEXTURE_BINDING_2D
+	case gl.SAMPLER_3D, gl.INT_SAMPLER_3D, gl.UNSIGNED_INT_SAMPLER_3D:
+		return gl.TEXTURE_3D, gl.TEXTURE_BINDING_3D
+	case gl.SAMPLER_CUBE, gl.SAMPLER_CUBE_SHADOW, gl.INT_SAMPLER_CUBE, gl.UNSIGNED_INT_SAMPLER_CUBE:
+		return gl.TEXTURE_CUBE_MAP, gl.TEXTURE_BINDING_CUBE_MAP
+	case gl.SAMPLER_1D_ARRAY, gl.SAMPLER_1D_ARRAY_SHADOW, gl.INT_SAMPLER_1D_ARRAY, gl.UNSIGNED_INT_SAMPLER_1D_ARRAY:
+		return gl.TEXTURE_1D_ARRAY, gl.TEXTURE_BINDING_1D_ARRAY
+	case gl.SAMPLER_2D_ARRAY, gl.SAMPLER_2D_ARRAY_SHADOW, gl.INT_SAMPLER_2D_ARRAY, gl.UNSIGNED_INT_SAMPLER_2D_ARRAY:
+		return gl.TEXTURE_2D_ARRAY, gl.TEXTURE_BINDING_2D_ARRAY
+	case gl.SAMPLER_2D_MULTISAMPLE, gl.INT_SAMPLER_2D_MULTISAMPLE, gl.UNSIGNED_INT_SAMPLER_2D_MULTISAMPLE:
+		return gl.TEXTURE_2D_MULTISAMPLE, gl.TEXTURE_BINDING_2D_MULTISAMPLE
+	case gl.SAMPLER_2D_RECT, gl.SAMPLER_2D_RECT_SHADOW, gl.INT_SAMPLER_2D_RECT, gl.UNSIGNED_INT_SAMPLER_2D_RECT:
+		return gl.TEXTURE_RECTANGLE, gl.TEXTURE_BINDING_RECTANGLE
+	case gl.SAMPLER_BUFFER, gl.INT_SAMPLER_BUFFER, gl.UNSIGNED_INT_SAMPLER_BUFFER:
+		return gl.TEXTURE_BUFFER, gl.TEXTURE_BINDING_BUFFER
+	default:
+		return 0, 0
+	}
+}
+
+func IsShadowSampler(xtype uint32) bool {
+	switch xtype {
+	case gl.SAMPLER_1D_SHADOW, gl.SAMPLER_2D_SHADOW, gl.SAMPLER_CUBE_SHADOW,
+		gl.SAMPLER_1D_ARRAY_SHADOW, gl.SAMPLER_2D_ARRAY_SHADOW, gl.SAMPLER_2D_RECT_SHADOW:
+		return true
+	default:
+		return false
+	}
+}
+
 func LogError() {
 	errStr := ErrorStr(gl.GetError())
 	if errStr != "" {
@@ -182,3 +373,40 @@ func GenVertexArray() uint32 {
 	gl.GenVertexArrays(1, &o)
 	return o
 }
+
+func GenFramebuffer() uint32 {
+	var o uint32
+	gl.GenFramebuffers(1, &o)
+	return o
+}
+
+func GenRenderbuffer() uint32 {
+	var o uint32
+	gl.GenRenderbuffers(1, &o)
+	return o
+}
+
+func FramebufferStatusStr(status uint32) string {
+	switch status {
+	case gl.FRAMEBUFFER_COMPLETE:
+		return ""
+	case gl.FRAMEBUFFER_UNDEFINED:
+		return "undefined"
+	case gl.FRAMEBUFFER_INCOMPLETE_ATTACHMENT:
+		return "incomplete attachment"
+	case gl.FRAMEBUFFER_INCOMPLETE_MISSING_ATTACHMENT:
+		return "missing attachment"
+	case gl.FRAMEBUFFER_INCOMPLETE_DRAW_BUFFER:
+		return "incomplete draw buffer"
+	case gl.FRAMEBUFFER_INCOMPLETE_READ_BUFFER:
+		return "incomplete read buffer"
+	case gl.FRAMEBUFFER_UNSUPPORTED:
+		return "unsupported"
+	case gl.FRAMEBUFFER_INCOMPLETE_MULTISAMPLE:
+		return "incomplete multisample"
+	case gl.FRAMEBUFFER_INCOMPLETE_LAYER_TARGETS:
+		return "incomplete layer targets"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,123 @@
+package gx
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// std140Block lays out, as std140 does,
+//
+//	float a; vec3 b; mat3 c; vec2 d[2]; layout(row_major) mat2 e;
+var std140Block = []BlockMember{
+	{Variable{"a", gl.FLOAT, 1, -1}, 0, 0, 0, false},
+	{Variable{"b", gl.FLOAT_VEC3, 1, -1}, 16, 0, 0, false},
+	{Variable{"c", gl.FLOAT_MAT3, 1, -1}, 32, 0, 16, false},
+	{Variable{"d[0]", gl.FLOAT_VEC2, 2, -1}, 80, 16, 0, false},
+	{Variable{"e", gl.FLOAT_MAT2, 1, -1}, 112, 0, 16, true},
+}
+
+func TestPackUniform(t *testing.T) {
+	buf := make([]byte, 144)
+	vals := [][]float64{
+		{1},
+		{2, 3, 4},
+		{5, 6, 7, 8, 9, 10, 11, 12, 13},
+		{14, 15, 16, 17},
+		{18, 19, 20, 21},
+	}
+	for i, m := range std140Block {
+		if err := PackUniform(buf, m, vals[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	at := func(off int) float32 {
+		return math.Float32frombits(binary.LittleEndian.Uint32(buf[off:]))
+	}
+	for _, k := range []struct {
+		off  int
+		want float32
+	}{
+		{0, 1}, {16, 2}, {24, 4},
+		// columns padded to 16 bytes
+		{32, 5}, {48, 8}, {64, 11}, {72, 13},
+		// elements padded to 16 bytes
+		{80, 14}, {84, 15}, {96, 16}, {100, 17},
+		// rows of a row major matrix, its first column down them
+		{112, 18}, {116, 20}, {128, 19}, {132, 21},
+	} {
+		if v := at(k.off); v != k.want {
+			t.Errorf("byte %v: %v, expected %v", k.off, v, k.want)
+		}
+	}
+
+	for i, m := range std140Block {
+		got, err := UnpackUniform(buf, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, vals[i]) {
+			t.Errorf("%v: unpacked %v, expected %v", m.Name, got, vals[i])
+		}
+	}
+}
+
+func TestPackUniformErrors(t *testing.T) {
+	buf := make([]byte, 144)
+	for _, k := range []struct {
+		m    BlockMember
+		vals []float64
+	}{
+		{std140Block[1], []float64{1, 2}},
+		{std140Block[3], []float64{1, 2, 3, 4, 5, 6}},
+		{BlockMember{Variable{"far", gl.FLOAT_VEC4, 1, -1}, 140, 0, 0, false}, []float64{1, 2, 3, 4}},
+		{BlockMember{Variable{"x", gl.DOUBLE, 1, -1}, 0, 0, 0, false}, []float64{1}},
+	} {
+		if err := PackUniform(buf, k.m, k.vals); err == nil {
+			t.Errorf("%v with %v: expected an error", k.m.Name, k.vals)
+		}
+	}
+}
+
+func TestComponentSize(t *testing.T) {
+	for xtype, size := range map[uint32]int32{
+		gl.UNSIGNED_BYTE: 1,
+		gl.SHORT:         2,
+		gl.HALF_FLOAT:    2,
+		gl.UNSIGNED_INT:  4,
+		gl.FLOAT:         4,
+		gl.DOUBLE:        8,
+		gl.FLOAT_VEC2:    0,
+	} {
+		if got := componentSize(xtype); got != size {
+			t.Errorf("%v: got %v bytes, expected %v", TypeStr(xtype), got, size)
+		}
+	}
+}
+
+func TestLive(t *testing.T) {
+	defer func(old map[object]string) { live = old }(live)
+	live = make(map[object]string)
+
+	track(gl.BUFFER, 3)
+	track(gl.TEXTURE, 2)
+	track(gl.BUFFER, 1)
+	track(gl.BUFFER, 0)
+	label(gl.BUFFER, 3, "a")
+	label(gl.BUFFER, 4, "untracked")
+	want := []LiveObject{{"buffer", 1, ""}, {"buffer", 3, "a"}, {"texture", 2, ""}}
+	if got := Live(); !reflect.DeepEqual(got, want) {
+		t.Errorf("live %v, expected %v", got, want)
+	}
+
+	untrack(gl.BUFFER, 3)
+	untrack(gl.TEXTURE, 2)
+	want = []LiveObject{{"buffer", 1, ""}}
+	if got := Live(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after deleting, live %v, expected %v", got, want)
+	}
+}
@@ -0,0 +1,325 @@
+package gx
+
+import (
+	"sort"
+	"unsafe"
+
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// Program, Shader, Texture, Buffer and VertexArray are GL object names
+// whose lifetimes are tracked from their New function to Delete, so objects
+// left behind, e.g. by a reload, show up in Live. The zero value is no
+// object, and deleting it does nothing.
+type (
+	Program     uint32
+	Shader      uint32
+	Texture     uint32
+	Buffer      uint32
+	VertexArray uint32
+)
+
+// dsa is whether the context has direct state access, core since 4.5,
+// which lets objects be created and edited without binding them.
+var dsa bool
+
+// EnableDSA makes the objects use direct state access, for contexts with
+// it, or bind-to-edit, restoring the bindings they touch.
+func EnableDSA(on bool) {
+	dsa = on
+}
+
+// object identifies a tracked object by its glObjectLabel identifier,
+// shaders and programs sharing names but not identifiers.
+type object struct {
+	kind uint32
+	id   uint32
+}
+
+// live maps the tracked objects to their labels.
+var live = make(map[object]string)
+
+var kindNames = map[uint32]string{
+	gl.PROGRAM:      "program",
+	gl.SHADER:       "shader",
+	gl.TEXTURE:      "texture",
+	gl.BUFFER:       "buffer",
+	gl.VERTEX_ARRAY: "vertex array",
+}
+
+func track(kind, id uint32) {
+	if id != 0 {
+		live[object{kind, id}] = ""
+	}
+}
+
+func untrack(kind, id uint32) {
+	delete(live, object{kind, id})
+}
+
+// label names a tracked object, in Live and, with debug output, in GL.
+func label(kind, id uint32, name string) {
+	if _, ok := live[object{kind, id}]; ok {
+		live[object{kind, id}] = name
+	}
+	Label(kind, id, name)
+}
+
+// LiveObject is an object created and not yet deleted.
+type LiveObject struct {
+	Kind  string
+	ID    uint32
+	Label string
+}
+
+// Live returns the objects not yet deleted, by kind, then label, then ID.
+func Live() []LiveObject {
+	objs := make([]LiveObject, 0, len(live))
+	for o, name := range live {
+		objs = append(objs, LiveObject{kindNames[o.kind], o.id, name})
+	}
+	sort.Slice(objs, func(i, j int) bool {
+		a, b := objs[i], objs[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Label != b.Label {
+			return a.Label < b.Label
+		}
+		return a.ID < b.ID
+	})
+	return objs
+}
+
+func NewProgram() Program {
+	p := gl.CreateProgram()
+	track(gl.PROGRAM, p)
+	return Program(p)
+}
+
+// Bind makes p the current program.
+func (p Program) Bind() {
+	gl.UseProgram(uint32(p))
+}
+
+func (p Program) Label(name string) {
+	label(gl.PROGRAM, uint32(p), name)
+}
+
+func (p *Program) Delete() {
+	if *p == 0 {
+		return
+	}
+	gl.DeleteProgram(uint32(*p))
+	untrack(gl.PROGRAM, uint32(*p))
+	*p = 0
+}
+
+func NewShader(stage uint32) Shader {
+	s := gl.CreateShader(stage)
+	track(gl.SHADER, s)
+	return Shader(s)
+}
+
+func (s Shader) Label(name string) {
+	label(gl.SHADER, uint32(s), name)
+}
+
+// Delete flags s for deletion, which waits for it to be detached from any
+// program.
+func (s *Shader) Delete() {
+	if *s == 0 {
+		return
+	}
+	gl.DeleteShader(uint32(*s))
+	untrack(gl.SHADER, uint32(*s))
+	*s = 0
+}
+
+// NewTexture creates a texture, bound to target, which it takes the type
+// of, e.g. gl.TEXTURE_2D.
+func NewTexture(target uint32) Texture {
+	var t uint32
+	if dsa {
+		gl.CreateTextures(target, 1, &t)
+	} else {
+		gl.GenTextures(1, &t)
+	}
+	gl.BindTexture(target, t)
+	track(gl.TEXTURE, t)
+	return Texture(t)
+}
+
+func (t Texture) Bind(target uint32) {
+	gl.BindTexture(target, uint32(t))
+}
+
+// SetData binds t to gl.TEXTURE_2D and replaces its base level, as
+// glTexImage2D does. Direct state access only allocates immutable storage,
+// which can't be resized or given levels one at a time, so images are
+// always specified through the binding.
+func (t Texture) SetData(internalformat int32, width, height int32, format, xtype uint32, pixels unsafe.Pointer) {
+	t.Bind(gl.TEXTURE_2D)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, internalformat, width, height, 0, format, xtype, pixels)
+}
+
+func (t Texture) Label(name string) {
+	label(gl.TEXTURE, uint32(t), name)
+}
+
+func (t *Texture) Delete() {
+	if *t == 0 {
+		return
+	}
+	gl.DeleteTextures(1, (*uint32)(t))
+	untrack(gl.TEXTURE, uint32(*t))
+	*t = 0
+}
+
+// NewBuffer creates a buffer. Without direct state access, it is created
+// through gl.COPY_WRITE_BUFFER, which is unbound after.
+func NewBuffer() Buffer {
+	var b uint32
+	if dsa {
+		gl.CreateBuffers(1, &b)
+	} else {
+		// binding creates the object behind a generated name; the copy
+		// target isn't vertex array state, unlike gl.ELEMENT_ARRAY_BUFFER
+		gl.GenBuffers(1, &b)
+		gl.BindBuffer(gl.COPY_WRITE_BUFFER, b)
+		gl.BindBuffer(gl.COPY_WRITE_BUFFER, 0)
+	}
+	track(gl.BUFFER, b)
+	return Buffer(b)
+}
+
+func (b Buffer) Bind(target uint32) {
+	gl.BindBuffer(target, uint32(b))
+}
+
+// SetData replaces the store of b with n bytes of data, as glBufferData
+// does. Without direct state access, gl.COPY_WRITE_BUFFER is unbound after.
+func (b Buffer) SetData(n int, data unsafe.Pointer, usage uint32) {
+	if dsa {
+		gl.NamedBufferData(uint32(b), n, data, usage)
+		return
+	}
+	b.Bind(gl.COPY_WRITE_BUFFER)
+	gl.BufferData(gl.COPY_WRITE_BUFFER, n, data, usage)
+	gl.BindBuffer(gl.COPY_WRITE_BUFFER, 0)
+}
+
+func (b Buffer) Label(name string) {
+	label(gl.BUFFER, uint32(b), name)
+}
+
+func (b *Buffer) Delete() {
+	if *b == 0 {
+		return
+	}
+	gl.DeleteBuffers(1, (*uint32)(b))
+	untrack(gl.BUFFER, uint32(*b))
+	*b = 0
+}
+
+// NewVertexArray creates a vertex array, leaving the bindings as they were.
+func NewVertexArray() VertexArray {
+	var a uint32
+	if dsa {
+		gl.CreateVertexArrays(1, &a)
+	} else {
+		gl.GenVertexArrays(1, &a)
+		gl.BindVertexArray(a)
+		gl.BindVertexArray(0)
+	}
+	track(gl.VERTEX_ARRAY, a)
+	return VertexArray(a)
+}
+
+func (a VertexArray) Bind() {
+	gl.BindVertexArray(uint32(a))
+}
+
+func (a VertexArray) Label(name string) {
+	label(gl.VERTEX_ARRAY, uint32(a), name)
+}
+
+// SetAttrib sources the attribute at loc from b, tightly packed vectors of
+// size components of xtype, which are passed to shaders as integers if
+// xtype is an integer type. Without direct state access, a is unbound
+// after.
+func (a VertexArray) SetAttrib(loc uint32, b Buffer, size int32, xtype uint32) {
+	integer := xtype != gl.FLOAT && xtype != gl.HALF_FLOAT && xtype != gl.DOUBLE
+	if dsa {
+		// a binding point per attribute, as the old entry points have
+		gl.VertexArrayVertexBuffer(uint32(a), loc, uint32(b), 0, size*componentSize(xtype))
+		if integer {
+			gl.VertexArrayAttribIFormat(uint32(a), loc, size, xtype, 0)
+		} else {
+			gl.VertexArrayAttribFormat(uint32(a), loc, size, xtype, false, 0)
+		}
+		gl.VertexArrayAttribBinding(uint32(a), loc, loc)
+		gl.EnableVertexArrayAttrib(uint32(a), loc)
+		return
+	}
+
+	a.Bind()
+	defer gl.BindVertexArray(0)
+	b.Bind(gl.ARRAY_BUFFER)
+	defer gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	if integer {
+		gl.VertexAttribIPointer(loc, size, xtype, 0, gl.PtrOffset(0))
+	} else {
+		gl.VertexAttribPointer(loc, size, xtype, false, 0, gl.PtrOffset(0))
+	}
+	gl.EnableVertexAttribArray(loc)
+}
+
+// componentSize returns the size in bytes of a scalar attribute type, e.g.
+// gl.UNSIGNED_SHORT, or 0 for others.
+func componentSize(xtype uint32) int32 {
+	switch xtype {
+	case gl.BYTE, gl.UNSIGNED_BYTE:
+		return 1
+	case gl.SHORT, gl.UNSIGNED_SHORT, gl.HALF_FLOAT:
+		return 2
+	case gl.INT, gl.UNSIGNED_INT, gl.FLOAT, gl.FIXED:
+		return 4
+	case gl.DOUBLE:
+		return 8
+	}
+	return 0
+}
+
+// DisableAttrib makes the attribute at loc take the current value of the
+// context instead of a buffer.
+func (a VertexArray) DisableAttrib(loc uint32) {
+	if dsa {
+		gl.DisableVertexArrayAttrib(uint32(a), loc)
+		return
+	}
+	a.Bind()
+	gl.DisableVertexAttribArray(loc)
+	gl.BindVertexArray(0)
+}
+
+// SetElements makes b the index buffer of a.
+func (a VertexArray) SetElements(b Buffer) {
+	if dsa {
+		gl.VertexArrayElementBuffer(uint32(a), uint32(b))
+		return
+	}
+	// the element binding belongs to the vertex array, so it stays
+	a.Bind()
+	b.Bind(gl.ELEMENT_ARRAY_BUFFER)
+	gl.BindVertexArray(0)
+}
+
+func (a *VertexArray) Delete() {
+	if *a == 0 {
+		return
+	}
+	gl.DeleteVertexArrays(1, (*uint32)(a))
+	untrack(gl.VERTEX_ARRAY, uint32(*a))
+	*a = 0
+}
@@ -0,0 +1,110 @@
+package gx
+
+import (
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// NumProgramResources returns the number of active resources in the given
+// program interface, e.g. gl.PROGRAM_INPUT or gl.UNIFORM_BLOCK.
+func NumProgramResources(prog uint32, iface uint32) int {
+	var n int32
+	gl.GetProgramInterfaceiv(prog, iface, gl.ACTIVE_RESOURCES, &n)
+	return int(n)
+}
+
+func ProgramResourceName(prog uint32, iface uint32, idx uint32) string {
+	var maxlen int32
+	gl.GetProgramInterfaceiv(prog, iface, gl.MAX_NAME_LENGTH, &maxlen)
+	if maxlen == 0 {
+		return ""
+	}
+
+	var length int32
+	buf := make([]byte, maxlen)
+	gl.GetProgramResourceName(prog, iface, idx, maxlen, &length, &buf[0])
+	return string(buf[:length])
+}
+
+// ProgramResource queries props for a single resource and returns their
+// values in the same order.
+func ProgramResource(prog uint32, iface uint32, idx uint32, props []uint32) []int32 {
+	params := make([]int32, len(props))
+	if len(props) == 0 {
+		return params
+	}
+
+	gl.GetProgramResourceiv(prog, iface, idx, int32(len(props)), &props[0], int32(len(params)), nil, &params[0])
+	return params
+}
+
+// ProgramResourceVariables returns the indices of the active variables of a
+// block resource (gl.UNIFORM_BLOCK or gl.SHADER_STORAGE_BLOCK).
+func ProgramResourceVariables(prog uint32, iface uint32, idx uint32) []uint32 {
+	n := ProgramResource(prog, iface, idx, []uint32{gl.NUM_ACTIVE_VARIABLES})[0]
+	if n == 0 {
+		return nil
+	}
+
+	prop := uint32(gl.ACTIVE_VARIABLES)
+	vars := make([]int32, n)
+	gl.GetProgramResourceiv(prog, iface, idx, 1, &prop, n, nil, &vars[0])
+
+	res := make([]uint32, n)
+	for i, v := range vars {
+		res[i] = uint32(v)
+	}
+	return res
+}
+
+// Variable describes an active attribute or uniform of a linked program.
+type Variable struct {
+	Name     string
+	Type     uint32
+	Size     int32
+	Location int32
+}
+
+// ActiveAttribs returns the active vertex attributes of a linked program.
+func ActiveAttribs(prog uint32) []Variable {
+	var n, maxlen int32
+	gl.GetProgramiv(prog, gl.ACTIVE_ATTRIBUTES, &n)
+	gl.GetProgramiv(prog, gl.ACTIVE_ATTRIBUTE_MAX_LENGTH, &maxlen)
+	if n == 0 {
+		return nil
+	}
+
+	vars := make([]Variable, n)
+	buf := make([]byte, maxlen)
+	for i := range vars {
+		var length int32
+		v := &vars[i]
+		gl.GetActiveAttrib(prog, uint32(i), maxlen, &length, &v.Size, &v.Type, &buf[0])
+		v.Name = string(buf[:length])
+		v.Location = gl.GetAttribLocation(prog, gl.Str(v.Name+"\x00"))
+	}
+
+	return vars
+}
+
+// ActiveUniforms returns the active uniforms of a linked program, including
+// those in uniform blocks, whose location is -1.
+func ActiveUniforms(prog uint32) []Variable {
+	var n, maxlen int32
+	gl.GetProgramiv(prog, gl.ACTIVE_UNIFORMS, &n)
+	gl.GetProgramiv(prog, gl.ACTIVE_UNIFORM_MAX_LENGTH, &maxlen)
+	if n == 0 {
+		return nil
+	}
+
+	vars := make([]Variable, n)
+	buf := make([]byte, maxlen)
+	for i := range vars {
+		var length int32
+		v := &vars[i]
+		gl.GetActiveUniform(prog, uint32(i), maxlen, &length, &v.Size, &v.Type, &buf[0])
+		v.Name = string(buf[:length])
+		v.Location = gl.GetUniformLocation(prog, gl.Str(v.Name+"\x00"))
+	}
+
+	return vars
+}
@@ -0,0 +1,100 @@
+package gx
+
+import (
+	"fmt"
+
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+var stateCaps = []struct {
+	name string
+	cap  uint32
+}{
+	{"BLEND", gl.BLEND},
+	{"CULL_FACE", gl.CULL_FACE},
+	{"DEPTH_TEST", gl.DEPTH_TEST},
+	{"SCISSOR_TEST", gl.SCISSOR_TEST},
+	{"STENCIL_TEST", gl.STENCIL_TEST},
+	{"POLYGON_OFFSET_FILL", gl.POLYGON_OFFSET_FILL},
+	{"PROGRAM_POINT_SIZE", gl.PROGRAM_POINT_SIZE},
+	{"FRAMEBUFFER_SRGB", gl.FRAMEBUFFER_SRGB},
+	{"MULTISAMPLE", gl.MULTISAMPLE},
+	{"DEPTH_CLAMP", gl.DEPTH_CLAMP},
+	{"RASTERIZER_DISCARD", gl.RASTERIZER_DISCARD},
+	{"COLOR_LOGIC_OP", gl.COLOR_LOGIC_OP},
+}
+
+var stateInts = []struct {
+	name  string
+	pname uint32
+	n     int
+}{
+	{"CURRENT_PROGRAM", gl.CURRENT_PROGRAM, 1},
+	{"VERTEX_ARRAY_BINDING", gl.VERTEX_ARRAY_BINDING, 1},
+	{"ARRAY_BUFFER_BINDING", gl.ARRAY_BUFFER_BINDING, 1},
+	{"DRAW_FRAMEBUFFER_BINDING", gl.DRAW_FRAMEBUFFER_BINDING, 1},
+	{"READ_FRAMEBUFFER_BINDING", gl.READ_FRAMEBUFFER_BINDING, 1},
+	{"RENDERBUFFER_BINDING", gl.RENDERBUFFER_BINDING, 1},
+	{"UNIFORM_BUFFER_BINDING", gl.UNIFORM_BUFFER_BINDING, 1},
+	{"ACTIVE_TEXTURE", gl.ACTIVE_TEXTURE, 1},
+	{"TEXTURE_BINDING_2D", gl.TEXTURE_BINDING_2D, 1},
+	{"SAMPLER_BINDING", gl.SAMPLER_BINDING, 1},
+	{"DEPTH_FUNC", gl.DEPTH_FUNC, 1},
+	{"DEPTH_WRITEMASK", gl.DEPTH_WRITEMASK, 1},
+	{"COLOR_WRITEMASK", gl.COLOR_WRITEMASK, 4},
+	{"CULL_FACE_MODE", gl.CULL_FACE_MODE, 1},
+	{"FRONT_FACE", gl.FRONT_FACE, 1},
+	{"POLYGON_MODE", gl.POLYGON_MODE, 2},
+	{"BLEND_SRC_RGB", gl.BLEND_SRC_RGB, 1},
+	{"BLEND_DST_RGB", gl.BLEND_DST_RGB, 1},
+	{"BLEND_SRC_ALPHA", gl.BLEND_SRC_ALPHA, 1},
+	{"BLEND_DST_ALPHA", gl.BLEND_DST_ALPHA, 1},
+	{"BLEND_EQUATION_RGB", gl.BLEND_EQUATION_RGB, 1},
+	{"BLEND_EQUATION_ALPHA", gl.BLEND_EQUATION_ALPHA, 1},
+	{"VIEWPORT", gl.VIEWPORT, 4},
+	{"SCISSOR_BOX", gl.SCISSOR_BOX, 4},
+}
+
+// State is a snapshot of the GL state most commonly leaked between passes:
+// enables, object bindings and fixed function settings.
+type State struct {
+	caps []bool
+	ints [][4]int32
+}
+
+func SnapshotState() *State {
+	var s State
+	s.caps = make([]bool, len(stateCaps))
+	for i, c := range stateCaps {
+		s.caps[i] = gl.IsEnabled(c.cap)
+	}
+
+	s.ints = make([][4]int32, len(stateInts))
+	for i, v := range stateInts {
+		gl.GetIntegerv(v.pname, &s.ints[i][0])
+	}
+
+	return &s
+}
+
+// DiffState describes every difference between two snapshots.
+func DiffState(before, after *State) []string {
+	var res []string
+	for i, c := range stateCaps {
+		if before.caps[i] != after.caps[i] {
+			res = append(res, fmt.Sprintf("%v: %v -> %v", c.name, before.caps[i], after.caps[i]))
+		}
+	}
+
+	for i, v := range stateInts {
+		b, a := before.ints[i][:v.n], after.ints[i][:v.n]
+		for j := range b {
+			if b[j] != a[j] {
+				res = append(res, fmt.Sprintf("%v: %v -> %v", v.name, b, a))
+				break
+			}
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,158 @@
+// Package midi reads the channel messages of a raw MIDI byte stream, as
+// device files like /dev/snd/midiC1D0 give them.
+package midi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Kinds of messages.
+const (
+	NoteOff       = 0x80
+	NoteOn        = 0x90
+	ControlChange = 0xb0
+)
+
+// Message is a channel message, with the channel from 1 to 16.
+type Message struct {
+	Kind    int
+	Channel int
+	Data1   int
+	Data2   int
+}
+
+// Reader reads messages, skipping system messages.
+type Reader struct {
+	r       *bufio.Reader
+	running byte
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// dataLen returns the number of data bytes following a status byte.
+func dataLen(status byte) int {
+	switch status & 0xf0 {
+	case 0xc0, 0xd0:
+		return 1
+	}
+	return 2
+}
+
+// Read returns the next channel message. A note on of velocity 0 is
+// returned as a note off, as it means.
+func (r *Reader) Read() (Message, error) {
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return Message{}, err
+		}
+
+		status := r.running
+		var data [2]byte
+		n := 0
+		switch {
+		case b >= 0xf8:
+			// real time messages may come between any bytes
+			continue
+		case b >= 0xf0:
+			// system common and exclusive messages cancel running status;
+			// their data bytes are skipped as strays below
+			r.running = 0
+			continue
+		case b >= 0x80:
+			status = b
+			r.running = b
+		default:
+			if status == 0 {
+				continue
+			}
+			data[0] = b
+			n = 1
+		}
+
+		for n < dataLen(status) {
+			b, err := r.r.ReadByte()
+			if err != nil {
+				return Message{}, err
+			}
+			if b >= 0xf8 {
+				continue
+			}
+			if b >= 0x80 {
+				r.r.UnreadByte()
+				break
+			}
+			data[n] = b
+			n++
+		}
+		if n < dataLen(status) {
+			continue
+		}
+
+		m := Message{int(status & 0xf0), int(status&0x0f) + 1, int(data[0]), int(data[1])}
+		if m.Kind == NoteOn && m.Data2 == 0 {
+			m.Kind = NoteOff
+		}
+		return m, nil
+	}
+}
+
+// Control is a knob, fader or key of a controller: a control change or
+// note number, on a channel from 1 to 16 or on any if 0.
+type Control struct {
+	Kind    int
+	Channel int
+	Number  int
+}
+
+// ParseControl reads a control of the form [CHANNEL:]ccNUMBER or
+// [CHANNEL:]noteNUMBER, e.g. cc74 or 2:note60.
+func ParseControl(s string) (Control, error) {
+	var c Control
+	rest := s
+	if i := strings.Index(rest, ":"); i >= 0 {
+		ch, err := strconv.Atoi(rest[:i])
+		if err != nil || ch < 1 || ch > 16 {
+			return Control{}, fmt.Errorf("invalid channel in %v, expected 1 to 16", s)
+		}
+		c.Channel, rest = ch, rest[i+1:]
+	}
+	switch {
+	case strings.HasPrefix(rest, "cc"):
+		c.Kind, rest = ControlChange, rest[2:]
+	case strings.HasPrefix(rest, "note"):
+		c.Kind, rest = NoteOn, rest[4:]
+	default:
+		return Control{}, fmt.Errorf("invalid control %v, expected [CHANNEL:]ccN or [CHANNEL:]noteN", s)
+	}
+	n, err := strconv.Atoi(rest)
+	if err != nil || n < 0 || n > 127 {
+		return Control{}, fmt.Errorf("invalid number in %v, expected 0 to 127", s)
+	}
+	c.Number = n
+	return c, nil
+}
+
+// Matches reports whether a message comes from a control, returning its
+// value from 0 to 1: the position of a control change, or the velocity of
+// a note, 0 when released.
+func (c Control) Matches(m Message) (float64, bool) {
+	if c.Channel != 0 && c.Channel != m.Channel || c.Number != m.Data1 {
+		return 0, false
+	}
+	switch {
+	case c.Kind == ControlChange && m.Kind == ControlChange:
+		return float64(m.Data2) / 127, true
+	case c.Kind == NoteOn && m.Kind == NoteOn:
+		return float64(m.Data2) / 127, true
+	case c.Kind == NoteOn && m.Kind == NoteOff:
+		return 0, true
+	}
+	return 0, false
+}
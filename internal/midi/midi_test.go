@@ -0,0 +1,75 @@
+package midi
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	stream := []byte{
+		0xb0, 7, 100,
+		// running status, with a clock tick in between
+		8, 0xf8, 64,
+		// sysex is skipped
+		0xf0, 0x7e, 0x01, 0xf7,
+		0x91, 60, 90,
+		0x91, 60, 0,
+		// program change has one data byte
+		0xc2, 5,
+	}
+	r := NewReader(bytes.NewReader(stream))
+	expected := []Message{
+		{ControlChange, 1, 7, 100},
+		{ControlChange, 1, 8, 64},
+		{NoteOn, 2, 60, 90},
+		{NoteOff, 2, 60, 0},
+		{0xc0, 3, 5, 0},
+	}
+	for i, e := range expected {
+		m, err := r.Read()
+		if err != nil {
+			t.Fatalf("message %v: %v", i, err)
+		}
+		if !reflect.DeepEqual(m, e) {
+			t.Errorf("message %v: expected %v, got %v", i, e, m)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestControl(t *testing.T) {
+	c, err := ParseControl("2:note60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != (Control{NoteOn, 2, 60}) {
+		t.Errorf("got %v", c)
+	}
+	if v, ok := c.Matches(Message{NoteOn, 2, 60, 127}); !ok || v != 1 {
+		t.Errorf("expected a full velocity match, got %v %v", v, ok)
+	}
+	if v, ok := c.Matches(Message{NoteOff, 2, 60, 40}); !ok || v != 0 {
+		t.Errorf("expected a release to 0, got %v %v", v, ok)
+	}
+	if _, ok := c.Matches(Message{NoteOn, 1, 60, 127}); ok {
+		t.Error("expected no match on another channel")
+	}
+
+	c, err = ParseControl("cc74")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Matches(Message{ControlChange, 16, 74, 0}); !ok {
+		t.Error("expected a match on any channel")
+	}
+
+	for _, s := range []string{"cc128", "17:cc1", "pitch", "note"} {
+		if _, err := ParseControl(s); err == nil {
+			t.Errorf("%v: expected an error", s)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package mip builds the mipmap levels of 8-bit sRGB images on the CPU,
+// averaging in linear light so that downsampled levels keep the brightness
+// of the original instead of darkening as averaging the encoded values
+// does.
+package mip
+
+import (
+	"math"
+)
+
+// Level is an image of 8-bit RGBA pixels, rows packed.
+type Level struct {
+	Pix           []byte
+	Width, Height int
+}
+
+var toLinear [256]float64
+
+func init() {
+	for i := range toLinear {
+		c := float64(i) / 255
+		if c <= 0.04045 {
+			toLinear[i] = c / 12.92
+		} else {
+			toLinear[i] = math.Pow((c+0.055)/1.055, 2.4)
+		}
+	}
+}
+
+func toSRGB(l float64) byte {
+	var c float64
+	if l <= 0.0031308 {
+		c = l * 12.92
+	} else {
+		c = 1.055*math.Pow(l, 1/2.4) - 0.055
+	}
+	return byte(math.Max(0, math.Min(255, math.Floor(c*255+0.5))))
+}
+
+// Downsample returns the next level of an image, half its size rounded
+// down but at least 1 in each direction, each pixel the average of the two
+// by two it covers. Color is averaged in linear light, alpha as is.
+func Downsample(l Level) Level {
+	w, h := l.Width/2, l.Height/2
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	res := Level{make([]byte, 4*w*h), w, h}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum [4]float64
+			n := 0
+			for sy := 2 * y; sy < 2*y+2 && sy < l.Height; sy++ {
+				for sx := 2 * x; sx < 2*x+2 && sx < l.Width; sx++ {
+					p := l.Pix[4*(sy*l.Width+sx):]
+					for c := 0; c < 3; c++ {
+						sum[c] += toLinear[p[c]]
+					}
+					sum[3] += float64(p[3])
+					n++
+				}
+			}
+			d := res.Pix[4*(y*w+x):]
+			for c := 0; c < 3; c++ {
+				d[c] = toSRGB(sum[c] / float64(n))
+			}
+			d[3] = byte(math.Floor(sum[3]/float64(n) + 0.5))
+		}
+	}
+	return res
+}
+
+// Chain returns the levels below an image, down to 1 by 1.
+func Chain(l Level) []Level {
+	var res []Level
+	for l.Width > 1 || l.Height > 1 {
+		l = Downsample(l)
+		res = append(res, l)
+	}
+	return res
+}
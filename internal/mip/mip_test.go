@@ -0,0 +1,43 @@
+package mip
+
+import "testing"
+
+// black and white average to the sRGB encoding of half the light, not 128
+func TestDownsample(t *testing.T) {
+	l := Level{[]byte{
+		0, 0, 0, 0, 255, 255, 255, 255,
+		255, 255, 255, 255, 0, 0, 0, 0,
+	}, 2, 2}
+	d := Downsample(l)
+	if d.Width != 1 || d.Height != 1 {
+		t.Fatalf("expected 1x1, got %vx%v", d.Width, d.Height)
+	}
+	expected := []byte{188, 188, 188, 128}
+	if string(d.Pix) != string(expected) {
+		t.Errorf("expected %v, got %v", expected, d.Pix)
+	}
+}
+
+func TestChain(t *testing.T) {
+	pix := make([]byte, 4*5*3)
+	for i := range pix {
+		pix[i] = 200
+	}
+	levels := Chain(Level{pix, 5, 3})
+	sizes := [][2]int{{2, 1}, {1, 1}}
+	if len(levels) != len(sizes) {
+		t.Fatalf("expected %v levels, got %v", len(sizes), len(levels))
+	}
+	for i, s := range sizes {
+		l := levels[i]
+		if l.Width != s[0] || l.Height != s[1] || len(l.Pix) != 4*s[0]*s[1] {
+			t.Errorf("level %v: expected %vx%v, got %vx%v with %v bytes", i+1, s[0], s[1], l.Width, l.Height, len(l.Pix))
+		}
+		for j, v := range l.Pix {
+			if v != 200 {
+				t.Errorf("level %v byte %v: expected a flat image to stay 200, got %v", i+1, j, v)
+				break
+			}
+		}
+	}
+}
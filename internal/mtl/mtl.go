@@ -0,0 +1,159 @@
+// Package mtl decodes Wavefront material libraries, as referenced by the
+// mtllib statements of OBJ files.
+package mtl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Material is a named material of a library. Map paths are as written,
+// relative to the library, and empty when not given.
+type Material struct {
+	Name string
+
+	Ambient  [3]float32
+	Diffuse  [3]float32
+	Specular [3]float32
+	Emissive [3]float32
+	// specular exponent
+	Shininess float32
+	// 1 is opaque
+	Opacity float32
+
+	DiffuseMap  string
+	SpecularMap string
+	EmissiveMap string
+	AlphaMap    string
+	// bump and norm maps are both taken as tangent space normal maps
+	NormalMap string
+}
+
+// Decode reads the materials of a library in the order they are defined.
+// Statements other than colors, Ns, d, Tr and the maps are ignored.
+func Decode(r io.Reader) ([]Material, error) {
+	var mats []Material
+	var m *Material
+
+	color := func(line int, fields []string, dst *[3]float32) error {
+		// "Kd r" is gray, and spectral or xyz forms are not supported
+		if len(fields) != 2 && len(fields) != 4 {
+			return fmt.Errorf("%v: %v requires 1 or 3 values", line, fields[0])
+		}
+		for i := range dst {
+			v := fields[1]
+			if len(fields) == 4 {
+				v = fields[1+i]
+			}
+			f, err := strconv.ParseFloat(v, 32)
+			if err != nil {
+				return fmt.Errorf("%v: %v", line, err)
+			}
+			dst[i] = float32(f)
+		}
+		return nil
+	}
+	scalar := func(line int, fields []string) (float32, error) {
+		if len(fields) != 2 {
+			return 0, fmt.Errorf("%v: %v requires 1 value", line, fields[0])
+		}
+		f, err := strconv.ParseFloat(fields[1], 32)
+		if err != nil {
+			return 0, fmt.Errorf("%v: %v", line, err)
+		}
+		return float32(f), nil
+	}
+
+	line := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if fields[0] == "newmtl" {
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("%v: newmtl requires a name", line)
+			}
+			mats = append(mats, Material{Name: strings.Join(fields[1:], " "), Diffuse: [3]float32{1, 1, 1}, Opacity: 1})
+			m = &mats[len(mats)-1]
+			continue
+		}
+		if m == nil {
+			return nil, fmt.Errorf("%v: %v before newmtl", line, fields[0])
+		}
+
+		var err error
+		switch fields[0] {
+		case "Ka":
+			err = color(line, fields, &m.Ambient)
+		case "Kd":
+			err = color(line, fields, &m.Diffuse)
+		case "Ks":
+			err = color(line, fields, &m.Specular)
+		case "Ke":
+			err = color(line, fields, &m.Emissive)
+		case "Ns":
+			m.Shininess, err = scalar(line, fields)
+		case "d":
+			m.Opacity, err = scalar(line, fields)
+		case "Tr":
+			var tr float32
+			tr, err = scalar(line, fields)
+			m.Opacity = 1 - tr
+		case "map_Kd":
+			m.DiffuseMap, err = mapPath(line, fields)
+		case "map_Ks":
+			m.SpecularMap, err = mapPath(line, fields)
+		case "map_Ke":
+			m.EmissiveMap, err = mapPath(line, fields)
+		case "map_d":
+			m.AlphaMap, err = mapPath(line, fields)
+		case "bump", "map_bump", "map_Bump", "norm":
+			m.NormalMap, err = mapPath(line, fields)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return mats, nil
+}
+
+// mapArgs is the number of values taken by each map option.
+var mapArgs = map[string]int{
+	"-blendu": 1, "-blendv": 1, "-bm": 1, "-boost": 1, "-cc": 1, "-clamp": 1,
+	"-imfchan": 1, "-mm": 2, "-o": 3, "-s": 3, "-t": 3, "-texres": 1,
+}
+
+// mapPath skips the options of a map statement and returns its file name,
+// which may contain spaces.
+func mapPath(line int, fields []string) (string, error) {
+	i := 1
+	for i < len(fields) {
+		n, ok := mapArgs[fields[i]]
+		if !ok {
+			break
+		}
+		// -o, -s and -t take 1 to 3 values
+		i++
+		for j := 0; j < n && i < len(fields); j++ {
+			if _, err := strconv.ParseFloat(fields[i], 32); err != nil && j > 0 {
+				break
+			}
+			i++
+		}
+	}
+	if i >= len(fields) {
+		return "", fmt.Errorf("%v: %v requires a file name", line, fields[0])
+	}
+	return strings.Join(fields[i:], " "), nil
+}
@@ -0,0 +1,51 @@
+package mtl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	src := `# exported
+newmtl brick
+Ka 0 0 0
+Kd 0.8 0.4 0.2
+Ks 0.5
+Ns 96
+Tr 0.25
+map_Kd -s 2 2 -bm 1 textures/brick albedo.png
+bump -bm 0.5 brick_n.png
+
+newmtl glass
+d 0.1
+map_Ks spec.jpg
+`
+	mats, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mats) != 2 {
+		t.Fatalf("expected 2 materials, got %v", len(mats))
+	}
+
+	b := mats[0]
+	if b.Name != "brick" || b.Diffuse != [3]float32{0.8, 0.4, 0.2} || b.Specular != [3]float32{0.5, 0.5, 0.5} {
+		t.Errorf("unexpected colors %+v", b)
+	}
+	if b.Shininess != 96 || b.Opacity != 0.75 {
+		t.Errorf("unexpected shininess %v and opacity %v", b.Shininess, b.Opacity)
+	}
+	if b.DiffuseMap != "textures/brick albedo.png" || b.NormalMap != "brick_n.png" {
+		t.Errorf("unexpected maps %q, %q", b.DiffuseMap, b.NormalMap)
+	}
+
+	g := mats[1]
+	if g.Diffuse != [3]float32{1, 1, 1} || g.Opacity != 0.1 || g.SpecularMap != "spec.jpg" {
+		t.Errorf("unexpected defaults %+v", g)
+	}
+
+	_, err = Decode(strings.NewReader("Kd 1 1 1\n"))
+	if err == nil {
+		t.Error("expected an error for a statement before newmtl")
+	}
+}
@@ -2,8 +2,10 @@ package obj
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -18,6 +20,13 @@ const (
 	texElem
 	norElem
 	facElem
+	objElem
+	grpElem
+	smoElem
+	libElem
+	useElem
+	linElem
+	pntElem
 	errElem
 )
 
@@ -35,6 +44,20 @@ func toElem(s string) elem {
 		return norElem
 	case "f":
 		return facElem
+	case "o":
+		return objElem
+	case "g":
+		return grpElem
+	case "s":
+		return smoElem
+	case "mtllib":
+		return libElem
+	case "usemtl":
+		return useElem
+	case "l":
+		return linElem
+	case "p":
+		return pntElem
 	default:
 		return errElem
 	}
@@ -51,6 +74,11 @@ func toIndex(s string) (int, error) {
 	return int(val), nil
 }
 
+// adjustIndex resolves an index of a face, line or point to a zero based
+// index into the attLen attributes read so far. Positive indices count from
+// the first attribute of the file, and negative ones back from the last read
+// before the element, so -1 is the latest. The 0 of an absent index becomes
+// -1.
 func adjustIndex(attIdx int, attLen int) (int, error) {
 	res := attIdx
 	if res < 0 {
@@ -61,8 +89,8 @@ func adjustIndex(attIdx int, attLen int) (int, error) {
 	} else {
 		res--
 	}
-	if res > attLen {
-		return 0, fmt.Errorf("index %v does not resolve to an attribute (i.e. too large)")
+	if res >= attLen {
+		return 0, fmt.Errorf("index %v does not resolve to an attribute (i.e. too large)", attIdx)
 	}
 
 	return res, nil
@@ -73,6 +101,384 @@ type Obj struct {
 	Tex  [][3]float32
 	Nor  [][3]float32
 	Face [][3][3]int
+
+	// Col holds a color per position when any vertex was given one in the
+	// nonstandard "v x y z r g b" form, and is nil otherwise.
+	Col [][3]float32
+
+	// Lines holds the position indices of each polyline of l statements,
+	// and Points those of p statements.
+	Lines  [][]int
+	Points []int
+
+	// Smooth holds the smoothing group of each face, 0 for none, when any s
+	// statement was given, and is nil otherwise.
+	Smooth []int
+
+	// Groups splits the faces into the parts named by o, g and usemtl
+	// statements, in order, and is nil when there are none.
+	Groups []Group
+
+	// MtlLibs lists the material libraries of mtllib statements, as written.
+	MtlLibs []string
+
+	// Units is the unit of length hinted at by an exporter comment, as one of
+	// the keys of UnitScale, or empty if no hint was found.
+	Units string
+}
+
+// Group is a named range of faces, Face[Start:End].
+// Object is the name given by the last o statement, Name by the last g
+// statement since, with several group names joined by spaces, and Material
+// by the last usemtl statement.
+// Faces before the first statement form a group with empty names.
+type Group struct {
+	Object   string
+	Name     string
+	Material string
+	Start    int
+	End      int
+}
+
+// UnitScale maps unit symbols to their length in meters.
+var UnitScale = map[string]float32{
+	"mm": 0.001,
+	"cm": 0.01,
+	"dm": 0.1,
+	"m":  1,
+	"km": 1000,
+	"in": 0.0254,
+	"ft": 0.3048,
+	"yd": 0.9144,
+	"mi": 1609.344,
+}
+
+var unitNames = map[string]string{
+	"mm":          "mm",
+	"millimeter":  "mm",
+	"millimeters": "mm",
+	"millimetre":  "mm",
+	"millimetres": "mm",
+	"cm":          "cm",
+	"centimeter":  "cm",
+	"centimeters": "cm",
+	"centimetre":  "cm",
+	"centimetres": "cm",
+	"dm":          "dm",
+	"decimeter":   "dm",
+	"decimeters":  "dm",
+	"m":           "m",
+	"meter":       "m",
+	"meters":      "m",
+	"metre":       "m",
+	"metres":      "m",
+	"km":          "km",
+	"kilometer":   "km",
+	"kilometers":  "km",
+	"in":          "in",
+	"inch":        "in",
+	"inches":      "in",
+	"ft":          "ft",
+	"foot":        "ft",
+	"feet":        "ft",
+	"yd":          "yd",
+	"yard":        "yd",
+	"yards":       "yd",
+	"mi":          "mi",
+	"mile":        "mi",
+	"miles":       "mi",
+}
+
+// unitsFromComment looks for a unit hint in a comment line, as written by
+// various exporters, e.g. "# Units: mm" or "# File units = centimeters".
+func unitsFromComment(line string) (string, bool) {
+	words := strings.FieldsFunc(strings.ToLower(line), func(r rune) bool {
+		return r < 'a' || r > 'z'
+	})
+
+	for i, w := range words {
+		if w != "unit" && w != "units" {
+			continue
+		}
+		for _, u := range words[i+1:] {
+			if sym, ok := unitNames[u]; ok {
+				return sym, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// GenerateNormals replaces the normals with smooth ones, averaging the
+// normals of the faces around each position weighted by the angle of the
+// face at that position. Without smoothing groups there is one normal per
+// position, at the same index. With them, only faces of the same group are
+// averaged, and faces of no group get their own flat normal.
+func (o *Obj) GenerateNormals() {
+	sub := func(a, b [4]float32) [3]float64 {
+		return [3]float64{float64(a[0] - b[0]), float64(a[1] - b[1]), float64(a[2] - b[2])}
+	}
+	dot := func(a, b [3]float64) float64 {
+		return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+	}
+	cross := func(a, b [3]float64) [3]float64 {
+		return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+	}
+
+	// the normal of each face vertex
+	nor := make([][3]int, len(o.Face))
+	var sum [][3]float64
+	if o.Smooth == nil {
+		sum = make([][3]float64, len(o.Pos))
+		for f := range o.Face {
+			for i := range o.Face[f] {
+				nor[f][i] = o.Face[f][i][0]
+			}
+		}
+	} else {
+		known := make(map[[2]int]int)
+		for f := range o.Face {
+			g := o.Smooth[f]
+			if g == 0 {
+				g = -f - 1
+			}
+			for i := range o.Face[f] {
+				k := [2]int{o.Face[f][i][0], g}
+				n, ok := known[k]
+				if !ok {
+					n = len(sum)
+					known[k] = n
+					sum = append(sum, [3]float64{})
+				}
+				nor[f][i] = n
+			}
+		}
+	}
+
+	for f := range o.Face {
+		var p [3][4]float32
+		for i := range p {
+			p[i] = *o.VertPos(f, i)
+		}
+
+		n := cross(sub(p[1], p[0]), sub(p[2], p[0]))
+		l := math.Sqrt(dot(n, n))
+		if l == 0 {
+			continue
+		}
+
+		for i := range p {
+			e1 := sub(p[(i+1)%3], p[i])
+			e2 := sub(p[(i+2)%3], p[i])
+			d := math.Sqrt(dot(e1, e1) * dot(e2, e2))
+			if d == 0 {
+				continue
+			}
+			angle := math.Acos(math.Max(-1, math.Min(1, dot(e1, e2)/d)))
+
+			s := &sum[nor[f][i]]
+			for j := range s {
+				s[j] += n[j] / l * angle
+			}
+		}
+	}
+
+	o.Nor = make([][3]float32, len(sum))
+	for i, s := range sum {
+		l := math.Sqrt(dot(s, s))
+		if l == 0 {
+			continue
+		}
+		o.Nor[i] = [3]float32{float32(s[0] / l), float32(s[1] / l), float32(s[2] / l)}
+	}
+
+	for f := range o.Face {
+		for i := range o.Face[f] {
+			o.Face[f][i][2] = nor[f][i]
+		}
+	}
+}
+
+// Bounds returns the minimum and maximum x, y and z of the positions, or
+// zeros if there are none.
+func (o *Obj) Bounds() (min, max [3]float32) {
+	if len(o.Pos) == 0 {
+		return min, max
+	}
+
+	copy(min[:], o.Pos[0][:3])
+	copy(max[:], o.Pos[0][:3])
+	for _, p := range o.Pos[1:] {
+		for i := 0; i < 3; i++ {
+			if p[i] < min[i] {
+				min[i] = p[i]
+			}
+			if p[i] > max[i] {
+				max[i] = p[i]
+			}
+		}
+	}
+	return min, max
+}
+
+// Center returns the center of the bounding box.
+func (o *Obj) Center() [3]float32 {
+	min, max := o.Bounds()
+	var c [3]float32
+	for i := range c {
+		c[i] = (min[i] + max[i]) / 2
+	}
+	return c
+}
+
+// Radius returns the distance from Center to the farthest position, the
+// radius of a bounding sphere around it.
+func (o *Obj) Radius() float32 {
+	c := o.Center()
+	var r2 float64
+	for _, p := range o.Pos {
+		dx, dy, dz := float64(p[0]-c[0]), float64(p[1]-c[1]), float64(p[2]-c[2])
+		r2 = math.Max(r2, dx*dx+dy*dy+dz*dz)
+	}
+	return float32(math.Sqrt(r2))
+}
+
+// faceArea returns the area and centroid of a face.
+func (o *Obj) faceArea(f int) (float64, [3]float64) {
+	var p [3][3]float64
+	for i := range p {
+		v := o.VertPos(f, i)
+		p[i] = [3]float64{float64(v[0]), float64(v[1]), float64(v[2])}
+	}
+	var e1, e2, c [3]float64
+	for i := range e1 {
+		e1[i] = p[1][i] - p[0][i]
+		e2[i] = p[2][i] - p[0][i]
+		c[i] = (p[0][i] + p[1][i] + p[2][i]) / 3
+	}
+	x := e1[1]*e2[2] - e1[2]*e2[1]
+	y := e1[2]*e2[0] - e1[0]*e2[2]
+	z := e1[0]*e2[1] - e1[1]*e2[0]
+	return math.Sqrt(x*x+y*y+z*z) / 2, c
+}
+
+// SurfaceArea returns the total area of the faces.
+func (o *Obj) SurfaceArea() float32 {
+	var a float64
+	for f := range o.Face {
+		fa, _ := o.faceArea(f)
+		a += fa
+	}
+	return float32(a)
+}
+
+// Centroid returns the center of mass of the surface, the centroids of the
+// faces weighted by their area, or Center if the faces have no area.
+func (o *Obj) Centroid() [3]float32 {
+	var a float64
+	var sum [3]float64
+	for f := range o.Face {
+		fa, c := o.faceArea(f)
+		a += fa
+		for i := range sum {
+			sum[i] += c[i] * fa
+		}
+	}
+	if a == 0 {
+		return o.Center()
+	}
+	return [3]float32{float32(sum[0] / a), float32(sum[1] / a), float32(sum[2] / a)}
+}
+
+// Mesh holds the elements of an Obj with a single index per vertex, as
+// drawing APIs expect, rather than one per attribute.
+type Mesh struct {
+	// one of each attribute per vertex, with Col, Tex and Nor nil when the
+	// Obj has none
+	Pos [][4]float32
+	Col [][3]float32
+	Tex [][3]float32
+	Nor [][3]float32
+
+	// Tris holds three vertices per face, Lines two per segment of each
+	// polyline, and Points one per point.
+	Tris   []uint32
+	Lines  []uint32
+	Points []uint32
+}
+
+// Interleave builds a Mesh, with a vertex for every distinct combination of
+// position, texture and normal indices of the faces, in order of first use.
+// Line and point vertices share those of faces at the same position only by
+// chance, so they get their own, with zero texture coordinates and normals
+// if faces have them.
+func (o *Obj) Interleave() *Mesh {
+	var m Mesh
+
+	addVert := func(p int) uint32 {
+		i := uint32(len(m.Pos))
+		m.Pos = append(m.Pos, o.Pos[p])
+		if len(o.Col) > 0 {
+			m.Col = append(m.Col, o.Col[p])
+		}
+		return i
+	}
+
+	known := make(map[[3]int]uint32)
+	for _, f := range o.Face {
+		for _, v := range f {
+			i, ok := known[v]
+			if !ok {
+				i = addVert(v[0])
+				known[v] = i
+				// vertices without their own index get zeros, as
+				// those of lines and points do
+				if len(o.Tex) > 0 {
+					var t [3]float32
+					if v[1] >= 0 {
+						t = o.Tex[v[1]]
+					}
+					m.Tex = append(m.Tex, t)
+				}
+				if len(o.Nor) > 0 {
+					var n [3]float32
+					if v[2] >= 0 {
+						n = o.Nor[v[2]]
+					}
+					m.Nor = append(m.Nor, n)
+				}
+			}
+			m.Tris = append(m.Tris, i)
+		}
+	}
+
+	elemVerts := make(map[int]uint32)
+	elemVert := func(p int) uint32 {
+		i, ok := elemVerts[p]
+		if ok {
+			return i
+		}
+		i = addVert(p)
+		elemVerts[p] = i
+		if m.Tex != nil {
+			m.Tex = append(m.Tex, [3]float32{})
+		}
+		if m.Nor != nil {
+			m.Nor = append(m.Nor, [3]float32{})
+		}
+		return i
+	}
+	for _, l := range o.Lines {
+		for i := 1; i < len(l); i++ {
+			m.Lines = append(m.Lines, elemVert(l[i-1]), elemVert(l[i]))
+		}
+	}
+	for _, p := range o.Points {
+		m.Points = append(m.Points, elemVert(p))
+	}
+
+	return &m
 }
 
 func (o *Obj) VertPos(face, vertex int) *[4]float32 {
@@ -97,7 +503,7 @@ func parseFace(fields []string, _face *[][3]int) error {
 		N
 	)
 
-	face := *_face
+	face := (*_face)[:0]
 
 	var err error
 	var vertices [][]string
@@ -151,38 +557,81 @@ func parseFace(fields []string, _face *[][3]int) error {
 				return fmt.Errorf("vertex %v:%s: %v", i, vertices[i], err)
 			}
 		}
+		face = append(face, vertex)
 	}
 
 	*_face = face
 	return nil
 }
 
-func Stream(r io.Reader) error {
-	var emitPos func([4]float32)
-	var emitNor func([3]float32)
-	var emitTex func([3]float32)
-	var emitFace func([][3]int)
+// Options controls how Decode treats lines it cannot use.
+type Options struct {
+	// Strict rejects unknown elements and malformed lines with an error.
+	// Otherwise they are skipped, and a warning is returned for each.
+	// Malformed v, vt and vn lines are kept as zeros rather than skipped,
+	// as the indices of the faces after them count them.
+	Strict bool
+}
 
-	line := 0
-	// reuse face between loops to reduce allocations
-	var face [][3]int
+// Warning describes a line skipped by a lenient decode.
+type Warning struct {
+	Line int
+	Msg  string
+}
 
-	scanner := bufio.NewScanner(r)
-	scanner.Split(bufio.ScanLines)
-	for scanner.Scan() {
-		line++
-		fields := strings.Fields(scanner.Text())
-		if len(fields) == 0 {
-			// rather than nest in len(fields) != 0
-			continue
+func (w Warning) String() string {
+	return fmt.Sprintf("%v: %v", w.Line, w.Msg)
+}
+
+// Handler receives the elements decoded by Stream. Elements without a
+// function are skipped.
+type Handler struct {
+	Pos func([4]float32)
+	Tex func([3]float32)
+	Nor func([3]float32)
+	// Face receives zero based indices like Obj.Face, relative indices
+	// resolved against the attributes before the face. The slice is reused
+	// for the next face.
+	Face func([][3]int)
+}
+
+// Stream decodes an OBJ file element by element, skipping the lines it
+// cannot use when not strict like DecodeOptions.
+func Stream(r io.Reader, h Handler, opts Options) ([]Warning, error) {
+	emitPos := func(v [4]float32) {
+		if h.Pos != nil {
+			h.Pos(v)
+		}
+	}
+	emitTex := func(v [3]float32) {
+		if h.Tex != nil {
+			h.Tex(v)
 		}
+	}
+	emitNor := func(v [3]float32) {
+		if h.Nor != nil {
+			h.Nor(v)
+		}
+	}
+	emitFace := func(f [][3]int) {
+		if h.Face != nil {
+			h.Face(f)
+		}
+	}
+
+	var warnings []Warning
+	// reuse face between loops to reduce allocations
+	var face [][3]int
+	// the attributes read so far, which relative indices count back from
+	var numPos, numTex, numNor int
 
+	streamLine := func(fields []string) error {
 		switch toElem(fields[0]) {
 		case comElem:
 			// nop
 		case posElem:
 			if len(fields) < 4 || len(fields) > 5 {
-				return fmt.Errorf("%v: v requires 3 or 4 values", line)
+				return fmt.Errorf("v requires 3 or 4 values")
 			}
 
 			var pos [4]float32
@@ -191,15 +640,16 @@ func Stream(r io.Reader) error {
 			for i, v := range fields[1:] {
 				f, err := strconv.ParseFloat(v, 32)
 				if err != nil {
-					return fmt.Errorf("%v: %v", line, err)
+					return err
 				}
 				pos[i] = float32(f)
 			}
 
 			emitPos(pos)
+			numPos++
 		case texElem:
 			if len(fields) < 3 || len(fields) > 4 {
-				return fmt.Errorf("%v: vt requires 2 or 3 values", line)
+				return fmt.Errorf("vt requires 2 or 3 values")
 			}
 
 			var tex [3]float32
@@ -207,51 +657,124 @@ func Stream(r io.Reader) error {
 			for i, v := range fields[1:] {
 				f, err := strconv.ParseFloat(v, 32)
 				if err != nil {
-					return fmt.Errorf("%v: %v", line, err)
+					return err
 				}
 				tex[i] = float32(f)
 			}
 
 			emitTex(tex)
+			numTex++
 		case norElem:
 			if len(fields) != 4 {
-				return fmt.Errorf("%v: vn requires 3 values", line)
+				return fmt.Errorf("vn requires 3 values")
 			}
 
 			var nor [3]float32
 			for i, v := range fields[1:] {
 				f, err := strconv.ParseFloat(v, 32)
 				if err != nil {
-					return fmt.Errorf("%v: %v", line, err)
+					return err
 				}
 				nor[i] = float32(f)
 			}
 
 			emitNor(nor)
+			numNor++
 		case facElem:
 			if len(fields) != 4 {
-				return fmt.Errorf("%v: f requires 3 vertices", line)
+				return fmt.Errorf("f requires 3 vertices")
 			}
 
 			err := parseFace(fields[1:], &face)
 			if err != nil {
-				return fmt.Errorf("%v: %v", line, err)
+				return err
+			}
+			for i := range face {
+				face[i][0], err = adjustIndex(face[i][0], numPos)
+				if err != nil {
+					return fmt.Errorf("vertex %v:v-index: %v", i, err)
+				}
+				face[i][1], err = adjustIndex(face[i][1], numTex)
+				if err != nil {
+					return fmt.Errorf("vertex %v:vt-index: %v", i, err)
+				}
+				face[i][2], err = adjustIndex(face[i][2], numNor)
+				if err != nil {
+					return fmt.Errorf("vertex %v:vn-index: %v", i, err)
+				}
 			}
 
 			emitFace(face)
 		case errElem:
-			fmt.Printf("%v: %s element not supported\n", line, fields[0])
+			return fmt.Errorf("%s element not supported", fields[0])
 		}
+		return nil
+	}
+
+	line := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			// rather than nest in len(fields) != 0
+			continue
+		}
+
+		err := streamLine(fields)
+		if err == nil {
+			continue
+		}
+		if opts.Strict {
+			return nil, fmt.Errorf("%v: %v", line, err)
+		}
+		switch toElem(fields[0]) {
+		case posElem:
+			emitPos([4]float32{0, 0, 0, 1})
+			numPos++
+		case texElem:
+			emitTex([3]float32{})
+			numTex++
+		case norElem:
+			emitNor([3]float32{})
+			numNor++
+		}
+		warnings = append(warnings, Warning{line, err.Error()})
 	}
 
 	if err := scanner.Err(); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return warnings, nil
+}
+
+// startGroup ends the current group at the last face read and starts g,
+// dropping the current one if it has no faces.
+func startGroup(o *Obj, g Group) {
+	f := len(o.Face)
+	if n := len(o.Groups); n > 0 {
+		o.Groups[n-1].End = f
+		if o.Groups[n-1].Start == f {
+			o.Groups = o.Groups[:n-1]
+		}
+	} else if f > 0 {
+		o.Groups = append(o.Groups, Group{End: f})
+	}
+	g.Start = f
+	o.Groups = append(o.Groups, g)
 }
 
+// Decode decodes strictly, failing on the first line it cannot use.
 func Decode(r io.Reader) (*Obj, error) {
+	o, _, err := DecodeOptions(r, Options{Strict: true})
+	return o, err
+}
+
+// DecodeOptions decodes an OBJ file, returning the lines skipped when not
+// strict.
+func DecodeOptions(r io.Reader, opts Options) (*Obj, []Warning, error) {
 	const (
 		P = iota
 		T
@@ -259,163 +782,300 @@ func Decode(r io.Reader) (*Obj, error) {
 	)
 
 	var o Obj
+	var warnings []Warning
+
+	// reused between lines to avoid allocating for each
+	var fields [][]byte
+	var vertices [3][3][]byte
+	var floats [4]float32
 
-	addFace := func(fields []string) error {
-		// addFace is always called with 3 fields
+	decodeFace := func(fields [][]byte) ([3][3]int, error) {
+		// decodeFace is always called with 3 fields
 		if len(fields) != 3 {
-			panic("addFace: number of fields != 3, have " + strconv.Itoa(len(fields)))
+			panic("decodeFace: number of fields != 3, have " + strconv.Itoa(len(fields)))
 		}
 
+		var face [3][3]int
 		var err error
-		var vertices [3][]string
+		var numAtts [3]int
 		for i, v := range fields {
-			vertices[i] = strings.Split(v, "/")
-			if len(vertices[i]) > 3 {
-				return fmt.Errorf("vertex %v:%s: vertices cannot have more than three attributes", i, vertices[i])
+			numAtts[i] = splitVertex(&vertices[i], v)
+			if numAtts[i] > 3 {
+				return face, fmt.Errorf("vertex %v:%s: vertices cannot have more than three attributes", i, v)
 			}
 		}
 
 		// The first vertex is a template for the following vertices
-		numAtt := len(vertices[0])
+		numAtt := numAtts[0]
 		var skipTex bool
 		if numAtt == 3 {
 			skipTex = (len(vertices[0][T]) == 0)
 		}
 
-		// Start a new face
-		f := len(o.Face)
-		o.Face = append(o.Face, [3][3]int{})
-
 		for i, vert := range vertices {
-			if len(vert) != numAtt {
-				return fmt.Errorf("vertex %v:%s: all vertices must have the same number of attributes", i, vertices[i])
+			if numAtts[i] != numAtt {
+				return face, fmt.Errorf("vertex %v:%s: all vertices must have the same number of attributes", i, fields[i])
 			}
 
-			o.Face[f][i][P], err = toIndex(vert[P])
+			face[i][P], err = parseIndex(vert[P])
 			if err != nil {
-				return fmt.Errorf("vertex %v:%s: %v", i, vertices[i], err)
+				return face, fmt.Errorf("vertex %v:%s: %v", i, fields[i], err)
 			}
 
 			switch numAtt {
 			case 2:
-				o.Face[f][i][T], err = toIndex(vert[T])
+				face[i][T], err = parseIndex(vert[T])
 				if err != nil {
-					return fmt.Errorf("vertex %v:%s: %v", i, vertices[i], err)
+					return face, fmt.Errorf("vertex %v:%s: %v", i, fields[i], err)
 				}
 			case 3:
 				if skipTex {
 					if len(vert[T]) != 0 {
-						return fmt.Errorf("vertex %v:%s: all texture indices must be present or elided", i, vertices[i])
+						return face, fmt.Errorf("vertex %v:%s: all texture indices must be present or elided", i, fields[i])
 					}
-					o.Face[f][i][T] = 0
+					face[i][T] = 0
 				} else {
-					o.Face[f][i][T], err = toIndex(vert[T])
+					face[i][T], err = parseIndex(vert[T])
 					if err != nil {
-						return fmt.Errorf("vertex %v:%s: %v", i, vertices[i], err)
+						return face, fmt.Errorf("vertex %v:%s: %v", i, fields[i], err)
 					}
 				}
 
-				o.Face[f][i][N], err = toIndex(vert[N])
+				face[i][N], err = parseIndex(vert[N])
 				if err != nil {
-					return fmt.Errorf("vertex %v:%s: %v", i, vertices[i], err)
+					return face, fmt.Errorf("vertex %v:%s: %v", i, fields[i], err)
 				}
 			}
 		}
 
-		for i := range o.Face[f] {
-			o.Face[f][i][P], err = adjustIndex(o.Face[f][i][P], len(o.Pos))
+		for i := range face {
+			face[i][P], err = adjustIndex(face[i][P], len(o.Pos))
 			if err != nil {
-				return fmt.Errorf("vertex %v:%s:v-index: %v", i, vertices[i], err)
+				return face, fmt.Errorf("vertex %v:%s:v-index: %v", i, fields[i], err)
 			}
-			o.Face[f][i][T], err = adjustIndex(o.Face[f][i][T], len(o.Tex))
+			face[i][T], err = adjustIndex(face[i][T], len(o.Tex))
 			if err != nil {
-				return fmt.Errorf("vertex %v:%s:vt-index: %v", i, vertices[i], err)
+				return face, fmt.Errorf("vertex %v:%s:vt-index: %v", i, fields[i], err)
 			}
-			o.Face[f][i][N], err = adjustIndex(o.Face[f][i][N], len(o.Nor))
+			face[i][N], err = adjustIndex(face[i][N], len(o.Nor))
 			if err != nil {
-				return fmt.Errorf("vertex %v:%s:vn-index: %v", i, vertices[i], err)
+				return face, fmt.Errorf("vertex %v:%s:vn-index: %v", i, fields[i], err)
 			}
 		}
 
-		return nil
+		return face, nil
 	}
 
-	line := 0
-	scanner := bufio.NewScanner(r)
-	scanner.Split(bufio.ScanLines)
-	for scanner.Scan() {
-		line++
-		fields := strings.Fields(scanner.Text())
-		if len(fields) == 0 {
-			// rather than nest in len(fields) != 0
-			continue
+	// parseFloats parses fields into the start of floats
+	parseFloats := func(fields [][]byte) error {
+		for i, v := range fields {
+			f, err := parseFloat32(v)
+			if err != nil {
+				return err
+			}
+			floats[i] = f
 		}
+		return nil
+	}
 
-		switch toElem(fields[0]) {
+	// joinFields joins the fields of names that may contain spaces
+	joinFields := func(fields [][]byte) string {
+		return string(bytes.Join(fields, []byte(" ")))
+	}
+
+	smooth := 0
+	// decodeLine adds the element of a line to o, leaving o unchanged if
+	// the line is malformed.
+	decodeLine := func(fields [][]byte, text []byte) error {
+		switch bytesElem(fields[0]) {
 		case comElem:
-			// nop
+			if o.Units == "" {
+				o.Units, _ = unitsFromComment(string(text))
+			}
 		case posElem:
-			if len(fields) < 4 || len(fields) > 5 {
-				return nil, fmt.Errorf("%v: v requires 3 or 4 values", line)
+			if len(fields) < 4 || len(fields) > 5 && len(fields) != 7 {
+				return fmt.Errorf("v requires 3 or 4 values, or 3 and a color")
+			}
+
+			// the nonstandard x y z r g b form carries a vertex color
+			var col [][]byte
+			if len(fields) == 7 {
+				fields, col = fields[:4], fields[4:]
 			}
 
-			p := len(o.Pos)
-			o.Pos = append(o.Pos, [4]float32{})
 			// default w coordinate to 1, per spec
-			o.Pos[p][3] = 1
-			for i, v := range fields[1:] {
-				f, err := strconv.ParseFloat(v, 32)
-				if err != nil {
-					return nil, fmt.Errorf("%v: %v", line, err)
+			floats[3] = 1
+			if err := parseFloats(fields[1:]); err != nil {
+				return err
+			}
+			pos := floats
+			c := [3]float32{1, 1, 1}
+			if col != nil {
+				if err := parseFloats(col); err != nil {
+					return err
 				}
-				o.Pos[p][i] = float32(f)
+				copy(c[:], floats[:3])
+			}
+
+			p := len(o.Pos)
+			o.Pos = append(o.Pos, pos)
+			if col == nil && o.Col == nil {
+				return nil
+			}
+			// vertices without a color among those with one are white
+			for len(o.Col) <= p {
+				o.Col = append(o.Col, [3]float32{1, 1, 1})
 			}
+			o.Col[p] = c
 		case texElem:
 			if len(fields) < 3 || len(fields) > 4 {
-				return nil, fmt.Errorf("%v: vt requires 2 or 3 values", line)
+				return fmt.Errorf("vt requires 2 or 3 values")
 			}
 
-			t := len(o.Tex)
-			o.Tex = append(o.Tex, [3]float32{})
 			// w coordinate defaults to 0, per spec
-			for i, v := range fields[1:] {
-				f, err := strconv.ParseFloat(v, 32)
-				if err != nil {
-					return nil, fmt.Errorf("%v: %v", line, err)
-				}
-				o.Tex[t][i] = float32(f)
+			floats[2] = 0
+			if err := parseFloats(fields[1:]); err != nil {
+				return err
 			}
+			o.Tex = append(o.Tex, [3]float32{floats[0], floats[1], floats[2]})
 		case norElem:
 			if len(fields) != 4 {
-				return nil, fmt.Errorf("%v: vn requires 3 values", line)
+				return fmt.Errorf("vn requires 3 values")
 			}
 
-			n := len(o.Nor)
-			o.Nor = append(o.Nor, [3]float32{})
-			for i, v := range fields[1:] {
-				f, err := strconv.ParseFloat(v, 32)
-				if err != nil {
-					return nil, fmt.Errorf("%v: %v", line, err)
-				}
-				o.Nor[n][i] = float32(f)
+			if err := parseFloats(fields[1:]); err != nil {
+				return err
 			}
+			o.Nor = append(o.Nor, [3]float32{floats[0], floats[1], floats[2]})
 		case facElem:
 			if len(fields) != 4 {
-				return nil, fmt.Errorf("%v: f requires 3 vertices", line)
+				return fmt.Errorf("f requires 3 vertices")
 			}
 
-			err := addFace(fields[1:])
+			face, err := decodeFace(fields[1:])
 			if err != nil {
-				return nil, fmt.Errorf("%v: %v", line, err)
+				return err
+			}
+			o.Face = append(o.Face, face)
+			if o.Smooth != nil {
+				o.Smooth = append(o.Smooth, smooth)
+			}
+		case linElem, pntElem:
+			min := 2
+			if bytesElem(fields[0]) == pntElem {
+				min = 1
+			}
+			if len(fields) < 1+min {
+				return fmt.Errorf("%s requires at least %v vertices", fields[0], min)
+			}
+
+			idx := make([]int, 0, len(fields)-1)
+			for _, v := range fields[1:] {
+				// texture indices of l vertices are ignored
+				if j := bytes.IndexByte(v, '/'); j >= 0 {
+					v = v[:j]
+				}
+				i, err := parseIndex(v)
+				if err != nil {
+					return err
+				}
+				i, err = adjustIndex(i, len(o.Pos))
+				if err != nil {
+					return err
+				}
+				idx = append(idx, i)
+			}
+			if bytesElem(fields[0]) == linElem {
+				o.Lines = append(o.Lines, idx)
+			} else {
+				o.Points = append(o.Points, idx...)
+			}
+		case smoElem:
+			if len(fields) != 2 {
+				return fmt.Errorf("s requires a group number or off")
+			}
+			g := uint64(0)
+			if string(fields[1]) != "off" {
+				var err error
+				g, err = strconv.ParseUint(string(fields[1]), 10, 31)
+				if err != nil {
+					return err
+				}
+			}
+			smooth = int(g)
+			// faces before the first s statement are not smoothed
+			if o.Smooth == nil {
+				o.Smooth = make([]int, len(o.Face))
+			}
+		case objElem, grpElem, useElem:
+			var g Group
+			if n := len(o.Groups); n > 0 {
+				g = o.Groups[n-1]
+			}
+			switch bytesElem(fields[0]) {
+			case objElem:
+				g.Object, g.Name = joinFields(fields[1:]), ""
+			case grpElem:
+				g.Name = joinFields(fields[1:])
+			case useElem:
+				g.Material = joinFields(fields[1:])
+			}
+			startGroup(&o, g)
+		case libElem:
+			// names may not contain spaces, unlike materials
+			for _, f := range fields[1:] {
+				o.MtlLibs = append(o.MtlLibs, string(f))
 			}
 		case errElem:
-			fmt.Printf("%v: %s element not supported\n", line, fields[0])
+			return fmt.Errorf("%s element not supported", fields[0])
 		}
+		return nil
+	}
+
+	line := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), bufio.MaxScanTokenSize)
+	scanner.Split(bufio.ScanLines)
+	for scanner.Scan() {
+		line++
+		text := scanner.Bytes()
+		fields = splitFields(fields, text)
+		if len(fields) == 0 {
+			// rather than nest in len(fields) != 0
+			continue
+		}
+
+		err := decodeLine(fields, text)
+		if err == nil {
+			continue
+		}
+		if opts.Strict {
+			return nil, nil, fmt.Errorf("%v: %v", line, err)
+		}
+		switch bytesElem(fields[0]) {
+		case posElem:
+			o.Pos = append(o.Pos, [4]float32{0, 0, 0, 1})
+			if o.Col != nil {
+				o.Col = append(o.Col, [3]float32{1, 1, 1})
+			}
+		case texElem:
+			o.Tex = append(o.Tex, [3]float32{})
+		case norElem:
+			o.Nor = append(o.Nor, [3]float32{})
+		}
+		warnings = append(warnings, Warning{line, err.Error()})
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if n := len(o.Groups); n > 0 {
+		o.Groups[n-1].End = len(o.Face)
+		if o.Groups[n-1].Start == o.Groups[n-1].End {
+			o.Groups = o.Groups[:n-1]
+		}
 	}
 
-	return &o, nil
+	return &o, warnings, nil
 }
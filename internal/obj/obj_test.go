@@ -1,7 +1,14 @@
 package obj
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -32,3 +39,561 @@ func TestDecode(t *testing.T) {
 		t.Error("expected 2048 Face elements, got ", len(o.Face))
 	}
 }
+
+func TestDecodeUnits(t *testing.T) {
+	cases := []struct {
+		src   string
+		units string
+	}{
+		{"# Units: mm\nv 0 0 0\n", "mm"},
+		{"# File units = centimeters\nv 0 0 0\n", "cm"},
+		{"#units inches\n", "in"},
+		{"# Blender v2.76 (sub 0) OBJ File: ''\n# www.blender.org\n", ""},
+		{"# meters mentioned without a unit keyword\n", ""},
+		{"# units: m\n# units: mm\n", "m"},
+	}
+
+	for _, c := range cases {
+		o, err := Decode(strings.NewReader(c.src))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if o.Units != c.units {
+			t.Errorf("%q: expected units %q, got %q", c.src, c.units, o.Units)
+		}
+	}
+}
+
+func TestGenerateNormals(t *testing.T) {
+	// two triangles of a unit square in the xy plane, and one folded up
+	// along x = 1 into the xz plane
+	src := `v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+v 1 0 -1
+f 1 2 3
+f 1 3 4
+f 2 5 3
+`
+	o, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o.GenerateNormals()
+	if len(o.Nor) != len(o.Pos) {
+		t.Fatalf("expected %v normals, got %v", len(o.Pos), len(o.Nor))
+	}
+
+	for f := range o.Face {
+		for i := range o.Face[f] {
+			if o.Face[f][i][2] != o.Face[f][i][0] {
+				t.Errorf("face %v vertex %v: normal index %v, expected %v", f, i, o.Face[f][i][2], o.Face[f][i][0])
+			}
+		}
+	}
+
+	near := func(a, b [3]float32) bool {
+		for i := range a {
+			if d := a[i] - b[i]; d > 1e-5 || d < -1e-5 {
+				return false
+			}
+		}
+		return true
+	}
+
+	if !near(o.Nor[0], [3]float32{0, 0, 1}) {
+		t.Errorf("flat vertex: expected +z, got %v", o.Nor[0])
+	}
+	if !near(o.Nor[4], [3]float32{1, 0, 0}) {
+		t.Errorf("folded vertex: expected +x, got %v", o.Nor[4])
+	}
+
+	// position 2 sees 45 degrees of each +z triangle and 45 of the +x one,
+	// so leans 2:1 towards +z
+	l := float32(math.Sqrt(5))
+	if !near(o.Nor[2], [3]float32{1 / l, 0, 2 / l}) {
+		t.Errorf("shared vertex: expected angle weighted normal, got %v", o.Nor[2])
+	}
+}
+
+func TestDecodeVertexColors(t *testing.T) {
+	src := `v 0 0 0
+v 1 0 0 1 0 0
+v 0 1 0 0 0.5 1
+f 1 2 3
+`
+	o, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][3]float32{{1, 1, 1}, {1, 0, 0}, {0, 0.5, 1}}
+	if len(o.Col) != len(expected) {
+		t.Fatalf("expected %v colors, got %v", len(expected), len(o.Col))
+	}
+	for i := range expected {
+		if o.Col[i] != expected[i] {
+			t.Errorf("color %v: expected %v, got %v", i, expected[i], o.Col[i])
+		}
+	}
+	if o.Pos[1] != [4]float32{1, 0, 0, 1} {
+		t.Errorf("colored position: got %v", o.Pos[1])
+	}
+
+	o, err = Decode(strings.NewReader("v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Col != nil {
+		t.Errorf("expected no colors, got %v", o.Col)
+	}
+}
+
+func TestDecodeGroups(t *testing.T) {
+	src := `v 0 0 0
+v 1 0 0
+v 0 1 0
+f 1 2 3
+o body
+g
+g left arm
+f 1 2 3
+f 1 2 3
+g right
+usemtl skin
+f 1 2 3
+o head
+f 1 2 3
+usemtl eyes
+f 1 2 3
+g empty
+`
+	o, err := Decode(strings.NewReader("mtllib a.mtl b.mtl\n" + src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o.MtlLibs) != 2 || o.MtlLibs[1] != "b.mtl" {
+		t.Errorf("unexpected material libraries %v", o.MtlLibs)
+	}
+
+	expected := []Group{
+		{"", "", "", 0, 1},
+		{"body", "left arm", "", 1, 3},
+		{"body", "right", "skin", 3, 4},
+		{"head", "", "skin", 4, 5},
+		{"head", "", "eyes", 5, 6},
+	}
+	if len(o.Groups) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, o.Groups)
+	}
+	for i := range expected {
+		if o.Groups[i] != expected[i] {
+			t.Errorf("group %v: expected %v, got %v", i, expected[i], o.Groups[i])
+		}
+	}
+}
+
+func TestGenerateNormalsSmoothingGroups(t *testing.T) {
+	// the folded square of TestGenerateNormals, with the fold a hard edge
+	src := `v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+v 1 0 -1
+s 1
+f 1 2 3
+f 1 3 4
+s off
+f 2 5 3
+`
+	o, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Smooth) != 3 || o.Smooth[0] != 1 || o.Smooth[1] != 1 || o.Smooth[2] != 0 {
+		t.Fatalf("unexpected smoothing groups %v", o.Smooth)
+	}
+
+	o.GenerateNormals()
+	// 4 in the square, 3 flat in the fold
+	if len(o.Nor) != 7 {
+		t.Fatalf("expected 7 normals, got %v", len(o.Nor))
+	}
+	for f, expected := range [][3]float32{{0, 0, 1}, {0, 0, 1}, {1, 0, 0}} {
+		for i := range o.Face[f] {
+			if n := *o.VertNor(f, i); n != expected {
+				t.Errorf("face %v vertex %v: expected %v, got %v", f, i, expected, n)
+			}
+		}
+	}
+	if o.Face[0][2][2] != o.Face[1][1][2] {
+		t.Error("expected the square to share the normal of position 3")
+	}
+}
+
+func TestDecodeLinesAndPoints(t *testing.T) {
+	src := `v 0 0 0
+v 1 0 0
+v 1 1 0
+vt 0 0
+l 1/1 2/1 3/1
+p 3 -1
+l -3 -2
+`
+	o, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(o.Lines) != 2 || len(o.Lines[0]) != 3 || o.Lines[0][2] != 2 {
+		t.Errorf("unexpected lines %v", o.Lines)
+	}
+	if len(o.Points) != 2 || o.Points[0] != 2 {
+		t.Errorf("unexpected points %v", o.Points)
+	}
+	if len(o.Face) != 0 {
+		t.Errorf("expected no faces, got %v", o.Face)
+	}
+
+	_, _, err = DecodeOptions(strings.NewReader("v 0 0 0\nl 1\n"), Options{Strict: true})
+	if err == nil {
+		t.Error("expected an error for a line of one vertex")
+	}
+}
+
+func TestDecodeOptions(t *testing.T) {
+	src := `v 0 0 0
+v 1 0 0
+v 1 x 0
+v 0 1 0
+vp 0.5
+f 1 2 3
+f 1 2 9
+cstype bspline
+`
+	_, _, err := DecodeOptions(strings.NewReader(src), Options{Strict: true})
+	if err == nil || !strings.HasPrefix(err.Error(), "3: ") {
+		t.Errorf("strict: expected an error on line 3, got %v", err)
+	}
+	if _, err := Decode(strings.NewReader(src)); err == nil {
+		t.Errorf("expected Decode to be strict")
+	}
+
+	o, warnings, err := DecodeOptions(strings.NewReader(src), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []int
+	for _, w := range warnings {
+		lines = append(lines, w.Line)
+	}
+	want := []int{3, 5, 7, 8}
+	if len(lines) != len(want) {
+		t.Fatalf("expected warnings on lines %v, got %v", want, warnings)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("expected warnings on lines %v, got %v", want, warnings)
+			break
+		}
+	}
+	// the malformed position is kept, so later indices still count it
+	if len(o.Pos) != 4 || len(o.Face) != 1 {
+		t.Fatalf("expected 4 positions and 1 face, got %v and %v", len(o.Pos), len(o.Face))
+	}
+	if o.Pos[2] != [4]float32{0, 0, 0, 1} || o.Pos[3] != [4]float32{0, 1, 0, 1} {
+		t.Errorf("expected a zero placeholder before the fourth position, got %v", o.Pos)
+	}
+	if w := warnings[1].String(); w != "5: vp element not supported" {
+		t.Errorf("unexpected warning %q", w)
+	}
+}
+
+// benchGrid returns an OBJ of an n by n grid of quads, with texture
+// coordinates and normals, as written by typical exporters.
+func benchGrid(n int) []byte {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "# Units: m")
+	fmt.Fprintln(&b, "o grid")
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			fx, fy := float64(x)/float64(n), float64(y)/float64(n)
+			fmt.Fprintf(&b, "v %.6f %.6f %.6f\n", fx*2-1, math.Sin(fx*7)*math.Cos(fy*5)*0.1, fy*2-1)
+			fmt.Fprintf(&b, "vt %.6f %.6f\n", fx, fy)
+			fmt.Fprintf(&b, "vn %.4f %.4f %.4f\n", 0.0, 1.0, 0.0)
+		}
+	}
+	fmt.Fprintln(&b, "usemtl default")
+	fmt.Fprintln(&b, "s 1")
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			i := y*(n+1) + x + 1
+			j := i + n + 1
+			fmt.Fprintf(&b, "f %v/%v/%v %v/%v/%v %v/%v/%v\n", i, i, i, i+1, i+1, i+1, j+1, j+1, j+1)
+			fmt.Fprintf(&b, "f %v/%v/%v %v/%v/%v %v/%v/%v\n", i, i, i, j+1, j+1, j+1, j, j, j)
+		}
+	}
+	return b.Bytes()
+}
+
+func BenchmarkDecode(b *testing.B) {
+	src := benchGrid(300)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := Decode(bytes.NewReader(src))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeFile(b *testing.B) {
+	src, err := ioutil.ReadFile("test.obj")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := Decode(bytes.NewReader(src))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseFloat32(t *testing.T) {
+	cases := []string{
+		"0", "-0", "1", "-1", "+2.5", "0.000001", "0.123456", "-0.8127431",
+		"16777215", "16777217", "3.4028235e38", "1e-45", "1.0e-3", "2E+5",
+		"12345.678901", ".5", "5.", "1e10", "1e11", "0.1e-10",
+		"nan", "inf", "", "-", ".", "1e", "1x", "1.2.3", "--1",
+	}
+	for _, c := range cases {
+		want, werr := strconv.ParseFloat(c, 32)
+		got, err := parseFloat32([]byte(c))
+		if (err != nil) != (werr != nil) {
+			t.Errorf("%q: expected error %v, got %v", c, werr, err)
+			continue
+		}
+		if err == nil && got != float32(want) && !(math.IsNaN(want) && got != got) {
+			t.Errorf("%q: expected %v, got %v", c, float32(want), got)
+		}
+	}
+
+	// every decimal of 6 places in [0, 1) as exporters write them
+	for i := 0; i < 1000000; i += 7 {
+		s := fmt.Sprintf("%.6f", float64(i)/1000000)
+		want, _ := strconv.ParseFloat(s, 32)
+		got, _ := parseFloat32([]byte(s))
+		if got != float32(want) {
+			t.Fatalf("%q: expected %v, got %v", s, float32(want), got)
+		}
+	}
+}
+
+func TestParseIndex(t *testing.T) {
+	cases := []struct {
+		s   string
+		i   int
+		err bool
+	}{
+		{"1", 1, false},
+		{"-3", -3, false},
+		{"2147483647", 2147483647, false},
+		{"2147483648", 0, true},
+		{"0", 0, true},
+		{"-0", 0, true},
+		{"", 0, true},
+		{"-", 0, true},
+		{"1a", 0, true},
+	}
+	for _, c := range cases {
+		i, err := parseIndex([]byte(c.s))
+		if (err != nil) != c.err || i != c.i {
+			t.Errorf("%q: expected %v, error %v, got %v, %v", c.s, c.i, c.err, i, err)
+		}
+	}
+}
+
+func TestBounds(t *testing.T) {
+	// a right triangle of area 2 and a unit square of area 1 beside it
+	src := `v 0 0 0
+v 2 0 0
+v 0 2 0
+v 3 0 0
+v 4 0 0
+v 4 1 0
+v 3 1 0
+v 0 0 -2
+f 1 2 3
+f 4 5 6
+f 4 6 7
+`
+	o, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	min, max := o.Bounds()
+	if min != [3]float32{0, 0, -2} || max != [3]float32{4, 2, 0} {
+		t.Errorf("expected bounds [0 0 -2] [4 2 0], got %v %v", min, max)
+	}
+	if c := o.Center(); c != [3]float32{2, 1, -1} {
+		t.Errorf("expected center [2 1 -1], got %v", c)
+	}
+	if r := o.Radius(); math.Abs(float64(r)-math.Sqrt(6)) > 1e-6 {
+		t.Errorf("expected radius %v, got %v", math.Sqrt(6), r)
+	}
+	if a := o.SurfaceArea(); a != 3 {
+		t.Errorf("expected area 3, got %v", a)
+	}
+
+	// the triangle's centroid (2/3, 2/3) weighted 2 and the square's
+	// (3.5, 0.5) weighted 1
+	want := [3]float32{(4.0/3 + 3.5) / 3, (4.0/3 + 0.5) / 3, 0}
+	c := o.Centroid()
+	for i := range c {
+		if math.Abs(float64(c[i]-want[i])) > 1e-6 {
+			t.Errorf("expected centroid %v, got %v", want, c)
+			break
+		}
+	}
+
+	var empty Obj
+	if min, max := empty.Bounds(); min != max || empty.Radius() != 0 || empty.Centroid() != [3]float32{} {
+		t.Errorf("expected zeros without positions")
+	}
+}
+
+func TestInterleave(t *testing.T) {
+	// two faces sharing an edge, one of whose vertices has another texture
+	// coordinate in the second face, and a line along an edge
+	src := `v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vt 1 1
+vn 0 0 1
+f 1/1/1 2/1/1 3/1/1
+f 1/1/1 3/2/1 4/1/1
+l 1 2
+p 2
+`
+	o, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := o.Interleave()
+	if len(m.Pos) != 7 || len(m.Tex) != 7 || len(m.Nor) != 7 || m.Col != nil {
+		t.Fatalf("expected 7 vertices without colors, got %v positions, %v texcoords, %v normals and %v colors", len(m.Pos), len(m.Tex), len(m.Nor), len(m.Col))
+	}
+
+	want := []uint32{0, 1, 2, 0, 3, 4}
+	for i := range want {
+		if m.Tris[i] != want[i] {
+			t.Fatalf("expected triangles %v, got %v", want, m.Tris)
+		}
+	}
+	if m.Pos[3] != m.Pos[2] || m.Tex[3] != [3]float32{1, 1, 0} {
+		t.Errorf("expected vertex 3 at position 3 with the second texcoord, got %v %v", m.Pos[3], m.Tex[3])
+	}
+
+	if len(m.Lines) != 2 || m.Lines[0] != 5 || m.Lines[1] != 6 || len(m.Points) != 1 || m.Points[0] != 6 {
+		t.Errorf("expected line 5 6 and point 6, got %v and %v", m.Lines, m.Points)
+	}
+	if m.Nor[5] != [3]float32{} || m.Pos[6] != [4]float32{1, 0, 0, 1} {
+		t.Errorf("expected line vertices with zero normals, got %v at %v", m.Nor[5], m.Pos[6])
+	}
+}
+
+func TestInterleaveMissingIndices(t *testing.T) {
+	// normals in the file, but not given by the face
+	src := `v 0 0 0
+v 1 0 0
+v 1 1 0
+vn 0 0 1
+f 1 2 3
+f 1//1 2//1 3//1
+`
+	o, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := o.Interleave()
+	if len(m.Pos) != 6 || len(m.Nor) != 6 || m.Tex != nil {
+		t.Fatalf("expected 6 vertices with normals only, got %v positions, %v normals and %v texcoords", len(m.Pos), len(m.Nor), len(m.Tex))
+	}
+	if m.Nor[0] != [3]float32{} || m.Nor[3] != [3]float32{0, 0, 1} {
+		t.Errorf("expected zero normals where the face gives none, got %v and %v", m.Nor[0], m.Nor[3])
+	}
+}
+
+func TestRelativeIndices(t *testing.T) {
+	// relative indices count back from the attributes read before each
+	// element, not from the end of the file
+	src := `v 0 0 0
+v 1 0 0
+v 1 1 0
+vt 0 0
+vn 0 0 1
+f -3/-1/-1 -2/-1/-1 -1/-1/-1
+v 0 1 0
+vt 1 1
+f 1/1/1 -2/1/1 -1/-1/1
+l -1 -4
+p -2
+`
+	want := [][3][3]int{
+		{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}},
+		{{0, 0, 0}, {2, 0, 0}, {3, 1, 0}},
+	}
+
+	o, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(o.Face, want) {
+		t.Errorf("expected faces %v, got %v", want, o.Face)
+	}
+	if !reflect.DeepEqual(o.Lines, [][]int{{3, 0}}) || !reflect.DeepEqual(o.Points, []int{2}) {
+		t.Errorf("expected line [3 0] and point 2, got %v and %v", o.Lines, o.Points)
+	}
+
+	var streamed [][3][3]int
+	_, err = Stream(strings.NewReader(src), Handler{Face: func(f [][3]int) {
+		streamed = append(streamed, [3][3]int{f[0], f[1], f[2]})
+	}}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(streamed, want) {
+		t.Errorf("expected streamed faces %v, got %v", want, streamed)
+	}
+
+	faces := []string{
+		"v 0 0 0\nv 1 0 0\nf 1 2 3\nv 1 1 0\n",
+		"v 0 0 0\nv 1 0 0\nv 1 1 0\nf -1 -2 -4\n",
+		"v 0 0 0\nv 1 0 0\nv 1 1 0\nvt 0 0\nf 1/1 2/1 3/2\n",
+	}
+	for _, src := range append(faces, "v 0 0 0\nl 1 2\n", "v 0 0 0\np -2\n") {
+		if _, _, err := DecodeOptions(strings.NewReader(src), Options{Strict: true}); err == nil {
+			t.Errorf("%q: expected an out of range index error", src)
+		}
+	}
+	for _, src := range faces {
+		if _, err := Stream(strings.NewReader(src), Handler{}, Options{Strict: true}); err == nil {
+			t.Errorf("%q: expected an out of range index error when streamed", src)
+		}
+	}
+}
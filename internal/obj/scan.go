@@ -0,0 +1,174 @@
+package obj
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// The decoder works on the bytes of each line rather than strings, since
+// converting and splitting every line dominates decoding large files.
+
+var isSpace = [256]bool{' ': true, '\t': true, '\r': true, '\v': true, '\f': true}
+
+// splitFields splits line at spaces and tabs, reusing the storage of dst.
+func splitFields(dst [][]byte, line []byte) [][]byte {
+	dst = dst[:0]
+	start := -1
+	for i, c := range line {
+		if isSpace[c] {
+			if start >= 0 {
+				dst = append(dst, line[start:i])
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		dst = append(dst, line[start:])
+	}
+	return dst
+}
+
+// splitVertex splits a face vertex like 1/2/3 into dst, returning the
+// number of attributes, or 4 if there are more than 3.
+func splitVertex(dst *[3][]byte, v []byte) int {
+	n, start := 0, 0
+	for i, c := range v {
+		if c != '/' {
+			continue
+		}
+		if n == 2 {
+			return 4
+		}
+		dst[n] = v[start:i]
+		n++
+		start = i + 1
+	}
+	dst[n] = v[start:]
+	return n + 1
+}
+
+func bytesElem(b []byte) elem {
+	if len(b) > 0 && b[0] == '#' {
+		return comElem
+	}
+	// the conversion doesn't allocate in a switch
+	switch string(b) {
+	case "v":
+		return posElem
+	case "vt":
+		return texElem
+	case "vn":
+		return norElem
+	case "f":
+		return facElem
+	}
+	return toElem(string(b))
+}
+
+// parseIndex parses b like toIndex, without allocating for valid indices.
+func parseIndex(b []byte) (int, error) {
+	i, neg := 0, false
+	if len(b) > 0 && b[0] == '-' {
+		i, neg = 1, true
+	}
+	// more digits may overflow 32 bits, which toIndex reports
+	if len(b) == i || len(b)-i > 9 {
+		return toIndex(string(b))
+	}
+	val := 0
+	for ; i < len(b); i++ {
+		c := b[i]
+		if c < '0' || c > '9' {
+			return toIndex(string(b))
+		}
+		val = val*10 + int(c-'0')
+	}
+	if val == 0 {
+		return 0, fmt.Errorf("0 is not a valid index")
+	}
+	if neg {
+		val = -val
+	}
+	return val, nil
+}
+
+// float32Pow10 holds the powers of ten exactly representable as float32.
+var float32Pow10 = [...]float32{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10}
+
+// parseFloat32 parses b like strconv.ParseFloat(string(b), 32). Decimals of
+// up to 7 significant digits, which is what exporters write for float32
+// data, take a fast path that doesn't allocate: a mantissa and power of ten
+// that are both exact as float32 give a correctly rounded result with a
+// single multiplication or division.
+func parseFloat32(b []byte) (float32, error) {
+	i, neg := 0, false
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		i, neg = 1, b[0] == '-'
+	}
+
+	mant, exp := uint32(0), 0
+	digits, dot := false, false
+	for ; i < len(b); i++ {
+		c := b[i]
+		if c == '.' && !dot {
+			dot = true
+			continue
+		}
+		if c < '0' || c > '9' {
+			break
+		}
+		digits = true
+		mant = mant*10 + uint32(c-'0')
+		if mant >= 1<<24 {
+			return parseFloat32Slow(b)
+		}
+		if dot {
+			exp--
+		}
+	}
+	if !digits {
+		return parseFloat32Slow(b)
+	}
+
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		i++
+		eneg := false
+		if i < len(b) && (b[i] == '-' || b[i] == '+') {
+			eneg = b[i] == '-'
+			i++
+		}
+		e := 0
+		start := i
+		for ; i < len(b) && b[i] >= '0' && b[i] <= '9' && i-start < 3; i++ {
+			e = e*10 + int(b[i]-'0')
+		}
+		if i == start {
+			return parseFloat32Slow(b)
+		}
+		if eneg {
+			e = -e
+		}
+		exp += e
+	}
+	if i != len(b) || exp < -len(float32Pow10)+1 || exp > len(float32Pow10)-1 {
+		return parseFloat32Slow(b)
+	}
+
+	f := float32(mant)
+	if exp < 0 {
+		f /= float32Pow10[-exp]
+	} else {
+		f *= float32Pow10[exp]
+	}
+	if neg {
+		f = -f
+	}
+	return f, nil
+}
+
+func parseFloat32Slow(b []byte) (float32, error) {
+	f, err := strconv.ParseFloat(string(b), 32)
+	return float32(f), err
+}
@@ -0,0 +1,145 @@
+// Package osc decodes Open Sound Control 1.0 packets, the messages and
+// bundles TouchOSC, Max/MSP and the like send over UDP.
+package osc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Message is an address and its arguments: int32, float32, int64, float64,
+// string, []byte, bool, or nil for N and I.
+type Message struct {
+	Address string
+	Args    []interface{}
+}
+
+// Parse returns the messages of a packet, those of a bundle in order and
+// regardless of its time tag.
+func Parse(b []byte) ([]Message, error) {
+	if strings.HasPrefix(string(b), "#bundle\x00") {
+		if len(b) < 16 {
+			return nil, fmt.Errorf("truncated bundle")
+		}
+		var res []Message
+		b = b[16:]
+		for len(b) > 0 {
+			if len(b) < 4 {
+				return nil, fmt.Errorf("truncated bundle")
+			}
+			n := int(binary.BigEndian.Uint32(b))
+			if n < 0 || 4+n > len(b) {
+				return nil, fmt.Errorf("bundle element of %v bytes, %v left", n, len(b)-4)
+			}
+			ms, err := Parse(b[4 : 4+n])
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, ms...)
+			b = b[4+n:]
+		}
+		return res, nil
+	}
+
+	m, err := parseMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	return []Message{m}, nil
+}
+
+// readString reads a padded string, returning the rest of b.
+func readString(b []byte) (string, []byte, error) {
+	i := strings.IndexByte(string(b), 0)
+	if i < 0 {
+		return "", nil, fmt.Errorf("unterminated string")
+	}
+	n := (i + 4) &^ 3
+	if n > len(b) {
+		n = len(b)
+	}
+	return string(b[:i]), b[n:], nil
+}
+
+func parseMessage(b []byte) (Message, error) {
+	var m Message
+	var err error
+	m.Address, b, err = readString(b)
+	if err != nil {
+		return Message{}, err
+	}
+	if !strings.HasPrefix(m.Address, "/") {
+		return Message{}, fmt.Errorf("invalid address %q", m.Address)
+	}
+	if len(b) == 0 {
+		// old implementations omit the type tags of messages without
+		// arguments
+		return m, nil
+	}
+	tags, b, err := readString(b)
+	if err != nil {
+		return Message{}, err
+	}
+	if !strings.HasPrefix(tags, ",") {
+		return Message{}, fmt.Errorf("%v: invalid type tags %q", m.Address, tags)
+	}
+
+	need := func(n int) error {
+		if len(b) < n {
+			return fmt.Errorf("%v: truncated arguments", m.Address)
+		}
+		return nil
+	}
+	for _, t := range tags[1:] {
+		switch t {
+		case 'i', 'f':
+			if err := need(4); err != nil {
+				return Message{}, err
+			}
+			u := binary.BigEndian.Uint32(b)
+			if t == 'i' {
+				m.Args = append(m.Args, int32(u))
+			} else {
+				m.Args = append(m.Args, math.Float32frombits(u))
+			}
+			b = b[4:]
+		case 'h', 'd', 't':
+			if err := need(8); err != nil {
+				return Message{}, err
+			}
+			u := binary.BigEndian.Uint64(b)
+			if t == 'd' {
+				m.Args = append(m.Args, math.Float64frombits(u))
+			} else {
+				m.Args = append(m.Args, int64(u))
+			}
+			b = b[8:]
+		case 's', 'S':
+			var s string
+			s, b, err = readString(b)
+			if err != nil {
+				return Message{}, err
+			}
+			m.Args = append(m.Args, s)
+		case 'b':
+			if err := need(4); err != nil {
+				return Message{}, err
+			}
+			n := int(binary.BigEndian.Uint32(b))
+			if n < 0 || 4+n > len(b) {
+				return Message{}, fmt.Errorf("%v: truncated blob", m.Address)
+			}
+			m.Args = append(m.Args, b[4:4+n])
+			b = b[(4+n+3)&^3:]
+		case 'T', 'F':
+			m.Args = append(m.Args, t == 'T')
+		case 'N', 'I':
+			m.Args = append(m.Args, nil)
+		default:
+			return Message{}, fmt.Errorf("%v: unsupported type tag %c", m.Address, t)
+		}
+	}
+	return m, nil
+}
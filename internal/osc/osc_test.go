@@ -0,0 +1,61 @@
+package osc
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// pad terminates and pads a string as OSC does.
+func pad(s string) []byte {
+	b := append([]byte(s), 0)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func be32(u uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, u)
+	return b
+}
+
+func TestParse(t *testing.T) {
+	var msg []byte
+	msg = append(msg, pad("/uniform/roughness")...)
+	msg = append(msg, pad(",fiT")...)
+	msg = append(msg, be32(0x3f000000)...)
+	msg = append(msg, be32(7)...)
+	reset := pad("/transport/reset")
+
+	var bundle []byte
+	bundle = append(bundle, pad("#bundle")...)
+	bundle = append(bundle, 0, 0, 0, 0, 0, 0, 0, 1)
+	bundle = append(bundle, be32(uint32(len(msg)))...)
+	bundle = append(bundle, msg...)
+	bundle = append(bundle, be32(uint32(len(reset)))...)
+	bundle = append(bundle, reset...)
+
+	expected := []Message{
+		{"/uniform/roughness", []interface{}{float32(0.5), int32(7), true}},
+		{"/transport/reset", nil},
+	}
+	ms, err := Parse(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ms, expected) {
+		t.Errorf("expected %v, got %v", expected, ms)
+	}
+
+	for _, b := range [][]byte{
+		pad("no/slash"),
+		append(pad("/a"), pad(",f")...),
+		append(pad("/a"), pad(",x")...),
+	} {
+		if _, err := Parse(b); err == nil {
+			t.Errorf("%q: expected an error", b)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Package rgbe decodes Radiance RGBE (.hdr) images.
+package rgbe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Image is a decoded RGBE image as linear float RGB triplets, ordered from
+// the bottom scanline up, as OpenGL expects texture data.
+type Image struct {
+	Width  int
+	Height int
+	Pix    []float32
+}
+
+func readHeader(r *bufio.Reader) (int, int, error) {
+	magic, err := r.ReadString('\n')
+	if err != nil {
+		return 0, 0, err
+	}
+	if !strings.HasPrefix(magic, "#?") {
+		return 0, 0, fmt.Errorf("not a radiance file")
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return 0, 0, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT=32-bit_rle_rgbe" {
+			return 0, 0, fmt.Errorf("unsupported format %v", line[len("FORMAT="):])
+		}
+	}
+
+	res, err := r.ReadString('\n')
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var w, h int
+	_, err = fmt.Sscanf(res, "-Y %d +X %d", &h, &w)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unsupported resolution string %q", strings.TrimSpace(res))
+	}
+	if w <= 0 || h <= 0 {
+		return 0, 0, fmt.Errorf("invalid resolution %vx%v", w, h)
+	}
+
+	return w, h, nil
+}
+
+// readScanline reads one scanline of RGBE quadruplets into line, handling
+// both flat and run length encoded scanlines.
+func readScanline(r *bufio.Reader, line []byte) error {
+	w := len(line) / 4
+
+	head, err := r.Peek(4)
+	if err != nil {
+		return err
+	}
+
+	if w < 8 || w > 0x7fff || head[0] != 2 || head[1] != 2 || head[2]&0x80 != 0 {
+		_, err := io.ReadFull(r, line)
+		return err
+	}
+
+	if int(head[2])<<8|int(head[3]) != w {
+		return fmt.Errorf("scanline width mismatch")
+	}
+	r.Discard(4)
+
+	// each component is encoded separately
+	for c := 0; c < 4; c++ {
+		for x := 0; x < w; {
+			count, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+
+			if count > 128 {
+				n := int(count) - 128
+				if x+n > w {
+					return fmt.Errorf("run overflows scanline")
+				}
+				v, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				for ; n > 0; n-- {
+					line[x*4+c] = v
+					x++
+				}
+			} else {
+				n := int(count)
+				if n == 0 || x+n > w {
+					return fmt.Errorf("invalid literal run")
+				}
+				for ; n > 0; n-- {
+					v, err := r.ReadByte()
+					if err != nil {
+						return err
+					}
+					line[x*4+c] = v
+					x++
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func Decode(r io.Reader) (*Image, error) {
+	br := bufio.NewReader(r)
+	w, h, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	img := Image{Width: w, Height: h, Pix: make([]float32, w*h*3)}
+	line := make([]byte, w*4)
+	for y := 0; y < h; y++ {
+		err := readScanline(br, line)
+		if err != nil {
+			return nil, fmt.Errorf("scanline %v: %v", y, err)
+		}
+
+		// the file stores the top scanline first
+		row := img.Pix[(h-1-y)*w*3:]
+		for x := 0; x < w; x++ {
+			e := line[x*4+3]
+			if e == 0 {
+				continue
+			}
+			f := float32(math.Ldexp(1, int(e)-(128+8)))
+			row[x*3+0] = float32(line[x*4+0]) * f
+			row[x*3+1] = float32(line[x*4+1]) * f
+			row[x*3+2] = float32(line[x*4+2]) * f
+		}
+	}
+
+	return &img, nil
+}
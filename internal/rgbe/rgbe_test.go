@@ -0,0 +1,60 @@
+package rgbe
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodeFlat(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y 2 +X 1\n")
+	// top: 1.0 red, bottom: black
+	b.Write([]byte{128, 0, 0, 129})
+	b.Write([]byte{0, 0, 0, 0})
+
+	img, err := Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if img.Width != 1 || img.Height != 2 {
+		t.Fatalf("expected 1x2, got %vx%v", img.Width, img.Height)
+	}
+
+	expected := []float32{0, 0, 0, 1, 0, 0}
+	for i := range expected {
+		if img.Pix[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, img.Pix)
+			break
+		}
+	}
+}
+
+func TestDecodeRLE(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("#?RGBE\n\n-Y 1 +X 8\n")
+	b.Write([]byte{2, 2, 0, 8})
+	// red: a run of 8
+	b.Write([]byte{128 + 8, 128})
+	// green: 8 literals
+	b.Write([]byte{8, 0, 0, 0, 0, 128, 128, 128, 128})
+	// blue: a run of 8 zeroes
+	b.Write([]byte{128 + 8, 0})
+	// exponent: a run of 8
+	b.Write([]byte{128 + 8, 129})
+
+	img, err := Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for x := 0; x < 8; x++ {
+		r, g := img.Pix[x*3], img.Pix[x*3+1]
+		if r != 1 {
+			t.Errorf("pixel %v: expected red 1, got %v", x, r)
+		}
+		if (x < 4 && g != 0) || (x >= 4 && g != 1) {
+			t.Errorf("pixel %v: unexpected green %v", x, g)
+		}
+	}
+}
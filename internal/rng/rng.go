@@ -0,0 +1,84 @@
+// Package rng generates procedural shader inputs, noise and sample
+// sequences, that depend only on a seed, so that stochastic shaders render
+// the same frames every time.
+package rng
+
+import "hash/fnv"
+
+// Source is a PCG32 generator, the XSH RR variant with 64 bits of state.
+type Source struct {
+	state uint64
+	inc   uint64
+}
+
+// New returns a generator of the given stream, seeded as pcg32_srandom.
+func New(seed, stream uint64) *Source {
+	s := &Source{inc: stream<<1 | 1}
+	s.Uint32()
+	s.state += seed
+	s.Uint32()
+	return s
+}
+
+func (s *Source) Uint32() uint32 {
+	old := s.state
+	s.state = old*6364136223846793005 + s.inc
+	x := uint32(((old >> 18) ^ old) >> 27)
+	rot := uint32(old >> 59)
+	return x>>rot | x<<((-rot)&31)
+}
+
+// Float32 returns a number in [0, 1).
+func (s *Source) Float32() float32 {
+	return float32(s.Uint32()>>8) / (1 << 24)
+}
+
+// FrameSource returns the generator for the input name at a frame, from the
+// session's seed.
+func FrameSource(seed uint32, frame int64, name string) *Source {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return New(uint64(seed)<<32^uint64(frame), h.Sum64())
+}
+
+// White returns width by height RGBA8 pixels of uniform white noise.
+func White(width, height int, s *Source) []byte {
+	pix := make([]byte, width*height*4)
+	for i := 0; i < len(pix); i += 4 {
+		v := s.Uint32()
+		pix[i], pix[i+1], pix[i+2], pix[i+3] = byte(v), byte(v>>8), byte(v>>16), byte(v>>24)
+	}
+	return pix
+}
+
+func radicalInverse(i, base int) float32 {
+	f, r := float32(1), float32(0)
+	for ; i > 0; i /= base {
+		f /= float32(base)
+		r += f * float32(i%base)
+	}
+	return r
+}
+
+// Halton returns n points of the Halton sequence in bases 2, 3, 5 and 7 as
+// RGBA float32s, all shifted by the same random offset modulo 1, so each
+// frame gets a differently placed but equally well spread set.
+func Halton(n int, s *Source) []float32 {
+	var offset [4]float32
+	for i := range offset {
+		offset[i] = s.Float32()
+	}
+
+	bases := [4]int{2, 3, 5, 7}
+	res := make([]float32, 0, n*4)
+	for i := 1; i <= n; i++ {
+		for j, b := range bases {
+			v := radicalInverse(i, b) + offset[j]
+			if v >= 1 {
+				v--
+			}
+			res = append(res, v)
+		}
+	}
+	return res
+}
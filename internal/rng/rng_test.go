@@ -0,0 +1,48 @@
+package rng
+
+import "testing"
+
+// the first outputs of the reference pcg32-demo
+func TestSource(t *testing.T) {
+	s := New(42, 54)
+	expected := []uint32{0xa15c02b7, 0x7b47f409, 0xba1d3330, 0x83d2f293, 0xbfa4784b, 0xcbed606e}
+	for i, e := range expected {
+		if v := s.Uint32(); v != e {
+			t.Errorf("output %v: expected %#x, got %#x", i, e, v)
+		}
+	}
+}
+
+func TestFrameSource(t *testing.T) {
+	a := White(4, 4, FrameSource(7, 10, "noise"))
+	b := White(4, 4, FrameSource(7, 10, "noise"))
+	c := White(4, 4, FrameSource(7, 11, "noise"))
+	d := White(4, 4, FrameSource(7, 10, "grain"))
+	if string(a) != string(b) {
+		t.Error("expected the same noise for the same seed, frame and name")
+	}
+	if string(a) == string(c) || string(a) == string(d) {
+		t.Error("expected different noise for other frames and names")
+	}
+}
+
+func TestHalton(t *testing.T) {
+	h := Halton(8, New(1, 1))
+	if len(h) != 32 {
+		t.Fatalf("expected 32 values, got %v", len(h))
+	}
+	for i, v := range h {
+		if v < 0 || v >= 1 {
+			t.Errorf("value %v out of range: %v", i, v)
+		}
+	}
+
+	// the offset keeps the spacing of base 2: 1/2, 1/4, 3/4 apart
+	d := h[4] - h[0]
+	if d < 0 {
+		d++
+	}
+	if d != 0.75 && d != 0.25 {
+		t.Errorf("expected base 2 points a quarter apart, got %v", d)
+	}
+}
@@ -0,0 +1,217 @@
+package source
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gcsScope       = "https://www.googleapis.com/auth/devstorage.read_only"
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+)
+
+// GCS reads gs://bucket/object URLs, authorized with the application
+// default credentials as Google's tools find them: the file named by
+// GOOGLE_APPLICATION_CREDENTIALS, or else the one gcloud writes, holding
+// either a service account key or a user's refresh token. Without
+// credentials, requests are anonymous, for public buckets.
+// STORAGE_EMULATOR_HOST replaces the endpoint.
+type GCS struct {
+	// Client exchanges credentials for access tokens.
+	Client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// googleCredentials is the JSON of a credentials file.
+type googleCredentials struct {
+	Type string `json:"type"`
+
+	// service_account
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+
+	// authorized_user
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (g *GCS) NewRequest(u *url.URL) (*http.Request, error) {
+	bucket, object := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || object == "" {
+		return nil, fmt.Errorf("%v: expected gs://bucket/object", u)
+	}
+
+	endpoint := "https://storage.googleapis.com"
+	if e := os.Getenv("STORAGE_EMULATOR_HOST"); e != "" {
+		endpoint = strings.TrimSuffix(e, "/")
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+	}
+	req, err := http.NewRequest("GET", endpoint+"/"+bucket+"/"+escapePath(object), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := g.accessToken()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// accessToken returns a token for the default credentials, reusing it
+// until shortly before it expires, or an empty token without credentials.
+func (g *GCS) accessToken() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.token != "" && time.Now().Add(time.Minute).Before(g.expires) {
+		return g.token, nil
+	}
+
+	creds, err := googleCredentialChain()
+	if err != nil || creds == nil {
+		return "", err
+	}
+
+	var form url.Values
+	tokenURL := googleTokenURL
+	switch creds.Type {
+	case "service_account":
+		assertion, err := serviceAccountJWT(creds, time.Now())
+		if err != nil {
+			return "", err
+		}
+		form = url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		}
+		if creds.TokenURI != "" {
+			tokenURL = creds.TokenURI
+		}
+	case "authorized_user":
+		form = url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {creds.ClientID},
+			"client_secret": {creds.ClientSecret},
+			"refresh_token": {creds.RefreshToken},
+		}
+	default:
+		return "", fmt.Errorf("unsupported google credentials type %q", creds.Type)
+	}
+
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.PostForm(tokenURL, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("google token exchange: %v", resp.Status)
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&tok)
+	if err != nil {
+		return "", fmt.Errorf("google token exchange: %v", err)
+	}
+	g.token = tok.AccessToken
+	g.expires = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return g.token, nil
+}
+
+func googleCredentialChain() (*googleCredentials, error) {
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, nil
+		}
+		path = filepath.Join(dir, "gcloud", "application_default_credentials.json")
+		if _, err := os.Stat(path); err != nil {
+			return nil, nil
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c googleCredentials
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return &c, nil
+}
+
+// serviceAccountJWT returns the signed assertion a service account
+// exchanges for an access token.
+func serviceAccountJWT(c *googleCredentials, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(c.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("%v: invalid private key", c.ClientEmail)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return "", fmt.Errorf("%v: %v", c.ClientEmail, err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("%v: private key is not RSA", c.ClientEmail)
+	}
+
+	aud := c.TokenURI
+	if aud == "" {
+		aud = googleTokenURL
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   c.ClientEmail,
+		"scope": gcsScope,
+		"aud":   aud,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,226 @@
+package source
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyHash is the SHA-256 of an empty payload, which every GET has.
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3 reads s3://bucket/key URLs, signing requests with the credentials
+// found as the AWS tools find them: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// and AWS_SESSION_TOKEN, or else the AWS_PROFILE (or default) profile of
+// the shared credentials file. Without credentials, requests are anonymous,
+// for public buckets.
+// The region is AWS_REGION or AWS_DEFAULT_REGION, defaulting to us-east-1,
+// and AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL replaces the endpoint, e.g.
+// for S3 compatible servers, addressing buckets by path.
+type S3 struct {
+	// now is replaced in tests
+	now func() time.Time
+}
+
+type awsCredentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+func (s *S3) NewRequest(u *url.URL) (*http.Request, error) {
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("%v: expected s3://bucket/key", u)
+	}
+
+	region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	var endpoint string
+	if e := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); e != "" {
+		endpoint = strings.TrimSuffix(e, "/") + "/" + bucket + "/" + escapePath(key)
+	} else {
+		endpoint = "https://" + bucket + ".s3." + region + ".amazonaws.com/" + escapePath(key)
+	}
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := awsCredentialChain()
+	if err != nil {
+		return nil, err
+	}
+	if creds == nil {
+		return req, nil
+	}
+
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	signV4(req, creds, region, "s3", now())
+	return req, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// escapePath escapes each segment of a key as S3 expects, keeping slashes.
+func escapePath(key string) string {
+	segs := strings.Split(key, "/")
+	for i := range segs {
+		segs[i] = strings.Replace(url.PathEscape(segs[i]), "+", "%2B", -1)
+	}
+	return strings.Join(segs, "/")
+}
+
+func awsCredentialChain() (*awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return &awsCredentials{id, os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := firstEnv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	return readAWSCredentials(path, profile)
+}
+
+// readAWSCredentials reads a profile of an ini style credentials file,
+// returning nil if the file doesn't exist.
+func readAWSCredentials(path, profile string) (*awsCredentials, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c awsCredentials
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			section = strings.TrimSpace(strings.Trim(line, "[]"))
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v := strings.TrimSpace(kv[1])
+		switch strings.TrimSpace(kv[0]) {
+		case "aws_access_key_id":
+			c.accessKey = v
+		case "aws_secret_access_key":
+			c.secretKey = v
+		case "aws_session_token":
+			c.sessionToken = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if c.accessKey == "" {
+		return nil, fmt.Errorf("%v: no aws_access_key_id in profile %v", path, profile)
+	}
+	return &c, nil
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// signV4 signs a request without a body with AWS Signature Version 4,
+// covering every header it has when signed.
+func signV4(req *http.Request, c *awsCredentials, region, service string, t time.Time) {
+	t = t.UTC()
+	stamp := t.Format("20060102T150405Z")
+	day := t.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", emptyHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonHeaders.String(),
+		signed,
+		emptyHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v", c.accessKey, scope, signed, sig))
+}
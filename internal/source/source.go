@@ -0,0 +1,66 @@
+// Package source turns asset URLs into HTTP requests, so resources in
+// storage services can be fetched like any other URL.
+package source
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Source makes read requests for the objects named by URLs of one scheme.
+type Source interface {
+	NewRequest(u *url.URL) (*http.Request, error)
+}
+
+var (
+	mu      sync.Mutex
+	sources = map[string]Source{
+		"s3": &S3{},
+		"gs": &GCS{},
+	}
+)
+
+// Register makes URLs of scheme fetched through s, replacing any source
+// registered before.
+func Register(scheme string, s Source) {
+	mu.Lock()
+	defer mu.Unlock()
+	sources[scheme] = s
+}
+
+// Handles reports whether rawurl is http(s) or of a registered scheme.
+func Handles(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "http" || u.Scheme == "https" {
+		return true
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	_, ok := sources[u.Scheme]
+	return ok
+}
+
+// NewRequest returns a GET request for rawurl, made by the source of its
+// scheme, or a plain one for http(s).
+func NewRequest(rawurl string) (*http.Request, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "http" || u.Scheme == "https" {
+		return http.NewRequest("GET", rawurl, nil)
+	}
+
+	mu.Lock()
+	s, ok := sources[u.Scheme]
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%v: no source for scheme %v", rawurl, u.Scheme)
+	}
+	return s.NewRequest(u)
+}
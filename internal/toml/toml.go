@@ -0,0 +1,356 @@
+// Package toml decodes the subset of TOML used by shaderdev's config files.
+//
+// Supported are comments, [tables] and [[arrays of tables]] with dotted
+// names, and key = value pairs with bare or quoted keys whose values are
+// strings, integers, floats, booleans or arrays of those. Arrays may span
+// lines. Inline tables, dotted keys, multi-line strings and dates are not.
+package toml
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Decode reads a document into nested maps. Tables become
+// map[string]interface{}, arrays of tables []map[string]interface{},
+// arrays []interface{}, integers int64 and floats float64.
+func Decode(r io.Reader) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	cur := root
+
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			t, err := header(root, line)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %v", lineno, err)
+			}
+			cur = t
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %v: expected key = value", lineno)
+		}
+		key, err := parseKey(strings.TrimSpace(line[:i]))
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", lineno, err)
+		}
+		if _, ok := cur[key]; ok {
+			return nil, fmt.Errorf("line %v: duplicate key %v", lineno, key)
+		}
+
+		// arrays continue until their brackets balance
+		src := strings.TrimSpace(line[i+1:])
+		start := lineno
+		for unbalanced(src) && scanner.Scan() {
+			lineno++
+			src += "\n" + stripComment(scanner.Text())
+		}
+
+		p := parser{src: src}
+		v, err := p.value()
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", start, err)
+		}
+		p.skip()
+		if p.pos < len(p.src) {
+			return nil, fmt.Errorf("line %v: unexpected %q after value", start, p.src[p.pos:])
+		}
+		cur[key] = v
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// header creates the table named by a [table] or [[array]] line and returns
+// it.
+func header(root map[string]interface{}, line string) (map[string]interface{}, error) {
+	array := strings.HasPrefix(line, "[[")
+	name := strings.TrimPrefix(line, "[")
+	if array {
+		if !strings.HasSuffix(line, "]]") {
+			return nil, fmt.Errorf("unterminated array of tables header")
+		}
+		name = strings.TrimSuffix(strings.TrimPrefix(line, "[["), "]]")
+	} else if strings.HasSuffix(name, "]") {
+		name = strings.TrimSuffix(name, "]")
+	} else {
+		return nil, fmt.Errorf("unterminated table header")
+	}
+
+	var parts []string
+	for _, s := range strings.Split(name, ".") {
+		k, err := parseKey(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, k)
+	}
+
+	t := root
+	for _, k := range parts[:len(parts)-1] {
+		switch v := t[k].(type) {
+		case nil:
+			m := make(map[string]interface{})
+			t[k] = m
+			t = m
+		case map[string]interface{}:
+			t = v
+		case []map[string]interface{}:
+			t = v[len(v)-1]
+		default:
+			return nil, fmt.Errorf("%v is not a table", k)
+		}
+	}
+
+	last := parts[len(parts)-1]
+	m := make(map[string]interface{})
+	if array {
+		switch v := t[last].(type) {
+		case nil:
+			t[last] = []map[string]interface{}{m}
+		case []map[string]interface{}:
+			t[last] = append(v, m)
+		default:
+			return nil, fmt.Errorf("%v is not an array of tables", last)
+		}
+		return m, nil
+	}
+
+	switch v := t[last].(type) {
+	case nil:
+		t[last] = m
+		return m, nil
+	case map[string]interface{}:
+		// implicitly created by a dotted header before
+		return v, nil
+	default:
+		return nil, fmt.Errorf("%v is already defined", last)
+	}
+}
+
+func parseKey(s string) (string, error) {
+	if s == "" {
+		return "", fmt.Errorf("empty key")
+	}
+	if s[0] == '"' || s[0] == '\'' {
+		p := parser{src: s}
+		k, err := p.str()
+		if err != nil {
+			return "", err
+		}
+		if p.pos != len(s) {
+			return "", fmt.Errorf("invalid key %v", s)
+		}
+		return k, nil
+	}
+
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return "", fmt.Errorf("invalid key %v", s)
+		}
+	}
+	return s, nil
+}
+
+// stripComment removes a trailing comment, respecting quotes.
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// unbalanced reports whether s opens more brackets than it closes, outside
+// quotes.
+func unbalanced(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+// skip moves past whitespace, including newlines within arrays.
+func (p *parser) skip() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *parser) value() (interface{}, error) {
+	p.skip()
+	if p.pos >= len(p.src) {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	switch c := p.src[p.pos]; {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		return p.array()
+	case strings.HasPrefix(p.src[p.pos:], "true"):
+		p.pos += 4
+		return true, nil
+	case strings.HasPrefix(p.src[p.pos:], "false"):
+		p.pos += 5
+		return false, nil
+	default:
+		return p.number()
+	}
+}
+
+func (p *parser) str() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\n':
+			return "", fmt.Errorf("newline in string")
+		case c == '\\' && quote == '"':
+			if p.pos >= len(p.src) {
+				return "", fmt.Errorf("unterminated string")
+			}
+			e := p.src[p.pos]
+			p.pos++
+			switch e {
+			case 'b':
+				b.WriteByte('\b')
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'f':
+				b.WriteByte('\f')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(e)
+			case 'u', 'U':
+				n := 4
+				if e == 'U' {
+					n = 8
+				}
+				if p.pos+n > len(p.src) {
+					return "", fmt.Errorf("short unicode escape")
+				}
+				r, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+				if err != nil {
+					return "", fmt.Errorf("invalid unicode escape: %v", err)
+				}
+				b.WriteRune(rune(r))
+				p.pos += n
+			default:
+				return "", fmt.Errorf("invalid escape \\%c", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+func (p *parser) array() ([]interface{}, error) {
+	p.pos++
+	res := []interface{}{}
+	for {
+		p.skip()
+		if p.pos >= len(p.src) {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if p.src[p.pos] == ']' {
+			p.pos++
+			return res, nil
+		}
+
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+
+		p.skip()
+		if p.pos < len(p.src) && p.src[p.pos] == ',' {
+			p.pos++
+		} else if p.pos < len(p.src) && p.src[p.pos] != ']' {
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *parser) number() (interface{}, error) {
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n,]", p.src[p.pos]) < 0 {
+		p.pos++
+	}
+	tok := strings.Replace(p.src[start:p.pos], "_", "", -1)
+	if tok == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	if !strings.HasPrefix(tok, "0x") && strings.ContainsAny(tok, ".eE") || strings.HasSuffix(tok, "inf") || strings.HasSuffix(tok, "nan") {
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %v", tok)
+		}
+		return f, nil
+	}
+
+	i, err := strconv.ParseInt(tok, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %v", tok)
+	}
+	return i, nil
+}
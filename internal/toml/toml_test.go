@@ -0,0 +1,85 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	src := `
+# jobs
+title = "nightly" # trailing comment
+count = 1_000
+scale = 0.5
+enabled = true
+"quoted key" = 'C:\path'
+escaped = "a\"b\tc\u00e9"
+
+[output]
+dir = "out"
+
+[output.png]
+level = 9
+
+[[job]]
+name = "torus"
+args = [
+	"-model", "torus.obj", # the mesh
+	"fs:frag.glsl",
+]
+
+[[job]]
+name = "cube"
+frames = [1, 2, [3]]
+`
+
+	doc, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"title":      "nightly",
+		"count":      int64(1000),
+		"scale":      0.5,
+		"enabled":    true,
+		"quoted key": `C:\path`,
+		"escaped":    "a\"b\tc\u00e9",
+		"output": map[string]interface{}{
+			"dir": "out",
+			"png": map[string]interface{}{"level": int64(9)},
+		},
+		"job": []map[string]interface{}{
+			{"name": "torus", "args": []interface{}{"-model", "torus.obj", "fs:frag.glsl"}},
+			{"name": "cube", "frames": []interface{}{int64(1), int64(2), []interface{}{int64(3)}}},
+		},
+	}
+
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("expected %#v, got %#v", expected, doc)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := []string{
+		"key",
+		"key = ",
+		"key = \"unterminated",
+		"key = [1, 2",
+		"key = 1 2",
+		"key = nope",
+		"a = 1\na = 2",
+		"[table",
+		"a = 1\n[a]",
+		"a = 1\n[[a]]",
+		"bad key = 1",
+	}
+
+	for _, c := range cases {
+		_, err := Decode(strings.NewReader(c))
+		if err == nil {
+			t.Errorf("%q: expected an error", c)
+		}
+	}
+}
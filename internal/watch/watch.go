@@ -0,0 +1,54 @@
+// Package watch collects files changed on disk until their events settle.
+//
+// Files are watched through their directories and matched by name, so a
+// file stays watched however it is replaced. Editors that save atomically
+// write a new file and rename it over the old one, or remove the old one
+// and create it again, which the directory reports as creates and renames
+// rather than writes; a save is several events either way, and the file is
+// reloaded once they settle.
+package watch
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/fsnotify.v1"
+)
+
+// SettleTime is how long a file must go without events to be reloaded.
+const SettleTime = 50 * time.Millisecond
+
+// Queue collects the files changed on disk until they settle.
+type Queue struct {
+	// when each file last had an event, for those written or created
+	pending map[string]time.Time
+}
+
+func NewQueue() *Queue {
+	return &Queue{pending: make(map[string]time.Time)}
+}
+
+// Add records the file of an event if it may have new content, and delays
+// any pending reload of it for the rest of a save.
+func (q *Queue) Add(evt fsnotify.Event, now time.Time) {
+	path := filepath.Clean(evt.Name)
+	_, pending := q.pending[path]
+	if pending || evt.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+		q.pending[path] = now
+	}
+}
+
+// Settled returns the queued files without events since SettleTime before
+// now, in order of name, and forgets them.
+func (q *Queue) Settled(now time.Time) []string {
+	var res []string
+	for path, t := range q.pending {
+		if now.Sub(t) >= SettleTime {
+			res = append(res, path)
+			delete(q.pending, path)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
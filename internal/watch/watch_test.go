@@ -0,0 +1,35 @@
+package watch
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/fsnotify.v1"
+)
+
+func TestQueue(t *testing.T) {
+	q := NewQueue()
+	t0 := time.Unix(0, 0)
+
+	// an atomic save: the new file is created, then renamed over the old
+	q.Add(fsnotify.Event{Name: "dir/frag.glsl~", Op: fsnotify.Create}, t0)
+	q.Add(fsnotify.Event{Name: "dir/frag.glsl", Op: fsnotify.Create}, t0)
+	q.Add(fsnotify.Event{Name: "dir/./frag.glsl", Op: fsnotify.Write}, t0.Add(10*time.Millisecond))
+	q.Add(fsnotify.Event{Name: "dir/frag.glsl~", Op: fsnotify.Rename}, t0.Add(20*time.Millisecond))
+	// a file only removed has nothing to reload
+	q.Add(fsnotify.Event{Name: "dir/vert.glsl", Op: fsnotify.Remove}, t0)
+
+	if got := q.Settled(t0.Add(SettleTime)); got != nil {
+		t.Errorf("expected nothing settled while events arrive, got %v", got)
+	}
+	if got := q.Settled(t0.Add(10*time.Millisecond + SettleTime)); !reflect.DeepEqual(got, []string{"dir/frag.glsl"}) {
+		t.Errorf("expected the saved file once, got %v", got)
+	}
+	if got := q.Settled(t0.Add(20*time.Millisecond + SettleTime)); !reflect.DeepEqual(got, []string{"dir/frag.glsl~"}) {
+		t.Errorf("expected the renamed file after its last event, got %v", got)
+	}
+	if got := q.Settled(t0.Add(time.Second)); got != nil {
+		t.Errorf("expected settled files to be forgotten, got %v", got)
+	}
+}
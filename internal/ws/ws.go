@@ -0,0 +1,271 @@
+// Package ws serves WebSocket connections, RFC 6455, as far as a server
+// pushing messages to browsers needs: the handshake, writing text and
+// binary messages, and reading what clients send, answering pings and
+// closes.
+package ws
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Opcodes of the frames of a message.
+const (
+	Continuation = 0x0
+	Text         = 0x1
+	Binary       = 0x2
+	Close        = 0x8
+	Ping         = 0x9
+	Pong         = 0xa
+)
+
+// maxMessage bounds the messages read from clients, which have no reason to
+// send large ones.
+const maxMessage = 1 << 20
+
+const guid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// AcceptKey returns the Sec-WebSocket-Accept answering a
+// Sec-WebSocket-Key.
+func AcceptKey(key string) string {
+	h := sha1.Sum([]byte(key + guid))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// Conn is a WebSocket connection. Messages may be written from any
+// goroutine, and read from one at a time.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex
+	w    *bufio.Writer
+}
+
+// SameOrigin reports whether a handshake comes from a page served by the
+// same host, or from a client that isn't a browser, which sends no Origin.
+// Browsers let any page open WebSockets to any host, local ones included.
+func SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// Upgrade answers a WebSocket handshake, taking over its connection, if
+// checkOrigin accepts it, SameOrigin if nil.
+func Upgrade(w http.ResponseWriter, r *http.Request, checkOrigin func(*http.Request) bool) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != "GET" || !headerHas(r.Header, "Connection", "upgrade") || !headerHas(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "expected a WebSocket handshake", http.StatusBadRequest)
+		return nil, fmt.Errorf("%v: not a WebSocket handshake", r.RemoteAddr)
+	}
+	if checkOrigin == nil {
+		checkOrigin = SameOrigin
+	}
+	if !checkOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil, fmt.Errorf("%v: origin %v not allowed", r.RemoteAddr, r.Header.Get("Origin"))
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("%v: WebSocket version %q", r.RemoteAddr, r.Header.Get("Sec-WebSocket-Version"))
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "cannot upgrade", http.StatusInternalServerError)
+		return nil, fmt.Errorf("%v: connection cannot be taken over", r.RemoteAddr)
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{conn: conn, r: rw.Reader, w: rw.Writer}
+	fmt.Fprintf(c.w, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %v\r\n\r\n", AcceptKey(key))
+	err = c.w.Flush()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// headerHas reports whether a comma separated header lists token, ignoring
+// case.
+func headerHas(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteMessage sends a Text or Binary message as a single frame.
+func (c *Conn) WriteMessage(op byte, b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := writeFrame(c.w, op, b, nil)
+	if err == nil {
+		err = c.w.Flush()
+	}
+	return err
+}
+
+// ReadMessage returns the next Text or Binary message from the client,
+// answering pings in the meantime. It returns io.EOF once the client closes
+// the connection, after answering its close.
+func (c *Conn) ReadMessage() (byte, []byte, error) {
+	var op byte
+	var msg []byte
+	for {
+		fin, fop, b, err := readFrame(c.r)
+		if err != nil {
+			return 0, nil, err
+		}
+		switch fop {
+		case Ping:
+			err = c.control(Pong, b)
+		case Pong:
+		case Close:
+			c.control(Close, b)
+			return 0, nil, io.EOF
+		case Continuation:
+			if msg == nil {
+				return 0, nil, fmt.Errorf("continuation without a message")
+			}
+			msg = append(msg, b...)
+		case Text, Binary:
+			if msg != nil {
+				return 0, nil, fmt.Errorf("message interrupted by another")
+			}
+			op, msg = fop, append([]byte{}, b...)
+		default:
+			return 0, nil, fmt.Errorf("unknown opcode %#x", fop)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(msg) > maxMessage {
+			return 0, nil, fmt.Errorf("message of more than %v bytes", maxMessage)
+		}
+		if fin && msg != nil && fop != Ping && fop != Pong {
+			return op, msg, nil
+		}
+	}
+}
+
+func (c *Conn) control(op byte, b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := writeFrame(c.w, op, b, nil)
+	if err == nil {
+		err = c.w.Flush()
+	}
+	return err
+}
+
+// Close closes the connection without a closing handshake.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// RemoteAddr returns the client's address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// writeFrame writes a final frame, masked if mask is given, as clients
+// must.
+func writeFrame(w io.Writer, op byte, b []byte, mask []byte) error {
+	hdr := make([]byte, 2, 14)
+	hdr[0] = 0x80 | op
+	switch n := len(b); {
+	case n < 126:
+		hdr[1] = byte(n)
+	case n <= 0xffff:
+		hdr[1] = 126
+		hdr = append(hdr, 0, 0)
+		binary.BigEndian.PutUint16(hdr[2:], uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = append(hdr, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(hdr[2:], uint64(n))
+	}
+	if mask != nil {
+		hdr[1] |= 0x80
+		hdr = append(hdr, mask[:4]...)
+		m := make([]byte, len(b))
+		for i := range b {
+			m[i] = b[i] ^ mask[i%4]
+		}
+		b = m
+	}
+	_, err := w.Write(hdr)
+	if err == nil {
+		_, err = w.Write(b)
+	}
+	return err
+}
+
+// readFrame reads a frame, unmasking its payload.
+func readFrame(r io.Reader) (bool, byte, []byte, error) {
+	var hdr [8]byte
+	_, err := io.ReadFull(r, hdr[:2])
+	if err != nil {
+		return false, 0, nil, err
+	}
+	fin, op := hdr[0]&0x80 != 0, hdr[0]&0x0f
+	masked := hdr[1]&0x80 != 0
+	n := uint64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		_, err = io.ReadFull(r, hdr[:2])
+		n = uint64(binary.BigEndian.Uint16(hdr[:2]))
+	case 127:
+		_, err = io.ReadFull(r, hdr[:8])
+		n = binary.BigEndian.Uint64(hdr[:8])
+	}
+	if err != nil {
+		return false, 0, nil, err
+	}
+	if n > maxMessage {
+		return false, 0, nil, fmt.Errorf("frame of %v bytes, more than %v", n, maxMessage)
+	}
+	if op >= Close && (!fin || n > 125) {
+		return false, 0, nil, fmt.Errorf("invalid control frame")
+	}
+
+	var mask [4]byte
+	if masked {
+		_, err = io.ReadFull(r, mask[:])
+		if err != nil {
+			return false, 0, nil, err
+		}
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range b {
+			b[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, b, nil
+}
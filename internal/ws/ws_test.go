@@ -0,0 +1,137 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// the example of RFC 6455
+	expected := "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+	if k := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); k != expected {
+		t.Errorf("expected %v, got %v", expected, k)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	mask := []byte{1, 2, 3, 4}
+	for _, n := range []int{0, 5, 125, 126, 0xffff, 0x10000} {
+		b := bytes.Repeat([]byte("x"), n)
+		var buf bytes.Buffer
+		err := writeFrame(&buf, Binary, b, mask)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fin, op, got, err := readFrame(&buf)
+		if err != nil {
+			t.Fatalf("%v bytes: %v", n, err)
+		}
+		if !fin || op != Binary || !bytes.Equal(got, b) {
+			t.Errorf("%v bytes: got fin %v, op %v, %v bytes", n, fin, op, len(got))
+		}
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	done := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r, nil)
+		if err != nil {
+			done <- err
+			return
+		}
+		defer c.Close()
+		op, b, err := c.ReadMessage()
+		if err == nil {
+			err = c.WriteMessage(op, append(b, '!'))
+		}
+		if err == nil {
+			_, _, err = c.ReadMessage()
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		done <- err
+	}))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: x\r\nConnection: keep-alive, Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != AcceptKey("dGhlIHNhbXBsZSBub25jZQ==") {
+		t.Fatalf("unexpected response %v %v", resp.Status, resp.Header)
+	}
+
+	mask := []byte{9, 8, 7, 6}
+	writeFrame(conn, Ping, []byte("p"), mask)
+	writeFrame(conn, Text, []byte("hi"), mask)
+	for _, expected := range []struct {
+		op byte
+		b  string
+	}{{Pong, "p"}, {Text, "hi!"}} {
+		_, op, b, err := readFrame(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op != expected.op || string(b) != expected.b {
+			t.Errorf("expected %v %q, got %v %q", expected.op, expected.b, op, b)
+		}
+	}
+	writeFrame(conn, Close, nil, mask)
+	if _, op, _, err := readFrame(r); err != nil || op != Close {
+		t.Errorf("expected the close answered, got %v, %v", op, err)
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	for _, c := range []struct {
+		origin, host string
+		same         bool
+	}{
+		{"", "localhost:8080", true},
+		{"http://localhost:8080", "localhost:8080", true},
+		{"http://LOCALHOST:8080", "localhost:8080", true},
+		{"http://evil.example", "localhost:8080", false},
+		{"http://localhost:9090", "localhost:8080", false},
+		{"null", "localhost:8080", false},
+	} {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		r.Host = c.host
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		if same := SameOrigin(r); same != c.same {
+			t.Errorf("origin %q, host %v: expected %v, got %v", c.origin, c.host, c.same, same)
+		}
+	}
+}
+
+func TestUpgradeOrigin(t *testing.T) {
+	r := httptest.NewRequest("GET", "/ws", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	r.Header.Set("Origin", "http://evil.example")
+	w := httptest.NewRecorder()
+	if _, err := Upgrade(w, r, nil); err == nil || w.Code != http.StatusForbidden {
+		t.Errorf("expected a cross-origin handshake refused, got %v, %v", w.Code, err)
+	}
+}
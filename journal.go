@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var journalPath = flag.String("journal", "", "append reloads, parameter changes, captures and viewers of the session to this file, see the journal subcommand")
+
+// journalEntry is a line of JSON in a journal file.
+type journalEntry struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Detail string    `json:"detail"`
+	// short hashes of the sources involved, by name
+	Hashes map[string]string `json:"hashes,omitempty"`
+}
+
+// sessionJournal is appended to as events happen, so it survives crashes.
+var sessionJournal struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openJournal(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	sessionJournal.f = f
+	journalEvent("start", strings.Join(os.Args[1:], " "), nil)
+	return nil
+}
+
+// journalEvent records an event if a journal is open.
+func journalEvent(kind, detail string, hashes map[string]string) {
+	sessionJournal.mu.Lock()
+	defer sessionJournal.mu.Unlock()
+	if sessionJournal.f == nil {
+		return
+	}
+
+	b, err := json.Marshal(&journalEntry{time.Now(), kind, detail, hashes})
+	if err == nil {
+		_, err = sessionJournal.f.Write(append(b, '\n'))
+	}
+	if err != nil {
+		log.Println("journal:", err)
+	}
+}
+
+// logChange logs a parameter change, journaling it.
+func logChange(v ...interface{}) {
+	s := strings.TrimSuffix(fmt.Sprintln(v...), "\n")
+	log.Println(s)
+	journalEvent("change", s, nil)
+}
+
+func logChangef(format string, v ...interface{}) {
+	logChange(fmt.Sprintf(format, v...))
+}
+
+func shortHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:6])
+}
+
+// fileHashes returns the short hash of a file by its name, or nil if it
+// can't be read.
+func fileHashes(path string) map[string]string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return map[string]string{filepath.Base(path): shortHash(b)}
+}
+
+// sourceHashes returns short hashes of the sources of every stage.
+func sourceHashes(p *program) map[string]string {
+	sources, err := programSources(p)
+	if err != nil {
+		return nil
+	}
+	hashes := make(map[string]string)
+	for prefix, src := range sources {
+		hashes[prefix] = shortHash([]byte(src))
+	}
+	return hashes
+}
+
+// journalMain writes a journal as Markdown to stdout.
+func journalMain(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("journal requires the path of a journal file")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var e journalEntry
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			return fmt.Errorf("%v:%v: %v", args[0], line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return writeJournalMarkdown(os.Stdout, entries)
+}
+
+// writeJournalMarkdown writes a section per session, started by each start
+// entry, with a line per event.
+func writeJournalMarkdown(w io.Writer, entries []journalEntry) error {
+	bw := bufio.NewWriter(w)
+	for i, e := range entries {
+		if e.Kind == "start" || i == 0 {
+			if i > 0 {
+				fmt.Fprintln(bw)
+			}
+			fmt.Fprintf(bw, "## Session of %v\n\n", e.Time.Format("2006-01-02 15:04"))
+			if e.Kind == "start" {
+				fmt.Fprintf(bw, "`shaderdev %v`\n\n", e.Detail)
+				continue
+			}
+		}
+
+		fmt.Fprintf(bw, "- %v **%v** %v", e.Time.Format("15:04:05"), e.Kind, e.Detail)
+		var names []string
+		for name := range e.Hashes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(bw, " `%v:%v`", name, e.Hashes[name])
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
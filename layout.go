@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// loadLayout reads expected block layouts in the format written by reflect.
+// Only uniformBlocks and storageBlocks are used.
+func loadLayout(path string) (*reflection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r reflection
+	err = json.NewDecoder(f).Decode(&r)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	return &r, nil
+}
+
+// checkBlocks compares expected blocks against actual ones by name.
+// Types, strides and sizes are only compared when given in the expectation,
+// so hand written layouts may list offsets alone.
+func checkBlocks(kind string, expected, actual []reflectBlock) []string {
+	var res []string
+
+	actualByName := make(map[string]*reflectBlock)
+	for i := range actual {
+		actualByName[actual[i].Name] = &actual[i]
+	}
+
+	for _, eb := range expected {
+		ab, ok := actualByName[eb.Name]
+		if !ok {
+			res = append(res, fmt.Sprintf("%v %v: not active in program", kind, eb.Name))
+			continue
+		}
+
+		if eb.DataSize > 0 && eb.DataSize != ab.DataSize {
+			res = append(res, fmt.Sprintf("%v %v: expected size %v, actual %v", kind, eb.Name, eb.DataSize, ab.DataSize))
+		}
+
+		members := make(map[string]*reflectMember)
+		for i := range ab.Members {
+			members[ab.Members[i].Name] = &ab.Members[i]
+		}
+
+		for _, em := range eb.Members {
+			am, ok := members[em.Name]
+			if !ok {
+				res = append(res, fmt.Sprintf("%v %v: member %v not active in program", kind, eb.Name, em.Name))
+				continue
+			}
+
+			prefix := fmt.Sprintf("%v %v: member %v:", kind, eb.Name, em.Name)
+			if em.Type != "" && em.Type != am.Type {
+				res = append(res, fmt.Sprintf("%v expected type %v, actual %v", prefix, em.Type, am.Type))
+			}
+			if em.Offset != am.Offset {
+				res = append(res, fmt.Sprintf("%v expected offset %v, actual %v", prefix, em.Offset, am.Offset))
+			}
+			if em.ArrayStride > 0 && em.ArrayStride != am.ArrayStride {
+				res = append(res, fmt.Sprintf("%v expected array stride %v, actual %v", prefix, em.ArrayStride, am.ArrayStride))
+			}
+			if em.MatrixStride > 0 && em.MatrixStride != am.MatrixStride {
+				res = append(res, fmt.Sprintf("%v expected matrix stride %v, actual %v", prefix, em.MatrixStride, am.MatrixStride))
+			}
+			if em.TopLevelArrayStride > 0 && em.TopLevelArrayStride != am.TopLevelArrayStride {
+				res = append(res, fmt.Sprintf("%v expected top level array stride %v, actual %v", prefix, em.TopLevelArrayStride, am.TopLevelArrayStride))
+			}
+		}
+	}
+
+	return res
+}
+
+// checkLayout returns a description of every difference between the expected
+// block layouts and those of the linked program.
+func checkLayout(expected *reflection, prog uint32) []string {
+	var res []string
+	res = append(res, checkBlocks("uniform block", expected.UniformBlocks, reflectBlocks(prog, gl.UNIFORM_BLOCK, gl.UNIFORM))...)
+	res = append(res, checkBlocks("storage block", expected.StorageBlocks, reflectBlocks(prog, gl.SHADER_STORAGE_BLOCK, gl.BUFFER_VARIABLE))...)
+	return res
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"flag"
+	"fmt"
 	"log"
 	"math"
 	"os"
@@ -11,23 +14,112 @@ import (
 	"time"
 	"unsafe"
 
+	"github.com/alotabits/shaderdev/internal/gltf"
 	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/alotabits/shaderdev/internal/midi"
 	"github.com/alotabits/shaderdev/internal/obj"
+	"github.com/alotabits/shaderdev/internal/osc"
+	"github.com/alotabits/shaderdev/internal/watch"
 	"github.com/go-gl/gl/all-core/gl"
 	"github.com/go-gl/glfw/v3.1/glfw"
 	"github.com/go-gl/mathgl/mgl32"
 	"gopkg.in/fsnotify.v1"
 )
 
+// wireMode selects how the model's polygons are rasterized.
+type wireMode int
+
+const (
+	wireOff wireMode = iota
+	wireOnly
+	// lines inverting the shaded model under them
+	wireOverlay
+)
+
+var wireModeNames = []string{"off", "only", "overlay"}
+
 type model struct {
 	pos [][4]float32
+	// vertex colors, if the OBJ has any
+	col [][4]float32
 	nor [][3]float32
 	tex [][3]float32
 	idx []uint32
+	// skinned models' joint indices and weights, morph targets, and their
+	// animations
+	joints  [][4]uint32
+	weights [][4]float32
+	targets []gltf.Target
+	rig     *rig
+
+	vao     gx.VertexArray
+	posBuf  gx.Buffer
+	colBuf  gx.Buffer
+	norBuf  gx.Buffer
+	texBuf  gx.Buffer
+	tanBuf  gx.Buffer
+	idxBuf  gx.Buffer
+	edgeBuf gx.Buffer
+	edges   int32
+
+	// joints and weights, 0 without a skin
+	jointBuf  gx.Buffer
+	weightBuf gx.Buffer
+	// positions and normals of each morph target
+	morphBufs [][2]gx.Buffer
+
+	// the OBJ's l and p elements, drawn along with the faces
+	lineIdx  []uint32
+	pointIdx []uint32
+	lineBuf  gx.Buffer
+	pointBuf gx.Buffer
+
+	// streams maps attribute names to the type of the data uploaded for them
+	streams map[string]uint32
+
+	cull      bool
+	frontFace uint32
+	wire      wireMode
+	// primitive drawn: gl.TRIANGLES, gl.LINES for the unique edges or
+	// gl.POINTS for the unique vertices
+	draw uint32
+
+	// parts drawn separately when some are hidden or have materials, from
+	// the OBJ's o, g and usemtl statements; solo, if not negative, is the
+	// only part drawn
+	parts     []part
+	solo      int
+	materials map[string]*material
+	// material libraries and maps the model was loaded from
+	files []string
+
+	// scale converts model units to meters
+	scale float32
+
+	// bounding box, and the sphere around its center, in model units
+	min, max [3]float32
+	center   [3]float32
+	radius   float32
+
+	path string
+}
+
+// part is a named range of the model's triangle indices.
+type part struct {
+	name     string
+	first    int32
+	count    int32
+	hidden   bool
+	material *material
+	faces    faceSettings
+}
 
-	vao    uint32
-	posBuf uint32
-	idxBuf uint32
+// faceSettings overrides the model's culling and winding for a part: cull if
+// setCull, and frontFace if not zero.
+type faceSettings struct {
+	setCull   bool
+	cull      bool
+	frontFace uint32
 }
 
 var cubeVertices = []float32{
@@ -52,310 +144,2781 @@ var cubeIndices = []uint32{
 }
 
 func loadModel(file string) (*model, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".gltf", ".glb":
+		return loadGLTF(file)
+	}
+
 	f, err := os.Open(file)
 	if err != nil {
 		return nil, err
 	}
 
-	o, err := obj.Decode(f)
+	o, warnings, err := obj.DecodeOptions(f, obj.Options{Strict: *strictOBJ})
 	if err != nil {
 		return nil, err
 	}
+	// a few are enough to tell what an exporter wrote that we don't read
+	const maxWarnings = 10
+	for i, w := range warnings {
+		if i == maxWarnings {
+			log.Printf("%v: %v more lines skipped", file, len(warnings)-i)
+			break
+		}
+		log.Printf("%v:%v, skipped", file, w)
+	}
 
-	var m model
+	if len(o.Nor) == 0 && len(o.Face) > 0 {
+		o.GenerateNormals()
+		log.Printf("%v: no normals, generated smooth ones", file)
+	}
 
-	/*
-		opengl requires all vertex attributes to have the same number of elements,
-		so here we remember index triplets we've seen before and reuse those indices,
-		otherwise we record a new index and add the indexed obj values to the attribute arrays
-	*/
-	knownVerts := make(map[[3]int]uint32)
-	for iface := range o.Face {
-		for ivert := range o.Face[iface] {
-			overt := o.Face[iface][ivert]
-			kv, ok := knownVerts[overt]
-			if ok {
-				m.idx = append(m.idx, kv)
-			} else {
-				i := uint32(len(m.pos))
-				m.idx = append(m.idx, i)
-				knownVerts[overt] = i
+	var m model
+	m.scale = 1
+	if o.Units != "" {
+		m.scale = obj.UnitScale[o.Units]
+		log.Printf("%v: units %v", file, o.Units)
+	}
 
-				ip := overt[0]
-				m.pos = append(m.pos, o.Pos[ip])
+	mesh := o.Interleave()
+	m.pos, m.tex, m.nor = mesh.Pos, mesh.Tex, mesh.Nor
+	for _, c := range mesh.Col {
+		m.col = append(m.col, [4]float32{c[0], c[1], c[2], 1})
+	}
+	m.idx, m.lineIdx, m.pointIdx = mesh.Tris, mesh.Lines, mesh.Points
 
-				if len(o.Tex) > 0 {
-					it := overt[1]
-					m.tex = append(m.tex, o.Tex[it])
-				}
+	m.materials, m.files, err = loadMaterials(o.MtlLibs, filepath.Dir(file))
+	if err != nil {
+		return nil, err
+	}
 
-				if len(o.Nor) > 0 {
-					in := overt[2]
-					m.nor = append(m.nor, o.Nor[in])
-				}
+	for _, g := range o.Groups {
+		var p part
+		p.name = strings.Trim(g.Object+"/"+g.Name, "/")
+		p.first = int32(g.Start * 3)
+		p.count = int32((g.End - g.Start) * 3)
+		if g.Material != "" {
+			p.material = m.materials[g.Material]
+			if p.material == nil {
+				log.Printf("%v: unknown material %v", file, g.Material)
 			}
 		}
+		m.parts = append(m.parts, p)
 	}
+	m.solo = -1
+
+	m.min, m.max = o.Bounds()
+	m.center, m.radius = o.Center(), o.Radius()
 
 	return &m, nil
 }
 
-func initModel(m *model, positionLoc, colorLoc uint32) {
-	vao := gx.GenVertexArray()
-	gl.BindVertexArray(vao)
-	defer gl.BindVertexArray(0)
-
-	var posBuf uint32
-	gl.GenBuffers(1, &posBuf)
-	gl.BindBuffer(gl.ARRAY_BUFFER, posBuf)
-	defer gl.BindBuffer(gl.ARRAY_BUFFER, 0)
-	posLen := len(m.pos) * int(unsafe.Sizeof([4]float32{}))
-	gl.BufferData(gl.ARRAY_BUFFER, posLen, gl.Ptr(m.pos), gl.STATIC_DRAW)
-	if gx.IsValidAttribLoc(positionLoc) {
-		gl.EnableVertexAttribArray(positionLoc)
-		gl.VertexAttribPointer(positionLoc, 4, gl.FLOAT, false, 0, gl.PtrOffset(0))
+// edgeIndices returns each edge of the triangles once, as pairs of indices.
+func edgeIndices(idx []uint32) []uint32 {
+	seen := make(map[[2]uint32]bool)
+	var res []uint32
+	for i := 0; i+2 < len(idx); i += 3 {
+		for j := 0; j < 3; j++ {
+			a, b := idx[i+j], idx[i+(j+1)%3]
+			if a > b {
+				a, b = b, a
+			}
+			if seen[[2]uint32{a, b}] {
+				continue
+			}
+			seen[[2]uint32{a, b}] = true
+			res = append(res, a, b)
+		}
 	}
+	return res
+}
+
+// arrayBuffer uploads n bytes of static vertex data into a new buffer
+// labeled name.
+func arrayBuffer(name string, data unsafe.Pointer, n int) gx.Buffer {
+	buf := gx.NewBuffer()
+	buf.Label(name)
+	buf.SetData(n, data, gl.STATIC_DRAW)
+	return buf
+}
+
+// elementBuffer uploads indices into a new buffer labeled name.
+func elementBuffer(name string, idx []uint32) gx.Buffer {
+	return arrayBuffer(name, gl.Ptr(idx), len(idx)*int(unsafe.Sizeof(uint32(0))))
+}
+
+func initModel(m *model, p *program) {
+	vao := gx.NewVertexArray()
+	vao.Label("model")
 
-	if gx.IsValidAttribLoc(colorLoc) {
-		gl.EnableVertexAttribArray(colorLoc)
-		gl.VertexAttribPointer(colorLoc, 4, gl.FLOAT, false, 0, gl.PtrOffset(0))
+	posBuf := arrayBuffer("model positions", gl.Ptr(m.pos), len(m.pos)*int(unsafe.Sizeof([4]float32{})))
+
+	// faces without normals or texture coordinates leave the model with
+	// fewer of them than positions, which can't be streamed
+	var colBuf, norBuf, texBuf, tanBuf gx.Buffer
+	if len(m.col) > 0 {
+		colBuf = arrayBuffer("model colors", gl.Ptr(m.col), len(m.col)*int(unsafe.Sizeof([4]float32{})))
+	}
+	if len(m.nor) == len(m.pos) {
+		norBuf = arrayBuffer("model normals", gl.Ptr(m.nor), len(m.nor)*int(unsafe.Sizeof([3]float32{})))
+	}
+	if len(m.tex) == len(m.pos) {
+		texBuf = arrayBuffer("model texcoords", gl.Ptr(m.tex), len(m.tex)*int(unsafe.Sizeof([3]float32{})))
+	}
+	if norBuf != 0 && texBuf != 0 {
+		tan := generateTangents(m.pos, m.nor, m.tex, m.idx)
+		tanBuf = arrayBuffer("model tangents", gl.Ptr(tan), len(tan)*int(unsafe.Sizeof([4]float32{})))
+	}
+	var jointBuf, weightBuf gx.Buffer
+	if len(m.joints) > 0 {
+		jointBuf = arrayBuffer("model joints", gl.Ptr(m.joints), len(m.joints)*int(unsafe.Sizeof([4]uint32{})))
+		weightBuf = arrayBuffer("model weights", gl.Ptr(m.weights), len(m.weights)*int(unsafe.Sizeof([4]float32{})))
+	}
+	var morphBufs [][2]gx.Buffer
+	for i, t := range m.targets {
+		n := len(t.Pos) * int(unsafe.Sizeof([3]float32{}))
+		pos := arrayBuffer(fmt.Sprintf("model morph %v positions", i), gl.Ptr(t.Pos), n)
+		nor := arrayBuffer(fmt.Sprintf("model morph %v normals", i), gl.Ptr(t.Nor), n)
+		morphBufs = append(morphBufs, [2]gx.Buffer{pos, nor})
 	}
 
-	var idxBuf uint32
-	gl.GenBuffers(1, &idxBuf)
-	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, idxBuf)
-	idxLen := len(m.idx) * int(unsafe.Sizeof(uint32(0)))
-	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, idxLen, gl.Ptr(m.idx), gl.STATIC_DRAW)
+	// OBJs of only lines or points have no triangles
+	var idxBuf, edgeBuf gx.Buffer
+	edges := edgeIndices(m.idx)
+	if len(m.idx) > 0 {
+		idxBuf = elementBuffer("model indices", m.idx)
+	}
+	if len(edges) > 0 {
+		edgeBuf = elementBuffer("model edges", edges)
+	}
+	var lineBuf, pointBuf gx.Buffer
+	if len(m.lineIdx) > 0 {
+		lineBuf = elementBuffer("model lines", m.lineIdx)
+	}
+	if len(m.pointIdx) > 0 {
+		pointBuf = elementBuffer("model points", m.pointIdx)
+	}
+	vao.SetElements(idxBuf)
 
 	m.vao = vao
 	m.posBuf = posBuf
+	m.colBuf = colBuf
+	m.norBuf = norBuf
+	m.texBuf = texBuf
+	m.tanBuf = tanBuf
+	m.jointBuf = jointBuf
+	m.weightBuf = weightBuf
+	m.morphBufs = morphBufs
 	m.idxBuf = idxBuf
+	m.edgeBuf = edgeBuf
+	m.edges = int32(len(edges))
+	m.lineBuf = lineBuf
+	m.pointBuf = pointBuf
+	m.streams = map[string]uint32{
+		"position": gl.FLOAT_VEC4,
+		"color":    gl.FLOAT_VEC4,
+		// constant without a skin
+		"joints":  gl.UNSIGNED_INT_VEC4,
+		"weights": gl.FLOAT_VEC4,
+	}
+	if norBuf != 0 {
+		m.streams["normal"] = gl.FLOAT_VEC3
+	}
+	if texBuf != 0 {
+		m.streams["texcoord"] = gl.FLOAT_VEC3
+	}
+	if tanBuf != 0 {
+		m.streams["tangent"] = gl.FLOAT_VEC4
+	}
+	for i := range morphBufs {
+		m.streams[fmt.Sprint("morphPosition", i)] = gl.FLOAT_VEC3
+		m.streams[fmt.Sprint("morphNormal", i)] = gl.FLOAT_VEC3
+	}
+
+	updateModel(m, p)
 }
 
-func updateModel(m *model, positionLoc, colorLoc uint32) {
-	gl.BindVertexArray(m.vao)
-	defer gl.BindVertexArray(0)
+// normalizeModel moves and uniformly scales the model's positions into the
+// unit cube centered on the origin, discarding its units.
+func normalizeModel(m *model) {
+	if len(m.pos) == 0 {
+		return
+	}
 
-	gl.BindBuffer(gl.ARRAY_BUFFER, m.posBuf)
-	defer gl.BindBuffer(gl.ARRAY_BUFFER, 0)
-	if gx.IsValidAttribLoc(positionLoc) {
-		gl.EnableVertexAttribArray(positionLoc)
-		gl.VertexAttribPointer(positionLoc, 4, gl.FLOAT, false, 0, gl.PtrOffset(0))
+	var size float32
+	for i := 0; i < 3; i++ {
+		size = float32(math.Max(float64(size), float64(m.max[i]-m.min[i])))
+	}
+	if size == 0 {
+		size = 1
 	}
 
-	if gx.IsValidAttribLoc(colorLoc) {
-		gl.EnableVertexAttribArray(colorLoc)
-		gl.VertexAttribPointer(colorLoc, 4, gl.FLOAT, false, 0, gl.PtrOffset(0))
+	for i := range m.pos {
+		for j := 0; j < 3; j++ {
+			m.pos[i][j] = (m.pos[i][j] - m.center[j]) / size
+		}
+	}
+	for j := 0; j < 3; j++ {
+		m.min[j] = (m.min[j] - m.center[j]) / size
+		m.max[j] = (m.max[j] - m.center[j]) / size
 	}
-}
 
-func drawModel(m *model) {
-	gl.Enable(gl.DEPTH_TEST)
-	defer gl.Disable(gl.DEPTH_TEST)
-	gl.BindVertexArray(m.vao)
-	defer gl.BindVertexArray(0)
-	gl.DrawElements(gl.TRIANGLES, int32(len(m.idx)), gl.UNSIGNED_INT, gl.PtrOffset(0))
-}
+	for _, t := range m.targets {
+		for i := range t.Pos {
+			for j := 0; j < 3; j++ {
+				t.Pos[i][j] /= size
+			}
+		}
+	}
+	if m.rig != nil {
+		m.rig.fix = mgl32.Scale3D(1/size, 1/size, 1/size).Mul4(mgl32.Translate3D(-m.center[0], -m.center[1], -m.center[2]))
+	}
 
-func init() {
-	runtime.LockOSThread()
+	m.center = [3]float32{}
+	m.radius /= size
+	m.scale = 1
 }
 
-func main() {
-	log.SetFlags(log.Ltime | log.Lshortfile)
-	flag.Parse()
-
-	err := glfw.Init()
+// openModel loads and uploads a model, applying -units and -normalize.
+func openModel(path string, prog *program) (*model, error) {
+	m, err := loadModel(path)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	defer glfw.Terminate()
+	m.path = path
+	m.cull = true
+	m.frontFace = gl.CCW
+	m.draw = gl.TRIANGLES
 
-	glfw.WindowHint(glfw.ContextVersionMajor, 3)
-	glfw.WindowHint(glfw.ContextVersionMinor, 3)
-	glfw.WindowHint(glfw.OpenGLProfile, glfw.OpenGLCoreProfile)
-	glfw.WindowHint(glfw.OpenGLForwardCompatible, gl.TRUE)
-	window, err := glfw.CreateWindow(400, 400, "Shaderdev", nil, nil)
-	if err != nil {
-		log.Fatal(err)
+	if *units != "" {
+		scale, ok := obj.UnitScale[*units]
+		if !ok {
+			return nil, fmt.Errorf("unknown units %v", *units)
+		}
+		m.scale = scale
 	}
-	defer window.Destroy()
-	window.MakeContextCurrent()
 
-	log.Print("context: ", window.GetAttrib(glfw.ContextVersionMajor), ".", window.GetAttrib(glfw.ContextVersionMinor))
+	if *normalize {
+		normalizeModel(m)
+	}
 
-	err = gl.Init()
-	if err != nil {
-		log.Fatal(err)
+	if m.rig != nil && *animation != "" {
+		err := selectAnimation(m.rig, *animation)
+		if err != nil {
+			log.Printf("%v: %v", path, err)
+		}
 	}
 
-	gl.Enable(gl.DEBUG_OUTPUT)
-	gl.DebugMessageCallback(gx.LogProc, unsafe.Pointer(nil))
+	hideParts(m)
+	faceParts(m)
 
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatal(err)
+	initModel(m, prog)
+	return m, nil
+}
+
+func deleteModel(m *model) {
+	m.vao.Delete()
+	m.posBuf.Delete()
+	m.colBuf.Delete()
+	m.norBuf.Delete()
+	m.texBuf.Delete()
+	m.tanBuf.Delete()
+	m.jointBuf.Delete()
+	m.weightBuf.Delete()
+	for i := range m.morphBufs {
+		m.morphBufs[i][0].Delete()
+		m.morphBufs[i][1].Delete()
 	}
-	defer watcher.Close()
+	m.idxBuf.Delete()
+	m.edgeBuf.Delete()
+	m.lineBuf.Delete()
+	m.pointBuf.Delete()
+	for _, mat := range m.materials {
+		deleteMaterial(mat)
+	}
+}
 
-	shaPrefixToStage := map[string]uint32{
-		"vs":  gl.VERTEX_SHADER,
-		"gs":  gl.GEOMETRY_SHADER,
-		"tes": gl.TESS_EVALUATION_SHADER,
-		"tcs": gl.TESS_CONTROL_SHADER,
-		"fs":  gl.FRAGMENT_SHADER,
+// hideParts hides the parts of the model named by -hide, showing the others.
+func hideParts(m *model) {
+	for i := range m.parts {
+		m.parts[i].hidden = false
+		for _, name := range hiddenParts {
+			if partNamed(m.parts[i].name, name) {
+				m.parts[i].hidden = true
+			}
+		}
 	}
+}
 
-	prog := newProgram()
-	for _, arg := range flag.Args() {
-		s := strings.SplitN(arg, ":", 2)
-		if len(s) < 2 {
-			log.Fatalln(arg, "is not a valid shader specification")
+// faceParts gives the parts of the model the culling and winding of
+// partFaces, the most specific name applying.
+func faceParts(m *model) {
+	for i := range m.parts {
+		var f faceSettings
+		cullLen, faceLen := -1, -1
+		for name, o := range partFaces {
+			if !partNamed(m.parts[i].name, name) {
+				continue
+			}
+			if o.setCull && len(name) > cullLen {
+				f.setCull, f.cull, cullLen = true, o.cull, len(name)
+			}
+			if o.frontFace != 0 && len(name) > faceLen {
+				f.frontFace, faceLen = o.frontFace, len(name)
+			}
 		}
-		prefix, path := s[0], s[1]
-		path = filepath.Clean(path)
+		m.parts[i].faces = f
+	}
+}
+
+// partNamed reports whether a part is the object or object/group name.
+func partNamed(part, name string) bool {
+	return part == name || strings.HasPrefix(part, name+"/")
+}
+
+// setFaces sets the culling and winding of a part, the model's where it
+// doesn't override them.
+func setFaces(m *model, f faceSettings) {
+	cull, front := m.cull, m.frontFace
+	if f.setCull {
+		cull = f.cull
+	}
+	if f.frontFace != 0 {
+		front = f.frontFace
+	}
+	if cull {
+		gl.Enable(gl.CULL_FACE)
+	} else {
+		gl.Disable(gl.CULL_FACE)
+	}
+	gl.FrontFace(front)
+}
 
-		var ok bool
-		var stage uint32
-		if stage, ok = shaPrefixToStage[prefix]; !ok {
-			log.Fatalln("unknown shader type for", arg)
+// replaceModel opens path, keeping the display settings of old, which is
+// deleted on success.
+func replaceModel(old *model, path string, prog *program) (*model, error) {
+	m, err := openModel(path, prog)
+	if err != nil {
+		return nil, err
+	}
+	m.cull, m.frontFace, m.wire, m.draw = old.cull, old.frontFace, old.wire, old.draw
+	if len(m.parts) == len(old.parts) {
+		for i := range m.parts {
+			m.parts[i].hidden = old.parts[i].hidden
 		}
+		m.solo = old.solo
+	}
+	if m.rig != nil && old.rig != nil && len(m.rig.clips) == len(old.rig.clips) {
+		m.rig.clip = old.rig.clip
+	}
+	deleteModel(old)
+	return m, nil
+}
 
-		dir, _ := filepath.Split(path)
-		err = watcher.Add(dir)
+// watchModel watches the directories of the model and the files it uses.
+func watchModel(w *fsnotify.Watcher, m *model) error {
+	for _, f := range append([]string{m.path}, m.files...) {
+		err := w.Add(filepath.Dir(f))
 		if err != nil {
-			log.Fatalln(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// usesFile reports whether the model was loaded from path as one of its
+// material libraries or maps.
+func usesFile(m *model, path string) bool {
+	for _, f := range m.files {
+		if filepath.Clean(f) == path {
+			return true
 		}
+	}
+	return false
+}
 
-		addPath(prog, stage, path)
+func parseDrawMode(s string) (uint32, error) {
+	switch s {
+	case "points":
+		return gl.POINTS, nil
+	case "lines":
+		return gl.LINES, nil
+	case "triangles":
+		return gl.TRIANGLES, nil
+	default:
+		return 0, fmt.Errorf("unknown draw mode %v, expected points, lines or triangles", s)
 	}
+}
 
-	err = updateProgram(prog)
-	if err != nil {
-		log.Fatal(err)
+func parseFrontFace(s string) (uint32, error) {
+	switch s {
+	case "ccw":
+		return gl.CCW, nil
+	case "cw":
+		return gl.CW, nil
+	default:
+		return 0, fmt.Errorf("unknown front face winding %v, expected ccw or cw", s)
 	}
+}
 
-	modelObj, err := loadModel("monkey.obj")
-	if err != nil {
-		log.Fatal(err)
+// logProgramChecks reports problems with the inputs of a freshly linked
+// program. Samplers are checked at its next draw, once the inputs are bound.
+func logProgramChecks(prog *program, m *model) {
+	for _, s := range checkAttribs(uint32(prog.id), m) {
+		log.Println("attribute mismatch:", s)
 	}
+	prog.checkSamplers = true
+}
 
-	initModel(modelObj, prog.positionLoc, prog.colorLoc)
+// updateModel points the attributes of the program at the model's buffers.
+func updateModel(m *model, p *program) {
+	if gx.IsValidAttribLoc(p.positionLoc) {
+		m.vao.SetAttrib(p.positionLoc, m.posBuf, 4, gl.FLOAT)
+	}
 
-	ticker := time.NewTicker(1000 / 60 * time.Millisecond)
-	start := time.Now()
-	angle := float32(0)
+	// without vertex colors, color repeats the position
+	if gx.IsValidAttribLoc(p.colorLoc) {
+		col := m.posBuf
+		if m.colBuf != 0 {
+			col = m.colBuf
+		}
+		m.vao.SetAttrib(p.colorLoc, col, 4, gl.FLOAT)
+	}
 
-	go func() {
-		for err := range watcher.Errors {
-			log.Println("watcher error:", err)
+	if m.norBuf != 0 && gx.IsValidAttribLoc(p.normalLoc) {
+		m.vao.SetAttrib(p.normalLoc, m.norBuf, 3, gl.FLOAT)
+	}
+
+	if m.texBuf != 0 && gx.IsValidAttribLoc(p.texcoordLoc) {
+		m.vao.SetAttrib(p.texcoordLoc, m.texBuf, 3, gl.FLOAT)
+	}
+
+	if m.tanBuf != 0 && gx.IsValidAttribLoc(p.tangentLoc) {
+		m.vao.SetAttrib(p.tangentLoc, m.tanBuf, 4, gl.FLOAT)
+	}
+
+	// unskinned vertices follow jointMatrices[0] alone
+	if gx.IsValidAttribLoc(p.jointsLoc) {
+		if m.jointBuf != 0 {
+			m.vao.SetAttrib(p.jointsLoc, m.jointBuf, 4, gl.UNSIGNED_INT)
+		} else {
+			m.vao.DisableAttrib(p.jointsLoc)
+			gl.VertexAttribI4ui(p.jointsLoc, 0, 0, 0, 0)
 		}
-	}()
+	}
+	if gx.IsValidAttribLoc(p.weightsLoc) {
+		if m.weightBuf != 0 {
+			m.vao.SetAttrib(p.weightsLoc, m.weightBuf, 4, gl.FLOAT)
+		} else {
+			m.vao.DisableAttrib(p.weightsLoc)
+			gl.VertexAttrib4f(p.weightsLoc, 1, 0, 0, 0)
+		}
+	}
 
-	for !window.ShouldClose() {
-		select {
-		case evt := <-watcher.Events:
-			if evt.Op&fsnotify.Write > 0 {
-				log.Println(evt)
-				err := pathChanged(prog, filepath.Clean(evt.Name))
-				if err != nil {
-					log.Println(err)
-				}
+	for i, bufs := range m.morphBufs {
+		for j, loc := range []uint32{p.morphPositionLocs[i], p.morphNormalLocs[i]} {
+			if gx.IsValidAttribLoc(loc) {
+				m.vao.SetAttrib(loc, bufs[j], 3, gl.FLOAT)
 			}
-		case <-ticker.C:
-			winWidth, winHeight := window.GetSize()
-			fbWidth, fbHeight := window.GetFramebufferSize()
-			wdivh := float32(fbWidth) / float32(fbHeight)
-			hdivw := float32(fbHeight) / float32(fbWidth)
-			gl.UseProgram(0)
+		}
+	}
+}
 
-			// Clear to error color
-			gl.ClearColor(1, 0, 0, 0)
-			gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+// drawElements draws the model's triangle indices as prim, skipping hidden
+// parts and binding the material and faces of each part.
+func drawElements(m *model, prog *program, prim uint32) {
+	if len(m.idx) == 0 {
+		return
+	}
+	all := m.solo < 0
+	for _, p := range m.parts {
+		all = all && !p.hidden && p.material == nil && p.faces == (faceSettings{})
+	}
+	if all {
+		gl.DrawElements(prim, int32(len(m.idx)), gl.UNSIGNED_INT, gl.PtrOffset(0))
+		return
+	}
 
-			err := updateProgram(prog)
-			if err != nil {
-				log.Println(err)
-				window.SwapBuffers()
-				glfw.PollEvents()
-				continue
+	bound, faced := false, false
+	for i, p := range m.parts {
+		if m.solo == i || m.solo < 0 && !p.hidden {
+			if p.material != nil {
+				bindMaterial(prog, p.material)
+				bound = true
+			}
+			if faced || p.faces != (faceSettings{}) {
+				setFaces(m, p.faces)
+				faced = p.faces != (faceSettings{})
 			}
+			gl.DrawElements(prim, p.count, gl.UNSIGNED_INT, gl.PtrOffset(int(p.first)*4))
+		}
+	}
+	if bound {
+		unbindMaterial(prog)
+	}
+	if faced {
+		setFaces(m, faceSettings{})
+	}
+}
+
+// drawLinesAndPoints draws the model's l and p elements.
+func drawLinesAndPoints(m *model) {
+	if m.lineBuf != 0 {
+		m.lineBuf.Bind(gl.ELEMENT_ARRAY_BUFFER)
+		gl.DrawElements(gl.LINES, int32(len(m.lineIdx)), gl.UNSIGNED_INT, gl.PtrOffset(0))
+	}
+	if m.pointBuf != 0 {
+		gl.Enable(gl.PROGRAM_POINT_SIZE)
+		m.pointBuf.Bind(gl.ELEMENT_ARRAY_BUFFER)
+		gl.DrawElements(gl.POINTS, int32(len(m.pointIdx)), gl.UNSIGNED_INT, gl.PtrOffset(0))
+		gl.Disable(gl.PROGRAM_POINT_SIZE)
+	}
+	m.idxBuf.Bind(gl.ELEMENT_ARRAY_BUFFER)
+}
 
-			updateModel(modelObj, prog.positionLoc, prog.colorLoc)
+// drawModel draws the model, as patches of patchVertices vertices if not
+// zero, for programs with tessellation stages.
+func drawModel(m *model, prog *program, patchVertices int32) {
+	gl.Enable(gl.DEPTH_TEST)
+	defer gl.Disable(gl.DEPTH_TEST)
+	if m.cull {
+		gl.Enable(gl.CULL_FACE)
+		defer gl.Disable(gl.CULL_FACE)
+	}
+	gl.FrontFace(m.frontFace)
+	defer gl.FrontFace(gl.CCW)
+	m.vao.Bind()
+	defer gl.BindVertexArray(0)
 
-			// Use scissor test for clearing to catch errors with viewport setup, hopefully.
-			gl.ClearColor(0, 0, 0, 0)
-			gl.Enable(gl.SCISSOR_TEST)
-			gl.Scissor(0, 0, int32(fbWidth), int32(fbHeight))
-			gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
-			gl.Disable(gl.SCISSOR_TEST)
+	prim := uint32(gl.TRIANGLES)
+	if patchVertices > 0 {
+		gl.PatchParameteri(gl.PATCH_VERTICES, patchVertices)
+		prim = gl.PATCHES
+	} else if m.draw != gl.POINTS {
+		// points already include every vertex
+		defer drawLinesAndPoints(m)
+	}
 
-			gl.Viewport(0, 0, int32(fbWidth), int32(fbHeight))
-			gl.UseProgram(prog.id)
+	switch {
+	case prim == gl.PATCHES:
+		// patches are always made from the triangle indices
+	case m.draw == gl.POINTS:
+		gl.Enable(gl.PROGRAM_POINT_SIZE)
+		defer gl.Disable(gl.PROGRAM_POINT_SIZE)
+		gl.DrawArrays(gl.POINTS, 0, int32(len(m.pos)))
+		return
+	case m.draw == gl.LINES:
+		if m.edges == 0 {
+			return
+		}
+		m.edgeBuf.Bind(gl.ELEMENT_ARRAY_BUFFER)
+		defer m.idxBuf.Bind(gl.ELEMENT_ARRAY_BUFFER)
+		gl.DrawElements(gl.LINES, m.edges, gl.UNSIGNED_INT, gl.PtrOffset(0))
+		return
+	}
 
-			if prog.viewportLoc >= 0 {
-				gl.Uniform4f(prog.viewportLoc, 0, 0, float32(fbWidth), float32(fbHeight))
-			}
+	switch m.wire {
+	case wireOff:
+		drawElements(m, prog, prim)
+	case wireOnly:
+		gl.PolygonMode(gl.FRONT_AND_BACK, gl.LINE)
+		defer gl.PolygonMode(gl.FRONT_AND_BACK, gl.FILL)
+		drawElements(m, prog, prim)
+	case wireOverlay:
+		// push the shaded faces back so the lines win the depth test, in
+		// whichever direction depth runs
+		var depthFunc int32
+		gl.GetIntegerv(gl.DEPTH_FUNC, &depthFunc)
+		offset := float32(1)
+		if depthFunc == gl.GREATER || depthFunc == gl.GEQUAL {
+			offset = -1
+		}
+		gl.Enable(gl.POLYGON_OFFSET_FILL)
+		gl.PolygonOffset(offset, offset)
+		drawElements(m, prog, prim)
+		gl.Disable(gl.POLYGON_OFFSET_FILL)
+		gl.PolygonOffset(0, 0)
 
-			if prog.cursorLoc >= 0 {
-				// Use ratio of window cursor pos to screen dimensions to calc framebuffer cursor pos.
-				// Also, convert y coord to lower-left origin
-				winX, winY := window.GetCursorPos()
-				fbX := math.Floor((winX/float64(winWidth))*float64(fbWidth))
-				fbY := math.Floor((float64(winHeight)-winY)/float64(winHeight)*float64(fbHeight))
-				gl.Uniform4f(prog.cursorLoc, float32(fbX), float32(fbY), 0, 0)
-			}
+		gl.PolygonMode(gl.FRONT_AND_BACK, gl.LINE)
+		defer gl.PolygonMode(gl.FRONT_AND_BACK, gl.FILL)
+		gl.Enable(gl.COLOR_LOGIC_OP)
+		defer gl.Disable(gl.COLOR_LOGIC_OP)
+		gl.LogicOp(gl.INVERT)
+		defer gl.LogicOp(gl.COPY)
+		drawElements(m, prog, prim)
+	}
+}
 
-			if prog.timeLoc >= 0 {
-				t := time.Now()
-				d := t.Sub(start)
-				gl.Uniform4f(prog.timeLoc, float32(t.Year()), float32(t.Month()), float32(t.Day()), float32(d.Seconds()))
-			}
+var shaPrefixToStage = map[string]uint32{
+	"vs":  gl.VERTEX_SHADER,
+	"gs":  gl.GEOMETRY_SHADER,
+	"tes": gl.TESS_EVALUATION_SHADER,
+	"tcs": gl.TESS_CONTROL_SHADER,
+	"fs":  gl.FRAGMENT_SHADER,
+}
 
-			if prog.projectionLoc >= 0 {
-				var projectionMat mgl32.Mat4
-				if wdivh > hdivw {
-					projectionMat = mgl32.Frustum(wdivh*-0.75, wdivh*0.75, -0.75, 0.75, 20, 24)
-				} else {
-					projectionMat = mgl32.Frustum(-0.75, 0.75, hdivw*-0.75, hdivw*0.75, 20, 24)
-				}
-				gl.UniformMatrix4fv(prog.projectionLoc, 1, false, &projectionMat[0])
-			}
+// parseShaderSpec splits a "prefix:path" argument into its stage and cleaned path.
+func parseShaderSpec(arg string) (uint32, string, error) {
+	s := strings.SplitN(arg, ":", 2)
+	if len(s) < 2 {
+		return 0, "", fmt.Errorf("%v is not a valid shader specification", arg)
+	}
+	prefix, path := s[0], s[1]
 
-			if prog.viewLoc >= 0 {
-				viewMat := mgl32.Translate3D(0, 0, -22).Mul4(mgl32.HomogRotate3DX(math.Pi / 8))
-				gl.UniformMatrix4fv(prog.viewLoc, 1, false, &viewMat[0])
-			}
+	stage, ok := shaPrefixToStage[prefix]
+	if !ok {
+		return 0, "", fmt.Errorf("unknown shader type for %v", arg)
+	}
 
-			var modelMat mgl32.Mat4
+	if isURL(path) {
+		return stage, path, nil
+	}
+	return stage, filepath.Clean(path), nil
+}
 
-			if prog.modelLoc >= 0 {
-				modelMat = mgl32.HomogRotate3DY(-angle).Mul4(mgl32.Translate3D(-0.5, -0.5, -0.5))
-				gl.UniformMatrix4fv(prog.modelLoc, 1, false, &modelMat[0])
-			}
+// createWindow creates a window with a core profile context of the given
+// version, makes it current and initializes gl.
+func createWindow(major, minor int, visible bool) (*glfw.Window, error) {
+	return createContextWindow(major, minor, profileCore, false, visible)
+}
 
-			// Draw things that pivot only around Y-axis here
+// createContextWindow creates a window with a context of at least
+// major.minor of a profile, and a debug context if debug.
+func createContextWindow(major, minor int, profile contextProfile, debug, visible bool) (*glfw.Window, error) {
+	glfw.WindowHint(glfw.ContextVersionMajor, major)
+	glfw.WindowHint(glfw.ContextVersionMinor, minor)
+	switch profile {
+	case profileCore:
+		glfw.WindowHint(glfw.ClientAPI, glfw.OpenGLAPI)
+		glfw.WindowHint(glfw.OpenGLProfile, glfw.OpenGLCoreProfile)
+		glfw.WindowHint(glfw.OpenGLForwardCompatible, gl.TRUE)
+	case profileCompat:
+		glfw.WindowHint(glfw.ClientAPI, glfw.OpenGLAPI)
+		glfw.WindowHint(glfw.OpenGLProfile, glfw.OpenGLCompatProfile)
+		glfw.WindowHint(glfw.OpenGLForwardCompatible, gl.FALSE)
+	case profileES:
+		glfw.WindowHint(glfw.ClientAPI, glfw.OpenGLESAPI)
+		glfw.WindowHint(glfw.OpenGLProfile, glfw.OpenGLAnyProfile)
+		glfw.WindowHint(glfw.OpenGLForwardCompatible, gl.FALSE)
+	}
+	if debug {
+		glfw.WindowHint(glfw.OpenGLDebugContext, gl.TRUE)
+	} else {
+		glfw.WindowHint(glfw.OpenGLDebugContext, gl.FALSE)
+	}
+	if visible {
+		glfw.WindowHint(glfw.Visible, gl.TRUE)
+	} else {
+		glfw.WindowHint(glfw.Visible, gl.FALSE)
+	}
+	window, err := glfw.CreateWindow(400, 400, "Shaderdev", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	window.MakeContextCurrent()
 
-			/*
-				if prog.modelLoc >= 0 {
-					modelMat = modelMat.Mul4(
-						mgl32.Translate3D(0.5, 0.5, 0.5),
-					).Mul4(
-						mgl32.HomogRotate3DX(angle),
-					).Mul4(
-						mgl32.Translate3D(-0.5, -0.5, -0.5),
-					)
-					gl.UniformMatrix4fv(prog.modelLoc, 1, false, &modelMat[0])
-				}
-			*/
+	gles = window.GetAttrib(glfw.ClientAPI) == glfw.OpenGLESAPI
+	if gles {
+		// the loader of go-gl only knows desktop GL libraries, but the
+		// functions ES shares with it are the same
+		err = gl.InitWithProcAddrFunc(glfwProcAddress)
+	} else {
+		err = gl.Init()
+	}
+	if err != nil {
+		window.Destroy()
+		return nil, err
+	}
 
-			gl.Enable(gl.CULL_FACE)
-			drawModel(modelObj)
-			gl.Disable(gl.CULL_FACE)
-			window.SwapBuffers()
+	major, minor = window.GetAttrib(glfw.ContextVersionMajor), window.GetAttrib(glfw.ContextVersionMinor)
+	obtained := profileCore
+	if gles {
+		obtained = profileES
+	} else if window.GetAttrib(glfw.OpenGLProfile) == glfw.OpenGLCompatProfile {
+		obtained = profileCompat
+	}
+	name := contextName(major, minor, obtained)
+	if window.GetAttrib(glfw.OpenGLDebugContext) == gl.TRUE {
+		name += " debug"
+	}
+	log.Printf("context: %v, %v", name, gl.GoStr(gl.GetString(gl.VERSION)))
 
-			glfw.PollEvents()
-			angle += 0.01
+	// ES 3.2 has KHR_debug without suffixes, and earlier versions only with
+	khrDebug := major > 4 || major == 4 && minor >= 3 || glfw.ExtensionSupported("GL_KHR_debug")
+	if gles {
+		khrDebug = minor >= 2
+	}
+	if khrDebug {
+		gl.Enable(gl.DEBUG_OUTPUT)
+		gl.DebugMessageCallback(gx.LogProc, unsafe.Pointer(nil))
+	}
+	gx.EnableDebug(khrDebug)
+	gx.EnableDSA(*dsaFlag && !gles && (major > 4 || major == 4 && minor >= 5 || glfw.ExtensionSupported("GL_ARB_direct_state_access")))
+
+	return window, nil
+}
+
+var timeScale = flag.Float64("timescale", 1, "multiplier applied to the elapsed time fed to the time uniform")
+var fixedDt = flag.String("fixed-dt", "", "advance time by this many seconds every frame, e.g. 1/60, instead of by wall time")
+var startTime = flag.Float64("start-time", 0, "initial value, in seconds, of the elapsed time fed to the time uniform")
+var reloadTransitionSpec = flag.String("reload-transition", "", "blend into the program whenever it is relinked: cut, fade, wipe or a fragment shader file, with an optional duration like fade:0.5")
+var reloadResetsFrame = flag.Bool("reload-resets-frame", false, "reset the frame uniform to 0 whenever the program is relinked")
+var backgroundSpec = flag.String("background", "black", "what to draw behind the model: black, transparent, gradient, checker or env:image.hdr")
+var resolution = flag.String("resolution", "", "render at a fixed internal resolution, e.g. 1920x1080, letterboxed into the window")
+var integerScale = flag.Bool("integer-scale", false, "with -resolution, upscale by whole multiples with nearest filtering, for pixel art")
+var crtMask = flag.Bool("crt", false, "with -resolution, present through a CRT scanline and aperture grille mask")
+var taaFlag = flag.Bool("taa", false, "jitter the main pass and resolve it against a reprojected history")
+var taaResolve = flag.String("taa-resolve", "", "fragment shader replacing the built-in TAA resolve")
+var fov = flag.Float64("fov", 0, "vertical field of view of the camera in degrees, across the shorter side of the viewport (default 4.3)")
+var near = flag.Float64("near", 20, "distance from the camera to the near clip plane")
+var far = flag.Float64("far", 24, "distance from the camera to the far clip plane")
+var eye = flag.String("eye", "", "position of the camera, e.g. 0,2,10 (default 0,8.42,20.33)")
+var lookAt = flag.String("target", "0,0,0", "point the camera looks at")
+var depthFlag = flag.String("depth", "standard", "depth convention of the main pass: standard, reversed (needs GL_ARB_clip_control) or log")
+
+// listFlag collects the values of a repeated flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+var extraCameras listFlag
+var searchRoots listFlag
+var hiddenParts listFlag
+
+// partFaces overrides culling and winding by object or object/group, from
+// the project's [cull] and [front-face] tables.
+var partFaces map[string]faceSettings
+var rngSpecs listFlag
+var builtinSpecs listFlag
+var morphSpecs listFlag
+var uniformSpecs listFlag
+
+func init() {
+	flag.Var(&extraCameras, "camera", "additional camera, EYE or EYE@TARGET, sharing the lens of the main one; may be repeated")
+	flag.Var(&rngSpecs, "rng", "procedural texture NAME=KIND[:WxH[:EVERY]] bound to sampler NAME, regenerated from -seed and the frame every EVERY frames; KIND is white (RGBA8 noise) or halton (RGBA32F samples); may be repeated")
+	flag.Var(&hiddenParts, "hide", "object or object/group of the model not to draw; may be repeated")
+	flag.Var(&builtinSpecs, "builtin", "fragment shader NAME=PATH replacing one of the tool's own, reloading when it changes; NAME is annotation, background, crt, cut, dof, fade, overlay, panel, stats, taa or wipe; may be repeated")
+	flag.Var(&morphSpecs, "morph", "weight NAME=WEIGHT of a glTF model's morph target, by name or index, fed to the morphWeights uniform instead of the animated one; may be repeated")
+	flag.Var(&uniformSpecs, "uniform", "value NAME=V[,V...] of a uniform of the shaders, set after every link in place of the defaults' and project's; numbers, true or false, as many as the uniform's type holds, e.g. lightDir=0.3,1,0.2; may be repeated")
+	flag.Var(&searchRoots, "I", "directory searched for shaders, models and textures not found relative to the working directory; may be repeated")
+}
+
+var fit = flag.Bool("fit", true, "frame the model's bounds, fitting whichever of -near, -far, -target, -focus-distance and the distance of -eye aren't set")
+var dofFlag = flag.Bool("dof", false, "blur the main pass by the camera's aperture and focus distance")
+var aperture = flag.Float64("aperture", 2.8, "f-number of the camera's aperture, fed to the aperture uniform")
+var focusDistance = flag.Float64("focus-distance", 22, "distance from the camera, in meters, that is in focus")
+var captureSeconds = flag.Float64("capture-seconds", 0, "keep this many seconds of frames in memory, dumped to a PNG sequence with D")
+var exportDir = flag.String("export", "", "render -frames frames with a hidden window into this directory as PNGs, resuming from its checkpoint if interrupted")
+var exportFrames = flag.Int("frames", 0, "number of frames to render with -export, or measure with -bench-out")
+var aspectMask = flag.String("aspect", "", "mask the viewport outside this aspect ratio, e.g. 16:9")
+var safeArea = flag.Bool("safe-area", false, "outline the action and title safe areas")
+var joystick = flag.Int("joystick", 0, "index of the joystick feeding the gamepadAxes and gamepadButtons uniforms")
+var seedFlag = flag.Int64("seed", -1, "value of the seed uniform, or -1 to pick one at random")
+var modelPath = flag.String("model", "monkey.obj", "OBJ, glTF or GLB file to draw")
+var animation = flag.String("animation", "", "animation of a glTF model to play, by name or index, or rest for the rest pose; M cycles them")
+var strictOBJ = flag.Bool("strict-obj", false, "reject models with unknown elements or malformed lines, instead of skipping them with a warning")
+var units = flag.String("units", "", "unit of length of the model, e.g. mm, cm or m, overriding any exporter hint")
+var normalize = flag.Bool("normalize", false, "recenter and scale the model to fit the unit cube, ignoring its units")
+var drawMode = flag.String("draw", "triangles", "primitives to draw the model as: points, lines or triangles")
+var patchSize = flag.Int("patch-vertices", 3, "vertices per patch when the program has tessellation stages")
+var cullFaces = flag.Bool("cull", true, "cull back faces of the model, but for the parts a project gives their own")
+var frontFace = flag.String("front-face", "ccw", "winding of the model's front faces, ccw or cw, but for the parts a project gives their own")
+var checkState = flag.Bool("check-state", false, "report GL state left changed by each pass")
+var shareAddr = flag.String("share", "", "host a live-share session on this address, e.g. :7070, sending shaders, uniforms, camera and time to viewers")
+var annotationsPath = flag.String("annotations", "annotations.json", "file the annotations added with N are saved to, shared with live-share viewers")
+var joinAddr = flag.String("join", "", "view the live-share session hosted at this address, e.g. host:7070, instead of loading shaders")
+var embedAddr = flag.String("embed", "", "render frames for the host application listening on this address, e.g. :7071 or unix:/tmp/host.sock, with a hidden window")
+var unusedFlag = flag.Bool("unused", true, "report uniforms and attributes that are declared but inactive after linking, and why")
+var explicitLayoutFlag = flag.Bool("explicit-layout", false, "inject layout(location) into vertex inputs and layout(binding) into samplers by the tool's mapping, where the GLSL version allows")
+var dsaFlag = flag.Bool("dsa", true, "create and fill buffers and vertex arrays with direct state access where the context has it, instead of binding them; false to rule it out when chasing driver bugs")
+var layoutPath = flag.String("layout", "", "JSON file of expected uniform and storage block layouts, in the format written by reflect")
+
+// reportedLeaks keeps runPass from repeating the same report every frame.
+var reportedLeaks = make(map[string]bool)
+
+// passNames are the passes run so far, in the order first run, and
+// disabledPasses those switched off from the panel.
+var passNames []string
+var disabledPasses = make(map[string]bool)
+
+// runPass calls f, unless the pass is switched off, timing it on the GPU,
+// and, with -check-state, reports any GL state f leaves changed, since every
+// pass is expected to restore what it touches.
+func runPass(name string, f func()) {
+	seen := false
+	for _, n := range passNames {
+		seen = seen || n == name
+	}
+	if !seen {
+		passNames = append(passNames, name)
+	}
+	if disabledPasses[name] {
+		return
+	}
+
+	gx.PushGroup(name)
+	defer gx.PopGroup()
+	t := startPassTimer(name)
+	defer stopPassTimer(t)
+	if !*checkState {
+		f()
+		return
+	}
+
+	before := gx.SnapshotState()
+	f()
+	for _, d := range gx.DiffState(before, gx.SnapshotState()) {
+		msg := fmt.Sprintf("%v pass leaked state: %v", name, d)
+		if !reportedLeaks[msg] {
+			reportedLeaks[msg] = true
+			log.Println(msg)
+		}
+	}
+}
+
+func init() {
+	runtime.LockOSThread()
+}
+
+func main() {
+	log.SetFlags(log.Ltime | log.Lshortfile)
+
+	// a bundle given as the last argument supplies the flags and shaders,
+	// with any flags before it taking precedence
+	args := os.Args[1:]
+	if n := len(args); n > 0 && isBundle(args[n-1]) && (n < 2 || args[n-2] != "pack") {
+		var err error
+		args, err = bundleArgs(args[n-1], args[:n-1])
+		defer removeBundle()
+		if err != nil {
+			removeBundle()
+			log.Fatal(err)
+		}
+	}
+	flag.CommandLine.Parse(args)
+
+	proj, err := loadProject(*projectPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the flags given on the command line, which the project can't change
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	// the flags the project sets, left to it when packing
+	fromProject := make(map[string]bool)
+	if proj != nil {
+		for name := range proj.flags {
+			fromProject[name] = !given[name]
+		}
+	}
+	if proj != nil {
+		err = applyFlagDefaults(proj.defaults)
+		if err != nil {
+			log.Fatal(err)
+		}
+		partFaces = proj.faces
+		log.Println("project:", proj.path)
+	}
+
+	defaultsFile := defaultsPath()
+	userDefaults, err := loadDefaults(defaultsFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = applyFlagDefaults(userDefaults)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = parseBuiltinSpecs(builtinSpecs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = parseMorphSpecs(morphSpecs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = parseUniformSpecs(uniformSpecs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the user's own, for merging with the project again when either changes
+	baseDefaults := userDefaults
+	userDefaults = mergeDefaults(baseDefaults, proj)
+
+	if flag.Arg(0) == "reflect" {
+		err := reflectMain(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "pack" {
+		err := packMain(flag.Args()[1:], proj, fromProject)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "journal" {
+		err := journalMain(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "batch" {
+		err := batchMain(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "bench" {
+		err := benchMain(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "playlist" {
+		err := playlistMain(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *infoFlag {
+		err := infoMain(os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// whether to run again in software is decided before anything the run
+	// would repeat, such as the journal or listeners
+	if *softwareFlag {
+		useSoftwareRenderer()
+	}
+
+	err = glfw.Init()
+	if err != nil && canFallBack() && *softwareDisplay != "" {
+		// without a display, e.g. in a container, one is needed too
+		exitSoftware(err, strings.Fields(*softwareDisplay))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer glfw.Terminate()
+
+	// block layout queries require program interface queries, from 4.3
+	major, minor := 3, 3
+	if *layoutPath != "" {
+		major, minor = 4, 3
+	}
+	// shaders given on the command line replace the project's
+	shaderSpecs := flag.Args()
+	projectShaders := len(shaderSpecs) == 0 && proj != nil
+	if projectShaders {
+		shaderSpecs = proj.shaders
+	}
+
+	// tessellation stages need 4.0, and WGSL translations 4.3
+	tess := false
+	for _, arg := range shaderSpecs {
+		stage, path, _ := parseShaderSpec(arg)
+		if stage == gl.TESS_CONTROL_SHADER || stage == gl.TESS_EVALUATION_SHADER {
+			tess = true
+			if major < 4 {
+				major, minor = 4, 0
+			}
+		}
+		if isWGSL(path) && (major < 4 || major == 4 && minor < 3) {
+			major, minor = 4, 3
+		}
+	}
+
+	window, err := createMainWindow(major, minor, tess, *exportDir == "" && *embedAddr == "" && *benchOut == "")
+	if err != nil && !*softwareFlag && canFallBack() {
+		exitSoftware(err, nil)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer window.Destroy()
+	labelSoftware()
+
+	if *journalPath != "" {
+		err = openJournal(*journalPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if proj != nil && proj.width > 0 && proj.height > 0 {
+		window.SetSize(proj.width, proj.height)
+	}
+	if proj != nil && proj.title != "" {
+		window.SetTitle(proj.title + softwareLabel)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer watcher.Close()
+
+	depth, err := parseDepthMode(*depthFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = checkMipmaps(*mipmapsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = parseWGSLEntries(*wgslEntry)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = setupDepth(depth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	prog := newProgram()
+	prog.defines = depthDefines(depth) + projectDefines(proj)
+	prog.spirvOut = *spirvOut
+	if *layoutPath != "" {
+		path, err := resolvePath(*layoutPath, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		prog.layout, err = loadLayout(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// a viewer compiles the host's shaders, written to files of its own
+	var viewer *shareViewer
+	if *joinAddr != "" {
+		if flag.NArg() > 0 {
+			log.Fatalln("-join takes no shader specifications")
+		}
+		viewer, err = joinShare(*joinAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer leaveShare(viewer)
+
+		m, ok := <-viewer.msgs
+		if !ok {
+			log.Fatalln("share: no shaders received from", *joinAddr)
+		}
+		paths, err := writeShaders(viewer, m.Shaders)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for prefix, path := range paths {
+			addPath(prog, shaPrefixToStage[prefix], path)
+		}
+		userDefaults.uniforms = m.Uniforms
+	}
+
+	for _, arg := range shaderSpecs {
+		stage, path, err := parseShaderSpec(arg)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		path, err = resolvePath(path, "")
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		dir, _ := filepath.Split(path)
+		err = watcher.Add(dir)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		addPath(prog, stage, path)
+	}
+
+	var diags *diagnosticsSink
+	if *diagnosticsFormat != "" {
+		diags, err = openDiagnostics(*diagnosticsFormat, *diagnosticsAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *diagnosticsAddr != "" {
+		log.Fatal("-diagnostics-addr needs -diagnostics")
+	}
+	var mx *metricsServer
+	if *metricsAddr != "" {
+		mx, err = serveMetrics(*metricsAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	err = updateProgram(prog)
+	if diags != nil {
+		reportBuild(diags, err)
+	}
+	if mx != nil {
+		observeBuild(mx, err)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	journalEvent("load", "program linked", sourceHashes(prog))
+	for _, err := range applyUniforms(prog, userDefaults.uniforms) {
+		log.Println("defaults:", err)
+	}
+	if *tweaksPath != "" {
+		err := loadTweaks(prog, *tweaksPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	defer autosaveTweaks(prog, true)
+
+	cmp, err := newCompare()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer closeCompare(cmp)
+	if cmp != nil {
+		reportCompare(cmp, syncCompare(cmp, prog))
+		updateCompare(cmp)
+		log.Printf("compare: %v, the shaders on the left, %v on the right", compareModeNames[cmp.mode], compareName(cmp))
+	}
+
+	var host *shareHost
+	if *shareAddr != "" {
+		host, err = hostShare(*shareAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sources, err := programSources(prog)
+		if err != nil {
+			log.Fatal(err)
+		}
+		publishShare(host, &shareMessage{Shaders: sources, Uniforms: userDefaults.uniforms})
+	}
+
+	var preview *previewServer
+	if *previewAddr != "" {
+		// NaN isn't positive either
+		if !(*previewFPS > 0) || *previewQuality < 1 || *previewQuality > 100 {
+			log.Fatal("-preview-fps must be positive and -preview-quality 1 to 100")
+		}
+		preview, err = servePreview(*previewAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Dir(defaultsFile)); err == nil {
+		err = watcher.Add(filepath.Dir(defaultsFile))
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	if proj != nil {
+		err = watcher.Add(filepath.Dir(proj.path))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	path, err := resolvePath(*modelPath, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	modelObj, err := openModel(path, prog)
+	if err != nil {
+		log.Fatal(err)
+	}
+	modelObj.cull = *cullFaces
+	modelObj.frontFace, err = parseFrontFace(*frontFace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	modelObj.draw, err = parseDrawMode(*drawMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logProgramChecks(prog, modelObj)
+
+	cam := newCamera()
+	cam.depth = depth
+	if *fov > 0 {
+		cam.fovy = float32(*fov * math.Pi / 180)
+	}
+	cam.near = float32(*near)
+	cam.far = float32(*far)
+	if cam.near <= 0 || cam.far <= cam.near {
+		log.Fatalln("-near must be positive and less than -far")
+	}
+	if *eye != "" {
+		cam.eye, err = parseVec3(*eye)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	cam.target, err = parseVec3(*lookAt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cam.eye.ApproxEqual(cam.target) {
+		log.Fatalln("-eye and -target must differ")
+	}
+	cam.aperture = float32(*aperture)
+	cam.focusDistance = float32(*focusDistance)
+
+	// V switches cam between cams, P shows the next one in an inset
+	cams := []*camera{cam}
+	for _, spec := range extraCameras {
+		c, err := parseCamera(cam, spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cams = append(cams, c)
+	}
+	activeCam := 0
+	pip := false
+	if *fit {
+		for _, c := range cams {
+			fitCamera(c, modelObj)
+		}
+	}
+
+	err = watchModel(watcher, modelObj)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var textures []textureInput
+	if proj != nil {
+		for _, spec := range proj.textures {
+			resolved, err := resolveTextureSpec(spec)
+			if err != nil {
+				log.Fatal(err)
+			}
+			path := resolved.path
+			t, err := openTextureInput(resolved, textureMipmaps(proj, spec.path))
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = watcher.Add(filepath.Dir(path))
+			if err != nil {
+				log.Fatal(err)
+			}
+			textures = append(textures, t)
+			logTextureInput(len(textures)-1, t)
+		}
+		logTextureChecks(prog, textures)
+	}
+
+	window.SetDropCallback(func(w *glfw.Window, names []string) {
+		for _, name := range names {
+			path := filepath.Clean(name)
+			if isURL(name) {
+				var err error
+				path, err = fetchURL(name)
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+			}
+			err := watcher.Add(filepath.Dir(path))
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			kind := dropKind(path)
+			switch kind {
+			case dropModel:
+				m, err := replaceModel(modelObj, path, prog)
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+				modelObj = m
+				err = watchModel(watcher, modelObj)
+				if err != nil {
+					log.Println(err)
+				}
+				logProgramChecks(prog, modelObj)
+				if *fit {
+					for _, c := range cams {
+						fitCamera(c, modelObj)
+					}
+				}
+				log.Println("model:", path)
+			case dropTexture, dropVideo:
+				spec := textureSpec{path: path}
+				if kind == dropVideo {
+					spec.kind = "video"
+				}
+				t, err := openTextureInput(spec, *mipmapsFlag)
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+				textures = append(textures, t)
+				logTextureInput(len(textures)-1, t)
+			case dropShader:
+				stage := extToStage[strings.ToLower(filepath.Ext(path))]
+				setStagePath(prog, stage, path)
+				log.Printf("%v shader: %v", gx.StageStr(stage), path)
+			default:
+				log.Println("don't know what to do with dropped file", path)
+			}
+		}
+	})
+
+	seed := uint32(*seedFlag)
+	if *seedFlag < 0 {
+		var b [4]byte
+		_, err = rand.Read(b[:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		seed = binary.LittleEndian.Uint32(b[:])
+	}
+	log.Println("seed:", seed)
+
+	var rngInputs []*rngInput
+	for _, spec := range rngSpecs {
+		in, err := parseRNGInput(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rngInputs = append(rngInputs, in)
+	}
+
+	var audioIn *audioInput
+	if *audioInCommand != "" {
+		audioIn, err = startAudio(*audioInCommand)
+	} else if *audioPath != "" {
+		audioIn, err = openAudioTrack(*audioPath)
+	}
+	if err != nil {
+		log.Fatal("audio: ", err)
+	}
+	if audioIn != nil {
+		defer stopAudio(audioIn)
+	}
+
+	bg, err := newBackground(*backgroundSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ov, err := newOverlay(*aspectMask, *safeArea)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// N starts a note at the cursor, typed into the title bar; viewers send
+	// theirs to the host, which saves and shares them
+	an, err := newAnnotator()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var notes []annotation
+	if viewer == nil {
+		notes, err = loadAnnotations(*annotationsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if host != nil {
+		publishShare(host, &shareMessage{Annotations: notes})
+	}
+	var note *annotation
+	// the cursor as a fraction of the image, and the annotation under it
+	var cursorUV [2]float32
+	hover := -1
+	title := ""
+	addNote := func(a annotation) {
+		notes = append(notes, a)
+		err := saveAnnotations(*annotationsPath, notes)
+		if err != nil {
+			log.Println(err)
+		}
+		if host != nil {
+			publishShare(host, &shareMessage{Annotations: notes})
+		}
+	}
+	// the character of the key starting a note, if it has one, is not part
+	// of it
+	skipChar := false
+	window.SetCharCallback(func(w *glfw.Window, char rune) {
+		if note != nil && !skipChar {
+			note.Text += string(char)
+		}
+		skipChar = false
+	})
+
+	var rt *target
+	if *resolution != "" {
+		w, h, err := parseResolution(*resolution)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rt, err = newTarget("resolution", w, h, gl.RGBA8)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var aa *taa
+	if *taaFlag {
+		resolve := *taaResolve
+		if resolve != "" {
+			resolve, err = resolvePath(resolve, "")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		aa, err = newTAA(resolve, depth)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var lens *dof
+	if *dofFlag {
+		lens, err = newDOF(depth)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var fader *reloadTransition
+	if *reloadTransitionSpec != "" {
+		t, err := newTransition(*reloadTransitionSpec, time.Second/2)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fader = &reloadTransition{t: t}
+	}
+
+	var crtPresenter *crt
+	if *crtMask {
+		if rt == nil {
+			log.Fatalln("-crt requires -resolution")
+		}
+		crtPresenter, err = newCRT()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	err = watchBuiltins(watcher)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pad := &gamepad{joy: glfw.Joystick(*joystick)}
+
+	var ring *captureRing
+	if *captureSeconds > 0 {
+		if !(*captureScale > 0 && *captureScale <= 1) || *captureMB <= 0 {
+			log.Fatalln("-capture-scale must be in (0, 1] and -capture-mb positive")
+		}
+		ring = newCaptureRing(int(math.Ceil(*captureSeconds*60)), *captureMB<<20, *captureScale)
+	}
+
+	ms := &mouse{}
+	window.SetScrollCallback(scrollCallback(ms))
+
+	ticker := time.NewTicker(1000 / 60 * time.Millisecond)
+	clk := newClock(time.Now(), time.Duration(*startTime*float64(time.Second)), *timeScale)
+	if *fixedDt != "" {
+		clk.fixed, err = parseSeconds(*fixedDt)
+		if err != nil {
+			log.Fatalln("invalid -fixed-dt:", err)
+		}
+	}
+	angle := float32(0)
+	frame := int32(0)
+
+	pn, err := newPanel(*panelFlag, func() {
+		resetClock(clk)
+		frame = 0
+		journalEvent("change", "reset time", nil)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	st, err := newFrameStats(*statsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// clicks on the panel are its own, not the shader's
+	buttons := mouseButtonCallback(ms)
+	window.SetMouseButtonCallback(func(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+		x, y := framebufferCursorPos(w)
+		if action == glfw.Press && panelContains(pn, x, y) {
+			return
+		}
+		// shift dragging moves the divider of a wipe instead
+		if cmp != nil && button == glfw.MouseButtonLeft {
+			if action == glfw.Press && mods&glfw.ModShift != 0 && comparing(cmp) && cmp.mode == compareWipe {
+				cmp.dragging = true
+				return
+			}
+			if action == glfw.Release && cmp.dragging {
+				cmp.dragging = false
+				return
+			}
+		}
+		buttons(w, button, action, mods)
+	})
+
+	// exports render as fast as they can, by default at 60 frames per second
+	// of shader time
+	tick := ticker.C
+	var shot captureFrame
+	// the hash of the settings an export started with, checked on resuming
+	var exportHash string
+	if *exportDir != "" {
+		if *exportFrames <= 0 {
+			log.Fatalln("-export requires -frames")
+		}
+		if clk.fixed == 0 {
+			clk.fixed = frameStep
+		}
+		if *resolution != "" {
+			w, h, _ := parseResolution(*resolution)
+			window.SetSize(int(w), int(h))
+		}
+
+		err := os.MkdirAll(*exportDir, 0755)
+		if err != nil {
+			log.Fatal(err)
+		}
+		exportHash, err = exportSettings(prog)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cp, err := loadCheckpoint(*exportDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if cp != nil {
+			if cp.Settings != exportHash {
+				log.Fatalf("%v was exported with other flags or shaders; export to another directory, or remove it to start over", *exportDir)
+			}
+			if cp.TAA != nil && aa != nil {
+				err = loadTAAHistory(aa, *exportDir, cp.TAA)
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			frame, clk.elapsed, seed, angle = cp.Frame, cp.Elapsed, cp.Seed, cp.Angle
+			log.Println("resuming export at frame", frame)
+		}
+		if int(frame) >= *exportFrames {
+			log.Println("export already complete")
+			return
+		}
+
+		now := make(chan time.Time)
+		close(now)
+		tick = now
+	}
+
+	// benchmarks render as fast as they can, without waiting for vsync
+	var bench *benchRun
+	if *benchOut != "" {
+		if *exportDir != "" {
+			log.Fatalln("-bench-out and -export can't be combined")
+		}
+		if *exportFrames <= 0 && *benchSeconds <= 0 {
+			log.Fatalln("-bench-out requires -frames or -bench-seconds")
+		}
+		bench = &benchRun{}
+		if clk.fixed == 0 {
+			clk.fixed = frameStep
+		}
+		if *resolution != "" {
+			w, h, _ := parseResolution(*resolution)
+			window.SetSize(int(w), int(h))
+		}
+		glfw.SwapInterval(0)
+
+		now := make(chan time.Time)
+		close(now)
+		tick = now
+	}
+
+	// an embedded instance renders a frame whenever the host asks for one
+	var emb *embedClient
+	if *embedAddr != "" {
+		if *exportDir != "" || *benchOut != "" || *resolution != "" {
+			log.Fatalln("-embed can't be combined with -export, -bench-out or -resolution")
+		}
+		emb, err = dialEmbed(*embedAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer closeEmbed(emb)
+		tick = emb.ticks
+	}
+
+	// Space pauses, left/right step a frame (a second with shift), R resets
+	// time and the frame counter,
+	// +/- double or halve the time scale.
+	// C toggles culling, F flips the front face winding.
+	// M cycles the animations of a glTF model.
+	// Tab shows or hides the tweak panel, I the frame statistics.
+	// A cycles the aspect ratio mask, S toggles the safe area outlines.
+	// Holding an arrow key scrubs through key repeat.
+	window.SetKeyCallback(func(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+		if action == glfw.Release {
+			return
+		}
+
+		if note != nil {
+			switch key {
+			case glfw.KeyEnter:
+				if viewer != nil {
+					err := sendAnnotation(viewer, *note)
+					if err != nil {
+						log.Println("share:", err)
+					}
+				} else {
+					addNote(*note)
+				}
+				log.Printf("note at %.3f, %.3f: %v", note.X, note.Y, note.Text)
+				journalEvent("note", fmt.Sprintf("at %.3f, %.3f: %v", note.X, note.Y, note.Text), nil)
+				note = nil
+			case glfw.KeyEscape:
+				note = nil
+			case glfw.KeyBackspace:
+				if r := []rune(note.Text); len(r) > 0 {
+					note.Text = string(r[:len(r)-1])
+				}
+			}
+			return
+		}
+
+		pressed := key
+		if k, ok := userDefaults.keys[key]; ok {
+			key = k
+		}
+
+		step := frameStep
+		if mods&glfw.ModShift != 0 {
+			step = time.Second
+		}
+
+		switch key {
+		case glfw.KeySpace:
+			if action == glfw.Press {
+				togglePause(clk)
+				logChange("paused:", clk.paused)
+			}
+		case glfw.KeyRight:
+			stepClock(clk, step)
+		case glfw.KeyLeft:
+			stepClock(clk, -step)
+		case glfw.KeyR:
+			if action == glfw.Press {
+				resetClock(clk)
+				frame = 0
+				journalEvent("change", "reset time", nil)
+			}
+		case glfw.KeyEqual, glfw.KeyKPAdd:
+			if action == glfw.Press {
+				scaleClock(clk, 2)
+				logChange("time scale:", clk.scale)
+			}
+		case glfw.KeyMinus, glfw.KeyKPSubtract:
+			if action == glfw.Press {
+				scaleClock(clk, 0.5)
+				logChange("time scale:", clk.scale)
+			}
+		case glfw.KeyA:
+			if action == glfw.Press {
+				cycleOverlayAspect(ov)
+				logChangef("aspect mask: %q", ov.aspect)
+			}
+		case glfw.KeyS:
+			if action == glfw.Press {
+				ov.safe = !ov.safe
+				logChange("safe area:", ov.safe)
+			}
+		case glfw.KeyC:
+			if action == glfw.Press {
+				modelObj.cull = !modelObj.cull
+				logChange("cull:", modelObj.cull)
+			}
+		case glfw.KeyLeftBracket, glfw.KeyRightBracket:
+			if action != glfw.Release {
+				d := float32(0.1)
+				if mods&glfw.ModShift != 0 {
+					d = 1
+				}
+				if key == glfw.KeyLeftBracket {
+					d = -d
+				}
+				cam.focusDistance = float32(math.Max(float64(cam.focusDistance+d), 0.1))
+				logChange("focus distance:", cam.focusDistance)
+			}
+		case glfw.KeyComma, glfw.KeyPeriod:
+			// a third of a stop at a time
+			if action != glfw.Release {
+				f := float32(math.Pow(2, 1.0/6))
+				if key == glfw.KeyComma {
+					f = 1 / f
+				}
+				cam.aperture *= f
+				logChangef("aperture: f/%.1f", cam.aperture)
+			}
+		case glfw.KeyD:
+			if action == glfw.Press && ring != nil {
+				frames := takeCaptureRing(ring)
+				dir := time.Now().Format("capture-20060102-150405")
+				log.Printf("writing %v frames to %v", len(frames), dir)
+				journalEvent("capture", fmt.Sprintf("%v frames to %v", len(frames), dir), nil)
+				go func() {
+					err := writeCapture(frames, dir)
+					if err != nil {
+						log.Println(err)
+						return
+					}
+					log.Println("wrote", dir)
+				}()
+			}
+		case glfw.KeyW:
+			if action == glfw.Press && gles {
+				log.Println("wireframe: ES has no polygon modes")
+			} else if action == glfw.Press {
+				modelObj.wire = (modelObj.wire + 1) % wireMode(len(wireModeNames))
+				logChange("wireframe:", wireModeNames[modelObj.wire])
+			}
+		case glfw.KeyV:
+			if action == glfw.Press {
+				activeCam = (activeCam + 1) % len(cams)
+				cam = cams[activeCam]
+				logChange("camera:", activeCam)
+			}
+		case glfw.KeyP:
+			if action == glfw.Press && len(cams) > 1 {
+				pip = !pip
+				logChange("picture in picture:", pip)
+			}
+		case glfw.KeyN:
+			if action == glfw.Press {
+				note = &annotation{X: cursorUV[0], Y: cursorUV[1]}
+				skipChar = pressed < glfw.KeyEscape
+			}
+		case glfw.KeyG:
+			if action == glfw.Press && len(modelObj.parts) > 0 {
+				modelObj.solo++
+				if modelObj.solo == len(modelObj.parts) {
+					modelObj.solo = -1
+					logChange("parts: all shown")
+				} else {
+					logChange("part:", modelObj.parts[modelObj.solo].name)
+				}
+			}
+		case glfw.KeyTab:
+			if action == glfw.Press {
+				pn.shown = !pn.shown
+				logChange("panel:", pn.shown)
+			}
+		case glfw.KeyI:
+			if action == glfw.Press {
+				st.shown = !st.shown
+				logChange("stats:", st.shown)
+			}
+		case glfw.KeyM:
+			if action == glfw.Press && modelObj.rig != nil {
+				cycleAnimation(modelObj.rig)
+				logChange("animation:", clipName(modelObj.rig))
+			}
+		case glfw.KeyB:
+			if action == glfw.Press && cmp != nil {
+				cmp.mode = (cmp.mode + 1) % compareMode(len(compareModeNames))
+				logChange("compare:", compareModeNames[cmp.mode])
+			}
+		case glfw.KeyF:
+			if action == glfw.Press {
+				if modelObj.frontFace == gl.CCW {
+					modelObj.frontFace = gl.CW
+					logChange("front face: cw")
+				} else {
+					modelObj.frontFace = gl.CCW
+					logChange("front face: ccw")
+				}
+			}
+		}
+	})
+
+	if *pollSeconds > 0 {
+		go pollURLs(time.Duration(*pollSeconds * float64(time.Second)))
+	}
+
+	go func() {
+		for err := range watcher.Errors {
+			log.Println("watcher error:", err)
+		}
+	}()
+
+	var annotate chan annotation
+	if host != nil {
+		annotate = host.annotate
+	}
+
+	// the passes a project can turn off and on again, kept once built
+	builtAA, builtLens := aa, lens
+	// liveFlags apply the flags a project can change while running, once
+	// set; the others, e.g. of the window or context, apply on restart
+	liveFlags := map[string]func() error{
+		"model": func() error {
+			path, err := resolvePath(*modelPath, "")
+			if err != nil {
+				return err
+			}
+			m, err := replaceModel(modelObj, path, prog)
+			if err != nil {
+				return err
+			}
+			modelObj = m
+			logProgramChecks(prog, modelObj)
+			if *fit {
+				for _, c := range cams {
+					fitCamera(c, modelObj)
+				}
+			}
+			return watchModel(watcher, modelObj)
+		},
+		"hide": func() error {
+			hideParts(modelObj)
+			return nil
+		},
+		"cull": func() error {
+			modelObj.cull = *cullFaces
+			return nil
+		},
+		"front-face": func() error {
+			f, err := parseFrontFace(*frontFace)
+			if err == nil {
+				modelObj.frontFace = f
+			}
+			return err
+		},
+		"draw": func() error {
+			d, err := parseDrawMode(*drawMode)
+			if err == nil {
+				modelObj.draw = d
+			}
+			return err
+		},
+		"background": func() error {
+			return setBackground(bg, *backgroundSpec)
+		},
+		"aspect": func() error {
+			_, err := parseAspect(*aspectMask)
+			if err == nil {
+				ov.aspect = *aspectMask
+			}
+			return err
+		},
+		"safe-area": func() error {
+			ov.safe = *safeArea
+			return nil
+		},
+		"panel": func() error {
+			pn.shown = *panelFlag
+			return nil
+		},
+		"stats": func() error {
+			st.shown = *statsFlag
+			return nil
+		},
+		"taa": func() error {
+			if *taaFlag && builtAA == nil {
+				resolve := *taaResolve
+				if resolve != "" {
+					var err error
+					resolve, err = resolvePath(resolve, "")
+					if err != nil {
+						return err
+					}
+				}
+				a, err := newTAA(resolve, depth)
+				if err != nil {
+					return err
+				}
+				builtAA = a
+			}
+			aa = nil
+			if *taaFlag {
+				aa = builtAA
+				discardTAA(aa)
+			}
+			return nil
+		},
+		"dof": func() error {
+			if *dofFlag && builtLens == nil {
+				d, err := newDOF(depth)
+				if err != nil {
+					return err
+				}
+				builtLens = d
+			}
+			lens = nil
+			if *dofFlag {
+				lens = builtLens
+			}
+			return nil
+		},
+		// read every frame or reload
+		"patch-vertices":      func() error { return nil },
+		"integer-scale":       func() error { return nil },
+		"reload-resets-frame": func() error { return nil },
+		"mipmaps":             func() error { return checkMipmaps(*mipmapsFlag) },
+	}
+
+	changes := watch.NewQueue()
+	// reload applies a change to a file on disk, once its events settle
+	reload := func(path string) {
+		if proj != nil && path == filepath.Clean(proj.path) {
+			p, err := loadProject(proj.path)
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			// before the textures, which follow -mipmaps
+			for _, name := range changedProjectFlags(proj, p) {
+				if given[name] {
+					continue
+				}
+				apply, ok := liveFlags[name]
+				if !ok {
+					log.Printf("project: -%v applies on restart", name)
+					continue
+				}
+				err := setProjectFlag(name, p, baseDefaults)
+				if err == nil {
+					err = apply()
+				}
+				if err != nil {
+					log.Println("project:", err)
+					continue
+				}
+				logChangef("%v: %v", name, flag.Lookup(name).Value)
+			}
+			if projectShaders {
+				err = reloadProjectShaders(proj, p, prog, watcher)
+				if err != nil {
+					log.Println("project:", err)
+				}
+			}
+			if projectDefines(p) != projectDefines(proj) {
+				prog.defines = depthDefines(depth) + projectDefines(p)
+				for _, s := range prog.shaderByStage {
+					s.update = true
+				}
+				prog.update = true
+			}
+			err = reloadProjectBuiltins(proj, p, watcher)
+			if err != nil {
+				log.Println("project:", err)
+			}
+			t, err := reloadProjectTextures(proj, p, textures, watcher)
+			if err != nil {
+				log.Println("project:", err)
+			} else {
+				textures = t
+				logTextureChecks(prog, textures)
+			}
+			if p.width > 0 && p.height > 0 && (p.width != proj.width || p.height != proj.height) {
+				window.SetSize(p.width, p.height)
+			}
+			partFaces = p.faces
+			faceParts(modelObj)
+			if p.title != proj.title {
+				title := p.title
+				if title == "" {
+					title = "Shaderdev"
+				}
+				window.SetTitle(title + softwareLabel)
+			}
+			proj = p
+
+			d := mergeDefaults(baseDefaults, proj)
+			if viewer != nil {
+				d.uniforms = userDefaults.uniforms
+			}
+			userDefaults = d
+			for _, err := range applyUniforms(prog, userDefaults.uniforms) {
+				log.Println("project:", err)
+			}
+			if host != nil {
+				publishShare(host, &shareMessage{Uniforms: userDefaults.uniforms})
+			}
+			log.Println("reloaded project", proj.path)
+			journalEvent("project", proj.path, nil)
+			return
+		}
+		if path == defaultsFile {
+			d, err := loadDefaults(path)
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			baseDefaults = d
+			d = mergeDefaults(d, proj)
+			if viewer != nil {
+				d.uniforms = userDefaults.uniforms
+			}
+			userDefaults = d
+			for _, err := range applyUniforms(prog, userDefaults.uniforms) {
+				log.Println("defaults:", err)
+			}
+			if host != nil {
+				publishShare(host, &shareMessage{Uniforms: userDefaults.uniforms})
+			}
+			log.Println("reloaded defaults, flag changes apply on restart")
+			journalEvent("defaults", path, nil)
+			return
+		}
+
+		if path == modelObj.path || usesFile(modelObj, path) {
+			m, err := replaceModel(modelObj, modelObj.path, prog)
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			journalEvent("model", path, fileHashes(path))
+			modelObj = m
+			err = watchModel(watcher, modelObj)
+			if err != nil {
+				log.Println(err)
+			}
+			logProgramChecks(prog, modelObj)
+			if *fit {
+				for _, c := range cams {
+					fitCamera(c, modelObj)
+				}
+			}
+			return
+		}
+
+		if i := findTextureInput(textures, path); i >= 0 {
+			err := reloadTextureInput(&textures[i])
+			if err != nil {
+				log.Println(err)
+			}
+			return
+		}
+
+		if builtinChanged(path) {
+			return
+		}
+
+		err := pathChanged(prog, path)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	var commands <-chan []string
+	if *stdinFlag {
+		commands = readCommands(os.Stdin)
+	}
+	// where the next frame is written, if anywhere
+	var screenshot string
+	// command runs a command read from standard input or src, see
+	// replCommands
+	command := func(src string, args []string) {
+		switch {
+		case args[0] == "set":
+			name, vals, err := setCommand(args[1:])
+			if err != nil {
+				log.Println(src+":", err)
+				return
+			}
+			if err := checkTweakRange(prog, name, vals); err != nil {
+				log.Println(src+":", err)
+			}
+			for _, err := range setTweak(prog, name, vals) {
+				log.Println(src+":", err)
+			}
+			logChangef("%v: %v", name, formatValues(vals))
+		case args[0] == "get" && len(args) == 2:
+			vals, err := uniformValues(prog, args[1])
+			if err != nil {
+				log.Println(src+":", err)
+				return
+			}
+			fmt.Println(args[1], formatValues(vals))
+		case args[0] == "uniforms" && len(args) == 1:
+			s := settableUniforms(prog)
+			if s == "" {
+				s = "none"
+			}
+			fmt.Println(s)
+		case (args[0] == "pause" || args[0] == "resume") && len(args) == 1:
+			clk.paused = args[0] == "pause"
+			logChange("paused:", clk.paused)
+		case args[0] == "seek" && len(args) == 2:
+			t, err := parseSeconds(args[1])
+			if err != nil {
+				log.Printf("%v: invalid seek %v", src, args[1])
+				return
+			}
+			clk.elapsed = 0
+			stepClock(clk, t)
+		case args[0] == "speed" && len(args) == 2:
+			d, err := parseSeconds(args[1])
+			if err != nil || d <= 0 {
+				log.Printf("%v: invalid speed %v", src, args[1])
+				return
+			}
+			clk.scale = d.Seconds()
+			logChange("time scale:", clk.scale)
+		case args[0] == "reset" && len(args) == 1:
+			resetClock(clk)
+		case args[0] == "screenshot" && len(args) <= 2:
+			screenshot = time.Now().Format("screenshot-20060102-150405.png")
+			if len(args) == 2 {
+				screenshot = args[1]
+			}
+		case args[0] == "timings" && len(args) == 1:
+			rows := passTimeRows()
+			if len(rows) == 0 {
+				rows = []string{"none"}
+			}
+			fmt.Println(strings.Join(rows, "\n"))
+		case args[0] == "objects" && len(args) == 1:
+			for _, o := range gx.Live() {
+				fmt.Printf("%-12v %5v %v\n", o.Kind, o.ID, o.Label)
+			}
+		case args[0] == "quit" && len(args) == 1:
+			window.SetShouldClose(true)
+		case args[0] == "help":
+			fmt.Println(replHelp())
+		default:
+			log.Printf("%v: invalid command %q, see help", src, strings.Join(args, " "))
+		}
+	}
+
+	var midiMessages <-chan midi.Message
+	if *midiPath != "" {
+		midiMessages, err = openMIDI(*midiPath)
+		if err != nil {
+			log.Fatal("midi: ", err)
+		}
+	}
+
+	var oscMessages <-chan osc.Message
+	if *oscAddr != "" {
+		oscMessages, err = listenOSC(*oscAddr)
+		if err != nil {
+			log.Fatal("osc: ", err)
+		}
+	}
+
+	for !window.ShouldClose() {
+		select {
+		case args, ok := <-commands:
+			if !ok {
+				commands = nil
+				continue
+			}
+			command("stdin", args)
+		case msg := <-oscMessages:
+			args, err := oscCommand(msg)
+			if err != nil {
+				log.Println("osc:", err)
+				continue
+			}
+			command("osc", args)
+		case msg, ok := <-midiMessages:
+			if !ok {
+				log.Println("midi: device closed")
+				midiMessages = nil
+				continue
+			}
+			for _, err := range applyMIDI(prog, userDefaults.midi, msg) {
+				log.Println("midi:", err)
+			}
+		case a := <-annotate:
+			addNote(a)
+			log.Printf("viewer note at %.3f, %.3f: %v", a.X, a.Y, a.Text)
+		case evt := <-watcher.Events:
+			changes.Add(evt, time.Now())
+		case <-tick:
+			read := beginFrameStats(st, time.Now())
+			if bench != nil && benchFrame(bench, st, read, time.Now()) {
+				err := writeBench(bench, *benchOut)
+				if err != nil {
+					log.Fatal(err)
+				}
+				log.Println("benchmark complete")
+				window.SetShouldClose(true)
+				continue
+			}
+			for _, path := range changes.Settled(time.Now()) {
+				reload(path)
+			}
+			autosaveTweaks(prog, false)
+			var req embedRequest
+			if emb != nil {
+				var ok bool
+				req, ok = <-emb.requests
+				if !ok {
+					window.SetShouldClose(true)
+					continue
+				}
+				if req.Uniforms != nil {
+					for _, err := range applyUniforms(prog, req.Uniforms) {
+						log.Println("embed:", err)
+					}
+				}
+				if req.Camera != nil {
+					applyShareCamera(cam, req.Camera)
+				}
+			}
+
+			fbWidth, fbHeight := window.GetFramebufferSize()
+
+			// post passes and reversed depth need the main pass offscreen, at
+			// window size unless -resolution is given; an embedded instance
+			// renders offscreen at the size the host asked for, whatever the
+			// size of the window
+			rtWidth, rtHeight := int32(fbWidth), int32(fbHeight)
+			if emb != nil {
+				rtWidth, rtHeight = req.Width, req.Height
+			}
+			if (aa != nil || lens != nil || depth == depthReversed || emb != nil) && *resolution == "" && (rt == nil || rt.width != rtWidth || rt.height != rtHeight) {
+				if rt != nil {
+					deleteTarget(rt)
+				}
+				rt, err = newTarget("render", rtWidth, rtHeight, gl.RGBA8)
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			width, height := int32(fbWidth), int32(fbHeight)
+			if rt != nil {
+				width, height = rt.width, rt.height
+			}
+
+			// rect is where the rendered image lands in the window
+			rect := [4]float32{0, 0, float32(fbWidth), float32(fbHeight)}
+			if rt != nil {
+				if *integerScale {
+					rect = integerRect(rect, width, height)
+				} else {
+					rect = aspectRect(rect, float32(width)/float32(height))
+				}
+			}
+			setCursorMapping(ms, rect, width)
+			cursorX, cursorY := framebufferCursorPos(window)
+			cursorX, cursorY = targetCursorPos(ms, cursorX, cursorY)
+			if cmp != nil {
+				dragWipe(cmp, cursorX, width)
+			}
+
+			gl.UseProgram(0)
+
+			// Clear to error color
+			gl.ClearColor(1, 0, 0, 0)
+			gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+
+			// apply everything received since the last frame, the latest
+			// state last
+			var shared *shareMessage
+			for draining := viewer != nil; draining; {
+				select {
+				case m, ok := <-viewer.msgs:
+					if !ok {
+						viewer, draining = nil, false
+						continue
+					}
+					paths, err := writeShaders(viewer, m.Shaders)
+					if err != nil {
+						log.Println("share:", err)
+					}
+					for prefix, path := range paths {
+						setStagePath(prog, shaPrefixToStage[prefix], path)
+					}
+					if m.Uniforms != nil {
+						userDefaults.uniforms = m.Uniforms
+						for _, err := range applyUniforms(prog, userDefaults.uniforms) {
+							log.Println("share:", err)
+						}
+					}
+					if m.Annotations != nil {
+						notes = m.Annotations
+					}
+					if m.Camera != nil {
+						shared = &m
+					}
+				default:
+					draining = false
+				}
+			}
+			if shared != nil && shared.Camera != nil {
+				applyShareCamera(cam, shared.Camera)
+			}
+
+			relink := prog.update
+			err := updateProgram(prog)
+			if err != nil {
+				journalEvent("error", err.Error(), sourceHashes(prog))
+				if diags != nil {
+					reportBuild(diags, err)
+				}
+				if mx != nil {
+					observeBuild(mx, err)
+				}
+				if *exportDir != "" || bench != nil {
+					log.Fatal(err)
+				}
+				log.Println(err)
+				if preview != nil {
+					publishPreviewStatus(preview, err, frame)
+				}
+				if emb != nil {
+					err := sendEmbedFrame(emb, nil, frame, err)
+					if err != nil {
+						log.Println("embed:", err)
+					}
+				}
+				window.SwapBuffers()
+				glfw.PollEvents()
+				continue
+			}
+
+			updateModel(modelObj, prog)
+			if relink {
+				journalEvent("reload", "program linked", sourceHashes(prog))
+				if diags != nil {
+					reportBuild(diags, nil)
+				}
+				if mx != nil {
+					observeBuild(mx, nil)
+				}
+				if preview != nil {
+					publishPreviewStatus(preview, nil, frame)
+				}
+				logProgramChecks(prog, modelObj)
+				logTextureChecks(prog, textures)
+				if host != nil {
+					sources, err := programSources(prog)
+					if err != nil {
+						log.Println("share:", err)
+					} else {
+						publishShare(host, &shareMessage{Shaders: sources})
+					}
+				}
+				if *reloadResetsFrame {
+					frame = 0
+				}
+				if fader != nil {
+					startReloadTransition(fader, time.Now())
+				}
+				if cmp != nil {
+					reportCompare(cmp, syncCompare(cmp, prog))
+				}
+			}
+			if cmp != nil {
+				updateCompare(cmp)
+			}
+
+			if winWidth, _ := window.GetSize(); winWidth > 0 {
+				x, y := framebufferCursorPos(window)
+				down := window.GetMouseButton(glfw.MouseButtonLeft) == glfw.Press
+				updatePanel(pn, prog, clk, x, y, down, fbHeight, int(math.Max(1, float64(fbWidth/winWidth))))
+			}
+
+			if rt != nil {
+				gl.BindFramebuffer(gl.FRAMEBUFFER, rt.fbo)
+			}
+
+			projectionMat := cameraProjection(cam, float32(width)/float32(height))
+			viewMat := cameraView(cam)
+			modelMat := mgl32.HomogRotate3DY(-angle).Mul4(mgl32.Scale3D(modelObj.scale, modelObj.scale, modelObj.scale)).Mul4(mgl32.Translate3D(-modelObj.center[0], -modelObj.center[1], -modelObj.center[2]))
+
+			// the main pass is drawn with drawProjection, which TAA jitters
+			drawProjection := projectionMat
+			var jitter mgl32.Vec2
+			if aa != nil {
+				jitter = taaJitter(frame)
+				drawProjection = jitterProjection(projectionMat, jitter, width, height)
+			}
+
+			// Use scissor test for clearing to catch errors with viewport setup, hopefully.
+			runPass("clear", func() {
+				clearBackground(bg)
+				// the scissor box is left as it was, as -check-state expects
+				var box [4]int32
+				gl.GetIntegerv(gl.SCISSOR_BOX, &box[0])
+				defer gl.Scissor(box[0], box[1], box[2], box[3])
+				gl.Enable(gl.SCISSOR_TEST)
+				gl.Scissor(0, 0, width, height)
+				gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+				gl.Disable(gl.SCISSOR_TEST)
+			})
+
+			gl.Viewport(0, 0, width, height)
+
+			runPass("background", func() {
+				viewport := [4]float32{0, 0, float32(width), float32(height)}
+				drawBackground(bg, viewport, drawProjection.Mul4(viewMat))
+			})
+
+			prog.id.Bind()
+			bindBlocks(prog)
+
+			if prog.viewportLoc >= 0 {
+				gl.Uniform4f(prog.viewportLoc, 0, 0, float32(width), float32(height))
+			}
+
+			if prog.cursorLoc >= 0 {
+				c := cursorUniform(ms, cursorX, cursorY)
+				gl.Uniform4fv(prog.cursorLoc, 1, &c[0])
+			}
+
+			if prog.buttonsLoc >= 0 {
+				gl.Uniform1i(prog.buttonsLoc, ms.buttons)
+			}
+			ms.clicked = false
+
+			if prog.scrollLoc >= 0 {
+				gl.Uniform2f(prog.scrollLoc, float32(ms.scrollX), float32(ms.scrollY))
+			}
+
+			pollGamepad(pad)
+
+			if prog.gamepadAxesLoc >= 0 {
+				gl.Uniform1fv(prog.gamepadAxesLoc, maxGamepadAxes, &pad.axes[0])
+			}
+
+			if prog.gamepadButtonsLoc >= 0 {
+				gl.Uniform1iv(prog.gamepadButtonsLoc, maxGamepadButtons, &pad.buttons[0])
+			}
+
+			t := time.Now()
+			tickClock(clk, t)
+			if shared != nil && shared.Camera != nil {
+				clk.elapsed, frame = shared.Elapsed, shared.Frame
+			}
+			if req.Elapsed != nil {
+				clk.elapsed = *req.Elapsed
+			}
+			if req.Frame != nil {
+				frame = *req.Frame
+			}
+			if audioIn != nil {
+				syncAudio(audioIn, clk, t)
+			}
+			if host != nil {
+				publishShare(host, &shareMessage{Camera: shareCameraOf(cam), Elapsed: clk.elapsed, Frame: frame})
+			}
+
+			if prog.timeLoc >= 0 {
+				// the date would make fixed-step runs differ from day to day
+				date := t
+				if clk.fixed > 0 {
+					date = time.Time{}
+				}
+				gl.Uniform4f(prog.timeLoc, float32(date.Year()), float32(date.Month()), float32(date.Day()), float32(clk.elapsed.Seconds()))
+			}
+
+			if prog.deltaTimeLoc >= 0 {
+				gl.Uniform1f(prog.deltaTimeLoc, float32(clk.delta.Seconds()))
+			}
+
+			if prog.frameLoc >= 0 {
+				gl.Uniform1i(prog.frameLoc, frame)
+			}
+
+			if prog.seedLoc >= 0 {
+				gl.Uniform1ui(prog.seedLoc, seed)
+			}
+
+			for _, in := range rngInputs {
+				updateRNGInput(in, seed, frame)
+			}
+			if audioIn != nil {
+				updateAudio(audioIn, clk.elapsed)
+			}
+			updateTextureInputs(textures, clk.elapsed)
+
+			setCameraUniforms(prog, cam, drawProjection, viewMat)
+
+			if prog.modelLoc >= 0 {
+				gl.UniformMatrix4fv(prog.modelLoc, 1, false, &modelMat[0])
+			}
+
+			setRigUniforms(prog, modelObj, clk.elapsed)
+
+			// Draw things that pivot only around Y-axis here
+
+			/*
+				if prog.modelLoc >= 0 {
+					modelMat = modelMat.Mul4(
+						mgl32.Translate3D(0.5, 0.5, 0.5),
+					).Mul4(
+						mgl32.HomogRotate3DX(angle),
+					).Mul4(
+						mgl32.Translate3D(-0.5, -0.5, -0.5),
+					)
+					gl.UniformMatrix4fv(prog.modelLoc, 1, false, &modelMat[0])
+				}
+			*/
+
+			// drawScene draws the model with a program whose uniforms are set
+			drawScene := func(p *program) {
+				bindTextureInputs(p, textures)
+				defer unbindTextureInputs(p, textures)
+				bindRNGInputs(p, rngInputs)
+				defer unbindRNGInputs(p, rngInputs)
+				bindAudio(p, audioIn)
+				defer unbindAudio(p, audioIn)
+				if p.checkSamplers {
+					for _, s := range checkSamplers(p) {
+						log.Println("sampler binding:", s)
+					}
+					p.checkSamplers = false
+				}
+				drawModel(modelObj, p, patchVertices(p, int32(*patchSize)))
+			}
+
+			runPass("model", func() {
+				if !comparing(cmp) {
+					drawScene(prog)
+					return
+				}
+
+				rects := compareRects(cmp, width, height)
+				for i, p := range []*program{prog, cmp.prog} {
+					r := rects[i]
+					x, y, w, h := int32(r[0]), int32(r[1]), int32(r[2]), int32(r[3])
+					if w <= 0 {
+						continue
+					}
+					if p != prog {
+						p.id.Bind()
+						copyUniforms(prog, p)
+						bindBlocks(p)
+						updateModel(modelObj, p)
+						defer updateModel(modelObj, prog)
+					}
+					gl.Enable(gl.SCISSOR_TEST)
+					gl.Scissor(x, y, w, h)
+					if cmp.mode == compareSplit {
+						// each half is a view of its own
+						projection := cameraProjection(cam, r[2]/r[3])
+						if aa != nil {
+							projection = jitterProjection(projection, jitter, w, h)
+						}
+						gl.Viewport(x, y, w, h)
+						drawBackground(bg, r, projection.Mul4(viewMat))
+						p.id.Bind()
+						if p.viewportLoc >= 0 {
+							gl.Uniform4f(p.viewportLoc, r[0], r[1], r[2], r[3])
+						}
+						setCameraUniforms(p, cam, projection, viewMat)
+					}
+					drawScene(p)
+					gl.Disable(gl.SCISSOR_TEST)
+				}
+				gl.Viewport(0, 0, width, height)
+				prog.id.Bind()
+				if cmp.mode == compareSplit {
+					// the passes after draw the whole view with prog
+					if prog.viewportLoc >= 0 {
+						gl.Uniform4f(prog.viewportLoc, 0, 0, float32(width), float32(height))
+					}
+					setCameraUniforms(prog, cam, drawProjection, viewMat)
+				}
+				drawCompareDivider(cmp, width, height)
+			})
+
+			if pip {
+				runPass("pip", func() {
+					c := cams[(activeCam+1)%len(cams)]
+					r := pipRect([4]float32{0, 0, float32(width), float32(height)})
+					x, y, w, h := int32(r[0]), int32(r[1]), int32(r[2]), int32(r[3])
+					projection := cameraProjection(c, r[2]/r[3])
+					view := cameraView(c)
+
+					gl.Enable(gl.SCISSOR_TEST)
+					gl.Scissor(x, y, w, h)
+					gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+					gl.Disable(gl.SCISSOR_TEST)
+					gl.Viewport(x, y, w, h)
+					defer gl.Viewport(0, 0, width, height)
+
+					drawBackground(bg, r, projection.Mul4(view))
+
+					prog.id.Bind()
+					defer gl.UseProgram(0)
+					if prog.viewportLoc >= 0 {
+						gl.Uniform4f(prog.viewportLoc, r[0], r[1], r[2], r[3])
+					}
+					setCameraUniforms(prog, c, projection, view)
+					bindTextureInputs(prog, textures)
+					defer unbindTextureInputs(prog, textures)
+					bindRNGInputs(prog, rngInputs)
+					defer unbindRNGInputs(prog, rngInputs)
+					bindAudio(prog, audioIn)
+					defer unbindAudio(prog, audioIn)
+					drawModel(modelObj, prog, patchVertices(prog, int32(*patchSize)))
+				})
+			}
+
+			runPass("overlay", func() {
+				viewport := [4]float32{0, 0, float32(width), float32(height)}
+				drawOverlay(ov, viewport)
+				drawAnnotations(an, notes, hover, width, height)
+			})
+
+			cursorUV = [2]float32{float32(cursorX) / float32(width), float32(cursorY) / float32(height)}
+			hover = hoveredAnnotation(notes, float32(cursorX), float32(cursorY), width, height)
+			caption := "Shaderdev"
+			if note != nil {
+				caption = "note: " + note.Text + "_"
+			} else if hover >= 0 {
+				caption = notes[hover].Text
+			}
+			if caption != title {
+				window.SetTitle(caption + softwareLabel)
+				title = caption
+			}
+
+			// the image after the post passes, when rendered offscreen
+			var presented *target
+			if rt != nil {
+				gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+				gl.UseProgram(0)
+
+				presented = rt
+				if aa != nil {
+					err := resizeTAA(aa, width, height)
+					if err != nil {
+						log.Fatal(err)
+					}
+					if cmp != nil && compareLayoutChanged(cmp) {
+						discardTAA(aa)
+					}
+					runPass("taa", func() {
+						presented = resolveTAA(aa, rt, cam, jitter, drawProjection.Mul4(viewMat), projectionMat.Mul4(viewMat), modelMat)
+					})
+				}
+				if lens != nil {
+					runPass("dof", func() {
+						presented, err = drawDOF(lens, presented, rt.depth, cam)
+					})
+					if err != nil {
+						log.Fatal(err)
+					}
+				}
+
+				gl.ClearColor(0, 0, 0, 1)
+				gl.Clear(gl.COLOR_BUFFER_BIT)
+				switch {
+				case crtPresenter != nil:
+					drawCRT(crtPresenter, presented, rect)
+				case *integerScale:
+					blitTarget(presented, rect, gl.NEAREST)
+				default:
+					blitTarget(presented, rect, gl.LINEAR)
+				}
+			}
+			if fader != nil {
+				err := presentReloadTransition(fader, int32(fbWidth), int32(fbHeight), time.Now())
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			if ring != nil {
+				captureFramebuffer(ring, int32(fbWidth), int32(fbHeight))
+			}
+			if screenshot != "" {
+				readFramebuffer(&shot, int32(fbWidth), int32(fbHeight))
+				err := writeFrame(shot, screenshot)
+				if err != nil {
+					log.Println("screenshot:", err)
+				} else {
+					fmt.Println("wrote", screenshot)
+					journalEvent("capture", screenshot, nil)
+				}
+				screenshot = ""
+			}
+			if preview != nil && previewDue(preview, time.Now()) {
+				readFramebuffer(&shot, int32(fbWidth), int32(fbHeight))
+				publishPreviewFrame(preview, &shot, time.Now())
+			}
+			// the panel is left out of captures and exports
+			gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+			gl.Viewport(0, 0, int32(fbWidth), int32(fbHeight))
+			drawPanel(pn)
+			drawStats(st, fbWidth, fbHeight)
+			endFrameStats(st, time.Now())
+			if mx != nil {
+				observeFrame(mx, st)
+			}
+			if *exportDir != "" {
+				readFramebuffer(&shot, int32(fbWidth), int32(fbHeight))
+				err := writeFrame(shot, filepath.Join(*exportDir, fmt.Sprintf("frame%05d.png", frame)))
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			if emb != nil {
+				readTarget(&shot, presented)
+				err := sendEmbedFrame(emb, &shot, frame, nil)
+				if err != nil {
+					log.Println("embed:", err)
+				}
+			}
+			window.SwapBuffers()
+
+			glfw.PollEvents()
+			angle += 0.01
+			frame++
+
+			if *exportDir != "" {
+				err := writeCheckpoint(*exportDir, &checkpoint{Frame: frame, Elapsed: clk.elapsed, Seed: seed, Angle: angle, Settings: exportHash}, aa)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if int(frame) >= *exportFrames {
+					log.Println("export complete")
+					window.SetShouldClose(true)
+				}
+			}
 		}
 	}
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/alotabits/shaderdev/internal/mtl"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// material is an OBJ material with its maps loaded, keyed by the name of
+// the sampler they are bound to: diffuseMap, specularMap, emissiveMap,
+// alphaMap or normalMap.
+type material struct {
+	mtl.Material
+	maps map[string]gx.Texture
+}
+
+var materialSamplers = map[string]bool{
+	"diffuseMap":  true,
+	"specularMap": true,
+	"emissiveMap": true,
+	"alphaMap":    true,
+	"normalMap":   true,
+}
+
+// materialLocs are the optional uniforms fed from the material of each part.
+type materialLocs struct {
+	diffuseColor  int32
+	specularColor int32
+	emissiveColor int32
+	shininess     int32
+	opacity       int32
+}
+
+func getMaterialLocs(p *program) materialLocs {
+	var l materialLocs
+	l.diffuseColor = activeLocation(p, "diffuseColor")
+	l.specularColor = activeLocation(p, "specularColor")
+	l.emissiveColor = activeLocation(p, "emissiveColor")
+	l.shininess = activeLocation(p, "shininess")
+	l.opacity = activeLocation(p, "opacity")
+	return l
+}
+
+// loadMaterials reads material libraries, resolved from dir, loading the
+// maps of their materials. Maps that fail to load are reported and left
+// out. It also returns the files read, for watching.
+func loadMaterials(libs []string, dir string) (map[string]*material, []string, error) {
+	mats := make(map[string]*material)
+	var files []string
+	for _, lib := range libs {
+		path, err := resolvePath(lib, dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		decoded, err := mtl.Decode(f)
+		f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%v: %v", path, err)
+		}
+		files = append(files, path)
+
+		for _, m := range decoded {
+			mat := &material{Material: m, maps: make(map[string]gx.Texture)}
+			maps := map[string]string{
+				"diffuseMap":  m.DiffuseMap,
+				"specularMap": m.SpecularMap,
+				"emissiveMap": m.EmissiveMap,
+				"alphaMap":    m.AlphaMap,
+				"normalMap":   m.NormalMap,
+			}
+			for sampler, name := range maps {
+				if name == "" {
+					continue
+				}
+				p, err := resolvePath(name, filepath.Dir(path))
+				if err != nil {
+					log.Printf("%v: material %v: %v", path, m.Name, err)
+					continue
+				}
+				tex, err := loadTexture(p, *mipmapsFlag)
+				if err != nil {
+					log.Printf("%v: material %v: %v", path, m.Name, err)
+					continue
+				}
+				mat.maps[sampler] = tex
+				files = append(files, p)
+			}
+			mats[m.Name] = mat
+		}
+	}
+	return mats, files, nil
+}
+
+func deleteMaterial(m *material) {
+	for _, tex := range m.maps {
+		tex.Delete()
+	}
+}
+
+// bindMaterial sets the material uniforms of the current program and binds
+// the maps to the units of the samplers named after them, unbinding those
+// the material has no map for.
+func bindMaterial(p *program, m *material) {
+	l := p.materialLocs
+	gl.Uniform3fv(l.diffuseColor, 1, &m.Diffuse[0])
+	gl.Uniform3fv(l.specularColor, 1, &m.Specular[0])
+	gl.Uniform3fv(l.emissiveColor, 1, &m.Emissive[0])
+	gl.Uniform1f(l.shininess, m.Shininess)
+	gl.Uniform1f(l.opacity, m.Opacity)
+
+	for _, s := range p.samplers {
+		if materialSamplers[s.name] {
+			gx.ActiveTexture(s.unit)
+			m.maps[s.name].Bind(gl.TEXTURE_2D)
+		}
+	}
+	gx.ActiveTexture(0)
+}
+
+func unbindMaterial(p *program) {
+	for _, s := range p.samplers {
+		if materialSamplers[s.name] {
+			gx.ActiveTexture(s.unit)
+			gl.BindTexture(gl.TEXTURE_2D, 0)
+		}
+	}
+	gx.ActiveTexture(0)
+}
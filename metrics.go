@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var metricsAddr = flag.String("metrics", "", "serve Prometheus metrics on this HTTP address at /metrics, e.g. :9100: frame, CPU and GPU times, the GPU time of each pass, and counts of frames, builds and build errors, to monitor installations that run for days")
+
+// frameBuckets are the upper bounds of the frame time histogram, in
+// seconds, around common refresh rates.
+var frameBuckets = []float64{1.0 / 240, 1.0 / 144, 1.0 / 120, 1.0 / 60, 1.0 / 30, 1.0 / 15, 0.25, 1}
+
+// metricsServer holds the latest measurements of the main loop for
+// scrapes, which come from other goroutines.
+type metricsServer struct {
+	mu    sync.Mutex
+	start time.Time
+
+	frames uint64
+	// the frame time histogram, a count per bucket and the +Inf bucket, not
+	// cumulative
+	buckets  []uint64
+	frameSum float64
+
+	// recent means in seconds, gpu negative if not known
+	cpu, gpu float64
+	passes   map[string]float64
+
+	builds      uint64
+	buildErrors uint64
+}
+
+func serveMetrics(addr string) (*metricsServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("metrics on http://%v/metrics", ln.Addr())
+
+	m := &metricsServer{start: time.Now(), buckets: make([]uint64, len(frameBuckets)+1), gpu: -1}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(formatMetrics(m))
+	})
+	go func() {
+		log.Println("metrics:", http.Serve(ln, mux))
+	}()
+	return m, nil
+}
+
+// observeFrame records the frame just ended and the latest times of st.
+func observeFrame(m *metricsServer, st *frameStats) {
+	i := (st.head - 1 + statsSamples) % statsSamples
+	interval := float64(st.interval[i]) / 1000
+	_, cpu, gpu := recentStats(st, 30)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.frames++
+	if interval > 0 {
+		b := sort.SearchFloat64s(frameBuckets, interval)
+		m.buckets[b]++
+		m.frameSum += interval
+	}
+	m.cpu = cpu / 1000
+	m.gpu = gpu
+	if gpu >= 0 {
+		m.gpu = gpu / 1000
+	}
+	m.passes = make(map[string]float64)
+	for name, t := range passTimers {
+		if t.ran {
+			m.passes[name] = t.ms / 1000
+		}
+	}
+}
+
+// observeBuild counts a build of the program that returned err.
+func observeBuild(m *metricsServer, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.builds++
+	if err != nil {
+		m.buildErrors++
+	}
+}
+
+// formatMetrics writes the metrics in the Prometheus text format.
+func formatMetrics(m *metricsServer) []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b bytes.Buffer
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, kind)
+	}
+
+	metric("shaderdev_uptime_seconds", "gauge", "Seconds since shaderdev started.")
+	fmt.Fprintf(&b, "shaderdev_uptime_seconds %g\n", time.Since(m.start).Seconds())
+
+	metric("shaderdev_frames_total", "counter", "Frames rendered.")
+	fmt.Fprintf(&b, "shaderdev_frames_total %v\n", m.frames)
+
+	metric("shaderdev_frame_seconds", "histogram", "Time between the starts of consecutive frames.")
+	var n uint64
+	for i, le := range frameBuckets {
+		n += m.buckets[i]
+		fmt.Fprintf(&b, "shaderdev_frame_seconds_bucket{le=\"%g\"} %v\n", le, n)
+	}
+	n += m.buckets[len(frameBuckets)]
+	fmt.Fprintf(&b, "shaderdev_frame_seconds_bucket{le=\"+Inf\"} %v\n", n)
+	fmt.Fprintf(&b, "shaderdev_frame_seconds_sum %g\n", m.frameSum)
+	fmt.Fprintf(&b, "shaderdev_frame_seconds_count %v\n", n)
+
+	metric("shaderdev_frame_cpu_seconds", "gauge", "CPU time of a frame, averaged over the last 30.")
+	fmt.Fprintf(&b, "shaderdev_frame_cpu_seconds %g\n", m.cpu)
+	if m.gpu >= 0 {
+		metric("shaderdev_frame_gpu_seconds", "gauge", "GPU time of a frame, averaged over the last 30.")
+		fmt.Fprintf(&b, "shaderdev_frame_gpu_seconds %g\n", m.gpu)
+	}
+
+	if len(m.passes) > 0 {
+		metric("shaderdev_pass_gpu_seconds", "gauge", "GPU time of a pass, smoothed over frames, including the passes it runs.")
+		names := make([]string, 0, len(m.passes))
+		for name := range m.passes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, "shaderdev_pass_gpu_seconds{pass=%q} %g\n", name, m.passes[name])
+		}
+	}
+
+	metric("shaderdev_builds_total", "counter", "Builds of the program, at start and on every change to its sources.")
+	fmt.Fprintf(&b, "shaderdev_builds_total %v\n", m.builds)
+	metric("shaderdev_build_errors_total", "counter", "Builds of the program that failed to read, compile or link.")
+	fmt.Fprintf(&b, "shaderdev_build_errors_total %v\n", m.buildErrors)
+
+	return b.Bytes()
+}
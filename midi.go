@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/alotabits/shaderdev/internal/midi"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+var midiPath = flag.String("midi", "", "raw MIDI device whose control changes and notes drive the uniforms the [midi] table of the defaults or project maps them to, e.g. /dev/snd/midiC1D0")
+
+// midiMapping is a control of a MIDI controller driving a scalar uniform
+// across a range, given as
+//
+//	[midi]
+//	cc74 = "cutoff 0..5"
+//	"2:note60" = "flash"
+//
+// A range may run backwards, e.g. 1..0. Without one the range of the
+// uniform's tweak is used, or 0..1. Integer and boolean uniforms are
+// rounded.
+type midiMapping struct {
+	control  midi.Control
+	uniform  string
+	min, max float64
+	ranged   bool
+}
+
+// parseMIDIMapping reads an entry of a [midi] table.
+func parseMIDIMapping(control string, v interface{}) (midiMapping, error) {
+	c, err := midi.ParseControl(control)
+	if err != nil {
+		return midiMapping{}, err
+	}
+	s, _ := v.(string)
+	f := strings.Fields(s)
+	if len(f) < 1 || len(f) > 2 {
+		return midiMapping{}, fmt.Errorf("%v: expected \"UNIFORM [MIN..MAX]\", have %v", control, v)
+	}
+	m := midiMapping{control: c, uniform: f[0]}
+	if semanticUniforms[m.uniform] {
+		return midiMapping{}, fmt.Errorf("%v: %v is set by the tool", control, m.uniform)
+	}
+	if len(f) == 2 {
+		i := strings.Index(f[1], "..")
+		if i < 0 {
+			return midiMapping{}, fmt.Errorf("%v: invalid range %v, expected MIN..MAX", control, f[1])
+		}
+		min, err1 := strconv.ParseFloat(f[1][:i], 64)
+		max, err2 := strconv.ParseFloat(f[1][i+2:], 64)
+		if err1 != nil || err2 != nil {
+			return midiMapping{}, fmt.Errorf("%v: invalid range %v, expected MIN..MAX", control, f[1])
+		}
+		m.min, m.max, m.ranged = min, max, true
+	}
+	return m, nil
+}
+
+// openMIDI starts reading messages from a device, closing the channel
+// when it ends.
+func openMIDI(path string) (<-chan midi.Message, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan midi.Message, 64)
+	go func() {
+		defer close(c)
+		defer f.Close()
+		r := midi.NewReader(f)
+		for {
+			m, err := r.Read()
+			if err != nil {
+				if err != io.EOF {
+					log.Println("midi:", err)
+				}
+				return
+			}
+			c <- m
+		}
+	}()
+	return c, nil
+}
+
+// applyMIDI sets the uniforms the controls a message comes from are
+// mapped to.
+func applyMIDI(p *program, mappings map[string]midiMapping, msg midi.Message) []error {
+	values := make(map[string][]float64)
+	var errs []error
+	for _, m := range mappings {
+		x, ok := m.control.Matches(msg)
+		if !ok {
+			continue
+		}
+		min, max := 0.0, 1.0
+		if tw, ok := p.tweaks[m.uniform]; ok && tw.Min < tw.Max {
+			min, max = tw.Min, tw.Max
+		}
+		if m.ranged {
+			min, max = m.min, m.max
+		}
+		v := min + x*(max-min)
+
+		if u, ok := p.active[m.uniform]; ok {
+			base, n := gx.TypeComponents(u.Type)
+			if n != 1 || u.Size != 1 {
+				errs = append(errs, fmt.Errorf("%v is %v, only scalar uniforms can be mapped", m.uniform, gx.TypeStr(u.Type)))
+				continue
+			}
+			if base != gl.FLOAT && base != gl.DOUBLE {
+				v = math.Round(v)
+			}
+		}
+		values[m.uniform] = []float64{v}
+	}
+	return append(errs, applyUniforms(p, values)...)
+}
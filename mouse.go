@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+
+	"github.com/go-gl/glfw/v3.1/glfw"
+)
+
+// mouse tracks button state between frames for the cursor and buttons uniforms.
+type mouse struct {
+	// bit n is set while button n is held
+	buttons int32
+
+	// framebuffer position of the last left button press
+	clickX, clickY float64
+
+	// set when the left button was pressed since the last frame
+	clicked bool
+
+	// accumulated scroll wheel offsets
+	scrollX, scrollY float64
+
+	// maps framebuffer positions to render target positions, for rendering
+	// at a resolution other than the window's:
+	// target = (framebuffer - origin) * scale
+	originX, originY float64
+	scale            float64
+}
+
+// setCursorMapping maps the cursor so that rect of the framebuffer covers a
+// render target width pixels wide.
+func setCursorMapping(ms *mouse, rect [4]float32, width int32) {
+	ms.originX, ms.originY = float64(rect[0]), float64(rect[1])
+	ms.scale = float64(width) / float64(rect[2])
+}
+
+// targetCursorPos returns the render target pixel under a framebuffer position.
+func targetCursorPos(ms *mouse, x, y float64) (float64, float64) {
+	return math.Floor((x - ms.originX) * ms.scale), math.Floor((y - ms.originY) * ms.scale)
+}
+
+// framebufferCursorPos returns the cursor position in framebuffer pixels with
+// a lower-left origin.
+func framebufferCursorPos(w *glfw.Window) (float64, float64) {
+	// Use ratio of window cursor pos to screen dimensions to calc framebuffer cursor pos.
+	// Also, convert y coord to lower-left origin
+	winWidth, winHeight := w.GetSize()
+	fbWidth, fbHeight := w.GetFramebufferSize()
+	winX, winY := w.GetCursorPos()
+	fbX := math.Floor((winX / float64(winWidth)) * float64(fbWidth))
+	fbY := math.Floor((float64(winHeight) - winY) / float64(winHeight) * float64(fbHeight))
+	return fbX, fbY
+}
+
+func mouseButtonCallback(ms *mouse) glfw.MouseButtonCallback {
+	return func(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+		bit := int32(1) << uint(button)
+		if action == glfw.Release {
+			ms.buttons &^= bit
+			return
+		}
+
+		ms.buttons |= bit
+		if button == glfw.MouseButtonLeft && action == glfw.Press {
+			x, y := framebufferCursorPos(w)
+			ms.clickX, ms.clickY = targetCursorPos(ms, x, y)
+			ms.clicked = true
+		}
+	}
+}
+
+// cursorUniform returns the cursor uniform following Shadertoy's iMouse
+// convention: xy is the current position and zw the position of the last
+// left click, with z negative once the left button is released and w negative
+// after the frame the click happened in.
+func cursorUniform(ms *mouse, x, y float64) [4]float32 {
+	cx, cy := ms.clickX, ms.clickY
+	if ms.buttons&(1<<uint(glfw.MouseButtonLeft)) == 0 {
+		cx = -cx
+	}
+	if !ms.clicked {
+		cy = -cy
+	}
+	return [4]float32{float32(x), float32(y), float32(cx), float32(cy)}
+}
+
+func scrollCallback(ms *mouse) glfw.ScrollCallback {
+	return func(w *glfw.Window, xoff, yoff float64) {
+		ms.scrollX += xoff
+		ms.scrollY += yoff
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/osc"
+)
+
+var oscAddr = flag.String("osc", "", "listen for Open Sound Control messages on this UDP address, e.g. :9000: /uniform/NAME V... sets a uniform and /transport/pause, resume, seek SECONDS, speed FACTOR and reset drive the clock, as the commands of standard input do")
+
+// listenOSC starts receiving messages on a UDP address.
+func listenOSC(addr string) (<-chan osc.Message, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan osc.Message, 64)
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				log.Println("osc:", err)
+				return
+			}
+			ms, err := osc.Parse(buf[:n])
+			if err != nil {
+				log.Printf("osc: from %v: %v", from, err)
+				continue
+			}
+			for _, m := range ms {
+				c <- m
+			}
+		}
+	}()
+	return c, nil
+}
+
+// transportCommands are the commands of standard input /transport/ gives.
+var transportCommands = map[string]bool{
+	"pause":  true,
+	"resume": true,
+	"seek":   true,
+	"speed":  true,
+	"reset":  true,
+}
+
+// oscCommand translates a message into a command of standard input, see
+// replCommands. A pause given an argument pauses if it is true or non-zero
+// and resumes otherwise, as toggle buttons send.
+func oscCommand(m osc.Message) ([]string, error) {
+	args := make([]string, len(m.Args))
+	for i, a := range m.Args {
+		switch a := a.(type) {
+		case int32, int64, float32, float64, bool, string:
+			args[i] = fmt.Sprint(a)
+		default:
+			return nil, fmt.Errorf("%v: unsupported argument %v", m.Address, a)
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(m.Address, "/uniform/"):
+		return append([]string{"set", strings.TrimPrefix(m.Address, "/uniform/")}, args...), nil
+	case m.Address == "/transport/pause" && len(args) == 1:
+		if args[0] == "0" || args[0] == "false" {
+			return []string{"resume"}, nil
+		}
+		return []string{"pause"}, nil
+	case transportCommands[strings.TrimPrefix(m.Address, "/transport/")]:
+		return append([]string{strings.TrimPrefix(m.Address, "/transport/")}, args...), nil
+	}
+	return nil, fmt.Errorf("unknown address %v", m.Address)
+}
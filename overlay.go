@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+const overlayFrag = `#version 330 core
+uniform vec4 frame;
+uniform int safe;
+
+in vec2 uv;
+out vec4 color;
+
+// onBorder is true for pixels just inside the edge of the rectangle lo, hi.
+bool onBorder(vec2 p, vec2 lo, vec2 hi) {
+	if (any(lessThan(p, lo)) || any(greaterThanEqual(p, hi))) {
+		return false;
+	}
+	vec2 d = min(p - lo, hi - p);
+	return min(d.x, d.y) < 1;
+}
+
+void main() {
+	vec2 p = gl_FragCoord.xy;
+	vec2 lo = frame.xy;
+	vec2 hi = frame.xy + frame.zw;
+	if (any(lessThan(p, lo)) || any(greaterThanEqual(p, hi))) {
+		color = vec4(0, 0, 0, 0.6);
+		return;
+	}
+
+	if (safe != 0) {
+		// action safe and title safe margins
+		if (onBorder(p, lo + frame.zw*0.05, hi - frame.zw*0.05)) {
+			color = vec4(1, 1, 0, 0.5);
+			return;
+		}
+		if (onBorder(p, lo + frame.zw*0.1, hi - frame.zw*0.1)) {
+			color = vec4(0, 1, 1, 0.5);
+			return;
+		}
+	}
+
+	discard;
+}
+`
+
+// overlayAspects are the aspect ratios cycled through by the overlay hotkey,
+// where 0 shows no aspect mask.
+var overlayAspects = []string{"", "16:9", "9:16", "1:1", "4:3", "2.39:1"}
+
+// overlay masks the parts of the viewport outside a target aspect ratio and
+// outlines the action and title safe areas, drawn on top of everything else.
+type overlay struct {
+	aspect string
+	safe   bool
+
+	prog     gx.Program
+	frameLoc int32
+	safeLoc  int32
+}
+
+func newOverlay(aspect string, safe bool) (*overlay, error) {
+	_, err := parseAspect(aspect)
+	if err != nil {
+		return nil, err
+	}
+
+	var o overlay
+	o.aspect = aspect
+	o.safe = safe
+	err = buildBuiltin(&builtinSlot{name: "overlay", src: overlayFrag, prog: &o.prog, locate: func() {
+		o.frameLoc = gl.GetUniformLocation(uint32(o.prog), gl.Str("frame\x00"))
+		o.safeLoc = gl.GetUniformLocation(uint32(o.prog), gl.Str("safe\x00"))
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// parseAspect parses ratios like "16:9" or "2.39:1", returning 0 for "".
+func parseAspect(s string) (float32, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid aspect ratio %v, expected w:h", s)
+	}
+	w, err := strconv.ParseFloat(parts[0], 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid aspect ratio %v: %v", s, err)
+	}
+	h, err := strconv.ParseFloat(parts[1], 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid aspect ratio %v: %v", s, err)
+	}
+	if w <= 0 || h <= 0 {
+		return 0, fmt.Errorf("invalid aspect ratio %v", s)
+	}
+
+	return float32(w / h), nil
+}
+
+// aspectRect returns the largest rectangle of the given aspect ratio
+// centered in the viewport, or the viewport itself for aspect 0.
+func aspectRect(viewport [4]float32, aspect float32) [4]float32 {
+	x, y, w, h := viewport[0], viewport[1], viewport[2], viewport[3]
+	if aspect <= 0 || h == 0 {
+		return viewport
+	}
+
+	if w/h > aspect {
+		rw := h * aspect
+		return [4]float32{x + (w-rw)/2, y, rw, h}
+	}
+	rh := w / aspect
+	return [4]float32{x, y + (h-rh)/2, w, rh}
+}
+
+func cycleOverlayAspect(o *overlay) {
+	i := 0
+	for j, a := range overlayAspects {
+		if a == o.aspect {
+			i = j
+			break
+		}
+	}
+	o.aspect = overlayAspects[(i+1)%len(overlayAspects)]
+}
+
+func drawOverlay(o *overlay, viewport [4]float32) {
+	if o.aspect == "" && !o.safe {
+		return
+	}
+
+	aspect, _ := parseAspect(o.aspect)
+	frame := aspectRect(viewport, aspect)
+
+	gl.Enable(gl.BLEND)
+	defer gl.Disable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	defer gl.BlendFunc(gl.ONE, gl.ZERO)
+
+	var prev int32
+	gl.GetIntegerv(gl.CURRENT_PROGRAM, &prev)
+	defer gl.UseProgram(uint32(prev))
+
+	o.prog.Bind()
+	gl.Uniform4fv(o.frameLoc, 1, &frame[0])
+	safe := int32(0)
+	if o.safe {
+		safe = 1
+	}
+	gl.Uniform1i(o.safeLoc, safe)
+
+	drawFullscreen()
+}
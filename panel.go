@@ -0,0 +1,478 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+var panelFlag = flag.Bool("panel", false, "show the tweak panel from the start; Tab toggles it")
+
+// The panel lists the time transport, a switch for each pass, and a control
+// for each uniform that can be set, as a grid of text cells in the top left
+// corner of the window. Sliders are bars behind their values; pragma
+// declared tweaks choose their control and range, see glsl.Tweak, and
+// unranged values are dragged instead. Values set here are kept across
+// reloads like any other.
+const panelFrag = `#version 330 core
+uniform sampler2D font;
+// per cell: the character, the fill of a bar out of 255, and flags,
+// 1 for hovered and 2 for a swatch of the color indexed by the character
+uniform usampler2D cells;
+// the top left corner of the panel in framebuffer pixels, and the pixels of
+// a font pixel
+uniform vec2 origin;
+uniform int scale;
+uniform vec4 swatches[16];
+
+in vec2 uv;
+out vec4 color;
+
+const ivec2 glyph = ivec2(5, 7);
+const ivec2 cell = ivec2(6, 9);
+
+void main() {
+	ivec2 p = ivec2(gl_FragCoord.x - origin.x, origin.y - gl_FragCoord.y) / scale;
+	ivec2 c = p / cell;
+	if (p.x < 0 || p.y < 0 || any(greaterThanEqual(c, textureSize(cells, 0)))) {
+		discard;
+	}
+	uvec4 v = texelFetch(cells, c, 0);
+	ivec2 q = p - c*cell;
+
+	if ((v.b & 2u) != 0u) {
+		color = vec4(swatches[int(v.r)].rgb, 1);
+		return;
+	}
+	color = vec4(0.08, 0.08, 0.1, 0.85);
+	if (q.x * 255 < int(v.g) * cell.x) {
+		color = vec4(0.2, 0.35, 0.6, 0.95);
+	}
+	if ((v.b & 1u) != 0u) {
+		color.rgb += 0.15;
+	}
+	ivec2 g = q - ivec2(0, 1);
+	if (v.r >= 32u && v.r <= 126u && all(greaterThanEqual(g, ivec2(0))) && all(lessThan(g, glyph))) {
+		if (texelFetch(font, ivec2(int(v.r - 32u)*glyph.x + g.x, g.y), 0).r > 0.5) {
+			color = vec4(0.95, 0.95, 0.95, 1);
+		}
+	}
+}
+`
+
+const (
+	// font pixels of a cell, the glyph and the space around it
+	panelCellWidth  = 6
+	panelCellHeight = 9
+	panelCols       = 48
+	// the column the controls of uniforms start at, after their names
+	panelControlCol = 15
+	maxSwatches     = 16
+)
+
+type panelWidgetKind int
+
+const (
+	// sets a component between min and max by where it is clicked
+	panelSlider panelWidgetKind = iota
+	// moves a component by how far it is dragged
+	panelDrag
+	// flips a boolean component
+	panelToggle
+	// runs an action
+	panelButton
+)
+
+// panelWidget is a clickable span of n cells of a row.
+type panelWidget struct {
+	kind        panelWidgetKind
+	row, col, n int
+	uniform     string
+	comp        int
+	min, max    float64
+	integer     bool
+	action      func()
+}
+
+type panel struct {
+	shown bool
+
+	prog        gx.Program
+	fontLoc     int32
+	cellsLoc    int32
+	originLoc   int32
+	scaleLoc    int32
+	swatchesLoc int32
+	font        gx.Texture
+	cells       gx.Texture
+
+	// the cells laid out last, four bytes each, and what they show
+	rows     int
+	grid     []byte
+	swatches []float32
+	widgets  []panelWidget
+
+	// framebuffer pixels of a font pixel, and the framebuffer height
+	scale  int
+	height int
+
+	// the widget under the cursor, or -1
+	hover int
+	// the widget being dragged, where the drag began and its value then
+	drag       *panelWidget
+	pressX     float64
+	pressValue float64
+	// whether the left button was held last frame
+	down bool
+
+	// reset is run by the reset button
+	reset func()
+}
+
+func newPanel(shown bool, reset func()) (*panel, error) {
+	pn := &panel{shown: shown, reset: reset, hover: -1, scale: 2}
+	err := buildBuiltin(&builtinSlot{name: "panel", src: panelFrag, prog: &pn.prog, locate: func() {
+		pn.fontLoc = gl.GetUniformLocation(uint32(pn.prog), gl.Str("font\x00"))
+		pn.cellsLoc = gl.GetUniformLocation(uint32(pn.prog), gl.Str("cells\x00"))
+		pn.originLoc = gl.GetUniformLocation(uint32(pn.prog), gl.Str("origin\x00"))
+		pn.scaleLoc = gl.GetUniformLocation(uint32(pn.prog), gl.Str("scale\x00"))
+		pn.swatchesLoc = gl.GetUniformLocation(uint32(pn.prog), gl.Str("swatches\x00"))
+	}})
+	if err != nil {
+		return nil, err
+	}
+	pn.font = newFontTexture()
+
+	pn.cells = gx.NewTexture(gl.TEXTURE_2D)
+	pn.cells.Label("panel cells")
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return pn, nil
+}
+
+// panelContains reports whether the panel is shown under a framebuffer
+// position with a lower-left origin.
+func panelContains(pn *panel, x, y float64) bool {
+	_, _, ok := panelCell(pn, x, y)
+	return pn.shown && ok
+}
+
+// panelCell returns the cell under a framebuffer position.
+func panelCell(pn *panel, x, y float64) (int, int, bool) {
+	px, py := x/float64(pn.scale), (float64(pn.height)-y)/float64(pn.scale)
+	col, row := int(px)/panelCellWidth, int(py)/panelCellHeight
+	ok := px >= 0 && py >= 0 && col < panelCols && row < pn.rows
+	return col, row, ok
+}
+
+// newPanelRow adds an empty row to the layout and returns its index.
+func newPanelRow(pn *panel) int {
+	pn.grid = append(pn.grid, make([]byte, 4*panelCols)...)
+	pn.rows++
+	return pn.rows - 1
+}
+
+// panelText writes s into a row from col on, cut at the edge.
+func panelText(pn *panel, row, col int, s string) {
+	for _, r := range s {
+		if col >= panelCols {
+			return
+		}
+		if r < firstGlyph || r > lastGlyph {
+			r = '?'
+		}
+		pn.grid[4*(row*panelCols+col)] = byte(r)
+		col++
+	}
+}
+
+// panelBar fills the first frac of n cells of a row.
+func panelBar(pn *panel, row, col, n int, frac float64) {
+	frac = math.Max(0, math.Min(1, frac)) * float64(n)
+	for i := 0; i < n; i++ {
+		f := math.Max(0, math.Min(1, frac-float64(i)))
+		pn.grid[4*(row*panelCols+col+i)+1] = byte(f * 255)
+	}
+}
+
+// panelButtonAt adds a button labeled s and returns the column after it.
+func panelButtonAt(pn *panel, row, col int, s string, action func()) int {
+	panelText(pn, row, col, s)
+	pn.widgets = append(pn.widgets, panelWidget{kind: panelButton, row: row, col: col, n: len(s), action: action})
+	return col + len(s) + 1
+}
+
+// formatPanelValue prints a value to fit n cells.
+func formatPanelValue(v float64, integer bool, n int) string {
+	if integer {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	for prec := 4; prec > 0; prec-- {
+		s := strconv.FormatFloat(v, 'g', prec, 64)
+		if len(s) <= n {
+			return s
+		}
+	}
+	return strconv.FormatFloat(v, 'g', 1, 64)
+}
+
+// layoutPanel lays out the transport, pass switches and uniform controls.
+func layoutPanel(pn *panel, p *program, clk *clock) {
+	pn.rows, pn.grid, pn.swatches, pn.widgets = 0, pn.grid[:0], pn.swatches[:0], pn.widgets[:0]
+
+	row := newPanelRow(pn)
+	panelText(pn, row, 1, "shaderdev")
+	panelText(pn, row, panelCols-10, "Tab hides")
+
+	row = newPanelRow(pn)
+	panelText(pn, row, 1, fmt.Sprintf("time %.2fs x%g", clk.elapsed.Seconds(), clk.scale))
+	label := "[pause]"
+	if clk.paused {
+		label = "[play]"
+	}
+	col := panelCols - 22
+	col = panelButtonAt(pn, row, col, label, func() {
+		togglePause(clk)
+		logChange("paused:", clk.paused)
+	})
+	col = panelButtonAt(pn, row, col, "[reset]", pn.reset)
+	col = panelButtonAt(pn, row, col, "[-]", func() {
+		scaleClock(clk, 0.5)
+		logChange("time scale:", clk.scale)
+	})
+	panelButtonAt(pn, row, col, "[+]", func() {
+		scaleClock(clk, 2)
+		logChange("time scale:", clk.scale)
+	})
+
+	row = newPanelRow(pn)
+	panelText(pn, row, 1, "passes")
+	col = 8
+	for _, name := range passNames {
+		if name == "clear" {
+			continue
+		}
+		label := "[x]" + name
+		if disabledPasses[name] {
+			label = "[ ]" + name
+		}
+		if col+len(label) > panelCols {
+			row, col = newPanelRow(pn), 8
+		}
+		name := name
+		col = panelButtonAt(pn, row, col, label, func() {
+			disabledPasses[name] = !disabledPasses[name]
+			logChangef("%v pass: %v", name, !disabledPasses[name])
+		})
+	}
+
+	names := make([]string, 0, len(p.active))
+	for name := range p.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	first := true
+	for _, name := range names {
+		v := p.active[name]
+		base, n := gx.TypeComponents(v.Type)
+		if !isSettable(p, name, v) || v.Size > 1 || n == 0 || n > 4 || base == gl.DOUBLE {
+			continue
+		}
+		vals, err := uniformValues(p, name)
+		if err != nil {
+			continue
+		}
+		if first {
+			newPanelRow(pn)
+			first = false
+		}
+		row := newPanelRow(pn)
+		panelText(pn, row, 1, name)
+		layoutControls(pn, row, p, name, base, vals)
+	}
+}
+
+// layoutControls adds the controls of the components of a uniform to a row.
+func layoutControls(pn *panel, row int, p *program, name string, base uint32, vals []float64) {
+	widget := ""
+	min, max := 0.0, 0.0
+	if tw, ok := p.tweaks[name]; ok {
+		widget, min, max = tw.Widget, tw.Min, tw.Max
+	}
+	integer := base == gl.INT || base == gl.UNSIGNED_INT
+
+	if base == gl.BOOL || widget == "toggle" {
+		col := panelControlCol
+		for i, x := range vals {
+			label := "[ ]"
+			if x != 0 {
+				label = "[x]"
+			}
+			panelText(pn, row, col, label)
+			pn.widgets = append(pn.widgets, panelWidget{kind: panelToggle, row: row, col: col, n: 3, uniform: name, comp: i})
+			col += 4
+		}
+		return
+	}
+
+	kind := panelDrag
+	if min < max && widget != "drag" || widget == "slider" || widget == "color" {
+		kind = panelSlider
+		if min >= max {
+			min, max = 0, 1
+		}
+	}
+
+	width := panelCols - panelControlCol - 1
+	swatch := widget == "color" && len(vals) >= 3 && len(pn.swatches) < 4*maxSwatches
+	if swatch {
+		width -= 3
+	}
+	n := (width - (len(vals) - 1)) / len(vals)
+	col := panelControlCol
+	for i, x := range vals {
+		if kind == panelSlider {
+			panelBar(pn, row, col, n, (x-min)/(max-min))
+		}
+		s := formatPanelValue(x, integer, n)
+		panelText(pn, row, col+(n-len(s))/2, s)
+		pn.widgets = append(pn.widgets, panelWidget{kind: kind, row: row, col: col, n: n, uniform: name, comp: i, min: min, max: max, integer: integer})
+		col += n + 1
+	}
+	if swatch {
+		i := len(pn.swatches) / 4
+		pn.swatches = append(pn.swatches, float32(vals[0]), float32(vals[1]), float32(vals[2]), 1)
+		for k := 0; k < 2; k++ {
+			c := 4 * (row*panelCols + panelCols - 3 + k)
+			pn.grid[c], pn.grid[c+2] = byte(i), 2
+		}
+	}
+}
+
+// updatePanel lays out the panel and applies the cursor at x, y in the
+// framebuffer, the left button held or not, to its controls. scale is the
+// framebuffer pixels of a window pixel.
+func updatePanel(pn *panel, p *program, clk *clock, x, y float64, down bool, height, scale int) {
+	if !pn.shown {
+		pn.drag, pn.down = nil, down
+		return
+	}
+	pn.scale, pn.height = 2*scale, height
+	layoutPanel(pn, p, clk)
+
+	pn.hover = -1
+	col, row, ok := panelCell(pn, x, y)
+	for i, w := range pn.widgets {
+		if ok && w.row == row && col >= w.col && col < w.col+w.n {
+			pn.hover = i
+		}
+	}
+	px := x / float64(pn.scale)
+
+	pressed := down && !pn.down
+	pn.down = down
+	if !down {
+		pn.drag = nil
+	}
+	if pressed && pn.hover >= 0 {
+		w := pn.widgets[pn.hover]
+		switch w.kind {
+		case panelButton:
+			w.action()
+		case panelToggle:
+			setPanelValue(p, w, func(v float64) float64 { return 1 - math.Min(1, math.Abs(v)) })
+		default:
+			pn.drag = &w
+			pn.pressX = px
+			setPanelValue(p, w, func(v float64) float64 {
+				pn.pressValue = v
+				return v
+			})
+		}
+	}
+
+	if w := pn.drag; w != nil {
+		setPanelValue(p, *w, func(v float64) float64 {
+			cells := (px - float64(w.col*panelCellWidth)) / panelCellWidth
+			if w.kind == panelSlider {
+				v = w.min + cells/float64(w.n)*(w.max-w.min)
+				v = math.Max(w.min, math.Min(w.max, v))
+			} else {
+				moved := (px - pn.pressX) / panelCellWidth
+				v = pn.pressValue + moved*0.05*math.Max(1, math.Abs(pn.pressValue))
+			}
+			if w.integer {
+				v = math.Round(v)
+			}
+			return v
+		})
+	}
+}
+
+// setPanelValue sets the component of a widget's uniform to f of its value.
+func setPanelValue(p *program, w panelWidget, f func(float64) float64) {
+	vals, err := uniformValues(p, w.uniform)
+	if err != nil || w.comp >= len(vals) {
+		return
+	}
+	v := f(vals[w.comp])
+	if v == vals[w.comp] {
+		return
+	}
+	vals[w.comp] = v
+	for _, err := range setTweak(p, w.uniform, vals) {
+		log.Println("panel:", err)
+	}
+}
+
+// drawPanel draws the panel as last laid out over the default framebuffer.
+func drawPanel(pn *panel) {
+	if !pn.shown || pn.rows == 0 {
+		return
+	}
+	if pn.hover >= 0 {
+		w := pn.widgets[pn.hover]
+		for c := w.col; c < w.col+w.n; c++ {
+			pn.grid[4*(w.row*panelCols+c)+2] |= 1
+		}
+	}
+
+	pn.cells.SetData(gl.RGBA8UI, panelCols, int32(pn.rows), gl.RGBA_INTEGER, gl.UNSIGNED_BYTE, gl.Ptr(pn.grid))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	gl.Enable(gl.BLEND)
+	defer gl.Disable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	defer gl.BlendFunc(gl.ONE, gl.ZERO)
+
+	var prev int32
+	gl.GetIntegerv(gl.CURRENT_PROGRAM, &prev)
+	defer gl.UseProgram(uint32(prev))
+
+	pn.prog.Bind()
+	gx.ActiveTexture(0)
+	pn.font.Bind(gl.TEXTURE_2D)
+	gx.ActiveTexture(1)
+	pn.cells.Bind(gl.TEXTURE_2D)
+	defer func() {
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+		gx.ActiveTexture(0)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+	}()
+	gl.Uniform1i(pn.fontLoc, 0)
+	gl.Uniform1i(pn.cellsLoc, 1)
+	gl.Uniform2f(pn.originLoc, 0, float32(pn.height))
+	gl.Uniform1i(pn.scaleLoc, int32(pn.scale))
+	if len(pn.swatches) > 0 {
+		gl.Uniform4fv(pn.swatchesLoc, int32(len(pn.swatches)/4), &pn.swatches[0])
+	}
+
+	drawFullscreen()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alotabits/shaderdev/internal/cache"
+	"github.com/alotabits/shaderdev/internal/source"
+)
+
+var offline = flag.Bool("offline", false, "use only previously downloaded resources")
+var pollSeconds = flag.Float64("poll", 0, "check URL inputs for changes every this many seconds, reloading them like edited files")
+
+var downloads *cache.Cache
+
+// downloadCache returns the cache for downloaded resources, opening it on
+// first use in the user's cache directory.
+func downloadCache() (*cache.Cache, error) {
+	if downloads != nil {
+		return downloads, nil
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	c, err := cache.Open(filepath.Join(dir, "shaderdev"))
+	if err != nil {
+		return nil, err
+	}
+	c.Offline = *offline
+	c.NewRequest = source.NewRequest
+	downloads = c
+	return c, nil
+}
+
+// isURL reports whether path is an http(s) URL or one of a storage bucket,
+// e.g. s3://bucket/key or gs://bucket/object.
+func isURL(path string) bool {
+	return strings.Contains(path, "://") && source.Handles(path)
+}
+
+// mirrors maps every URL fetched to the file holding its latest content.
+var mirrors = make(map[string]string)
+var mirrorsMu sync.Mutex
+
+// fetchURL downloads a URL and returns a file holding its content. The file
+// stays the same for the URL and is only written when the content changes,
+// so it can be watched like any other, and keeps the name of the URL's path
+// so its extension can be told.
+func fetchURL(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	c, err := downloadCache()
+	if err != nil {
+		return "", err
+	}
+	content, err := c.Fetch(rawurl)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(rawurl))
+	name := filepath.Base(u.Path)
+	if name == "/" || name == "." {
+		name = "index"
+	}
+	mirror := filepath.Join(c.Dir(), "urls", hex.EncodeToString(sum[:8]), name)
+
+	b, err := ioutil.ReadFile(content)
+	if err != nil {
+		return "", err
+	}
+	old, err := ioutil.ReadFile(mirror)
+	if err != nil || !bytes.Equal(old, b) {
+		err = os.MkdirAll(filepath.Dir(mirror), 0755)
+		if err != nil {
+			return "", err
+		}
+		err = ioutil.WriteFile(mirror, b, 0644)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	mirrorsMu.Lock()
+	mirrors[rawurl] = mirror
+	mirrorsMu.Unlock()
+	return mirror, nil
+}
+
+// pollURLs fetches every URL fetched so far each interval, forever, so that
+// changed content reaches their files.
+func pollURLs(interval time.Duration) {
+	for range time.Tick(interval) {
+		mirrorsMu.Lock()
+		var urls []string
+		for u := range mirrors {
+			urls = append(urls, u)
+		}
+		mirrorsMu.Unlock()
+
+		for _, u := range urls {
+			_, err := fetchURL(u)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// resolvePath finds a relative path by trying, in order, the directory of
+// the file referring to it (dir, if not empty), the working directory and
+// each -I root. Absolute paths are returned as they are, and URLs are
+// downloaded, see fetchURL.
+func resolvePath(path, dir string) (string, error) {
+	if isURL(path) {
+		return fetchURL(path)
+	}
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path), nil
+	}
+
+	var roots []string
+	if dir != "" {
+		roots = append(roots, dir)
+	}
+	roots = append(roots, ".")
+	roots = append(roots, searchRoots...)
+
+	for _, root := range roots {
+		p := filepath.Join(root, path)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("%v not found, searched: %v", path, strings.Join(roots, ", "))
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/alotabits/shaderdev/internal/toml"
+	"github.com/alotabits/shaderdev/internal/watch"
+	"github.com/go-gl/gl/all-core/gl"
+	"github.com/go-gl/glfw/v3.1/glfw"
+	"gopkg.in/fsnotify.v1"
+)
+
+// playlistItem is one [[item]] of a playlist file: a shaderdev command line,
+// e.g. a bundle, shown for a while.
+type playlistItem struct {
+	name     string
+	args     []string
+	duration time.Duration
+	// working directory the args are relative to, if not the playlist's
+	dir string
+}
+
+type playlist struct {
+	items []playlistItem
+	// how each item gives way to the next: cut, fade, wipe or a fragment
+	// shader file
+	transition string
+	// how long the transition takes, part of the duration of each item
+	fade time.Duration
+}
+
+// tomlSeconds converts a number of seconds given as an integer or a float.
+func tomlSeconds(v interface{}) (time.Duration, bool) {
+	switch v := v.(type) {
+	case int64:
+		return time.Duration(v) * time.Second, true
+	case float64:
+		return time.Duration(v * float64(time.Second)), true
+	}
+	return 0, false
+}
+
+func loadPlaylist(path string) (*playlist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	doc, err := toml.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	pl := playlist{transition: "fade", fade: time.Second}
+	if doc["transition"] != nil {
+		var ok bool
+		if pl.transition, ok = doc["transition"].(string); !ok {
+			return nil, fmt.Errorf("%v: transition must be a string", path)
+		}
+		name, _, _ := splitTransitionSpec(pl.transition, 0)
+		if _, ok := transitionFrags[name]; !ok && !filepath.IsAbs(name) {
+			pl.transition = filepath.Join(filepath.Dir(path), pl.transition)
+		}
+	}
+	if doc["fade"] != nil {
+		var ok bool
+		if pl.fade, ok = tomlSeconds(doc["fade"]); !ok || pl.fade < 0 {
+			return nil, fmt.Errorf("%v: fade must be a number of seconds", path)
+		}
+	}
+
+	tables, _ := doc["item"].([]map[string]interface{})
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("%v: no [[item]] entries", path)
+	}
+
+	for i, t := range tables {
+		var it playlistItem
+		var ok bool
+		it.name, _ = t["name"].(string)
+		if it.name == "" {
+			it.name = fmt.Sprintf("item%v", i+1)
+		}
+		if it.args, ok = stringList(t["args"]); !ok {
+			return nil, fmt.Errorf("%v: %v: args must be a list of strings", path, it.name)
+		}
+		if it.duration, ok = tomlSeconds(t["duration"]); !ok || it.duration <= pl.fade {
+			return nil, fmt.Errorf("%v: %v: duration must be a number of seconds longer than the fade", path, it.name)
+		}
+		it.dir, _ = t["dir"].(string)
+		if !filepath.IsAbs(it.dir) {
+			it.dir = filepath.Join(filepath.Dir(path), it.dir)
+		}
+		pl.items = append(pl.items, it)
+	}
+
+	return &pl, nil
+}
+
+// embedTimeout bounds how long a playlist waits for a frame, including the
+// first, which may wait for the item's shaders to compile.
+const embedTimeout = 10 * time.Second
+
+// playlistChild is a shaderdev process rendering an item with -embed, which
+// connects back to the playlist.
+type playlistChild struct {
+	item  playlistItem
+	cmd   *exec.Cmd
+	ln    net.Listener
+	conns chan net.Conn
+	conn  net.Conn
+	r     *bufio.Reader
+	pix   []byte
+	// closed when the process has ended
+	done chan struct{}
+
+	// the latest frame
+	tex    gx.Texture
+	width  int32
+	height int32
+	// the last error reported, to log each only once
+	err string
+	// when the item started showing
+	shown time.Time
+}
+
+func startChild(exe, dir string, n int, it playlistItem) (*playlistChild, error) {
+	sock := filepath.Join(dir, fmt.Sprintf("item%v.sock", n))
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &playlistChild{item: it, ln: ln, conns: make(chan net.Conn, 1), done: make(chan struct{})}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		c.conns <- conn
+	}()
+
+	// flags must come before the shader specifications
+	args := append([]string{"-embed", "unix:" + sock}, it.args...)
+	c.cmd = exec.Command(exe, args...)
+	c.cmd.Dir = it.dir
+	c.cmd.Stdout = os.Stdout
+	c.cmd.Stderr = os.Stderr
+	err = c.cmd.Start()
+	if err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("%v: %v", it.name, err)
+	}
+	go func() {
+		err := c.cmd.Wait()
+		if err != nil {
+			log.Printf("playlist: %v: %v", it.name, err)
+		}
+		close(c.done)
+	}()
+	log.Println("playlist: started", it.name)
+	return c, nil
+}
+
+// childReady reports whether the child has connected.
+func childReady(c *playlistChild) bool {
+	if c.conn == nil {
+		select {
+		case c.conn = <-c.conns:
+			c.r = bufio.NewReader(c.conn)
+		default:
+		}
+	}
+	return c.conn != nil
+}
+
+// childExited reports whether the child ended without connecting.
+func childExited(c *playlistChild) bool {
+	if childReady(c) {
+		return false
+	}
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// renderChild asks the child for a frame of the given size, showing elapsed
+// seconds of its item, and uploads it to its texture. Frames the child fails
+// to render, e.g. while its program doesn't link, keep the last one.
+func renderChild(c *playlistChild, width, height int32, elapsed time.Duration) error {
+	c.conn.SetDeadline(time.Now().Add(embedTimeout))
+	b, err := json.Marshal(&embedRequest{Width: width, Height: height, Elapsed: &elapsed})
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+
+	line, err := c.r.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	var f embedFrame
+	err = json.Unmarshal(line, &f)
+	if err != nil {
+		return err
+	}
+	if f.Error != "" {
+		if f.Error != c.err {
+			log.Printf("playlist: %v: %v", c.item.name, f.Error)
+		}
+		c.err = f.Error
+		return nil
+	}
+	c.err = ""
+	if f.Size != int(f.Width*f.Height*4) {
+		return fmt.Errorf("frame of %v bytes for %vx%v", f.Size, f.Width, f.Height)
+	}
+	if len(c.pix) != f.Size {
+		c.pix = make([]byte, f.Size)
+	}
+	_, err = io.ReadFull(c.r, c.pix)
+	if err != nil {
+		return err
+	}
+
+	if c.tex == 0 || c.width != f.Width || c.height != f.Height {
+		c.tex.Delete()
+		c.tex = gx.NewTexture(gl.TEXTURE_2D)
+		c.tex.Label("playlist")
+		c.tex.SetData(gl.RGBA8, f.Width, f.Height, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(c.pix))
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+		c.width, c.height = f.Width, f.Height
+	} else {
+		c.tex.Bind(gl.TEXTURE_2D)
+		gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, f.Width, f.Height, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(c.pix))
+	}
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return nil
+}
+
+// stopChild closes the connection, which ends the child, or kills it if it
+// hasn't connected.
+func stopChild(c *playlistChild) {
+	if c.conn != nil {
+		c.conn.Close()
+	} else {
+		c.cmd.Process.Kill()
+	}
+	c.ln.Close()
+	c.tex.Delete()
+}
+
+// playlistMain shows the items of a playlist file in turn, looping, each in
+// a shaderdev process of its own that renders for it with -embed. The next
+// item starts in the background while the current one shows, and transitions
+// in over the end of it.
+func playlistMain(args []string) error {
+	fs := flag.NewFlagSet("playlist", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("playlist requires a single playlist file")
+	}
+
+	pl, err := loadPlaylist(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir("", "shaderdev-playlist")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	err = glfw.Init()
+	if err != nil {
+		return err
+	}
+	defer glfw.Terminate()
+
+	window, err := createWindow(3, 3, true)
+	if err != nil {
+		return err
+	}
+	defer window.Destroy()
+
+	tr, err := newTransition(pl.transition, pl.fade)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	err = watchBuiltins(watcher)
+	if err != nil {
+		return err
+	}
+
+	// started counts the children started, naming their sockets; next is
+	// the index of the item after the current one
+	started := 0
+	next := 0
+	// failed counts the items in a row that failed to start or connect,
+	// ending the playlist when all have
+	failed := 0
+	start := func() (*playlistChild, error) {
+		for failed < len(pl.items) {
+			it := pl.items[next]
+			next = (next + 1) % len(pl.items)
+			started++
+			c, err := startChild(exe, dir, started, it)
+			if err == nil {
+				return c, nil
+			}
+			log.Println("playlist:", err)
+			failed++
+		}
+		return nil, fmt.Errorf("every item of the playlist failed")
+	}
+
+	cur, err := start()
+	if err != nil {
+		return err
+	}
+	// the item to show next, none when a single item just keeps showing
+	var following *playlistChild
+	defer func() {
+		stopChild(cur)
+		if following != nil {
+			stopChild(following)
+		}
+	}()
+
+	changes := watch.NewQueue()
+	var fadeAt time.Time
+	ticker := time.NewTicker(1000 / 60 * time.Millisecond)
+	defer ticker.Stop()
+	for !window.ShouldClose() {
+		select {
+		case evt := <-watcher.Events:
+			changes.Add(evt, time.Now())
+			continue
+		case err := <-watcher.Errors:
+			log.Println("watcher error:", err)
+			continue
+		case <-ticker.C:
+		}
+		now := time.Now()
+		for _, path := range changes.Settled(now) {
+			builtinChanged(path)
+		}
+		fbWidth, fbHeight := window.GetFramebufferSize()
+
+		if following == nil && len(pl.items) > 1 {
+			following, err = start()
+			if err != nil {
+				return err
+			}
+		}
+		// replace a child that failed to start with the item after it
+		if childExited(cur) {
+			log.Printf("playlist: %v exited before connecting", cur.item.name)
+			failed++
+			stopChild(cur)
+			cur, following = following, nil
+			if cur == nil {
+				cur, err = start()
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if following != nil && childExited(following) {
+			log.Printf("playlist: %v exited before connecting", following.item.name)
+			failed++
+			stopChild(following)
+			following = nil
+			continue
+		}
+
+		if childReady(cur) && cur.shown.IsZero() {
+			cur.shown = now
+			failed = 0
+		}
+		if !cur.shown.IsZero() && fadeAt.IsZero() && following != nil && now.Sub(cur.shown) >= cur.item.duration-tr.duration && childReady(following) {
+			fadeAt = now
+			following.shown = now
+			log.Println("playlist:", following.item.name)
+		}
+
+		progress := float32(0)
+		if !fadeAt.IsZero() {
+			progress = transitionProgress(tr, fadeAt, now)
+		}
+		if progress >= 1 {
+			stopChild(cur)
+			cur, following = following, nil
+			fadeAt = time.Time{}
+			progress = 0
+		}
+
+		var to gx.Texture
+		if cur.shown.IsZero() {
+			// still starting
+		} else if err := renderChild(cur, int32(fbWidth), int32(fbHeight), now.Sub(cur.shown)); err != nil {
+			log.Printf("playlist: %v: %v", cur.item.name, err)
+			stopChild(cur)
+			cur, following = following, nil
+			fadeAt = time.Time{}
+			if cur == nil {
+				cur, err = start()
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !fadeAt.IsZero() {
+			if err := renderChild(following, int32(fbWidth), int32(fbHeight), now.Sub(following.shown)); err != nil {
+				log.Printf("playlist: %v: %v", following.item.name, err)
+				stopChild(following)
+				following = nil
+				fadeAt = time.Time{}
+				progress = 0
+			} else {
+				to = following.tex
+			}
+		}
+
+		gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+		gl.Viewport(0, 0, int32(fbWidth), int32(fbHeight))
+		gl.ClearColor(0, 0, 0, 1)
+		gl.Clear(gl.COLOR_BUFFER_BIT)
+		drawTransition(tr, cur.tex, to, progress)
+
+		window.SwapBuffers()
+		glfw.PollEvents()
+	}
+	return nil
+}
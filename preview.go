@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alotabits/shaderdev/internal/ws"
+)
+
+var (
+	previewAddr      = flag.String("preview", "", "serve a live preview on this HTTP address, e.g. :8080: the page streams the rendered frames as JPEG and the compile errors over a WebSocket, to watch from another machine while editing")
+	previewFPS       = flag.Float64("preview-fps", 15, "the most frames a second -preview sends")
+	previewQuality   = flag.Int("preview-quality", 75, "the JPEG quality of -preview frames, 1 to 100")
+	previewAnyOrigin = flag.Bool("preview-any-origin", false, "let pages served from other hosts watch -preview; by default only the preview's own page may, as any page open in a browser could otherwise read the frames and compile errors")
+)
+
+// previewMessage is a WebSocket message to viewers: a JPEG frame, or a
+// previewStatus as JSON text.
+type previewMessage struct {
+	op   byte
+	data []byte
+}
+
+// previewStatus is the state of the program, sent when it links or fails
+// to. Error holds the compile or link errors, empty once it links again.
+type previewStatus struct {
+	Error string `json:"error"`
+	Frame int32  `json:"frame"`
+}
+
+// previewServer streams frames to the viewers of the preview page.
+// Viewers that fall behind miss frames rather than slowing rendering, and
+// frames are encoded off the render loop, which skips any that come while
+// the last is being encoded.
+type previewServer struct {
+	mu      sync.Mutex
+	viewers map[chan previewMessage]bool
+	// the latest status, for viewers joining later
+	status []byte
+
+	frames chan captureFrame
+	sent   time.Time
+}
+
+func servePreview(addr string) (*previewServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("preview on http://%v/", ln.Addr())
+
+	s := &previewServer{viewers: make(map[chan previewMessage]bool), frames: make(chan captureFrame, 1)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, previewPage)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		var checkOrigin func(*http.Request) bool
+		if *previewAnyOrigin {
+			checkOrigin = func(*http.Request) bool { return true }
+		}
+		c, err := ws.Upgrade(w, r, checkOrigin)
+		if err != nil {
+			log.Println("preview:", err)
+			return
+		}
+		serveWatcher(s, c)
+	})
+	go func() {
+		log.Println("preview:", http.Serve(ln, mux))
+	}()
+	go encodePreview(s)
+	return s, nil
+}
+
+func serveWatcher(s *previewServer, c *ws.Conn) {
+	defer c.Close()
+	log.Println("preview: viewer joined from", c.RemoteAddr())
+	journalEvent("access", fmt.Sprint("preview viewer joined from ", c.RemoteAddr()), nil)
+
+	ch := make(chan previewMessage, 4)
+	s.mu.Lock()
+	status := s.status
+	s.viewers[ch] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.viewers, ch)
+		s.mu.Unlock()
+		log.Println("preview: viewer left from", c.RemoteAddr())
+		journalEvent("access", fmt.Sprint("preview viewer left from ", c.RemoteAddr()), nil)
+	}()
+
+	// viewers send nothing, but reading notices when they leave
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	var err error
+	if status != nil {
+		err = c.WriteMessage(ws.Text, status)
+	}
+	for err == nil {
+		select {
+		case m := <-ch:
+			err = c.WriteMessage(m.op, m.data)
+		case <-closed:
+			return
+		}
+	}
+}
+
+// broadcastPreview sends m to every viewer.
+func broadcastPreview(s *previewServer, m previewMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.viewers {
+		select {
+		case ch <- m:
+		default:
+		}
+	}
+}
+
+// previewDue reports whether a frame should be read back for the preview,
+// as someone is watching and -preview-fps allows another.
+func previewDue(s *previewServer, now time.Time) bool {
+	s.mu.Lock()
+	watched := len(s.viewers) > 0
+	s.mu.Unlock()
+	return watched && now.Sub(s.sent).Seconds() >= 1 / *previewFPS
+}
+
+// publishPreviewFrame hands a copy of f to be encoded and sent, unless the
+// last frame is still being encoded.
+func publishPreviewFrame(s *previewServer, f *captureFrame, now time.Time) {
+	c := *f
+	c.pix = append([]byte{}, f.pix...)
+	select {
+	case s.frames <- c:
+		s.sent = now
+	default:
+	}
+}
+
+func encodePreview(s *previewServer) {
+	var buf bytes.Buffer
+	for f := range s.frames {
+		img := image.NewRGBA(image.Rect(0, 0, int(f.width), int(f.height)))
+		stride := int(f.width) * 4
+		// rows come bottom up from GL
+		for y := 0; y < int(f.height); y++ {
+			copy(img.Pix[y*img.Stride:y*img.Stride+stride], f.pix[(int(f.height)-1-y)*stride:])
+		}
+		buf.Reset()
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: *previewQuality})
+		if err != nil {
+			log.Println("preview:", err)
+			continue
+		}
+		broadcastPreview(s, previewMessage{ws.Binary, append([]byte{}, buf.Bytes()...)})
+	}
+}
+
+// publishPreviewStatus sends the errors of a program that failed to build,
+// or none once it links, to every viewer.
+func publishPreviewStatus(s *previewServer, err error, frame int32) {
+	st := previewStatus{Frame: frame}
+	if err != nil {
+		st.Error = err.Error()
+	}
+	b, err := json.Marshal(&st)
+	if err != nil {
+		log.Println("preview:", err)
+		return
+	}
+	s.mu.Lock()
+	s.status = b
+	s.mu.Unlock()
+	broadcastPreview(s, previewMessage{ws.Text, b})
+}
+
+const previewPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>shaderdev</title>
+<style>
+html, body { margin: 0; height: 100%; background: #111; color: #ddd; font: 13px monospace; }
+img { display: block; width: 100%; height: 100%; object-fit: contain; }
+#errors { position: fixed; left: 0; right: 0; bottom: 0; margin: 0; padding: 8px; max-height: 50%; overflow: auto; background: rgba(64, 0, 0, 0.85); white-space: pre-wrap; }
+#state { position: fixed; top: 4px; right: 8px; opacity: 0.6; }
+</style>
+</head>
+<body>
+<img id="frame" alt="">
+<pre id="errors" hidden></pre>
+<div id="state">connecting</div>
+<script>
+var frame = document.getElementById("frame");
+var errors = document.getElementById("errors");
+var state = document.getElementById("state");
+
+function connect() {
+	var sock = new WebSocket((location.protocol == "https:" ? "wss://" : "ws://") + location.host + "/ws");
+	sock.binaryType = "blob";
+	sock.onopen = function() { state.textContent = ""; };
+	sock.onmessage = function(e) {
+		if (typeof e.data == "string") {
+			var st = JSON.parse(e.data);
+			errors.textContent = st.error;
+			errors.hidden = !st.error;
+			return;
+		}
+		var url = URL.createObjectURL(e.data);
+		frame.onload = function() { URL.revokeObjectURL(url); };
+		frame.src = url;
+	};
+	sock.onclose = function() {
+		state.textContent = "disconnected";
+		setTimeout(connect, 1000);
+	};
+}
+connect();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,18 @@
+package main
+
+// #include <stdlib.h>
+//
+// typedef void (*glfwProc)(void);
+// glfwProc glfwGetProcAddress(const char *procname);
+import "C"
+
+import "unsafe"
+
+// glfwProcAddress looks up a function of the current context with GLFW's
+// glfwGetProcAddress, which GLFW 3.1 has but its Go bindings don't expose.
+// It is linked from the C library the bindings build.
+func glfwProcAddress(name string) unsafe.Pointer {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	return unsafe.Pointer(C.glfwGetProcAddress(cname))
+}
@@ -1,24 +1,36 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"reflect"
+	"sort"
 
+	"github.com/alotabits/shaderdev/internal/glsl"
 	"github.com/alotabits/shaderdev/internal/gx"
 	"github.com/go-gl/gl/all-core/gl"
 )
 
 type shader struct {
-	id     uint32
+	id     gx.Shader
 	paths  []string
 	update bool
+	// the concatenated files, as last read
+	source []byte
+	// the line of source each file starts at
+	starts []int
+	// the source as last given to the compiler, with injected lines
+	compiled []byte
+	// what explicitLayout last couldn't inject, logged when it changes
+	layoutNote string
 }
 
 type program struct {
-	id            uint32
+	id            gx.Program
 	shaderByStage map[uint32]*shader
 	shadersByPath map[string][]*shader
 	update        bool
@@ -28,52 +40,195 @@ type program struct {
 	viewLoc       int32
 	modelLoc      int32
 	cursorLoc     int32
+	buttonsLoc    int32
+	scrollLoc     int32
 	timeLoc       int32
+	deltaTimeLoc  int32
+	frameLoc      int32
+	seedLoc       int32
+
+	gamepadAxesLoc    int32
+	gamepadButtonsLoc int32
+
+	focalLengthLoc   int32
+	apertureLoc      int32
+	focusDistanceLoc int32
+	nearFarLoc       int32
 
 	positionLoc uint32
 	colorLoc    uint32
+	normalLoc   uint32
+	texcoordLoc uint32
+	tangentLoc  uint32
+	jointsLoc   uint32
+	weightsLoc  uint32
+
+	// morphPosition0, morphNormal0 and so on
+	morphPositionLocs [maxMorphTargets]uint32
+	morphNormalLocs   [maxMorphTargets]uint32
+
+	// arrays of the skinning palette and morph target weights, and how
+	// many elements they hold
+	jointMatricesLoc  int32
+	jointMatricesSize int32
+	morphWeightsLoc   int32
+	morphWeightsSize  int32
+
+	materialLocs materialLocs
+
+	// the active uniforms of the last link by name, arrays by the name
+	// they were declared with
+	active map[string]gx.Variable
+	// the uniform blocks of the last link by block name, and where each of
+	// their members lies by the name it is set by
+	blocks       map[string]*uniformBlock
+	blockMembers map[string]*blockMember
+	// the active uniforms not set by the tool, as last logged
+	settable string
+	// uniforms declared tweakable by pragmas in the sources, and the
+	// defaults they last gave, to tell them from values set since
+	tweaks        map[string]*glsl.Tweak
+	tweakDefaults map[string][]float64
+
+	// values set by name, reapplied after every link
+	uniforms *uniformSlots
+
+	// preprocessor lines inserted after the #version line of every shader
+	defines string
+
+	// the directory -spirv writes the stages to, empty for none
+	spirvOut string
+
+	// expected block layouts, checked after every link when set
+	layout *reflection
+
+	samplers []samplerUnit
+	// whether the samplers are checked against the textures bound at the
+	// next draw, after a link or a change of inputs
+	checkSamplers bool
+	// texture units of sampler uniforms by name, injected as bindings with
+	// -explicit-layout, and nil without
+	bindings map[string]uint32
 }
 
 func newProgram() *program {
 	var p program
-	p.id = gl.CreateProgram()
+	p.id = gx.NewProgram()
+	p.id.Label("program")
 	p.shaderByStage = make(map[uint32]*shader)
 	p.shadersByPath = make(map[string][]*shader)
+	p.uniforms = newUniformSlots()
 	p.update = true
 	return &p
 }
 
-func updateShader(s *shader) error {
-	if !s.update {
+// readShader reads the files of a shader into its source.
+func readShader(stage uint32, s *shader) error {
+	for _, p := range s.paths {
+		if !isWGSL(p) {
+			continue
+		}
+		if len(s.paths) > 1 {
+			return fmt.Errorf("%v: WGSL shaders can't be combined with other files", p)
+		}
+		b, err := translateWGSL(stage, p)
+		if err != nil {
+			return err
+		}
+		s.source, s.starts = b, []int{1}
 		return nil
 	}
 
-	s.update = false
-
 	files := make([]io.Reader, len(s.paths))
 	for i, p := range s.paths {
 		file, err := os.Open(p)
 		if err != nil {
 			return err
 		}
+		defer file.Close()
 		files[i] = io.Reader(file)
 	}
 
-	b, err := ioutil.ReadAll(io.MultiReader(files...))
-	if err != nil {
-		return err
+	var starts []int
+	var b []byte
+	for _, f := range files {
+		starts = append(starts, 1+bytes.Count(b, []byte("\n")))
+		fb, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		b = append(b, fb...)
+	}
+	s.source, s.starts = b, starts
+	return nil
+}
+
+// sourceLine returns the file and line of a line of a shader's source.
+func sourceLine(s *shader, line int) (string, int) {
+	i := sort.SearchInts(s.starts, line+1) - 1
+	if i < 0 {
+		return "", line
+	}
+	return s.paths[i], line - s.starts[i] + 1
+}
+
+// compileError is a stage that failed to compile, with the compiler's log.
+type compileError struct {
+	stage  uint32
+	shader *shader
+	err    error
+}
+
+func (e *compileError) Error() string {
+	return e.err.Error()
+}
+
+// linkError is a program that failed to link, with the linker's log.
+type linkError struct {
+	err error
+}
+
+func (e *linkError) Error() string {
+	return e.err.Error()
+}
+
+func updateShader(p *program, stage uint32, s *shader) error {
+	if !s.update {
+		return nil
+	}
+
+	s.update = false
+
+	b := s.source
+	if p.bindings != nil {
+		lb, note, err := explicitLayout(b, stage, p.bindings)
+		if err != nil {
+			// the compiler has the final say on the source
+			note = fmt.Sprintf("explicit layouts skipped: %v", err)
+		} else {
+			b = lb
+		}
+		if note != s.layoutNote && note != "" {
+			log.Printf("%v: %v", stageName(stage, s), note)
+		}
+		s.layoutNote = note
 	}
 
-	err = gx.CompileSource(s.id, [][]byte{b})
+	if p.defines != "" {
+		b = insertAfterVersion(b, p.defines)
+	}
+
+	s.compiled = b
+	err := gx.CompileSource(uint32(s.id), [][]byte{b})
 	if err != nil {
-		return err
+		return &compileError{stage, s, err}
 	}
 
 	return nil
 }
 
-func getUniformLocation(program uint32, name string) int32 {
-	loc := gl.GetUniformLocation(program, gl.Str(name))
+func getUniformLocation(p *program, name string) int32 {
+	loc := activeLocation(p, name)
 	if !gx.IsValidUniformLoc(loc) {
 		log.Println("missing uniform", name)
 	}
@@ -95,26 +250,104 @@ func updateProgram(p *program) error {
 
 	p.update = false
 
-	for _, s := range p.shaderByStage {
-		err := updateShader(s)
+	for stage, s := range p.shaderByStage {
+		if s.update {
+			err := readShader(stage, s)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if *explicitLayoutFlag {
+		// every stage is recompiled when the mapping changes, as samplers
+		// shared between stages must agree
+		b := samplerBindings(p)
+		if !reflect.DeepEqual(b, p.bindings) {
+			p.bindings = b
+			for _, s := range p.shaderByStage {
+				s.update = true
+			}
+		}
+	}
+
+	for stage, s := range p.shaderByStage {
+		err := updateShader(p, stage, s)
 		if err != nil {
 			return err
 		}
 	}
 
-	err := gx.LinkProgram(p.id)
+	err := gx.LinkProgram(uint32(p.id))
 	if err != nil {
-		return err
+		return &linkError{err}
+	}
+
+	if p.layout != nil {
+		for _, m := range checkLayout(p.layout, uint32(p.id)) {
+			log.Println("layout mismatch:", m)
+		}
+	}
+
+	if *unusedFlag {
+		reportUnused(p)
 	}
+	if *spirvCompiler != "" {
+		reportSPIRV(p)
+	}
+
+	reflectUniforms(p)
+	updateBlocks(p)
+
+	p.viewportLoc = getUniformLocation(p, "viewport")
+	p.cursorLoc = getUniformLocation(p, "cursor")
+	p.timeLoc = getUniformLocation(p, "time")
+	p.projectionLoc = getUniformLocation(p, "projection")
+	p.viewLoc = getUniformLocation(p, "view")
+	p.modelLoc = getUniformLocation(p, "model")
+	// optional, for the shaders that want them
+	p.buttonsLoc = activeLocation(p, "buttons")
+	p.scrollLoc = activeLocation(p, "scroll")
+	p.gamepadAxesLoc = activeLocation(p, "gamepadAxes")
+	p.gamepadButtonsLoc = activeLocation(p, "gamepadButtons")
+	p.deltaTimeLoc = activeLocation(p, "deltaTime")
+	p.frameLoc = activeLocation(p, "frame")
+	p.seedLoc = activeLocation(p, "seed")
+	p.focalLengthLoc = activeLocation(p, "focalLength")
+	p.apertureLoc = activeLocation(p, "aperture")
+	p.focusDistanceLoc = activeLocation(p, "focusDistance")
+	p.nearFarLoc = activeLocation(p, "nearFar")
+	p.positionLoc = getAttribLocation(uint32(p.id), "position\x00")
+	p.colorLoc = getAttribLocation(uint32(p.id), "color\x00")
+	// optional, as few shaders light or texture the mesh
+	p.normalLoc = uint32(gl.GetAttribLocation(uint32(p.id), gl.Str("normal\x00")))
+	p.texcoordLoc = uint32(gl.GetAttribLocation(uint32(p.id), gl.Str("texcoord\x00")))
+	p.tangentLoc = uint32(gl.GetAttribLocation(uint32(p.id), gl.Str("tangent\x00")))
+	p.jointsLoc = uint32(gl.GetAttribLocation(uint32(p.id), gl.Str("joints\x00")))
+	p.weightsLoc = uint32(gl.GetAttribLocation(uint32(p.id), gl.Str("weights\x00")))
+	for i := range p.morphPositionLocs {
+		p.morphPositionLocs[i] = uint32(gl.GetAttribLocation(uint32(p.id), gl.Str(fmt.Sprint("morphPosition", i, "\x00"))))
+		p.morphNormalLocs[i] = uint32(gl.GetAttribLocation(uint32(p.id), gl.Str(fmt.Sprint("morphNormal", i, "\x00"))))
+	}
+	p.jointMatricesLoc, p.jointMatricesSize = arrayUniform(p, "jointMatrices")
+	p.morphWeightsLoc, p.morphWeightsSize = arrayUniform(p, "morphWeights")
+	p.materialLocs = getMaterialLocs(p)
+
+	assignSamplers(p)
 
-	p.viewportLoc = getUniformLocation(p.id, "viewport\x00")
-	p.cursorLoc = getUniformLocation(p.id, "cursor\x00")
-	p.timeLoc = getUniformLocation(p.id, "time\x00")
-	p.projectionLoc = getUniformLocation(p.id, "projection\x00")
-	p.viewLoc = getUniformLocation(p.id, "view\x00")
-	p.modelLoc = getUniformLocation(p.id, "model\x00")
-	p.positionLoc = getAttribLocation(p.id, "position\x00")
-	p.colorLoc = getAttribLocation(p.id, "color\x00")
+	for _, err := range remapUniforms(p.uniforms, p) {
+		log.Println("uniforms:", err)
+	}
+	for _, err := range updateTweaks(p) {
+		log.Println("tweaks:", err)
+	}
+	if s := settableUniforms(p); s != p.settable {
+		p.settable = s
+		if s == "" {
+			s = "none"
+		}
+		log.Println("settable uniforms:", s)
+	}
 
 	return nil
 }
@@ -124,8 +357,9 @@ func addPath(p *program, stage uint32, path string) {
 	s := p.shaderByStage[stage]
 	if s == nil {
 		s = &shader{}
-		s.id = gl.CreateShader(stage)
-		gl.AttachShader(p.id, s.id)
+		s.id = gx.NewShader(stage)
+		s.id.Label(gx.StageStr(stage) + " shader")
+		gl.AttachShader(uint32(p.id), uint32(s.id))
 		p.shaderByStage[stage] = s
 	}
 	s.paths = append(s.paths, path)
@@ -134,6 +368,63 @@ func addPath(p *program, stage uint32, path string) {
 	p.shadersByPath[path] = append(p.shadersByPath[path], s)
 }
 
+// setStagePath replaces all sources of a stage with a single path, adding
+// the stage if the program does not have it yet.
+func setStagePath(p *program, stage uint32, path string) {
+	setStagePaths(p, stage, []string{path})
+}
+
+// setStagePaths replaces all sources of a stage with paths, adding the
+// stage if the program does not have it yet.
+func setStagePaths(p *program, stage uint32, paths []string) {
+	s := p.shaderByStage[stage]
+	if s == nil {
+		for _, path := range paths {
+			addPath(p, stage, path)
+		}
+		return
+	}
+
+	forgetPaths(p, s)
+	s.paths = append([]string(nil), paths...)
+	s.update = true
+	for _, path := range paths {
+		p.shadersByPath[path] = append(p.shadersByPath[path], s)
+	}
+	p.update = true
+}
+
+// removeStage detaches and deletes the shader of a stage.
+func removeStage(p *program, stage uint32) {
+	s := p.shaderByStage[stage]
+	if s == nil {
+		return
+	}
+	forgetPaths(p, s)
+	gl.DetachShader(uint32(p.id), uint32(s.id))
+	s.id.Delete()
+	delete(p.shaderByStage, stage)
+	p.update = true
+}
+
+// forgetPaths removes a shader from the shaders of its paths.
+func forgetPaths(p *program, s *shader) {
+	for _, old := range s.paths {
+		ss := p.shadersByPath[old]
+		for i := range ss {
+			if ss[i] == s {
+				ss = append(ss[:i], ss[i+1:]...)
+				break
+			}
+		}
+		if len(ss) == 0 {
+			delete(p.shadersByPath, old)
+		} else {
+			p.shadersByPath[old] = ss
+		}
+	}
+}
+
 func pathChanged(p *program, path string) error {
 	var ss []*shader
 	var ok bool
@@ -148,3 +439,12 @@ func pathChanged(p *program, path string) error {
 
 	return nil
 }
+
+// patchVertices returns n if the program has a tessellation evaluation stage,
+// which must be fed patches, or 0.
+func patchVertices(p *program, n int32) int32 {
+	if _, ok := p.shaderByStage[gl.TESS_EVALUATION_SHADER]; ok {
+		return n
+	}
+	return 0
+}
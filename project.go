@@ -0,0 +1,485 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/alotabits/shaderdev/internal/toml"
+	"gopkg.in/fsnotify.v1"
+)
+
+var projectPath = flag.String("project", "shaderdev.toml", "project file describing the shaders, model, textures, uniforms and window, versioned with the shaders; flags on the command line take precedence, and a missing shaderdev.toml is ignored")
+
+// project is a setup read from a project file, with paths relative to it:
+//
+//	textures = ["albedo.png"]  # bound to units 0, 1 and so on, or to the
+//	                           # sampler named as in "albedo:wood.png";
+//	                           # videos as "video:clip.mp4", decoded by ffmpeg,
+//	                           # and image sequences as a directory or
+//	                           # pattern, "walk/%04d.png@12" at 12 fps
+//
+//	[mipmaps]   # modes of -mipmaps by texture, or false for off
+//	"noise.png" = false
+//
+//	# -cull and -front-face by object or object/group of the model, as
+//	# -hide names them, the most specific name applying
+//	[cull]
+//	"sail" = false
+//	[front-face]
+//	"hull/inside" = "cw"
+//
+//	[shaders]   # files of each stage, as given by vs:, fs: and so on
+//	vs = "vert.glsl"
+//	fs = ["common.glsl", "frag.glsl"]
+//
+//	[builtins]  # the tool's own shaders replaced, as with -builtin
+//	background = "sky.glsl"
+//
+//	[defines]   # inserted after the #version line of every shader
+//	OCTAVES = 5
+//
+//	[window]
+//	width = 1280
+//	height = 720
+//	title = "Terrain"
+//
+//	[flags]     # as in the defaults file, e.g. model = "terrain.obj"
+//	[uniforms]
+//	[keys]
+//
+// Its flags, uniforms and keys take precedence over the user's defaults.
+// Changes are applied live when the file changes, but for the flags only
+// read at startup, e.g. of the window and context, which apply on restart.
+type project struct {
+	*defaults
+	// shader specifications, as on the command line
+	shaders  []string
+	textures []textureSpec
+	// the -mipmaps modes of textures by path, for those given one
+	mipmaps map[string]string
+	defines map[string]string
+	// culling and winding by object or object/group of the model
+	faces map[string]faceSettings
+
+	width, height int
+	title         string
+}
+
+// loadProject reads a project file, or returns nil if path is the default
+// and there is none.
+func loadProject(path string) (*project, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && path == flag.Lookup("project").DefValue {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	doc, err := toml.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return decodeProject(doc, path)
+}
+
+func decodeProject(doc map[string]interface{}, path string) (*project, error) {
+	d, err := decodeDefaults(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	p := &project{defaults: d}
+	dir := filepath.Dir(path)
+
+	// paths in flags are relative to the project too
+	for name, vals := range p.flags {
+		prefix, ok := pathFlags[name]
+		if !ok && name != "I" {
+			continue
+		}
+		for i, v := range vals {
+			if strings.HasPrefix(v, prefix) && v != prefix {
+				vals[i] = prefix + projectFile(dir, v[len(prefix):])
+			}
+		}
+	}
+
+	shaders, _ := doc["shaders"].(map[string]interface{})
+	prefixes := make([]string, 0, len(shaders))
+	for prefix := range shaders {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		if _, ok := shaPrefixToStage[prefix]; !ok {
+			return nil, fmt.Errorf("%v: unknown shader stage %v, expected vs, tcs, tes, gs or fs", path, prefix)
+		}
+		files, ok := stringOrList(shaders[prefix])
+		if !ok {
+			return nil, fmt.Errorf("%v: shaders %v: expected a path or paths", path, prefix)
+		}
+		for _, f := range files {
+			p.shaders = append(p.shaders, prefix+":"+projectFile(dir, f))
+		}
+	}
+
+	builtins, _ := doc["builtins"].(map[string]interface{})
+	for name, v := range builtins {
+		f, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v: builtin %v: expected a path, have %v", path, name, v)
+		}
+		p.flags["builtin"] = append(p.flags["builtin"], name+"="+projectFile(dir, f))
+	}
+	// in a stable order, for the errors of parseBuiltinSpecs
+	sort.Strings(p.flags["builtin"])
+
+	if v, ok := doc["textures"]; ok {
+		files, ok := stringOrList(v)
+		if !ok {
+			return nil, fmt.Errorf("%v: textures: expected a path or paths", path)
+		}
+		for _, f := range files {
+			t := parseTextureSpec(f)
+			t.path = projectFile(dir, t.path)
+			p.textures = append(p.textures, t)
+		}
+	}
+
+	p.mipmaps = make(map[string]string)
+	mipmaps, _ := doc["mipmaps"].(map[string]interface{})
+	for f, v := range mipmaps {
+		var mode string
+		switch v := v.(type) {
+		case string:
+			mode = v
+		case bool:
+			mode = "off"
+			if v {
+				mode = "gl"
+			}
+		}
+		if err := checkMipmaps(mode); err != nil {
+			return nil, fmt.Errorf("%v: mipmaps %v: %v", path, f, err)
+		}
+		p.mipmaps[projectFile(dir, f)] = mode
+	}
+
+	p.defines = make(map[string]string)
+	defines, _ := doc["defines"].(map[string]interface{})
+	for name, v := range defines {
+		switch v := v.(type) {
+		case string:
+			p.defines[name] = v
+		case int64, float64:
+			p.defines[name] = fmt.Sprint(v)
+		case bool:
+			p.defines[name] = "0"
+			if v {
+				p.defines[name] = "1"
+			}
+		default:
+			return nil, fmt.Errorf("%v: define %v: expected a string, number or boolean, have %v", path, name, v)
+		}
+	}
+
+	p.faces = make(map[string]faceSettings)
+	cull, _ := doc["cull"].(map[string]interface{})
+	for name, v := range cull {
+		c, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%v: cull %v: expected a boolean, have %v", path, name, v)
+		}
+		f := p.faces[name]
+		f.setCull, f.cull = true, c
+		p.faces[name] = f
+	}
+	winding, _ := doc["front-face"].(map[string]interface{})
+	for name, v := range winding {
+		s, _ := v.(string)
+		w, err := parseFrontFace(s)
+		if err != nil {
+			return nil, fmt.Errorf("%v: front-face %v: %v", path, name, err)
+		}
+		f := p.faces[name]
+		f.frontFace = w
+		p.faces[name] = f
+	}
+
+	window, _ := doc["window"].(map[string]interface{})
+	width, _ := window["width"].(int64)
+	height, _ := window["height"].(int64)
+	if width < 0 || height < 0 {
+		return nil, fmt.Errorf("%v: window size %vx%v", path, width, height)
+	}
+	p.width, p.height = int(width), int(height)
+	p.title, _ = window["title"].(string)
+
+	return p, nil
+}
+
+// projectFile resolves a path of a project in dir, the project's directory.
+func projectFile(dir, path string) string {
+	if isURL(path) || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, filepath.FromSlash(path))
+}
+
+// stringOrList reads a string or an array of strings.
+func stringOrList(v interface{}) ([]string, bool) {
+	if s, ok := v.(string); ok {
+		return []string{s}, true
+	}
+	return stringList(v)
+}
+
+// mergeDefaults returns the user's defaults with the uniforms and keys of a
+// project, if any, in place of theirs, and the uniforms given with -uniform
+// in place of both.
+func mergeDefaults(user *defaults, p *project) *defaults {
+	d := newDefaults(user.path)
+	d.flags = user.flags
+	for name, v := range user.uniforms {
+		d.uniforms[name] = v
+	}
+	for k, v := range user.keys {
+		d.keys[k] = v
+	}
+	for c, m := range user.midi {
+		d.midi[c] = m
+	}
+	if p != nil {
+		for name, v := range p.uniforms {
+			d.uniforms[name] = v
+		}
+		for k, v := range p.keys {
+			d.keys[k] = v
+		}
+		for c, m := range p.midi {
+			d.midi[c] = m
+		}
+	}
+	for name, v := range uniformOverrides {
+		d.uniforms[name] = v
+	}
+	return d
+}
+
+// projectDefines returns the #define lines of a project, if any.
+func projectDefines(p *project) string {
+	if p == nil {
+		return ""
+	}
+	names := make([]string, 0, len(p.defines))
+	for name := range p.defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "#define %v %v\n", name, p.defines[name])
+	}
+	return b.String()
+}
+
+// projectStages returns the resolved files of each stage of a project.
+func projectStages(p *project) (map[uint32][]string, error) {
+	res := make(map[uint32][]string)
+	for _, spec := range p.shaders {
+		stage, path, err := parseShaderSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		path, err = resolvePath(path, "")
+		if err != nil {
+			return nil, err
+		}
+		res[stage] = append(res[stage], path)
+	}
+	return res, nil
+}
+
+// reloadProjectShaders points the stages of a program at the files a
+// project now gives them, removing the stages it no longer has.
+func reloadProjectShaders(old, p *project, prog *program, w *fsnotify.Watcher) error {
+	before, err := projectStages(old)
+	if err != nil {
+		return err
+	}
+	after, err := projectStages(p)
+	if err != nil {
+		return err
+	}
+
+	for stage, paths := range after {
+		if reflect.DeepEqual(paths, before[stage]) {
+			continue
+		}
+		for _, path := range paths {
+			err := w.Add(filepath.Dir(path))
+			if err != nil {
+				return err
+			}
+		}
+		setStagePaths(prog, stage, paths)
+		log.Printf("%v shader: %v", gx.StageStr(stage), strings.Join(paths, ", "))
+	}
+	for stage := range before {
+		if _, ok := after[stage]; !ok {
+			removeStage(prog, stage)
+			log.Printf("%v shader removed", gx.StageStr(stage))
+		}
+	}
+	return nil
+}
+
+// reloadProjectBuiltins replaces the tool's shaders as a project now gives,
+// restoring those it no longer replaces.
+func reloadProjectBuiltins(old, p *project, w *fsnotify.Watcher) error {
+	paths := func(p *project) map[string]string {
+		res := make(map[string]string)
+		for _, spec := range p.flags["builtin"] {
+			i := strings.Index(spec, "=")
+			res[spec[:i]] = spec[i+1:]
+		}
+		return res
+	}
+	before, after := paths(old), paths(p)
+
+	var errs []string
+	for _, name := range builtinNames {
+		if before[name] == after[name] {
+			continue
+		}
+		path := after[name]
+		if path != "" {
+			var err error
+			path, err = resolvePath(path, "")
+			if err == nil {
+				err = w.Add(filepath.Dir(path))
+			}
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+		}
+		err := setBuiltinPath(name, path)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// textureMipmaps returns the -mipmaps mode of a texture of a project.
+func textureMipmaps(p *project, path string) string {
+	if mode, ok := p.mipmaps[path]; ok {
+		return mode
+	}
+	return *mipmapsFlag
+}
+
+// reloadProjectTextures loads the textures a project now gives in place of
+// its old ones, the first of textures, reusing those it still has with the
+// same mipmaps and frame rate.
+func reloadProjectTextures(old, p *project, textures []textureInput, w *fsnotify.Watcher) ([]textureInput, error) {
+	// by kind and path, as a video and an image of it differ
+	kept := make(map[string]textureInput)
+	for _, t := range textures[:len(old.textures)] {
+		kept[t.kind+":"+t.path] = t
+	}
+
+	var res []textureInput
+	for _, spec := range p.textures {
+		mipmaps := textureMipmaps(p, spec.path)
+		resolved, err := resolveTextureSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		path := resolved.path
+		key := spec.kind + ":" + path
+		t, ok := kept[key]
+		t.name = spec.name
+		if ok && (t.mipmaps != mipmaps || t.fps != spec.fps) {
+			t.mipmaps, t.fps = mipmaps, spec.fps
+			err = reloadTextureInput(&t)
+			if err != nil {
+				return nil, err
+			}
+			logTextureInput(len(res), t)
+		}
+		if !ok {
+			t, err = openTextureInput(resolved, mipmaps)
+			if err != nil {
+				return nil, err
+			}
+			err = w.Add(filepath.Dir(path))
+			if err != nil {
+				return nil, err
+			}
+			logTextureInput(len(res), t)
+		}
+		delete(kept, key)
+		res = append(res, t)
+	}
+	for _, t := range kept {
+		closeTextureInput(&t)
+	}
+	return append(res, textures[len(old.textures):]...), nil
+}
+
+// changedProjectFlags returns the flags other than the built-in
+// replacements, which reload on their own, that differ between two versions
+// of a project, sorted.
+func changedProjectFlags(old, p *project) []string {
+	var names []string
+	for name, v := range p.flags {
+		if name != "builtin" && !reflect.DeepEqual(v, old.flags[name]) {
+			names = append(names, name)
+		}
+	}
+	for name := range old.flags {
+		if _, ok := p.flags[name]; !ok && name != "builtin" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setProjectFlag sets a flag to the values a project now gives it, or back
+// to the user's defaults, or its own, when the project no longer does.
+func setProjectFlag(name string, p *project, user *defaults) error {
+	f := flag.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("%v: unknown flag %v", p.path, name)
+	}
+	vals, ok := p.flags[name]
+	if !ok {
+		vals, ok = user.flags[name]
+	}
+	if l, isList := f.Value.(*listFlag); isList {
+		*l = nil
+	} else if !ok {
+		vals = []string{f.DefValue}
+	}
+	for _, v := range vals {
+		err := f.Value.Set(v)
+		if err != nil {
+			return fmt.Errorf("%v: flag %v: %v", p.path, name, err)
+		}
+	}
+	return nil
+}
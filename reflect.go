@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+	"github.com/go-gl/glfw/v3.1/glfw"
+)
+
+type reflectVar struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	ArraySize int32  `json:"arraySize"`
+	Location  int32  `json:"location"`
+}
+
+type reflectMember struct {
+	Name                string `json:"name"`
+	Type                string `json:"type"`
+	ArraySize           int32  `json:"arraySize"`
+	Offset              int32  `json:"offset"`
+	ArrayStride         int32  `json:"arrayStride"`
+	MatrixStride        int32  `json:"matrixStride"`
+	RowMajor            bool   `json:"rowMajor"`
+	TopLevelArraySize   int32  `json:"topLevelArraySize,omitempty"`
+	TopLevelArrayStride int32  `json:"topLevelArrayStride,omitempty"`
+}
+
+type reflectBlock struct {
+	Name     string          `json:"name"`
+	Binding  int32           `json:"binding"`
+	DataSize int32           `json:"dataSize"`
+	Members  []reflectMember `json:"members"`
+}
+
+type reflection struct {
+	Inputs        []reflectVar   `json:"inputs"`
+	Outputs       []reflectVar   `json:"outputs"`
+	Uniforms      []reflectVar   `json:"uniforms"`
+	UniformBlocks []reflectBlock `json:"uniformBlocks"`
+	StorageBlocks []reflectBlock `json:"storageBlocks"`
+}
+
+func reflectVars(prog uint32, iface uint32) []reflectVar {
+	props := []uint32{gl.TYPE, gl.ARRAY_SIZE, gl.LOCATION}
+	if iface == gl.UNIFORM {
+		props = append(props, gl.BLOCK_INDEX)
+	}
+
+	vars := []reflectVar{}
+	n := gx.NumProgramResources(prog, iface)
+	for i := 0; i < n; i++ {
+		params := gx.ProgramResource(prog, iface, uint32(i), props)
+		// Block members are reported with their block
+		if iface == gl.UNIFORM && params[3] != -1 {
+			continue
+		}
+		vars = append(vars, reflectVar{
+			Name:      gx.ProgramResourceName(prog, iface, uint32(i)),
+			Type:      gx.TypeStr(uint32(params[0])),
+			ArraySize: params[1],
+			Location:  params[2],
+		})
+	}
+
+	return vars
+}
+
+func reflectBlocks(prog uint32, iface uint32, memberIface uint32) []reflectBlock {
+	props := []uint32{gl.BUFFER_BINDING, gl.BUFFER_DATA_SIZE}
+	memberProps := []uint32{gl.TYPE, gl.ARRAY_SIZE, gl.OFFSET, gl.ARRAY_STRIDE, gl.MATRIX_STRIDE, gl.IS_ROW_MAJOR}
+	if memberIface == gl.BUFFER_VARIABLE {
+		memberProps = append(memberProps, gl.TOP_LEVEL_ARRAY_SIZE, gl.TOP_LEVEL_ARRAY_STRIDE)
+	}
+
+	blocks := []reflectBlock{}
+	n := gx.NumProgramResources(prog, iface)
+	for i := 0; i < n; i++ {
+		params := gx.ProgramResource(prog, iface, uint32(i), props)
+		b := reflectBlock{
+			Name:     gx.ProgramResourceName(prog, iface, uint32(i)),
+			Binding:  params[0],
+			DataSize: params[1],
+			Members:  []reflectMember{},
+		}
+
+		for _, m := range gx.ProgramResourceVariables(prog, iface, uint32(i)) {
+			mp := gx.ProgramResource(prog, memberIface, m, memberProps)
+			member := reflectMember{
+				Name:         gx.ProgramResourceName(prog, memberIface, m),
+				Type:         gx.TypeStr(uint32(mp[0])),
+				ArraySize:    mp[1],
+				Offset:       mp[2],
+				ArrayStride:  mp[3],
+				MatrixStride: mp[4],
+				RowMajor:     mp[5] != 0,
+			}
+			if memberIface == gl.BUFFER_VARIABLE {
+				member.TopLevelArraySize = mp[6]
+				member.TopLevelArrayStride = mp[7]
+			}
+			b.Members = append(b.Members, member)
+		}
+
+		blocks = append(blocks, b)
+	}
+
+	return blocks
+}
+
+func reflectProgram(prog uint32) *reflection {
+	return &reflection{
+		Inputs:        reflectVars(prog, gl.PROGRAM_INPUT),
+		Outputs:       reflectVars(prog, gl.PROGRAM_OUTPUT),
+		Uniforms:      reflectVars(prog, gl.UNIFORM),
+		UniformBlocks: reflectBlocks(prog, gl.UNIFORM_BLOCK, gl.UNIFORM),
+		StorageBlocks: reflectBlocks(prog, gl.SHADER_STORAGE_BLOCK, gl.BUFFER_VARIABLE),
+	}
+}
+
+// reflectMain links the shaders given as "prefix:path" arguments and writes a
+// JSON description of the program interface to stdout.
+// Program interface queries require a 4.3 context.
+func reflectMain(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("reflect requires at least one shader specification")
+	}
+
+	err := glfw.Init()
+	if err != nil {
+		return err
+	}
+	defer glfw.Terminate()
+
+	window, err := createWindow(4, 3, false)
+	if err != nil {
+		return err
+	}
+	defer window.Destroy()
+
+	prog := newProgram()
+	for _, arg := range args {
+		stage, path, err := parseShaderSpec(arg)
+		if err != nil {
+			return err
+		}
+		addPath(prog, stage, path)
+	}
+
+	err = updateProgram(prog)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(reflectProgram(uint32(prog.id)))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+var stdinFlag = flag.Bool("stdin", false, "read commands from standard input while running, one per line, e.g. set roughness 0.7; see replCommands")
+
+// replCommands are the commands read from standard input, answered on
+// standard output between frames.
+var replCommands = []struct{ usage, help string }{
+	{"set NAME V[,V...]", "sets a uniform as -uniform does, until it is set again"},
+	{"get NAME", "prints the values of an active uniform as last drawn"},
+	{"uniforms", "lists the uniforms that can be set"},
+	{"pause", "stops the clock"},
+	{"resume", "restarts the clock"},
+	{"seek SECONDS", "moves the clock to a time"},
+	{"speed FACTOR", "sets how fast the clock runs"},
+	{"reset", "returns the clock to its start"},
+	{"timings", "prints the GPU time of each pass, in milliseconds"},
+	{"objects", "lists the programs, shaders, textures, buffers and vertex arrays not yet deleted, to find leaks"},
+	{"screenshot [PATH]", "writes the next frame to PATH, by default named after the time"},
+	{"quit", "closes the window"},
+	{"help", "lists the commands"},
+}
+
+// readCommands sends the lines of r split into words, skipping blank lines
+// and # comments, and closes the channel at the end of r.
+func readCommands(r io.Reader) <-chan []string {
+	c := make(chan []string)
+	go func() {
+		defer close(c)
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			line := s.Text()
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = line[:i]
+			}
+			if args := strings.Fields(line); len(args) > 0 {
+				c <- args
+			}
+		}
+		if err := s.Err(); err != nil {
+			log.Println("stdin:", err)
+		}
+	}()
+	return c
+}
+
+// replHelp returns the usage of every command.
+func replHelp() string {
+	var b strings.Builder
+	for _, c := range replCommands {
+		fmt.Fprintf(&b, "%-20v %v\n", c.usage, c.help)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// setCommand reads the arguments of set, values separated by commas or
+// spaces.
+func setCommand(args []string) (string, []float64, error) {
+	if len(args) < 2 {
+		return "", nil, fmt.Errorf("usage: set NAME V[,V...]")
+	}
+	if semanticUniforms[args[0]] {
+		return "", nil, fmt.Errorf("%v is set by the tool", args[0])
+	}
+	vals, err := parseUniformValues(strings.Join(args[1:], ","))
+	if err != nil {
+		return "", nil, err
+	}
+	return args[0], vals, nil
+}
+
+// formatValues prints values as they would be given to set.
+func formatValues(vals []float64) string {
+	s := make([]string, len(vals))
+	for i, v := range vals {
+		s[i] = fmt.Sprint(v)
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alotabits/shaderdev/internal/gltf"
+	"github.com/go-gl/gl/all-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Rigged models, loaded from glTF, are posed every frame by the selected
+// animation at the current time.
+//
+// Skinned ones supply joints and weights attributes indexing the
+// jointMatrices uniform, a mat4 array. Other models supply joint 0 with
+// weight 1 and an identity jointMatrices[0], so skinning shaders draw them
+// as they are.
+//
+// Morph targets are supplied as the attributes morphPosition0 and
+// morphNormal0, morphPosition1 and so on, displacing the vertices by the
+// weights in the morphWeights float array, which -morph overrides.
+
+// maxMorphTargets is the number of morph targets supplied as attributes,
+// as glTF requires of renderers.
+const maxMorphTargets = 8
+
+type rig struct {
+	doc     *gltf.Doc
+	palette []gltf.Joint
+	// names of the morph targets, and the node whose weights blend them
+	targets   []string
+	morphNode int
+	clips     []*gltf.Clip
+	// index of the clip played, or -1 for the rest pose
+	clip int
+	// maps the model's vertices to where normalizeModel moved them
+	fix mgl32.Mat4
+	// whether the palette was logged as not fitting jointMatrices
+	truncated bool
+}
+
+// morphOverrides are the weights given with -morph, by target name or
+// index.
+var morphOverrides = make(map[string]float32)
+
+// parseMorphSpecs reads the NAME=WEIGHT values of -morph into
+// morphOverrides.
+func parseMorphSpecs(specs []string) error {
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, "=")
+		if i < 0 {
+			return fmt.Errorf("invalid -morph %v, expected NAME=WEIGHT", spec)
+		}
+		w, err := strconv.ParseFloat(spec[i+1:], 32)
+		if err != nil {
+			return fmt.Errorf("invalid -morph %v: %v", spec, err)
+		}
+		morphOverrides[spec[:i]] = float32(w)
+	}
+	return nil
+}
+
+// loadGLTF loads the meshes of the default scene of a .gltf or .glb file.
+func loadGLTF(file string) (*model, error) {
+	d, err := gltf.Load(file)
+	if err != nil {
+		return nil, err
+	}
+	g, err := d.Geometry()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", file, err)
+	}
+	for _, w := range g.Warnings {
+		log.Printf("%v: %v", file, w)
+	}
+
+	var m model
+	// glTF is in meters
+	m.scale = 1
+	m.files = d.Files
+	for i, p := range g.Pos {
+		m.pos = append(m.pos, [4]float32{p[0], p[1], p[2], 1})
+		m.nor = append(m.nor, g.Nor[i])
+	}
+	for _, t := range g.Tex {
+		m.tex = append(m.tex, [3]float32{t[0], t[1], 0})
+	}
+	m.col = g.Col
+	m.idx = g.Idx
+	for _, p := range g.Parts {
+		m.parts = append(m.parts, part{name: p.Name, first: int32(p.First), count: int32(p.Count)})
+	}
+	m.solo = -1
+
+	if g.Palette != nil || g.Targets != nil {
+		r := &rig{doc: d, palette: g.Palette, morphNode: g.MorphNode, clip: -1, fix: mgl32.Ident4()}
+		for i := range d.Animations {
+			c, err := d.Clip(i)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", file, err)
+			}
+			r.clips = append(r.clips, c)
+		}
+		if len(r.clips) > 0 {
+			r.clip = 0
+		}
+		if len(g.Targets) > maxMorphTargets {
+			log.Printf("%v: %v morph targets, only the first %v are supplied", file, len(g.Targets), maxMorphTargets)
+			g.Targets = g.Targets[:maxMorphTargets]
+		}
+		for _, t := range g.Targets {
+			r.targets = append(r.targets, t.Name)
+		}
+		m.joints, m.weights, m.targets, m.rig = g.Joints, g.Weights, g.Targets, r
+		log.Printf("%v: %v joints, %v morph targets, %v animations", file, len(g.Palette)-1, len(g.Targets), len(r.clips))
+	}
+
+	modelBounds(&m)
+	return &m, nil
+}
+
+// modelBounds sets the bounds of a model from its positions, as posed at
+// rest if skinned.
+func modelBounds(m *model) {
+	pos := make([][3]float32, len(m.pos))
+	var mats []mgl32.Mat4
+	if m.rig != nil {
+		mats = jointMatrices(m.rig, rigPose(m.rig, nil))
+	}
+	for i, p := range m.pos {
+		v := mgl32.Vec4(p)
+		if m.joints != nil {
+			var s mgl32.Vec4
+			for k := 0; k < 4; k++ {
+				s = s.Add(mats[m.joints[i][k]].Mul4x1(v).Mul(m.weights[i][k]))
+			}
+			v = s
+		}
+		pos[i] = [3]float32{v[0], v[1], v[2]}
+	}
+
+	if len(pos) == 0 {
+		return
+	}
+	m.min, m.max = pos[0], pos[0]
+	for _, p := range pos[1:] {
+		for i := 0; i < 3; i++ {
+			m.min[i] = float32(math.Min(float64(m.min[i]), float64(p[i])))
+			m.max[i] = float32(math.Max(float64(m.max[i]), float64(p[i])))
+		}
+	}
+	for i := range m.center {
+		m.center[i] = (m.min[i] + m.max[i]) / 2
+	}
+	var r2 float64
+	for _, p := range pos {
+		dx, dy, dz := float64(p[0]-m.center[0]), float64(p[1]-m.center[1]), float64(p[2]-m.center[2])
+		r2 = math.Max(r2, dx*dx+dy*dy+dz*dz)
+	}
+	m.radius = float32(math.Sqrt(r2))
+}
+
+// clipName names the clip a rig plays.
+func clipName(r *rig) string {
+	if r.clip < 0 {
+		return "rest pose"
+	}
+	return r.clips[r.clip].Name
+}
+
+// selectAnimation plays the animation named by spec, its name or index, or
+// the rest pose for "rest".
+func selectAnimation(r *rig, spec string) error {
+	if spec == "rest" {
+		r.clip = -1
+		return nil
+	}
+	for i, c := range r.clips {
+		if c.Name == spec {
+			r.clip = i
+			return nil
+		}
+	}
+	i, err := strconv.Atoi(spec)
+	if err != nil || i < 0 || i >= len(r.clips) {
+		return fmt.Errorf("no animation %v among the model's %v", spec, len(r.clips))
+	}
+	r.clip = i
+	return nil
+}
+
+// cycleAnimation plays the next animation, then the rest pose.
+func cycleAnimation(r *rig) {
+	r.clip++
+	if r.clip == len(r.clips) {
+		r.clip = -1
+	}
+}
+
+// rigPose returns the pose of a rig at elapsed, looping the clip played,
+// or at rest for nil.
+func rigPose(r *rig, elapsed *time.Duration) []gltf.Transform {
+	pose := r.doc.RestPose()
+	if r.clip >= 0 && elapsed != nil {
+		c := r.clips[r.clip]
+		t := float32(elapsed.Seconds())
+		if c.Duration > 0 {
+			t = float32(math.Mod(float64(t), float64(c.Duration)))
+			if t < 0 {
+				t += c.Duration
+			}
+		}
+		c.Apply(pose, t)
+	}
+	return pose
+}
+
+// jointMatrices returns the palette of a rig in a pose, or nil if it has no
+// skin.
+func jointMatrices(r *rig, pose []gltf.Transform) []mgl32.Mat4 {
+	if r.palette == nil {
+		return nil
+	}
+	globals := r.doc.Globals(pose)
+	res := make([]mgl32.Mat4, len(r.palette))
+	inv := r.fix.Inv()
+	for i, j := range r.palette {
+		m := mgl32.Ident4()
+		if j.Node >= 0 {
+			m = globals[j.Node].Mul4(j.InverseBind)
+		}
+		res[i] = r.fix.Mul4(m).Mul4(inv)
+	}
+	return res
+}
+
+// morphWeights returns the weights of the morph targets of a rig in a pose,
+// as overridden by -morph.
+func morphWeights(r *rig, pose []gltf.Transform) []float32 {
+	res := make([]float32, len(r.targets))
+	if r.morphNode >= 0 {
+		copy(res, pose[r.morphNode].Weights)
+	}
+	for i, name := range r.targets {
+		if w, ok := morphOverrides[strconv.Itoa(i)]; ok {
+			res[i] = w
+		}
+		if w, ok := morphOverrides[name]; ok && name != "" {
+			res[i] = w
+		}
+	}
+	return res
+}
+
+// arrayUniform returns the location and length of an array uniform of a
+// program, or -1 if it has none.
+func arrayUniform(p *program, name string) (int32, int32) {
+	if u, ok := p.active[name]; ok {
+		return u.Location, u.Size
+	}
+	return -1, 0
+}
+
+// setRigUniforms uploads the model's pose at elapsed to the program's
+// jointMatrices and morphWeights, which must be in use.
+func setRigUniforms(p *program, m *model, elapsed time.Duration) {
+	if p.jointMatricesLoc < 0 && p.morphWeightsLoc < 0 {
+		return
+	}
+	var pose []gltf.Transform
+	if m.rig != nil {
+		pose = rigPose(m.rig, &elapsed)
+	}
+
+	if p.jointMatricesLoc >= 0 {
+		mats := []mgl32.Mat4{mgl32.Ident4()}
+		if m.rig != nil && m.rig.palette != nil {
+			mats = jointMatrices(m.rig, pose)
+		}
+		if n := int(p.jointMatricesSize); len(mats) > n {
+			if !m.rig.truncated {
+				log.Printf("jointMatrices holds %v matrices, the model has %v; the rest are left out", n, len(mats))
+				m.rig.truncated = true
+			}
+			mats = mats[:n]
+		}
+		gl.UniformMatrix4fv(p.jointMatricesLoc, int32(len(mats)), false, &mats[0][0])
+	}
+
+	if p.morphWeightsLoc >= 0 && m.rig != nil && len(m.rig.targets) > 0 {
+		w := morphWeights(m.rig, pose)
+		if n := int(p.morphWeightsSize); len(w) > n {
+			w = w[:n]
+		}
+		gl.Uniform1fv(p.morphWeightsLoc, int32(len(w)), &w[0])
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/alotabits/shaderdev/internal/rng"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// rngInput is a procedural texture regenerated from the seed and frame
+// index, bound to the sampler uniform of the same name, so stochastic
+// shaders see the same inputs for a frame whether live or exported.
+type rngInput struct {
+	name string
+	// white for RGBA8 noise, or halton for RGBA32F rows of 4D samples
+	kind   string
+	width  int32
+	height int32
+	// regenerated every this many frames
+	every int32
+
+	tex   uint32
+	frame int32
+}
+
+// parseRNGInput parses NAME=KIND[:WxH[:EVERY]], e.g. noise=white:256x256 or
+// samples=halton:64x1:4.
+func parseRNGInput(spec string) (*rngInput, error) {
+	eq := strings.Index(spec, "=")
+	if eq <= 0 {
+		return nil, fmt.Errorf("invalid rng input %v, expected NAME=KIND[:WxH[:EVERY]]", spec)
+	}
+
+	in := &rngInput{name: spec[:eq], width: 256, height: 256, every: 1, frame: -1}
+	parts := strings.Split(spec[eq+1:], ":")
+	in.kind = parts[0]
+	if in.kind != "white" && in.kind != "halton" {
+		return nil, fmt.Errorf("%v: unknown kind %v, expected white or halton", spec, in.kind)
+	}
+	if in.kind == "halton" {
+		in.width, in.height = 64, 1
+	}
+	if len(parts) > 1 {
+		var err error
+		in.width, in.height, err = parseResolution(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", spec, err)
+		}
+	}
+	if len(parts) > 2 {
+		n, err := strconv.Atoi(parts[2])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%v: invalid frame interval %v", spec, parts[2])
+		}
+		in.every = int32(n)
+	}
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid rng input %v, expected NAME=KIND[:WxH[:EVERY]]", spec)
+	}
+	return in, nil
+}
+
+// updateRNGInput regenerates the texture if the frame starts a new interval.
+func updateRNGInput(in *rngInput, seed uint32, frame int32) {
+	key := frame / in.every
+	if in.tex != 0 && key == in.frame {
+		return
+	}
+	in.frame = key
+
+	src := rng.FrameSource(seed, int64(key), in.name)
+	if in.tex != 0 {
+		gl.DeleteTextures(1, &in.tex)
+	}
+	switch in.kind {
+	case "white":
+		pix := rng.White(int(in.width), int(in.height), src)
+		in.tex = gx.CreateTexture2D(gl.RGBA8, in.width, in.height, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pix))
+	case "halton":
+		pix := rng.Halton(int(in.width*in.height), src)
+		in.tex = gx.CreateTexture2D(gl.RGBA32F, in.width, in.height, gl.RGBA, gl.FLOAT, gl.Ptr(pix))
+	}
+	gx.Label(gl.TEXTURE, in.tex, "rng "+in.name)
+	// exact texels, for indexing samples with texelFetch
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// bindRNGInputs binds each input to the unit of its sampler, if the program
+// has one.
+func bindRNGInputs(p *program, inputs []*rngInput) {
+	for _, s := range p.samplers {
+		for _, in := range inputs {
+			if s.name == in.name {
+				gx.ActiveTexture(s.unit)
+				gl.BindTexture(gl.TEXTURE_2D, in.tex)
+			}
+		}
+	}
+	gx.ActiveTexture(0)
+}
+
+func unbindRNGInputs(p *program, inputs []*rngInput) {
+	for _, s := range p.samplers {
+		for _, in := range inputs {
+			if s.name == in.name {
+				gx.ActiveTexture(s.unit)
+				gl.BindTexture(gl.TEXTURE_2D, 0)
+			}
+		}
+	}
+	gx.ActiveTexture(0)
+}
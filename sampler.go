@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// samplerUnit records the texture units assigned to an active sampler uniform.
+// Sampler arrays occupy size consecutive units starting at unit.
+type samplerUnit struct {
+	name     string
+	xtype    uint32
+	location int32
+	size     int32
+	unit     uint32
+}
+
+// assignSamplers enumerates the sampler uniforms of a linked program and
+// assigns texture units in order of name, so that units only change when
+// samplers are added or removed, or the units of p.bindings when set.
+func assignSamplers(p *program) {
+	p.samplers = p.samplers[:0]
+	for _, u := range p.active {
+		target, _ := gx.SamplerTarget(u.Type)
+		if target == 0 || !gx.IsValidUniformLoc(u.Location) {
+			continue
+		}
+		p.samplers = append(p.samplers, samplerUnit{
+			name:     u.Name,
+			xtype:    u.Type,
+			location: u.Location,
+			size:     u.Size,
+		})
+	}
+
+	sort.Slice(p.samplers, func(i, j int) bool {
+		return p.samplers[i].name < p.samplers[j].name
+	})
+
+	p.id.Bind()
+	defer gl.UseProgram(0)
+
+	unit := uint32(0)
+	for i := range p.samplers {
+		s := &p.samplers[i]
+		if b, ok := p.bindings[strings.TrimSuffix(s.name, "[0]")]; ok {
+			unit = b
+		}
+		s.unit = unit
+		units := make([]int32, s.size)
+		for j := range units {
+			units[j] = int32(unit)
+			unit++
+		}
+		gl.Uniform1iv(s.location, s.size, &units[0])
+	}
+}
+
+// checkSamplers describes every sampler whose units have no texture bound to
+// the sampler's target, or a texture incompatible with the sampler, as the
+// inputs are bound for a draw. Material maps are left out, being bound by
+// part during the draw, and missing from materials without them.
+func checkSamplers(p *program) []string {
+	var maxUnits int32
+	gl.GetIntegerv(gl.MAX_COMBINED_TEXTURE_IMAGE_UNITS, &maxUnits)
+
+	var active int32
+	gl.GetIntegerv(gl.ACTIVE_TEXTURE, &active)
+	defer gl.ActiveTexture(uint32(active))
+
+	var res []string
+	for _, s := range p.samplers {
+		if materialSamplers[s.name] {
+			continue
+		}
+		target, binding := gx.SamplerTarget(s.xtype)
+		for i := uint32(0); i < uint32(s.size); i++ {
+			unit := s.unit + i
+			name := s.name
+			if s.size > 1 {
+				name = fmt.Sprintf("%v (element %v)", s.name, i)
+			}
+
+			if unit >= uint32(maxUnits) {
+				res = append(res, fmt.Sprintf("sampler %v: unit %v exceeds the %v available units", name, unit, maxUnits))
+				continue
+			}
+
+			gx.ActiveTexture(unit)
+			var tex int32
+			gl.GetIntegerv(binding, &tex)
+			if tex == 0 {
+				res = append(res, fmt.Sprintf("sampler %v %v: no texture bound to unit %v", gx.TypeStr(s.xtype), name, unit))
+				continue
+			}
+
+			if target == gl.TEXTURE_BUFFER || target == gl.TEXTURE_2D_MULTISAMPLE {
+				continue
+			}
+
+			var compare int32
+			gl.GetTexParameteriv(target, gl.TEXTURE_COMPARE_MODE, &compare)
+			shadow := gx.IsShadowSampler(s.xtype)
+			if shadow && compare == gl.NONE {
+				res = append(res, fmt.Sprintf("sampler %v %v: texture on unit %v has no compare mode set", gx.TypeStr(s.xtype), name, unit))
+			} else if !shadow && compare != gl.NONE {
+				res = append(res, fmt.Sprintf("sampler %v %v: texture on unit %v has a compare mode set, which is undefined for non-shadow samplers", gx.TypeStr(s.xtype), name, unit))
+			}
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+)
+
+var sequenceFPS = flag.Float64("sequence-fps", 24, "frames per second of image sequence texture inputs not given a rate with @FPS")
+var sequenceResident = flag.Int("sequence-resident", 64, "most frames of each image sequence kept loaded as textures, others being read from disk as they come up")
+
+// imageSequence is the images of a directory, in order of name, or those
+// numbered by a printf pattern like walk/%04d.png from 0 or 1 on, played
+// looped at a frame rate as a texture input. Frames are loaded as they are
+// shown, and those shown longest ago unloaded past -sequence-resident.
+type imageSequence struct {
+	paths   []string
+	fps     float64
+	mipmaps string
+	// the loaded frames by index, and their indices from least to most
+	// recently shown
+	texs map[int]gx.Texture
+	used []int
+	// the frame last shown, shown again in place of frames that fail to
+	// load, which are only tried once
+	last   gx.Texture
+	failed map[int]bool
+}
+
+// isSequence reports whether a texture input's path names an image
+// sequence.
+func isSequence(path string) bool {
+	if strings.Contains(path, "%") {
+		return true
+	}
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// sequencePaths lists the images of a sequence.
+func sequencePaths(path string) ([]string, error) {
+	var paths []string
+	if strings.Contains(path, "%") {
+		exists := func(i int) bool {
+			_, err := os.Stat(fmt.Sprintf(path, i))
+			return err == nil
+		}
+		i := 0
+		if !exists(i) {
+			i = 1
+		}
+		for ; exists(i); i++ {
+			paths = append(paths, fmt.Sprintf(path, i))
+		}
+	} else {
+		fis, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range fis {
+			if !fi.IsDir() && imageExts[strings.ToLower(filepath.Ext(fi.Name()))] {
+				paths = append(paths, filepath.Join(path, fi.Name()))
+			}
+		}
+		sort.Strings(paths)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%v: no images", path)
+	}
+	return paths, nil
+}
+
+// openSequence lists the images of a sequence and loads the first.
+func openSequence(path string, fps float64, mipmaps string) (*imageSequence, error) {
+	paths, err := sequencePaths(path)
+	if err != nil {
+		return nil, err
+	}
+	if fps <= 0 {
+		fps = *sequenceFPS
+	}
+	s := &imageSequence{
+		paths:   paths,
+		fps:     fps,
+		mipmaps: mipmaps,
+		texs:    make(map[int]gx.Texture),
+		failed:  make(map[int]bool),
+	}
+	tex, err := loadSequenceFrame(s, 0)
+	if err != nil {
+		return nil, err
+	}
+	s.last = tex
+	return s, nil
+}
+
+func closeSequence(s *imageSequence) {
+	for i, tex := range s.texs {
+		tex.Delete()
+		delete(s.texs, i)
+	}
+	s.used = nil
+}
+
+// loadSequenceFrame loads frame n, unloading the frames shown longest ago
+// beyond -sequence-resident.
+func loadSequenceFrame(s *imageSequence, n int) (gx.Texture, error) {
+	tex, err := loadTexture(s.paths[n], s.mipmaps)
+	if err != nil {
+		return 0, err
+	}
+	s.texs[n] = tex
+	s.used = append(s.used, n)
+	for len(s.used) > 1 && len(s.used) > *sequenceResident {
+		old := s.texs[s.used[0]]
+		old.Delete()
+		delete(s.texs, s.used[0])
+		s.used = s.used[1:]
+	}
+	return tex, nil
+}
+
+// sequenceFrameIndex returns the frame shown at time t, looping both ways,
+// as the clock can run backwards or start before zero.
+func sequenceFrameIndex(s *imageSequence, t time.Duration) int {
+	n := int(t.Seconds()*s.fps) % len(s.paths)
+	return (n + len(s.paths)) % len(s.paths)
+}
+
+// sequenceFrame returns the texture of the frame at time t, loading it if
+// it isn't, or the frame last shown and why if it can't be.
+func sequenceFrame(s *imageSequence, t time.Duration) (gx.Texture, error) {
+	n := sequenceFrameIndex(s, t)
+	if tex, ok := s.texs[n]; ok {
+		for i, m := range s.used {
+			if m == n {
+				s.used = append(append(s.used[:i:i], s.used[i+1:]...), n)
+				break
+			}
+		}
+		s.last = tex
+		return tex, nil
+	}
+	if s.failed[n] {
+		return s.last, nil
+	}
+	tex, err := loadSequenceFrame(s, n)
+	if err != nil {
+		s.failed[n] = true
+		return s.last, err
+	}
+	s.last = tex
+	return tex, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// shareMessage is a line of JSON sent by a sharing host to its viewers.
+// Shaders, uniforms and annotations are sent when they change, and the rest
+// every frame.
+// The only message viewers send is one with Annotate set, adding an
+// annotation.
+type shareMessage struct {
+	// sources by shader prefix, e.g. "fs"
+	Shaders     map[string]string    `json:"shaders,omitempty"`
+	Uniforms    map[string][]float64 `json:"uniforms,omitempty"`
+	Annotations []annotation         `json:"annotations,omitempty"`
+	Annotate    *annotation          `json:"annotate,omitempty"`
+
+	Camera  *shareCamera  `json:"camera,omitempty"`
+	Elapsed time.Duration `json:"elapsed"`
+	Frame   int32         `json:"frame"`
+}
+
+type shareCamera struct {
+	Eye           mgl32.Vec3 `json:"eye"`
+	Target        mgl32.Vec3 `json:"target"`
+	Fovy          float32    `json:"fovy"`
+	Near          float32    `json:"near"`
+	Far           float32    `json:"far"`
+	Aperture      float32    `json:"aperture"`
+	FocusDistance float32    `json:"focusDistance"`
+}
+
+func shareCameraOf(c *camera) *shareCamera {
+	return &shareCamera{c.eye, c.target, c.fovy, c.near, c.far, c.aperture, c.focusDistance}
+}
+
+func applyShareCamera(c *camera, s *shareCamera) {
+	c.eye, c.target, c.fovy, c.near, c.far = s.Eye, s.Target, s.Fovy, s.Near, s.Far
+	c.aperture, c.focusDistance = s.Aperture, s.FocusDistance
+}
+
+// shareHost sends its state to every viewer connected to its listener.
+// Viewers that fall behind miss frames rather than slowing the host.
+type shareHost struct {
+	mu      sync.Mutex
+	viewers map[chan []byte]bool
+	// the latest sources, uniforms and annotations, for viewers joining
+	// later
+	sources shareMessage
+
+	// annotations added by viewers
+	annotate chan annotation
+}
+
+func hostShare(addr string) (*shareHost, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("sharing on", ln.Addr())
+
+	h := &shareHost{viewers: make(map[chan []byte]bool), annotate: make(chan annotation, 16)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				log.Println("share:", err)
+				return
+			}
+			go serveViewer(h, conn)
+		}
+	}()
+	return h, nil
+}
+
+func serveViewer(h *shareHost, conn net.Conn) {
+	defer conn.Close()
+	log.Println("share: viewer joined from", conn.RemoteAddr())
+	journalEvent("access", fmt.Sprint("viewer joined from ", conn.RemoteAddr()), nil)
+
+	ch := make(chan []byte, 8)
+	h.mu.Lock()
+	b, err := json.Marshal(&h.sources)
+	h.viewers[ch] = true
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.viewers, ch)
+		h.mu.Unlock()
+		log.Println("share: viewer left from", conn.RemoteAddr())
+		journalEvent("access", fmt.Sprint("viewer left from ", conn.RemoteAddr()), nil)
+	}()
+	if err != nil {
+		log.Println("share:", err)
+		return
+	}
+
+	go func() {
+		dec := json.NewDecoder(conn)
+		for {
+			var m shareMessage
+			if dec.Decode(&m) != nil {
+				return
+			}
+			if m.Annotate != nil {
+				h.annotate <- *m.Annotate
+			}
+		}
+	}()
+
+	w := bufio.NewWriter(conn)
+	for ; err == nil; b = <-ch {
+		_, err = w.Write(append(b, '\n'))
+		if err == nil {
+			err = w.Flush()
+		}
+	}
+}
+
+// publishShare sends m to every viewer, remembering sources, uniforms and
+// annotations.
+func publishShare(h *shareHost, m *shareMessage) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		log.Println("share:", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if m.Shaders != nil {
+		h.sources.Shaders = m.Shaders
+	}
+	if m.Uniforms != nil {
+		h.sources.Uniforms = m.Uniforms
+	}
+	if m.Annotations != nil {
+		h.sources.Annotations = m.Annotations
+	}
+	for ch := range h.viewers {
+		select {
+		case ch <- b:
+		default:
+		}
+	}
+}
+
+// programSources reads the sources of every stage of the program, by prefix.
+func programSources(p *program) (map[string]string, error) {
+	res := make(map[string]string)
+	for prefix, stage := range shaPrefixToStage {
+		s := p.shaderByStage[stage]
+		if s == nil {
+			continue
+		}
+		var src []byte
+		for _, path := range s.paths {
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			src = append(src, b...)
+		}
+		res[prefix] = string(src)
+	}
+	return res, nil
+}
+
+// shareViewer receives the state of a host, writing received shaders to
+// files in dir so they compile like any other.
+type shareViewer struct {
+	dir  string
+	msgs chan shareMessage
+	conn net.Conn
+}
+
+func joinShare(addr string) (*shareViewer, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir("", "shaderdev-share")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	v := &shareViewer{dir: dir, msgs: make(chan shareMessage, 64), conn: conn}
+	go func() {
+		defer conn.Close()
+		defer close(v.msgs)
+		dec := json.NewDecoder(conn)
+		for {
+			var m shareMessage
+			err := dec.Decode(&m)
+			if err == io.EOF {
+				log.Println("share: host ended the session")
+				return
+			}
+			if err != nil {
+				log.Println("share:", err)
+				return
+			}
+			v.msgs <- m
+		}
+	}()
+	return v, nil
+}
+
+// writeShaders writes shaders received by a viewer to its directory,
+// returning the paths by prefix of those that changed. Prefixes come from
+// the host, so only stage prefixes are taken, and only paths inside the
+// directory written.
+func writeShaders(v *shareViewer, shaders map[string]string) (map[string]string, error) {
+	changed := make(map[string]string)
+	for prefix, src := range shaders {
+		if _, ok := shaPrefixToStage[prefix]; !ok {
+			return nil, fmt.Errorf("invalid shader prefix %q from host", prefix)
+		}
+		path := filepath.Join(v.dir, prefix+".glsl")
+		if rel, err := filepath.Rel(v.dir, path); err != nil || strings.HasPrefix(rel, "..") || filepath.IsAbs(rel) {
+			return nil, fmt.Errorf("shader %q from host is outside %v", prefix, v.dir)
+		}
+		old, err := ioutil.ReadFile(path)
+		if err == nil && string(old) == src {
+			continue
+		}
+		err = ioutil.WriteFile(path, []byte(src), 0644)
+		if err != nil {
+			return nil, err
+		}
+		changed[prefix] = path
+	}
+	return changed, nil
+}
+
+// sendAnnotation asks the host to add an annotation, which comes back
+// with the host's annotations.
+func sendAnnotation(v *shareViewer, a annotation) error {
+	b, err := json.Marshal(&shareMessage{Annotate: &a})
+	if err != nil {
+		return err
+	}
+	_, err = v.conn.Write(append(b, '\n'))
+	return err
+}
+
+func leaveShare(v *shareViewer) {
+	os.RemoveAll(v.dir)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-gl/gl/all-core/gl"
+	"github.com/go-gl/glfw/v3.1/glfw"
+)
+
+var softwareFlag = flag.Bool("software", false, "render with Mesa's llvmpipe software renderer instead of the GPU driver, slow but available without GPU drivers, e.g. in containers and CI")
+var softwareFallback = flag.Bool("software-fallback", true, "when no GL context can be created, run again with -software, and when no display can be opened, also under -software-display")
+var softwareDisplay = flag.String("software-display", "xvfb-run -a", "command providing a virtual display to run shaderdev under when none can be opened, e.g. in containers; shaderdev's GLFW has no OSMesa or surfaceless EGL platform to render without one")
+
+// rerunEnv marks a shaderdev run again by the fallback, which doesn't fall
+// back again.
+const rerunEnv = "SHADERDEV_SOFTWARE_RERUN"
+
+// softwareLabel is appended to window titles while rendering in software,
+// so its frame rates aren't mistaken for the GPU's.
+var softwareLabel string
+
+// useSoftwareRenderer makes Mesa choose llvmpipe, which it only reads
+// before glfw.Init connects to the display.
+func useSoftwareRenderer() {
+	os.Setenv("LIBGL_ALWAYS_SOFTWARE", "1")
+	os.Setenv("GALLIUM_DRIVER", "llvmpipe")
+}
+
+// canFallBack returns whether shaderdev may run again in software.
+func canFallBack() bool {
+	return *softwareFallback && os.Getenv(rerunEnv) == ""
+}
+
+// rerunSoftware runs shaderdev again with -software and the same
+// arguments, under wrapper if given, returning its exit code.
+func rerunSoftware(wrapper []string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	// flags must come before the shader specifications
+	args := append(append(wrapper, exe, "-software"), os.Args[1:]...)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), rerunEnv+"=1")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	if e, ok := err.(*exec.ExitError); ok {
+		return e.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// exitSoftware runs shaderdev again in software, as it can't run as it is
+// for reason, and exits with its exit code. Nothing is to have been done yet
+// that the run would do again, e.g. opening files or listening.
+func exitSoftware(reason error, wrapper []string) {
+	how := "with -software"
+	if len(wrapper) > 0 {
+		how += " under " + strings.Join(wrapper, " ")
+	}
+	log.Printf("%v; running again %v", reason, how)
+	glfw.Terminate()
+	removeBundle()
+	code, err := rerunSoftware(wrapper)
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(code)
+}
+
+// isSoftwareRenderer returns whether the GL_RENDERER of the current context
+// names a software rasterizer, however it was chosen.
+func isSoftwareRenderer() bool {
+	r := strings.ToLower(gl.GoStr(gl.GetString(gl.RENDERER)))
+	for _, s := range []string{"llvmpipe", "softpipe", "swrast", "software rasterizer", "swiftshader"} {
+		if strings.Contains(r, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// labelSoftware notes a software renderer in the log and in window
+// titles.
+func labelSoftware() {
+	if !isSoftwareRenderer() {
+		return
+	}
+	softwareLabel = " [software]"
+	log.Printf("rendering in software with %v: GPU times and frame rates don't reflect hardware", gl.GoStr(gl.GetString(gl.RENDERER)))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/glsl"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+var spirvCompiler = flag.String("spirv", "", "SPIR-V validation: after every link, also validate each stage by compiling it to SPIR-V under Vulkan rules with this glslang compiler, e.g. glslangValidator, reporting what Vulkan rejects, such as uniforms outside blocks; rendering stays in GL, there is no Vulkan renderer")
+var spirvOut = flag.String("spirv-out", "", "directory to write the SPIR-V of each stage of the shaders validated with -spirv to, e.g. frag.spv, for engines to reload; stages that fail leave no file, and the second version of -compare is written to its compare subdirectory")
+
+// spirvExts are the file extensions glslang takes the stage of a source
+// from.
+var spirvExts = map[uint32]string{
+	gl.VERTEX_SHADER:          "vert",
+	gl.TESS_CONTROL_SHADER:    "tesc",
+	gl.TESS_EVALUATION_SHADER: "tese",
+	gl.GEOMETRY_SHADER:        "geom",
+	gl.FRAGMENT_SHADER:        "frag",
+}
+
+// compileSPIRV compiles the source of a stage as last given to GL to
+// SPIR-V for Vulkan, writing it to out, and returns the compiler's
+// messages, with line numbers of the source, if it fails.
+func compileSPIRV(stage uint32, src []byte, out string) ([]glsl.Diagnostic, error) {
+	f, err := ioutil.TempFile("", "shaderdev-*."+spirvExts[stage])
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(src)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := exec.Command(*spirvCompiler, "-V", "--target-env", "vulkan1.0", "-o", out, f.Name()).CombinedOutput()
+	if _, ok := err.(*exec.ExitError); !ok && err != nil {
+		return nil, err
+	}
+	if err == nil {
+		return nil, nil
+	}
+	// glslang names sources by path, where drivers number them
+	ds := glsl.ParseLog(strings.Replace(string(b), f.Name()+":", "0:", -1))
+	var errs []glsl.Diagnostic
+	for _, d := range ds {
+		// the first line of the log is the path
+		if d.Severity == "error" && d.Line == 0 && strings.TrimSpace(d.Message) == f.Name() {
+			continue
+		}
+		errs = append(errs, d)
+	}
+	return errs, nil
+}
+
+// reportSPIRV compiles every stage of a linked program to SPIR-V, logging
+// what the compiler reports in the files of the stage, and writing it to
+// the program's spirvOut if set.
+func reportSPIRV(p *program) {
+	var stages []int
+	for stage := range p.shaderByStage {
+		stages = append(stages, int(stage))
+	}
+	sort.Ints(stages)
+
+	for _, stage := range stages {
+		s := p.shaderByStage[uint32(stage)]
+		out := os.DevNull
+		if p.spirvOut != "" {
+			out = filepath.Join(p.spirvOut, spirvExts[uint32(stage)]+".spv")
+			// a failed compile mustn't leave the last good one behind
+			err := os.Remove(out)
+			if err != nil && !os.IsNotExist(err) {
+				log.Println("spirv:", err)
+				return
+			}
+		}
+		ds, err := compileSPIRV(uint32(stage), s.compiled, out)
+		if err != nil {
+			log.Println("spirv:", err)
+			return
+		}
+		for _, d := range ds {
+			where := stageName(uint32(stage), s)
+			if d.Line > 0 {
+				file, line := sourceLine(s, d.Line)
+				where = fmt.Sprintf("%v:%v", file, line)
+			}
+			log.Printf("spirv: %v: %v", where, d.Message)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+var statsFlag = flag.Bool("stats", false, "show the frame rate, frame, CPU and GPU times and a graph of them from the start; I toggles them")
+
+// The statistics are a box in the top right corner of the window: the
+// frame rate and times averaged over the last half second, above a graph of
+// the last frames, where gray bars are the time between frames, orange bars
+// the GPU time, the blue line the CPU time and the green line 60 frames a
+// second, with the GPU time of each pass listed below. CPU time runs from
+// the start of a frame to the swap, and GPU time between timestamps taken
+// then and around each pass, read back a few frames later so as not to
+// stall. The time of a pass includes those of the passes it runs, e.g. pip
+// within model.
+const statsFrag = `#version 330 core
+uniform sampler2D font;
+// a character per texel, rows top down
+uniform usampler2D text;
+// per column of the graph, oldest first: the time between frames, the CPU
+// time and the GPU time in milliseconds, negative if not known
+uniform sampler2D history;
+// the top left corner of the box in framebuffer pixels, and the pixels of a
+// font pixel
+uniform vec2 origin;
+uniform int scale;
+// the milliseconds the graph's height spans, and the line drawn across it
+uniform float span;
+uniform float target;
+
+in vec2 uv;
+out vec4 color;
+
+const ivec2 glyph = ivec2(5, 7);
+const ivec2 cell = ivec2(6, 9);
+const int graphHeight = 40;
+
+// row returns the row of the graph, from the bottom, of a time.
+int row(float ms) {
+	return int(ms / span * float(graphHeight));
+}
+
+void main() {
+	ivec2 p = ivec2(gl_FragCoord.x - origin.x, origin.y - gl_FragCoord.y) / scale;
+	ivec2 cells = textureSize(text, 0);
+	int top = cells.y*cell.y;
+	int width = textureSize(history, 0).x;
+	if (p.x < 0 || p.y < 0 || p.x >= width || p.y >= top + graphHeight) {
+		discard;
+	}
+	color = vec4(0.08, 0.08, 0.1, 0.85);
+
+	if (p.y < top) {
+		ivec2 c = p / cell;
+		ivec2 g = p - c*cell - ivec2(0, 1);
+		uint r = c.x < cells.x ? texelFetch(text, c, 0).r : 32u;
+		if (r >= 32u && r <= 126u && all(greaterThanEqual(g, ivec2(0))) && all(lessThan(g, glyph))) {
+			if (texelFetch(font, ivec2(int(r - 32u)*glyph.x + g.x, g.y), 0).r > 0.5) {
+				color = vec4(0.95, 0.95, 0.95, 1);
+			}
+		}
+		return;
+	}
+
+	int y = top + graphHeight - 1 - p.y;
+	vec3 h = texelFetch(history, ivec2(p.x, 0), 0).rgb;
+	if (y < row(h.r)) {
+		color = vec4(0.4, 0.4, 0.45, 0.95);
+	}
+	if (h.b >= 0 && y < row(h.b)) {
+		color = vec4(0.9, 0.55, 0.15, 0.95);
+	}
+	if (y == row(target)) {
+		color = vec4(0.3, 0.8, 0.3, 0.95);
+	}
+	if (h.g >= 0 && y == row(h.g)) {
+		color = vec4(0.3, 0.6, 1, 1);
+	}
+}
+`
+
+const (
+	// samples kept, a column of the graph each
+	statsSamples = 180
+	statsCols    = statsSamples / panelCellWidth
+	// frames of timestamp queries in flight
+	statsQueries = 4
+	// the time of a frame at 60 frames a second
+	statsTarget = 1000.0 / 60
+)
+
+// frameStats measures frames and draws the statistics.
+type frameStats struct {
+	shown bool
+
+	// the samples in milliseconds, a ring from head, the oldest: the time
+	// between frames, CPU time and GPU time, negative if not known
+	interval, cpu, gpu [statsSamples]float32
+	head               int
+	// when the current frame began and the last one did
+	begin, last time.Time
+
+	// the timestamps at the start and end of a frame, the sample each pair
+	// is for, -1 if none, and the pair of the current frame
+	queries [statsQueries][2]uint32
+	pending [statsQueries]int
+	query   int
+
+	// when the text was last updated, which it is a few times a second to
+	// stay readable
+	updated time.Time
+	text    []byte
+
+	prog       gx.Program
+	fontLoc    int32
+	textLoc    int32
+	historyLoc int32
+	originLoc  int32
+	scaleLoc   int32
+	spanLoc    int32
+	targetLoc  int32
+	font       gx.Texture
+	textTex    gx.Texture
+	historyTex gx.Texture
+}
+
+func newFrameStats(shown bool) (*frameStats, error) {
+	s := &frameStats{shown: shown}
+	for i := range s.interval {
+		s.interval[i], s.cpu[i], s.gpu[i] = 0, -1, -1
+	}
+	for i := range s.pending {
+		s.pending[i] = -1
+		gl.GenQueries(2, &s.queries[i][0])
+	}
+
+	err := buildBuiltin(&builtinSlot{name: "stats", src: statsFrag, prog: &s.prog, locate: func() {
+		s.fontLoc = gl.GetUniformLocation(uint32(s.prog), gl.Str("font\x00"))
+		s.textLoc = gl.GetUniformLocation(uint32(s.prog), gl.Str("text\x00"))
+		s.historyLoc = gl.GetUniformLocation(uint32(s.prog), gl.Str("history\x00"))
+		s.originLoc = gl.GetUniformLocation(uint32(s.prog), gl.Str("origin\x00"))
+		s.scaleLoc = gl.GetUniformLocation(uint32(s.prog), gl.Str("scale\x00"))
+		s.spanLoc = gl.GetUniformLocation(uint32(s.prog), gl.Str("span\x00"))
+		s.targetLoc = gl.GetUniformLocation(uint32(s.prog), gl.Str("target\x00"))
+	}})
+	if err != nil {
+		return nil, err
+	}
+	s.font = newFontTexture()
+
+	for name, tex := range map[string]*gx.Texture{"stats text": &s.textTex, "stats history": &s.historyTex} {
+		*tex = gx.NewTexture(gl.TEXTURE_2D)
+		tex.Label(name)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return s, nil
+}
+
+// beginFrameStats marks the start of a frame, reading back the GPU times of
+// the frame that last used this frame's queries if they are ready, and
+// returns that frame's sample, or -1 if none. A frame that begins without
+// the last having ended replaces it.
+func beginFrameStats(s *frameStats, now time.Time) int {
+	q := s.queries[s.query]
+	read := s.pending[s.query]
+	// ES has timestamp queries only as an extension, leaving GPU times
+	// unknown
+	if i := read; i >= 0 && !gles {
+		var ready uint64
+		gl.GetQueryObjectui64v(q[1], gl.QUERY_RESULT_AVAILABLE, &ready)
+		if ready != 0 {
+			var t0, t1 uint64
+			gl.GetQueryObjectui64v(q[0], gl.QUERY_RESULT, &t0)
+			gl.GetQueryObjectui64v(q[1], gl.QUERY_RESULT, &t1)
+			s.gpu[i] = float32(float64(t1-t0) / 1e6)
+		}
+	}
+	s.pending[s.query] = -1
+	readPassTimers(s.query)
+	passSlot = s.query
+	if !gles {
+		gl.QueryCounter(q[0], gl.TIMESTAMP)
+	}
+	s.begin = now
+	return read
+}
+
+// endFrameStats marks the end of a frame, before the swap.
+func endFrameStats(s *frameStats, now time.Time) {
+	if !gles {
+		gl.QueryCounter(s.queries[s.query][1], gl.TIMESTAMP)
+	}
+	s.pending[s.query] = s.head
+	s.query = (s.query + 1) % statsQueries
+
+	i := s.head
+	s.interval[i], s.cpu[i], s.gpu[i] = 0, float32(now.Sub(s.begin).Seconds()*1000), -1
+	if !s.last.IsZero() {
+		s.interval[i] = float32(s.begin.Sub(s.last).Seconds() * 1000)
+	}
+	s.last = s.begin
+	s.head = (s.head + 1) % statsSamples
+}
+
+// recentStats returns the mean time between frames, CPU time and GPU time
+// over the last n frames, the last negative if none is known.
+func recentStats(s *frameStats, n int) (interval, cpu, gpu float64) {
+	var frames, gpus int
+	for k := 1; k <= n; k++ {
+		i := (s.head - k + statsSamples) % statsSamples
+		if s.interval[i] <= 0 {
+			continue
+		}
+		interval += float64(s.interval[i])
+		cpu += float64(s.cpu[i])
+		frames++
+		if s.gpu[i] >= 0 {
+			gpu += float64(s.gpu[i])
+			gpus++
+		}
+	}
+	if frames > 0 {
+		interval /= float64(frames)
+		cpu /= float64(frames)
+	}
+	if gpus == 0 {
+		return interval, cpu, -1
+	}
+	return interval, cpu, gpu / float64(gpus)
+}
+
+// statsText writes the rows of text, cut at the edge of the box.
+func statsText(s *frameStats, rows ...string) {
+	s.text = s.text[:0]
+	for i := 0; i < len(rows)*statsCols; i++ {
+		s.text = append(s.text, ' ')
+	}
+	for r, row := range rows {
+		for c := 0; c < len(row) && c < statsCols; c++ {
+			s.text[r*statsCols+c] = row[c]
+		}
+	}
+}
+
+// drawStats draws the statistics in the top right corner of a framebuffer.
+func drawStats(s *frameStats, width, height int) {
+	if !s.shown {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(s.updated) >= 250*time.Millisecond {
+		s.updated = now
+		interval, cpu, gpu := recentStats(s, 30)
+		fps := "-"
+		if interval > 0 {
+			fps = fmt.Sprintf("%.1f", 1000/interval)
+		}
+		gpuText := "-"
+		if gpu >= 0 {
+			gpuText = fmt.Sprintf("%.2f", gpu)
+		}
+		rows := []string{
+			fmt.Sprintf("%v fps  %.2f ms", fps, interval),
+			fmt.Sprintf("cpu %.2f  gpu %v ms", cpu, gpuText),
+		}
+		statsText(s, append(rows, passTimeRows()...)...)
+	}
+
+	// oldest first, spanning the slowest frame
+	history := make([]float32, 0, 3*statsSamples)
+	span := 2 * statsTarget
+	for k := 0; k < statsSamples; k++ {
+		i := (s.head + k) % statsSamples
+		history = append(history, s.interval[i], s.cpu[i], s.gpu[i])
+		span = math.Max(span, math.Max(float64(s.interval[i]), math.Max(float64(s.cpu[i]), float64(s.gpu[i]))))
+	}
+
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	s.textTex.SetData(gl.R8UI, statsCols, int32(len(s.text)/statsCols), gl.RED_INTEGER, gl.UNSIGNED_BYTE, gl.Ptr(s.text))
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 4)
+	s.historyTex.SetData(gl.RGB32F, statsSamples, 1, gl.RGB, gl.FLOAT, gl.Ptr(history))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	gl.Enable(gl.BLEND)
+	defer gl.Disable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	defer gl.BlendFunc(gl.ONE, gl.ZERO)
+
+	var prev int32
+	gl.GetIntegerv(gl.CURRENT_PROGRAM, &prev)
+	defer gl.UseProgram(uint32(prev))
+
+	s.prog.Bind()
+	gx.ActiveTexture(0)
+	s.font.Bind(gl.TEXTURE_2D)
+	gx.ActiveTexture(1)
+	s.textTex.Bind(gl.TEXTURE_2D)
+	gx.ActiveTexture(2)
+	s.historyTex.Bind(gl.TEXTURE_2D)
+	defer func() {
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+		gx.ActiveTexture(1)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+		gx.ActiveTexture(0)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+	}()
+	scale := 2
+	gl.Uniform1i(s.fontLoc, 0)
+	gl.Uniform1i(s.textLoc, 1)
+	gl.Uniform1i(s.historyLoc, 2)
+	gl.Uniform2f(s.originLoc, float32(width-statsSamples*scale), float32(height))
+	gl.Uniform1i(s.scaleLoc, int32(scale))
+	gl.Uniform1f(s.spanLoc, float32(span))
+	gl.Uniform1f(s.targetLoc, statsTarget)
+
+	drawFullscreen()
+}
+
+// passTimers time the passes on the GPU, by name, see runPass.
+var passTimers = make(map[string]*passTimer)
+
+// passSlot is the pair of queries of each timer the current frame uses.
+var passSlot int
+
+// passTimer measures a pass with timestamps before and after it, a pair for
+// each frame in flight as frameStats has.
+type passTimer struct {
+	queries [statsQueries][2]uint32
+	pending [statsQueries]bool
+	// the GPU time of the pass in milliseconds, smoothed over frames, and
+	// whether it ran in the frame last read back
+	ms  float64
+	ran bool
+	// the time in the frame last read back, negative if it didn't run or
+	// the time wasn't ready
+	last float64
+}
+
+// startPassTimer takes the timestamp before a pass, returning nil on ES.
+func startPassTimer(name string) *passTimer {
+	if gles {
+		return nil
+	}
+	t := passTimers[name]
+	if t == nil {
+		t = &passTimer{}
+		for i := range t.queries {
+			gl.GenQueries(2, &t.queries[i][0])
+		}
+		passTimers[name] = t
+	}
+	gl.QueryCounter(t.queries[passSlot][0], gl.TIMESTAMP)
+	return t
+}
+
+// stopPassTimer takes the timestamp after a pass.
+func stopPassTimer(t *passTimer) {
+	if t == nil {
+		return
+	}
+	gl.QueryCounter(t.queries[passSlot][1], gl.TIMESTAMP)
+	t.pending[passSlot] = true
+}
+
+// readPassTimers reads back the times of the frame that last used a slot,
+// if they are ready.
+func readPassTimers(slot int) {
+	for _, t := range passTimers {
+		q := t.queries[slot]
+		t.last = -1
+		if !t.pending[slot] {
+			t.ran = false
+			continue
+		}
+		t.pending[slot] = false
+		var ready uint64
+		gl.GetQueryObjectui64v(q[1], gl.QUERY_RESULT_AVAILABLE, &ready)
+		if ready == 0 {
+			continue
+		}
+		var t0, t1 uint64
+		gl.GetQueryObjectui64v(q[0], gl.QUERY_RESULT, &t0)
+		gl.GetQueryObjectui64v(q[1], gl.QUERY_RESULT, &t1)
+		t.last = float64(t1-t0) / 1e6
+		ms := t.last
+		if t.ran {
+			ms = 0.9*t.ms + 0.1*ms
+		}
+		t.ms, t.ran = ms, true
+	}
+}
+
+// passTimeRows returns the GPU time of each pass that ran, in the order
+// the passes first ran.
+func passTimeRows() []string {
+	var rows []string
+	for _, name := range passNames {
+		if t := passTimers[name]; t != nil && t.ran {
+			rows = append(rows, fmt.Sprintf("%-12v %7.3f ms", name, t.ms))
+		}
+	}
+	return rows
+}
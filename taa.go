@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// taaResolveFrag is the default resolve, blending the reprojected history
+// clamped to the current neighborhood. Replacement resolves given with
+// -taa-resolve receive the same inputs, and depthFuncs after their #version.
+const taaResolveFrag = `#version 330 core
+uniform sampler2D current;
+uniform sampler2D depth;
+uniform sampler2D history;
+// maps current clip space to previous clip space, for the model and for
+// the background, which only moves with the camera
+uniform mat4 reprojectModel;
+uniform mat4 reprojectBackground;
+uniform vec2 jitter;
+uniform int historyValid;
+
+in vec2 uv;
+out vec4 color;
+
+void main() {
+	vec4 c = texture(current, uv);
+	if (historyValid == 0) {
+		color = c;
+		return;
+	}
+
+	float d = texture(depth, uv).r;
+	vec4 clip = vec4(uv*2 - 1, clipDepth(d), 1);
+	vec4 prev = (isFar(d) ? reprojectBackground : reprojectModel) * clip;
+	vec2 prevUV = prev.xy / prev.w * 0.5 + 0.5;
+	if (any(lessThan(prevUV, vec2(0))) || any(greaterThan(prevUV, vec2(1)))) {
+		color = c;
+		return;
+	}
+
+	vec4 lo = c, hi = c;
+	for (int y = -1; y <= 1; y++) {
+		for (int x = -1; x <= 1; x++) {
+			vec4 n = textureOffset(current, uv, ivec2(x, y));
+			lo = min(lo, n);
+			hi = max(hi, n);
+		}
+	}
+
+	vec4 h = clamp(texture(history, prevUV), lo, hi);
+	color = mix(h, c, 0.1);
+}
+`
+
+// taa resolves jittered frames of the main pass against an accumulated
+// history, ping-ponging between two history targets.
+type taa struct {
+	prog gx.Program
+
+	currentLoc             int32
+	depthLoc               int32
+	historyLoc             int32
+	reprojectModelLoc      int32
+	reprojectBackgroundLoc int32
+	jitterLoc              int32
+	historyValidLoc        int32
+	nearFarLoc             int32
+
+	history [2]*target
+	cur     int
+
+	// previous unjittered view projection and model matrices
+	prevViewProjection mgl32.Mat4
+	prevModel          mgl32.Mat4
+	valid              bool
+
+	// a history saved by an interrupted export, restored when the history
+	// targets are created
+	restore    *taaCheckpoint
+	restorePix []byte
+}
+
+// newTAA creates the TAA resolve from the built-in shader, or from the
+// fragment shader at resolvePath if not empty, which reloads like that of
+// -builtin taa.
+func newTAA(resolvePath string, mode depthMode) (*taa, error) {
+	var a taa
+	err := buildBuiltin(&builtinSlot{
+		name: "taa",
+		src:  taaResolveFrag,
+		path: resolvePath,
+		prepare: func(src []byte) []byte {
+			return insertAfterVersion(src, depthDefines(mode)+depthFuncs)
+		},
+		prog: &a.prog,
+		locate: func() {
+			a.currentLoc = gl.GetUniformLocation(uint32(a.prog), gl.Str("current\x00"))
+			a.depthLoc = gl.GetUniformLocation(uint32(a.prog), gl.Str("depth\x00"))
+			a.historyLoc = gl.GetUniformLocation(uint32(a.prog), gl.Str("history\x00"))
+			a.reprojectModelLoc = gl.GetUniformLocation(uint32(a.prog), gl.Str("reprojectModel\x00"))
+			a.reprojectBackgroundLoc = gl.GetUniformLocation(uint32(a.prog), gl.Str("reprojectBackground\x00"))
+			a.jitterLoc = gl.GetUniformLocation(uint32(a.prog), gl.Str("jitter\x00"))
+			a.historyValidLoc = gl.GetUniformLocation(uint32(a.prog), gl.Str("historyValid\x00"))
+			a.nearFarLoc = gl.GetUniformLocation(uint32(a.prog), gl.Str("nearFar\x00"))
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// resizeTAA makes sure the history matches the size of the main pass,
+// discarding it when it doesn't.
+func resizeTAA(a *taa, width, height int32) error {
+	if a.history[0] != nil && a.history[0].width == width && a.history[0].height == height {
+		return nil
+	}
+
+	for i := range a.history {
+		if a.history[i] != nil {
+			deleteTarget(a.history[i])
+		}
+		t, err := newTarget(fmt.Sprintf("taa history %v", i), width, height, gl.RGBA16F)
+		if err != nil {
+			return err
+		}
+		a.history[i] = t
+	}
+	a.valid = false
+
+	if c := a.restore; c != nil {
+		pix := a.restorePix
+		a.restore, a.restorePix = nil, nil
+		if c.Width != width || c.Height != height {
+			return fmt.Errorf("TAA history of the checkpoint is %vx%v, not %vx%v", c.Width, c.Height, width, height)
+		}
+		a.history[a.cur].color.Bind(gl.TEXTURE_2D)
+		gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, width, height, gl.RGBA, gl.HALF_FLOAT, gl.Ptr(pix))
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+		a.prevViewProjection, a.prevModel, a.valid = c.PrevViewProjection, c.PrevModel, c.Valid
+	}
+
+	return nil
+}
+
+// discardTAA starts the history over, e.g. when what is drawn where changes
+// without the camera moving.
+func discardTAA(a *taa) {
+	a.valid = false
+}
+
+func halton(i, base int) float32 {
+	f, r := float32(1), float32(0)
+	for ; i > 0; i /= base {
+		f /= float32(base)
+		r += f * float32(i%base)
+	}
+	return r
+}
+
+// taaJitter returns the subpixel offset, in pixels within [-0.5, 0.5), for a
+// frame, cycling through 8 points of the Halton (2, 3) sequence.
+func taaJitter(frame int32) mgl32.Vec2 {
+	i := int(frame)%8 + 1
+	return mgl32.Vec2{halton(i, 2) - 0.5, halton(i, 3) - 0.5}
+}
+
+// jitterProjection offsets a projection by a subpixel amount.
+func jitterProjection(projection mgl32.Mat4, jitter mgl32.Vec2, width, height int32) mgl32.Mat4 {
+	offset := mgl32.Translate3D(jitter[0]*2/float32(width), jitter[1]*2/float32(height), 0)
+	return offset.Mul4(projection)
+}
+
+// resolveTAA blends the jittered scene into the history and returns the
+// target holding the result. viewProjection and model are unjittered, while
+// jitteredViewProjection is what the scene was drawn with.
+func resolveTAA(a *taa, scene *target, cam *camera, jitter mgl32.Vec2, jitteredViewProjection, viewProjection, model mgl32.Mat4) *target {
+	src, dst := a.history[a.cur], a.history[1-a.cur]
+
+	unproject := jitteredViewProjection.Inv()
+	reprojectModel := a.prevViewProjection.Mul4(a.prevModel).Mul4(model.Inv()).Mul4(unproject)
+	reprojectBackground := a.prevViewProjection.Mul4(unproject)
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, dst.fbo)
+	defer gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	gl.Viewport(0, 0, dst.width, dst.height)
+
+	a.prog.Bind()
+	defer gl.UseProgram(0)
+
+	textures := []gx.Texture{scene.color, scene.depth, src.color}
+	locs := []int32{a.currentLoc, a.depthLoc, a.historyLoc}
+	for i := range textures {
+		gx.ActiveTexture(uint32(i))
+		textures[i].Bind(gl.TEXTURE_2D)
+		gl.Uniform1i(locs[i], int32(i))
+	}
+	defer func() {
+		for i := range textures {
+			gx.ActiveTexture(uint32(i))
+			gl.BindTexture(gl.TEXTURE_2D, 0)
+		}
+		gx.ActiveTexture(0)
+	}()
+
+	gl.UniformMatrix4fv(a.reprojectModelLoc, 1, false, &reprojectModel[0])
+	gl.UniformMatrix4fv(a.reprojectBackgroundLoc, 1, false, &reprojectBackground[0])
+	gl.Uniform2f(a.jitterLoc, jitter[0], jitter[1])
+	valid := int32(0)
+	if a.valid {
+		valid = 1
+	}
+	gl.Uniform1i(a.historyValidLoc, valid)
+	gl.Uniform2f(a.nearFarLoc, cam.near, cam.far)
+
+	drawFullscreen()
+
+	a.prevViewProjection = viewProjection
+	a.prevModel = model
+	a.valid = true
+	a.cur = 1 - a.cur
+
+	return dst
+}
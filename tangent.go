@@ -0,0 +1,76 @@
+package main
+
+import "math"
+
+// generateTangents returns a tangent per vertex for normal mapping, pointing
+// along increasing u and orthogonal to the normal, averaged over the
+// triangles sharing the vertex. w is the handedness of the basis, so the
+// bitangent is cross(normal, tangent.xyz) * tangent.w.
+func generateTangents(pos [][4]float32, nor, tex [][3]float32, idx []uint32) [][4]float32 {
+	tan := make([][3]float64, len(pos))
+	bitan := make([][3]float64, len(pos))
+
+	for i := 0; i+2 < len(idx); i += 3 {
+		a, b, c := idx[i], idx[i+1], idx[i+2]
+		var e1, e2 [3]float64
+		for j := 0; j < 3; j++ {
+			e1[j] = float64(pos[b][j] - pos[a][j])
+			e2[j] = float64(pos[c][j] - pos[a][j])
+		}
+		du1, dv1 := float64(tex[b][0]-tex[a][0]), float64(tex[b][1]-tex[a][1])
+		du2, dv2 := float64(tex[c][0]-tex[a][0]), float64(tex[c][1]-tex[a][1])
+
+		det := du1*dv2 - du2*dv1
+		if det == 0 {
+			continue
+		}
+		r := 1 / det
+
+		var t, bt [3]float64
+		for j := 0; j < 3; j++ {
+			t[j] = (e1[j]*dv2 - e2[j]*dv1) * r
+			bt[j] = (e2[j]*du1 - e1[j]*du2) * r
+		}
+		for _, v := range []uint32{a, b, c} {
+			for j := 0; j < 3; j++ {
+				tan[v][j] += t[j]
+				bitan[v][j] += bt[j]
+			}
+		}
+	}
+
+	res := make([][4]float32, len(pos))
+	for i := range res {
+		n := [3]float64{float64(nor[i][0]), float64(nor[i][1]), float64(nor[i][2])}
+		t := tan[i]
+
+		// Gram-Schmidt against the normal
+		d := n[0]*t[0] + n[1]*t[1] + n[2]*t[2]
+		for j := range t {
+			t[j] -= n[j] * d
+		}
+		l := math.Sqrt(t[0]*t[0] + t[1]*t[1] + t[2]*t[2])
+		if l == 0 {
+			// no usable uvs, any direction orthogonal to the normal will do
+			t = [3]float64{1, 0, 0}
+			if math.Abs(n[0]) > 0.9 {
+				t = [3]float64{0, 1, 0}
+			}
+			d := n[0]*t[0] + n[1]*t[1] + n[2]*t[2]
+			for j := range t {
+				t[j] -= n[j] * d
+			}
+			l = math.Sqrt(t[0]*t[0] + t[1]*t[1] + t[2]*t[2])
+		}
+
+		w := 1.0
+		c := [3]float64{n[1]*t[2] - n[2]*t[1], n[2]*t[0] - n[0]*t[2], n[0]*t[1] - n[1]*t[0]}
+		if c[0]*bitan[i][0]+c[1]*bitan[i][1]+c[2]*bitan[i][2] < 0 {
+			w = -1
+		}
+
+		res[i] = [4]float32{float32(t[0] / l), float32(t[1] / l), float32(t[2] / l), float32(w)}
+	}
+
+	return res
+}
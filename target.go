@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// target is an offscreen framebuffer with color and depth textures, used to
+// render at a resolution independent of the window and to feed later passes.
+type target struct {
+	fbo    uint32
+	color  gx.Texture
+	depth  gx.Texture
+	width  int32
+	height int32
+}
+
+// newTarget creates a target whose color texture has the given internal
+// format, e.g. gl.RGBA8, labeling its objects after name.
+func newTarget(name string, width, height int32, format int32) (*target, error) {
+	var t target
+	t.width = width
+	t.height = height
+
+	t.color = gx.NewTexture(gl.TEXTURE_2D)
+	t.color.Label(name + " color")
+	t.color.SetData(format, width, height, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	t.depth = gx.NewTexture(gl.TEXTURE_2D)
+	t.depth.Label(name + " depth")
+	t.depth.SetData(gl.DEPTH_COMPONENT32F, width, height, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	t.fbo = gx.GenFramebuffer()
+	gl.BindFramebuffer(gl.FRAMEBUFFER, t.fbo)
+	defer gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	gx.Label(gl.FRAMEBUFFER, t.fbo, name)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, uint32(t.color), 0)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.TEXTURE_2D, uint32(t.depth), 0)
+
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		deleteTarget(&t)
+		return nil, fmt.Errorf("framebuffer %vx%v: %v", width, height, gx.FramebufferStatusStr(status))
+	}
+
+	return &t, nil
+}
+
+func deleteTarget(t *target) {
+	gl.DeleteFramebuffers(1, &t.fbo)
+	t.depth.Delete()
+	t.color.Delete()
+}
+
+// blitTarget copies the target's color into rect of the default framebuffer.
+func blitTarget(t *target, rect [4]float32, filter uint32) {
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, t.fbo)
+	defer gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	gl.BindFramebuffer(gl.DRAW_FRAMEBUFFER, 0)
+
+	x0, y0 := int32(rect[0]), int32(rect[1])
+	x1, y1 := int32(rect[0]+rect[2]), int32(rect[1]+rect[3])
+	gl.BlitFramebuffer(0, 0, t.width, t.height, x0, y0, x1, y1, gl.COLOR_BUFFER_BIT, filter)
+}
+
+const crtFrag = `#version 330 core
+uniform sampler2D image;
+
+in vec2 uv;
+out vec4 color;
+
+void main() {
+	vec2 size = vec2(textureSize(image, 0));
+	vec3 c = texture(image, uv).rgb;
+
+	// darken the edges of each source row like scanlines
+	float row = fract(uv.y * size.y);
+	c *= mix(0.6, 1.0, sin(row * 3.14159265));
+
+	// aperture grille: tint every output column towards one of r, g or b
+	int col = int(gl_FragCoord.x) % 3;
+	vec3 mask = vec3(0.7);
+	mask[col] = 1.0;
+	c *= mask;
+
+	color = vec4(c, 1);
+}
+`
+
+// crt presents a target through a scanline and aperture grille mask.
+type crt struct {
+	prog     gx.Program
+	imageLoc int32
+}
+
+func newCRT() (*crt, error) {
+	var c crt
+	err := buildBuiltin(&builtinSlot{name: "crt", src: crtFrag, prog: &c.prog, locate: func() {
+		c.imageLoc = gl.GetUniformLocation(uint32(c.prog), gl.Str("image\x00"))
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// drawCRT draws the target's color with nearest filtering into rect of the
+// current framebuffer.
+func drawCRT(c *crt, t *target, rect [4]float32) {
+	gl.Viewport(int32(rect[0]), int32(rect[1]), int32(rect[2]), int32(rect[3]))
+
+	c.prog.Bind()
+	defer gl.UseProgram(0)
+
+	gx.ActiveTexture(0)
+	t.color.Bind(gl.TEXTURE_2D)
+	defer gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	defer gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	defer gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.Uniform1i(c.imageLoc, 0)
+
+	drawFullscreen()
+}
+
+// integerRect returns the largest integer multiple of width x height that
+// fits in the viewport, centered, or a 1x rect if none fits.
+func integerRect(viewport [4]float32, width, height int32) [4]float32 {
+	scale := int32(viewport[2]) / width
+	if s := int32(viewport[3]) / height; s < scale {
+		scale = s
+	}
+	if scale < 1 {
+		scale = 1
+	}
+
+	w, h := float32(width*scale), float32(height*scale)
+	x := viewport[0] + float32(int32((viewport[2]-w)/2))
+	y := viewport[1] + float32(int32((viewport[3]-h)/2))
+	return [4]float32{x, y, w, h}
+}
+
+// parseResolution parses sizes like "1920x1080".
+func parseResolution(s string) (int32, int32, error) {
+	var w, h int32
+	_, err := fmt.Sscanf(s, "%dx%d", &w, &h)
+	if err != nil || w <= 0 || h <= 0 {
+		return 0, 0, fmt.Errorf("invalid resolution %v, expected WIDTHxHEIGHT", s)
+	}
+	return w, h, nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alotabits/shaderdev/internal/glsl"
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/alotabits/shaderdev/internal/mip"
+	"github.com/alotabits/shaderdev/internal/rgbe"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+var mipmapsFlag = flag.String("mipmaps", "off", "how texture inputs get mipmaps for trilinear filtering: off leaves them without, sampled bilinearly, gl generates them with glGenerateMipmap, srgb downsamples 8-bit images in linear light on the CPU; the project's [mipmaps] table sets it per texture")
+
+// checkMipmaps returns an error if s is not a mode of -mipmaps.
+func checkMipmaps(s string) error {
+	switch s {
+	case "gl", "srgb", "off":
+		return nil
+	}
+	return fmt.Errorf("unknown mipmaps mode %v, expected gl, srgb or off", s)
+}
+
+// loadTexture creates a 2D texture from an image file, with mipmaps as
+// given by a mode of -mipmaps. Radiance .hdr files are loaded as floating
+// point textures, anything else the image package can decode as 8-bit RGBA;
+// srgb only applies to the latter, the former being linear already.
+// Images are flipped so the first row of the texture is the bottom of the image.
+func loadTexture(path, mipmaps string) (gx.Texture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	tex := gx.NewTexture(gl.TEXTURE_2D)
+	if strings.ToLower(filepath.Ext(path)) == ".hdr" {
+		if mipmaps == "srgb" {
+			mipmaps = "gl"
+		}
+		img, err := rgbe.Decode(f)
+		if err != nil {
+			tex.Delete()
+			return 0, err
+		}
+		tex.SetData(gl.RGB32F, int32(img.Width), int32(img.Height), gl.RGB, gl.FLOAT, gl.Ptr(img.Pix))
+	} else {
+		img, _, err := image.Decode(f)
+		if err != nil {
+			tex.Delete()
+			return 0, err
+		}
+
+		b := img.Bounds()
+		rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		for y := 0; y < b.Dy(); y++ {
+			dst := image.Rect(0, b.Dy()-1-y, b.Dx(), b.Dy()-y)
+			draw.Draw(rgba, dst, img, image.Pt(b.Min.X, b.Min.Y+y), draw.Src)
+		}
+		tex.SetData(gl.RGBA8, int32(b.Dx()), int32(b.Dy()), gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(rgba.Pix))
+
+		if mipmaps == "srgb" {
+			for i, l := range mip.Chain(mip.Level{Pix: rgba.Pix, Width: b.Dx(), Height: b.Dy()}) {
+				gl.TexImage2D(gl.TEXTURE_2D, int32(i+1), gl.RGBA8, int32(l.Width), int32(l.Height), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(l.Pix))
+			}
+		}
+	}
+
+	tex.Label(path)
+
+	switch mipmaps {
+	case "gl":
+		gl.GenerateMipmap(gl.TEXTURE_2D)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+	case "srgb":
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+	default:
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	}
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	return tex, nil
+}
+
+// textureSpec is a texture input as given, [NAME:][video:]PATH[@FPS], with
+// the sampler uniform it is bound to if named, whether it is a video, and
+// the frame rate of an image sequence, 0 for -sequence-fps.
+type textureSpec struct {
+	name, kind, path string
+	fps              float64
+}
+
+// parseTextureSpec reads a texture input. A name is an identifier of more
+// than one character, to tell it from a drive letter, and not followed by
+// //, to tell it from the scheme of a URL.
+func parseTextureSpec(s string) textureSpec {
+	var t textureSpec
+	i := strings.Index(s, ":")
+	if i > 1 && glsl.IsIdent(s[:i]) && !strings.HasPrefix(s[i+1:], "//") && s[:i] != "video" {
+		t.name, s = s[:i], s[i+1:]
+	}
+	if strings.HasPrefix(s, "video:") {
+		t.kind, s = "video", s[len("video:"):]
+	}
+	if i := strings.LastIndex(s, "@"); i > 0 {
+		fps, err := strconv.ParseFloat(s[i+1:], 64)
+		if err == nil && fps > 0 {
+			t.fps, s = fps, s[:i]
+		}
+	}
+	t.path = s
+	return t
+}
+
+// resolveTextureSpec resolves the path of a texture input, and the
+// directory of a sequence's pattern.
+func resolveTextureSpec(spec textureSpec) (textureSpec, error) {
+	var err error
+	if strings.Contains(spec.path, "%") {
+		var dir string
+		dir, err = resolvePath(filepath.Dir(spec.path), "")
+		spec.path = filepath.Join(dir, filepath.Base(spec.path))
+	} else {
+		spec.path, err = resolvePath(spec.path, "")
+	}
+	return spec, err
+}
+
+// textureInput is a texture loaded from a file for the user's program, bound
+// to the unit of the sampler uniform it is named after, or without a name to
+// the unit matching its position in the list of inputs.
+type textureInput struct {
+	textureSpec
+	mipmaps string
+	id      gx.Texture
+	// the stream of a video, whose texture id is, or the images of a
+	// sequence, one of which it is
+	video    *videoStream
+	sequence *imageSequence
+}
+
+// openTextureInput loads the file of a spec whose path is resolved.
+func openTextureInput(spec textureSpec, mipmaps string) (textureInput, error) {
+	t := textureInput{textureSpec: spec, mipmaps: mipmaps}
+	if spec.kind == "video" {
+		v, err := openVideo(spec.path)
+		if err != nil {
+			return textureInput{}, err
+		}
+		t.video, t.id = v, v.tex
+		return t, nil
+	}
+	if isSequence(spec.path) {
+		s, err := openSequence(spec.path, spec.fps, mipmaps)
+		if err != nil {
+			return textureInput{}, err
+		}
+		t.sequence, t.id = s, s.last
+		return t, nil
+	}
+	id, err := loadTexture(spec.path, mipmaps)
+	if err != nil {
+		return textureInput{}, err
+	}
+	t.id = id
+	return t, nil
+}
+
+func reloadTextureInput(t *textureInput) error {
+	n, err := openTextureInput(t.textureSpec, t.mipmaps)
+	if err != nil {
+		return err
+	}
+	closeTextureInput(t)
+	*t = n
+	return nil
+}
+
+func closeTextureInput(t *textureInput) {
+	switch {
+	case t.video != nil:
+		closeVideo(t.video)
+	case t.sequence != nil:
+		closeSequence(t.sequence)
+	default:
+		t.id.Delete()
+	}
+}
+
+// updateTextureInputs shows the frames of videos and sequences at time t.
+func updateTextureInputs(inputs []textureInput, t time.Duration) {
+	for i, in := range inputs {
+		switch {
+		case in.video != nil:
+			updateVideo(in.video, t)
+		case in.sequence != nil:
+			id, err := sequenceFrame(in.sequence, t)
+			if err != nil {
+				log.Println(err)
+			}
+			inputs[i].id = id
+		}
+	}
+}
+
+func findTextureInput(inputs []textureInput, path string) int {
+	for i, t := range inputs {
+		if t.path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// logTextureInput logs where the input at a position in the list of inputs
+// is bound.
+func logTextureInput(i int, t textureInput) {
+	if t.name != "" {
+		log.Printf("texture %v: %v", t.name, t.path)
+		return
+	}
+	log.Printf("texture unit %v: %v", i, t.path)
+}
+
+// logTextureChecks logs the problems checkTextureInputs finds, and has the
+// samplers checked again at the next draw.
+func logTextureChecks(p *program, inputs []textureInput) {
+	for _, s := range checkTextureInputs(p, inputs) {
+		log.Println("texture input:", s)
+	}
+	p.checkSamplers = true
+}
+
+// textureInputUnit returns the unit an input is bound to in a program, and
+// false if it is named after no sampler of the program.
+func textureInputUnit(p *program, inputs []textureInput, i int) (uint32, bool) {
+	t := inputs[i]
+	if t.name == "" {
+		return uint32(i), true
+	}
+	for _, s := range p.samplers {
+		if strings.TrimSuffix(s.name, "[0]") == t.name {
+			return s.unit, true
+		}
+	}
+	return 0, false
+}
+
+// bindTextureInputs binds the inputs to their units, the named last so they
+// take the units of their samplers over any unnamed input.
+func bindTextureInputs(p *program, inputs []textureInput) {
+	for _, named := range []bool{false, true} {
+		for i, t := range inputs {
+			unit, ok := textureInputUnit(p, inputs, i)
+			if ok && (t.name != "") == named {
+				gx.ActiveTexture(unit)
+				t.id.Bind(gl.TEXTURE_2D)
+			}
+		}
+	}
+	gx.ActiveTexture(0)
+}
+
+func unbindTextureInputs(p *program, inputs []textureInput) {
+	for i := range inputs {
+		if unit, ok := textureInputUnit(p, inputs, i); ok {
+			gx.ActiveTexture(unit)
+			gl.BindTexture(gl.TEXTURE_2D, 0)
+		}
+	}
+	gx.ActiveTexture(0)
+}
+
+// checkTextureInputs describes every named input the program has no
+// sampler for, or no 2D sampler.
+func checkTextureInputs(p *program, inputs []textureInput) []string {
+	var res []string
+	for i, t := range inputs {
+		if _, ok := textureInputUnit(p, inputs, i); !ok {
+			res = append(res, fmt.Sprintf("%v: no sampler uniform %v", t.path, t.name))
+			continue
+		}
+		v := p.active[t.name]
+		if target, _ := gx.SamplerTarget(v.Type); t.name != "" && target != gl.TEXTURE_2D {
+			res = append(res, fmt.Sprintf("%v: sampler %v is %v, not a 2D sampler", t.path, t.name, gx.TypeStr(v.Type)))
+		}
+	}
+	return res
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// Transitions blend an outgoing image into an incoming one. Their fragment
+// shaders sample the two from the from and to uniforms, at uv, and are given
+// how far along they are, from 0 to 1, in progress.
+
+const cutFrag = `#version 330 core
+uniform sampler2D from;
+uniform sampler2D to;
+uniform float progress;
+
+in vec2 uv;
+out vec4 color;
+
+void main() {
+	color = progress < 0.5 ? texture(from, uv) : texture(to, uv);
+}
+`
+
+const fadeFrag = `#version 330 core
+uniform sampler2D from;
+uniform sampler2D to;
+uniform float progress;
+
+in vec2 uv;
+out vec4 color;
+
+void main() {
+	color = mix(texture(from, uv), texture(to, uv), progress);
+}
+`
+
+const wipeFrag = `#version 330 core
+uniform sampler2D from;
+uniform sampler2D to;
+uniform float progress;
+
+in vec2 uv;
+out vec4 color;
+
+void main() {
+	// a soft edge sweeping left to right, starting and ending off screen
+	float edge = progress * 1.1 - 0.05;
+	color = mix(texture(to, uv), texture(from, uv), smoothstep(edge - 0.05, edge + 0.05, uv.x));
+}
+`
+
+var transitionFrags = map[string]string{
+	"cut":  cutFrag,
+	"fade": fadeFrag,
+	"wipe": wipeFrag,
+}
+
+type transition struct {
+	prog        gx.Program
+	fromLoc     int32
+	toLoc       int32
+	progressLoc int32
+	duration    time.Duration
+}
+
+// splitTransitionSpec splits specs like wipe:0.5 into the transition and
+// its duration, or def if it has none.
+func splitTransitionSpec(spec string, def time.Duration) (string, time.Duration, error) {
+	i := strings.LastIndex(spec, ":")
+	if i < 0 {
+		return spec, def, nil
+	}
+	secs, err := strconv.ParseFloat(spec[i+1:], 64)
+	if err != nil {
+		// a path with a colon, e.g. C:\wipe.glsl
+		return spec, def, nil
+	}
+	if secs < 0 {
+		return "", 0, fmt.Errorf("transition %v: negative duration", spec)
+	}
+	return spec[:i], time.Duration(secs * float64(time.Second)), nil
+}
+
+// newTransition builds a transition from a spec naming a built-in one, cut,
+// fade or wipe, or a fragment shader file, optionally followed by its
+// duration in seconds, e.g. wipe:0.5.
+func newTransition(spec string, def time.Duration) (*transition, error) {
+	name, duration, err := splitTransitionSpec(spec, def)
+	if err != nil {
+		return nil, err
+	}
+
+	var t transition
+	t.duration = duration
+	slot := &builtinSlot{name: name, src: transitionFrags[name], prog: &t.prog, locate: func() {
+		t.fromLoc = gl.GetUniformLocation(uint32(t.prog), gl.Str("from\x00"))
+		t.toLoc = gl.GetUniformLocation(uint32(t.prog), gl.Str("to\x00"))
+		t.progressLoc = gl.GetUniformLocation(uint32(t.prog), gl.Str("progress\x00"))
+	}}
+	if slot.src == "" {
+		// a shader of the user's, reloading like the replaced built-ins
+		if _, err := os.Stat(name); err != nil {
+			return nil, fmt.Errorf("transition %v is neither cut, fade, wipe nor a readable shader: %v", name, err)
+		}
+		slot.name, slot.path = "transition", name
+	}
+	err = buildBuiltin(slot)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// transitionProgress returns how far a transition started at start is at
+// now, from 0 to 1.
+func transitionProgress(t *transition, start, now time.Time) float32 {
+	if t.duration <= 0 {
+		return 1
+	}
+	p := float32(now.Sub(start)) / float32(t.duration)
+	if p > 1 {
+		p = 1
+	}
+	return p
+}
+
+// drawTransition draws the textures from and to blended progress of the
+// way into the current framebuffer. Either may be 0, for black.
+func drawTransition(t *transition, from, to gx.Texture, progress float32) {
+	t.prog.Bind()
+	defer gl.UseProgram(0)
+
+	for i, tex := range []gx.Texture{from, to} {
+		gx.ActiveTexture(uint32(i))
+		tex.Bind(gl.TEXTURE_2D)
+	}
+	defer func() {
+		gx.ActiveTexture(1)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+		gx.ActiveTexture(0)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+	}()
+	gl.Uniform1i(t.fromLoc, 0)
+	gl.Uniform1i(t.toLoc, 1)
+	gl.Uniform1f(t.progressLoc, progress)
+
+	drawFullscreen()
+}
+
+// reloadTransition blends the last frame of a program into the frames of
+// the program relinked in its place.
+type reloadTransition struct {
+	t *transition
+	// the frame last presented, and the one a transition started from
+	last *target
+	from *target
+	// the frame being presented, as drawn by the new program
+	to    *target
+	start time.Time
+}
+
+// copyFramebuffer copies the default framebuffer into t.
+func copyFramebuffer(t *target) {
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	gl.BindFramebuffer(gl.DRAW_FRAMEBUFFER, t.fbo)
+	defer gl.BindFramebuffer(gl.DRAW_FRAMEBUFFER, 0)
+	gl.BlitFramebuffer(0, 0, t.width, t.height, 0, 0, t.width, t.height, gl.COLOR_BUFFER_BIT, gl.NEAREST)
+}
+
+// startReloadTransition starts blending from the frame last presented.
+func startReloadTransition(r *reloadTransition, now time.Time) {
+	if r.last == nil {
+		return
+	}
+	r.last, r.from = r.from, r.last
+	r.start = now
+}
+
+// presentReloadTransition blends the frame in the default framebuffer, of
+// the given size, with the one the transition started from, if it is
+// still going, and keeps the result for the next transition.
+func presentReloadTransition(r *reloadTransition, width, height int32, now time.Time) error {
+	for name, t := range map[string]**target{"transition last": &r.last, "transition from": &r.from, "transition to": &r.to} {
+		if *t != nil && ((*t).width != width || (*t).height != height) {
+			deleteTarget(*t)
+			*t = nil
+		}
+		if *t == nil {
+			var err error
+			*t, err = newTarget(name, width, height, gl.RGBA8)
+			if err != nil {
+				return err
+			}
+			if t == &r.from {
+				// nothing to blend from at this size
+				r.start = time.Time{}
+			}
+		}
+	}
+
+	if !r.start.IsZero() {
+		progress := transitionProgress(r.t, r.start, now)
+		copyFramebuffer(r.to)
+		gl.Viewport(0, 0, width, height)
+		drawTransition(r.t, r.from.color, r.to.color, progress)
+		if progress >= 1 {
+			r.start = time.Time{}
+		}
+	}
+	copyFramebuffer(r.last)
+	return nil
+}
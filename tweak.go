@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/alotabits/shaderdev/internal/glsl"
+	"github.com/alotabits/shaderdev/internal/gx"
+)
+
+var tweaksPath = flag.String("tweaks", "", "JSON file the uniforms set from the panel or standard input are restored from at start and saved to as they change, so tuning survives restarts; -uniform takes precedence")
+
+// Shaders declare tweakable uniforms with pragmas, see glsl.Tweak, giving
+// their ranges, defaults and the controls that present them. The defaults
+// are the least of the values of a uniform: the defaults file, the project,
+// -uniform and the controls all take precedence, and a value set since
+// survives reloads unless the shader changes the default.
+
+// updateTweaks collects the tweaks declared in the sources of a newly
+// linked program and sets the defaults of those whose uniform has no value,
+// or the default the shader last gave.
+func updateTweaks(p *program) []error {
+	var errs []error
+	tweaks := make(map[string]*glsl.Tweak)
+	for stage, s := range p.shaderByStage {
+		tws, err := glsl.Tweaks(s.source)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", stageName(stage, s), err))
+			continue
+		}
+		for _, tw := range tws {
+			if v, ok := p.active[tw.Name]; ok && gx.TypeStr(v.Type) != tw.Type {
+				errs = append(errs, fmt.Errorf("%v:%v: %v declared %v, the uniform is %v", stageName(stage, s), tw.Line, tw.Name, tw.Type, gx.TypeStr(v.Type)))
+			}
+			tweaks[tw.Name] = tw
+		}
+	}
+
+	values := make(map[string][]float64)
+	defaults := make(map[string][]float64)
+	for name, tw := range tweaks {
+		if tw.Default == nil {
+			continue
+		}
+		defaults[name] = tw.Default
+		if i, ok := p.uniforms.slot[name]; ok {
+			v := p.uniforms.values[i]
+			if v != nil && !reflect.DeepEqual(v, p.tweakDefaults[name]) {
+				continue
+			}
+		}
+		values[name] = tw.Default
+	}
+	p.tweaks, p.tweakDefaults = tweaks, defaults
+
+	return append(errs, applyUniforms(p, values)...)
+}
+
+// checkTweakRange returns an error if values fall outside the range a
+// tweak gives its uniform.
+func checkTweakRange(p *program, name string, vals []float64) error {
+	tw, ok := p.tweaks[name]
+	if !ok || tw.Min >= tw.Max {
+		return nil
+	}
+	for _, v := range vals {
+		if v < tw.Min || v > tw.Max {
+			return fmt.Errorf("%v: %v is outside %v..%v", name, v, tw.Min, tw.Max)
+		}
+	}
+	return nil
+}
+
+// savedTweak is the value of a uniform in a -tweaks file, with its type if
+// it was active.
+type savedTweak struct {
+	Type   string    `json:"type,omitempty"`
+	Values []float64 `json:"values"`
+}
+
+// tweaksSaved is when the -tweaks file was last written.
+var tweaksSaved time.Time
+
+// setTweak sets a uniform from the panel or standard input, to be saved
+// with -tweaks.
+func setTweak(p *program, name string, vals []float64) []error {
+	errs := applyUniforms(p, map[string][]float64{name: vals})
+	s := p.uniforms
+	i := s.slot[name]
+	s.tweaked[i], s.dirty = true, true
+	return errs
+}
+
+// loadTweaks sets the uniforms saved at path, if any, but for those given
+// with -uniform and those whose type has changed since.
+func loadTweaks(p *program, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved map[string]savedTweak
+	err = json.Unmarshal(b, &saved)
+	if err != nil {
+		return fmt.Errorf("%v: %v", path, err)
+	}
+
+	for name, t := range saved {
+		if _, ok := uniformOverrides[name]; ok {
+			continue
+		}
+		if v, ok := p.active[name]; ok && t.Type != "" && gx.TypeStr(v.Type) != t.Type {
+			log.Printf("%v: %v is now %v, was %v; its value is dropped", path, name, gx.TypeStr(v.Type), t.Type)
+			continue
+		}
+		for _, err := range setTweak(p, name, t.Values) {
+			log.Printf("%v: %v", path, err)
+		}
+	}
+	p.uniforms.dirty = false
+	return nil
+}
+
+// saveTweaks writes the uniforms set from the panel or standard input to
+// path.
+func saveTweaks(p *program, path string) error {
+	s := p.uniforms
+	saved := make(map[string]savedTweak)
+	for i, name := range s.names {
+		if !s.tweaked[i] {
+			continue
+		}
+		var t string
+		if s.types[i] != 0 {
+			t = gx.TypeStr(s.types[i])
+		}
+		saved[name] = savedTweak{t, s.values[i]}
+	}
+
+	b, err := json.MarshalIndent(saved, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, append(b, '\n'), 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return err
+	}
+	s.dirty = false
+	tweaksSaved = time.Now()
+	return nil
+}
+
+// autosaveTweaks saves the tweaked uniforms to -tweaks if any changed, at
+// most once a second unless final.
+func autosaveTweaks(p *program, final bool) {
+	if *tweaksPath == "" || !p.uniforms.dirty || !final && time.Since(tweaksSaved) < time.Second {
+		return
+	}
+	err := saveTweaks(p, *tweaksPath)
+	if err != nil {
+		log.Println(err)
+	}
+}
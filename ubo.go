@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// Uniforms in named blocks are set by name like any other, e.g. Params.gain
+// for a member of uniform Params { float gain; } params, or gain if the
+// block has no instance name. Their values are packed into a buffer per
+// block by the layout the program reports, std140 or otherwise, and the
+// buffer is bound at the block's index.
+
+// uniformBlock is an active uniform block and the buffer backing it, kept
+// by block name across links.
+type uniformBlock struct {
+	gx.UniformBlock
+	buf  gx.Buffer
+	data []byte
+	// whether data has changed since it was last uploaded
+	dirty bool
+}
+
+// blockMember is where a uniform set by name lies in a block.
+type blockMember struct {
+	block  *uniformBlock
+	member gx.BlockMember
+}
+
+// updateBlocks reflects the uniform blocks of a newly linked program,
+// reusing the buffers of blocks it had before. Their data starts zeroed,
+// for remapUniforms to set the values remembered.
+func updateBlocks(p *program) {
+	blocks := make(map[string]*uniformBlock)
+	p.blockMembers = make(map[string]*blockMember)
+	for _, ub := range gx.ActiveUniformBlocks(uint32(p.id)) {
+		b, ok := p.blocks[ub.Name]
+		if ok {
+			delete(p.blocks, ub.Name)
+		} else {
+			b = &uniformBlock{}
+			b.buf = gx.NewBuffer()
+			b.buf.Label("block " + ub.Name)
+		}
+		b.UniformBlock = ub
+		b.data = make([]byte, ub.DataSize)
+		b.dirty = true
+		gl.UniformBlockBinding(uint32(p.id), ub.Index, ub.Index)
+		blocks[ub.Name] = b
+
+		for _, m := range ub.Members {
+			p.blockMembers[strings.TrimSuffix(m.Name, "[0]")] = &blockMember{b, m}
+		}
+	}
+	for _, b := range p.blocks {
+		b.buf.Delete()
+	}
+	p.blocks = blocks
+}
+
+// packMember packs values into the buffer of a member's block, filling as
+// many elements of an array member as the values cover.
+func packMember(m *blockMember, vals []float64) error {
+	_, n := gx.TypeComponents(m.member.Type)
+	if max := int(n * m.member.Size); n > 0 && len(vals)%int(n) == 0 && len(vals) > max {
+		vals = vals[:max]
+	}
+	err := gx.PackUniform(m.block.data, m.member, vals)
+	if err != nil {
+		return err
+	}
+	m.block.dirty = true
+	return nil
+}
+
+// bindBlocks uploads the blocks whose values changed and binds their
+// buffers for the program's draws.
+func bindBlocks(p *program) {
+	if len(p.blocks) == 0 {
+		return
+	}
+	for _, b := range p.blocks {
+		if b.dirty {
+			b.buf.SetData(len(b.data), gl.Ptr(b.data), gl.DYNAMIC_DRAW)
+			b.dirty = false
+		}
+		gl.BindBufferBase(gl.UNIFORM_BUFFER, b.Index, uint32(b.buf))
+	}
+	gl.BindBuffer(gl.UNIFORM_BUFFER, 0)
+}
@@ -1,7 +1,18 @@
 #line 1
 uniform vec4 viewport;
 uniform vec4 cursor;
+uniform int buttons;
+uniform vec2 scroll;
+uniform float gamepadAxes[8];
+uniform int gamepadButtons[32];
 uniform vec4 time;
+uniform float deltaTime;
+uniform int frame;
+uniform uint seed;
+uniform float focalLength;
+uniform float aperture;
+uniform float focusDistance;
+uniform vec2 nearFar;
 uniform mat4 projection;
 uniform mat4 view;
 uniform mat4 model;
@@ -17,6 +28,8 @@ uniform mat4 model;
 
 	void main() {
 		gl_Position = projection*view*model*position;
+		// used with -draw points
+		gl_PointSize = 4;
 		outData.position = position;
 		outData.color = color;
 	}
@@ -32,6 +45,9 @@ uniform mat4 model;
 
 	void main() {
 		color = inData.color;
+	#ifdef DEPTH_LOG
+		gl_FragDepth = log2(1 + 1/gl_FragCoord.w) / log2(1 + nearFar.y);
+	#endif
 	}
 #endif
 
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// semanticUniforms are the uniforms the tool sets itself, every frame or
+// from the model. Any other active uniform is set by name, from the
+// defaults, the project or the controls, and keeps its value across links.
+var semanticUniforms = map[string]bool{
+	"viewport":       true,
+	"cursor":         true,
+	"buttons":        true,
+	"scroll":         true,
+	"gamepadAxes":    true,
+	"gamepadButtons": true,
+	"time":           true,
+	"deltaTime":      true,
+	"frame":          true,
+	"seed":           true,
+	"focalLength":    true,
+	"aperture":       true,
+	"focusDistance":  true,
+	"nearFar":        true,
+	"projection":     true,
+	"view":           true,
+	"model":          true,
+	"jointMatrices":  true,
+	"morphWeights":   true,
+	"diffuseColor":   true,
+	"specularColor":  true,
+	"emissiveColor":  true,
+	"shininess":      true,
+	"opacity":        true,
+}
+
+// uniformOverrides are the values given with -uniform, by uniform name.
+var uniformOverrides = make(map[string][]float64)
+
+// parseUniformSpecs reads the NAME=V[,V...] values of -uniform into
+// uniformOverrides. Booleans are read as 1 and 0, like those of the
+// defaults; the types are checked once the uniforms are set.
+func parseUniformSpecs(specs []string) error {
+	for _, spec := range specs {
+		i := strings.Index(spec, "=")
+		if i <= 0 {
+			return fmt.Errorf("invalid -uniform %v, expected NAME=V[,V...]", spec)
+		}
+		if semanticUniforms[spec[:i]] {
+			return fmt.Errorf("invalid -uniform %v: %v is set by the tool", spec, spec[:i])
+		}
+		vals, err := parseUniformValues(spec[i+1:])
+		if err != nil {
+			return fmt.Errorf("invalid -uniform %v: %v", spec, err)
+		}
+		uniformOverrides[spec[:i]] = vals
+	}
+	return nil
+}
+
+// parseUniformValues reads comma separated numbers, true or false.
+func parseUniformValues(s string) ([]float64, error) {
+	var vals []float64
+	for _, s := range strings.Split(s, ",") {
+		s = strings.TrimSpace(s)
+		switch s {
+		case "true":
+			vals = append(vals, 1)
+		case "false":
+			vals = append(vals, 0)
+		default:
+			x, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, x)
+		}
+	}
+	return vals, nil
+}
+
+// uniformValues reads back the values of an active uniform of a program,
+// every element of an array in turn.
+func uniformValues(p *program, name string) ([]float64, error) {
+	if m, ok := p.blockMembers[name]; ok {
+		return gx.UnpackUniform(m.block.data, m.member)
+	}
+	v, ok := p.active[name]
+	if !ok || !gx.IsValidUniformLoc(v.Location) {
+		return nil, fmt.Errorf("no active uniform %v", name)
+	}
+	base, n := gx.TypeComponents(v.Type)
+	if target, _ := gx.SamplerTarget(v.Type); target != 0 {
+		base, n = gl.INT, 1
+	}
+	if n == 0 || base == gl.DOUBLE {
+		return nil, fmt.Errorf("%v: cannot read %v uniforms", name, gx.TypeStr(v.Type))
+	}
+
+	var res []float64
+	for i := int32(0); i < v.Size; i++ {
+		loc := v.Location
+		if i > 0 {
+			loc = gl.GetUniformLocation(uint32(p.id), gl.Str(fmt.Sprintf("%v[%v]\x00", name, i)))
+		}
+		switch base {
+		case gl.FLOAT:
+			f := make([]float32, n)
+			gl.GetUniformfv(uint32(p.id), loc, &f[0])
+			for _, x := range f {
+				res = append(res, float64(x))
+			}
+		case gl.UNSIGNED_INT:
+			u := make([]uint32, n)
+			gl.GetUniformuiv(uint32(p.id), loc, &u[0])
+			for _, x := range u {
+				res = append(res, float64(x))
+			}
+		default:
+			d := make([]int32, n)
+			gl.GetUniformiv(uint32(p.id), loc, &d[0])
+			for _, x := range d {
+				res = append(res, float64(x))
+			}
+		}
+	}
+	return res, nil
+}
+
+// reflectUniforms builds the table of the active uniforms of a newly linked
+// program. Array uniforms are reported by their first element and kept by
+// the name they were declared with.
+func reflectUniforms(p *program) {
+	p.active = make(map[string]gx.Variable)
+	for _, v := range gx.ActiveUniforms(uint32(p.id)) {
+		p.active[strings.TrimSuffix(v.Name, "[0]")] = v
+	}
+}
+
+// activeLocation returns the location of a uniform in the program's last
+// link, or -1 if it isn't active.
+func activeLocation(p *program, name string) int32 {
+	if v, ok := p.active[name]; ok {
+		return v.Location
+	}
+	return -1
+}
+
+// isSettable reports whether an active uniform is left to be set by name:
+// neither set by the tool nor a sampler, and either loose or a member of a
+// uniform block.
+func isSettable(p *program, name string, v gx.Variable) bool {
+	target, _ := gx.SamplerTarget(v.Type)
+	if semanticUniforms[name] || target != 0 {
+		return false
+	}
+	_, inBlock := p.blockMembers[name]
+	return gx.IsValidUniformLoc(v.Location) || inBlock
+}
+
+// settableUniforms lists the active uniforms left to be set by name, with
+// their types, in order of name; empty if there are none.
+func settableUniforms(p *program) string {
+	var res []string
+	for name, v := range p.active {
+		if !isSettable(p, name, v) {
+			continue
+		}
+		typ := gx.TypeStr(v.Type)
+		if v.Size > 1 {
+			typ = fmt.Sprintf("%v[%v]", typ, v.Size)
+		}
+		if tw, ok := p.tweaks[name]; ok && tw.Min < tw.Max {
+			typ = fmt.Sprintf("%v %v..%v", typ, tw.Min, tw.Max)
+		}
+		res = append(res, name+" "+typ)
+	}
+	sort.Strings(res)
+	return strings.Join(res, ", ")
+}
+
+// setUniform sets a uniform of the current program from a flat list of
+// values, filling as many elements of an array uniform as the values cover.
+func setUniform(v gx.Variable, vals []float64) error {
+	base, n := gx.TypeComponents(v.Type)
+	if n == 0 || base == gl.DOUBLE {
+		return fmt.Errorf("%v: cannot set %v uniforms", v.Name, gx.TypeStr(v.Type))
+	}
+	if len(vals) == 0 || len(vals)%int(n) != 0 {
+		return fmt.Errorf("%v: %v needs a multiple of %v values, have %v", v.Name, gx.TypeStr(v.Type), n, len(vals))
+	}
+	count := int32(len(vals)) / n
+	if count > v.Size {
+		count = v.Size
+	}
+	vals = vals[:count*n]
+
+	loc := v.Location
+	if loc < 0 {
+		return fmt.Errorf("%v: uniforms in blocks cannot be set", v.Name)
+	}
+
+	switch base {
+	case gl.FLOAT:
+		f := make([]float32, len(vals))
+		for i, x := range vals {
+			f[i] = float32(x)
+		}
+		switch v.Type {
+		case gl.FLOAT:
+			gl.Uniform1fv(loc, count, &f[0])
+		case gl.FLOAT_VEC2:
+			gl.Uniform2fv(loc, count, &f[0])
+		case gl.FLOAT_VEC3:
+			gl.Uniform3fv(loc, count, &f[0])
+		case gl.FLOAT_VEC4:
+			gl.Uniform4fv(loc, count, &f[0])
+		case gl.FLOAT_MAT2:
+			gl.UniformMatrix2fv(loc, count, false, &f[0])
+		case gl.FLOAT_MAT3:
+			gl.UniformMatrix3fv(loc, count, false, &f[0])
+		case gl.FLOAT_MAT4:
+			gl.UniformMatrix4fv(loc, count, false, &f[0])
+		default:
+			return fmt.Errorf("%v: cannot set %v uniforms", v.Name, gx.TypeStr(v.Type))
+		}
+	case gl.INT, gl.BOOL:
+		d := make([]int32, len(vals))
+		for i, x := range vals {
+			d[i] = int32(x)
+		}
+		switch n {
+		case 1:
+			gl.Uniform1iv(loc, count, &d[0])
+		case 2:
+			gl.Uniform2iv(loc, count, &d[0])
+		case 3:
+			gl.Uniform3iv(loc, count, &d[0])
+		case 4:
+			gl.Uniform4iv(loc, count, &d[0])
+		}
+	case gl.UNSIGNED_INT:
+		u := make([]uint32, len(vals))
+		for i, x := range vals {
+			u[i] = uint32(x)
+		}
+		switch n {
+		case 1:
+			gl.Uniform1uiv(loc, count, &u[0])
+		case 2:
+			gl.Uniform2uiv(loc, count, &u[0])
+		case 3:
+			gl.Uniform3uiv(loc, count, &u[0])
+		case 4:
+			gl.Uniform4uiv(loc, count, &u[0])
+		}
+	}
+
+	return nil
+}
+
+// uniformSlots gives the uniforms set by name stable slots, assigned the
+// first time each name is seen and kept however a relink moves their
+// locations, and remembers the values last set through each so they can be
+// reapplied after every relink. External controls refer to slots rather
+// than locations, so their mappings survive shaders being refactored.
+type uniformSlots struct {
+	slot  map[string]int
+	names []string
+	// the active uniform of each slot in the current link, with location
+	// -1 when it isn't active or is a member of a block, and where in its
+	// block if it is
+	vars    []gx.Variable
+	members []*blockMember
+	// the values last set for each slot, nil if none, and the type of the
+	// uniform they were set on, 0 if it wasn't active
+	values [][]float64
+	types  []uint32
+	// whether the values were set from the panel or standard input, to be
+	// saved with -tweaks, and whether any have been since the last save
+	tweaked []bool
+	dirty   bool
+}
+
+func newUniformSlots() *uniformSlots {
+	return &uniformSlots{slot: make(map[string]int)}
+}
+
+// uniformSlot returns the slot of a uniform name, assigning a new one the
+// first time.
+func uniformSlot(s *uniformSlots, name string) int {
+	if i, ok := s.slot[name]; ok {
+		return i
+	}
+	i := len(s.names)
+	s.slot[name] = i
+	s.names = append(s.names, name)
+	s.vars = append(s.vars, gx.Variable{Name: name, Location: -1})
+	s.members = append(s.members, nil)
+	s.values = append(s.values, nil)
+	s.types = append(s.types, 0)
+	s.tweaked = append(s.tweaked, false)
+	return i
+}
+
+// lookupSlots finds the uniform of each slot in the program's last link.
+func lookupSlots(s *uniformSlots, p *program) {
+	for i := range s.vars {
+		s.vars[i] = gx.Variable{Name: s.names[i], Location: -1}
+		s.members[i] = p.blockMembers[s.names[i]]
+	}
+	for name, v := range p.active {
+		if i, ok := s.slot[name]; ok {
+			s.vars[i] = v
+		}
+	}
+}
+
+// slotActive reports whether the uniform of a slot is active, loose or in
+// a block.
+func slotActive(s *uniformSlots, slot int) bool {
+	return s.vars[slot].Location >= 0 || s.members[slot] != nil
+}
+
+// setSlotUniform sets the uniform of a slot in the current program, or
+// packs it into its block.
+func setSlotUniform(s *uniformSlots, slot int, vals []float64) error {
+	if m := s.members[slot]; m != nil {
+		return packMember(m, vals)
+	}
+	return setUniform(s.vars[slot], vals)
+}
+
+// remapUniforms looks up the slots in a newly linked program and sets the
+// remembered values of those still active, returning an error for each that
+// no longer fits its uniform. Values of uniforms whose type changed are
+// dropped. It leaves the current program unchanged.
+func remapUniforms(s *uniformSlots, p *program) []error {
+	lookupSlots(s, p)
+
+	var prev int32
+	gl.GetIntegerv(gl.CURRENT_PROGRAM, &prev)
+	defer gl.UseProgram(uint32(prev))
+	p.id.Bind()
+
+	var errs []error
+	for i, vals := range s.values {
+		if vals == nil || !slotActive(s, i) {
+			continue
+		}
+		if t := s.types[i]; t != 0 && t != s.vars[i].Type {
+			errs = append(errs, fmt.Errorf("%v is now %v, was %v; its value is dropped", s.names[i], gx.TypeStr(s.vars[i].Type), gx.TypeStr(t)))
+			s.dirty = s.dirty || s.tweaked[i]
+			s.values[i], s.types[i], s.tweaked[i] = nil, 0, false
+			continue
+		}
+		if err := setSlotUniform(s, i, vals); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// setSlot remembers the values of a slot and sets its uniform if active,
+// in the current program. The values are no longer the ones tweaked.
+func setSlot(s *uniformSlots, slot int, vals []float64) error {
+	s.dirty = s.dirty || s.tweaked[slot]
+	s.values[slot], s.types[slot], s.tweaked[slot] = vals, 0, false
+	if !slotActive(s, slot) {
+		return nil
+	}
+	err := setSlotUniform(s, slot, vals)
+	if err == nil {
+		s.types[slot] = s.vars[slot].Type
+	}
+	return err
+}
+
+// applyUniforms sets the uniforms named in values, remembering them for
+// later links, and leaves the current program unchanged.
+func applyUniforms(p *program, values map[string][]float64) []error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	n := len(p.uniforms.names)
+	for name := range values {
+		uniformSlot(p.uniforms, name)
+	}
+	if len(p.uniforms.names) > n {
+		lookupSlots(p.uniforms, p)
+	}
+
+	var prev int32
+	gl.GetIntegerv(gl.CURRENT_PROGRAM, &prev)
+	defer gl.UseProgram(uint32(prev))
+	p.id.Bind()
+
+	var errs []error
+	for name, vals := range values {
+		err := setSlot(p.uniforms, p.uniforms.slot[name], vals)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/glsl"
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// declared is a uniform or vertex input found in the sources of a program.
+type declared struct {
+	kind string
+	name string
+	// where it was declared, e.g. frag.glsl:12
+	pos string
+	// whether main of any stage reaches it
+	used bool
+}
+
+// baseName strips the array index and struct fields from the name of an
+// active variable, leaving the name it was declared with.
+func baseName(name string) string {
+	if i := strings.IndexAny(name, "[."); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// stageName names the file of a stage's source, or the stage when its
+// source is several files.
+func stageName(stage uint32, s *shader) string {
+	if len(s.paths) == 1 {
+		return s.paths[0]
+	}
+	return gx.StageStr(stage) + " shader"
+}
+
+// declaredVars returns the uniforms of every stage and the inputs of the
+// vertex stage of a program, by name.
+func declaredVars(p *program) map[string]*declared {
+	vars := make(map[string]*declared)
+	for stage, s := range p.shaderByStage {
+		f, err := glsl.Parse(s.source)
+		if err != nil {
+			// left to the compiler, or beyond what the parser follows
+			log.Printf("%v:%v, not checked for unused variables", stageName(stage, s), err)
+			continue
+		}
+		used := glsl.Used(f, "main")
+
+		for _, d := range f.Decls {
+			d, ok := d.(*glsl.VarDecl)
+			if !ok {
+				continue
+			}
+			kind := ""
+			for _, q := range d.Qualifiers {
+				switch {
+				case q == "uniform":
+					kind = "uniform"
+				case (q == "in" || q == "attribute") && stage == gl.VERTEX_SHADER:
+					kind = "attribute"
+				}
+			}
+			if kind == "" {
+				continue
+			}
+
+			for _, v := range d.Vars {
+				dv := vars[v.Name]
+				if dv == nil {
+					dv = &declared{kind: kind, name: v.Name, pos: fmt.Sprintf("%v:%v", stageName(stage, s), d.Line)}
+					vars[v.Name] = dv
+				}
+				dv.used = dv.used || used[v.Name]
+			}
+		}
+	}
+	return vars
+}
+
+// reportUnused logs the uniforms and attributes a linked program declares
+// but doesn't have active, either because no main reaches them or because
+// the compiler found they don't affect the output and removed them. Both
+// leave their location at -1.
+func reportUnused(p *program) {
+	vars := declaredVars(p)
+
+	active := make(map[string]bool)
+	for _, v := range gx.ActiveUniforms(uint32(p.id)) {
+		active[baseName(v.Name)] = true
+	}
+	for _, v := range gx.ActiveAttribs(uint32(p.id)) {
+		active[baseName(v.Name)] = true
+	}
+
+	var msgs []string
+	for _, v := range vars {
+		switch {
+		case active[v.name]:
+		case !v.used:
+			msgs = append(msgs, fmt.Sprintf("%v: %v %v is never used", v.pos, v.kind, v.name))
+		default:
+			msgs = append(msgs, fmt.Sprintf("%v: %v %v is used but optimized away, as it doesn't affect the output", v.pos, v.kind, v.name))
+		}
+	}
+	sort.Strings(msgs)
+	for _, m := range msgs {
+		log.Println(m)
+	}
+}
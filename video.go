@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// videoStream is a video file decoded by an ffmpeg child process into a
+// texture, showing the frame at the clock's time and looping at the end.
+// Frames are uploaded through two pixel buffers in turn, so the copy to the
+// texture need not wait for the previous upload.
+type videoStream struct {
+	path          string
+	width, height int32
+	// the frame rate as ffprobe gives it, e.g. 30000/1001, and in frames
+	// per second
+	rate     string
+	fps      float64
+	duration time.Duration
+
+	// the decoder, the frames it decodes and the index of the next
+	cmd    *exec.Cmd
+	frames chan []byte
+	done   chan struct{}
+	next   int
+	// the index of the frame in the texture, -1 if none
+	shown int
+
+	tex  gx.Texture
+	pbos [2]gx.Buffer
+	pbo  int
+}
+
+// probeVideo reads the size, frame rate and duration of the first video
+// stream of a file with ffprobe.
+func probeVideo(v *videoStream) error {
+	var errs bytes.Buffer
+	cmd := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "stream=width,height,avg_frame_rate:format=duration",
+		"-of", "default=noprint_wrappers=1", v.path)
+	cmd.Stderr = &errs
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("%v: probing with ffprobe: %v %v", v.path, err, strings.TrimSpace(errs.String()))
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "width", "height":
+			n, _ := strconv.Atoi(kv[1])
+			if kv[0] == "width" {
+				v.width = int32(n)
+			} else {
+				v.height = int32(n)
+			}
+		case "avg_frame_rate":
+			d, err := parseSeconds(kv[1])
+			if err == nil && d > 0 {
+				v.rate, v.fps = kv[1], d.Seconds()
+			}
+		case "duration":
+			s, err := strconv.ParseFloat(kv[1], 64)
+			if err == nil {
+				v.duration = time.Duration(s * float64(time.Second))
+			}
+		}
+	}
+	if v.width <= 0 || v.height <= 0 || v.fps == 0 {
+		return fmt.Errorf("%v: no video stream", v.path)
+	}
+	return nil
+}
+
+// openVideo probes a video file and starts decoding it from the start.
+func openVideo(path string) (*videoStream, error) {
+	v := &videoStream{path: path, shown: -1}
+	err := probeVideo(v)
+	if err != nil {
+		return nil, err
+	}
+
+	v.tex = gx.NewTexture(gl.TEXTURE_2D)
+	v.tex.Label(path)
+	v.tex.SetData(gl.RGBA8, v.width, v.height, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	for i := range v.pbos {
+		v.pbos[i] = gx.NewBuffer()
+		v.pbos[i].Label(path + " upload")
+	}
+
+	err = startDecoder(v, 0)
+	if err != nil {
+		closeVideo(v)
+		return nil, err
+	}
+	return v, nil
+}
+
+// startDecoder starts decoding at a frame, flipped so the first row of each
+// is the bottom of the picture.
+func startDecoder(v *videoStream, frame int) error {
+	from := strconv.FormatFloat(float64(frame)/v.fps, 'f', -1, 64)
+	v.cmd = exec.Command("ffmpeg", "-v", "error", "-ss", from, "-i", v.path,
+		"-an", "-vf", "vflip", "-r", v.rate, "-f", "rawvideo", "-pix_fmt", "rgba", "-")
+	out, err := v.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = v.cmd.Start()
+	if err != nil {
+		return fmt.Errorf("%v: decoding with ffmpeg: %v", v.path, err)
+	}
+	v.frames, v.done, v.next = make(chan []byte, 2), make(chan struct{}), frame
+
+	frames, done := v.frames, v.done
+	go func() {
+		defer close(frames)
+		r := bufio.NewReaderSize(out, int(4*v.width))
+		for {
+			pix := make([]byte, 4*v.width*v.height)
+			_, err := io.ReadFull(r, pix)
+			if err != nil {
+				return
+			}
+			select {
+			case frames <- pix:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func stopDecoder(v *videoStream) {
+	if v.cmd == nil {
+		return
+	}
+	close(v.done)
+	v.cmd.Process.Kill()
+	go v.cmd.Wait()
+	v.cmd = nil
+}
+
+func closeVideo(v *videoStream) {
+	stopDecoder(v)
+	v.tex.Delete()
+	for i := range v.pbos {
+		v.pbos[i].Delete()
+	}
+}
+
+// updateVideo shows the frame at time t, decoding up to it, or restarting
+// the decoder if it is behind or more than a second ahead.
+func updateVideo(v *videoStream, t time.Duration) {
+	n := int(t.Seconds() * v.fps)
+	if count := int(v.duration.Seconds() * v.fps); count > 0 {
+		n %= count
+	}
+	if n == v.shown {
+		return
+	}
+
+	if v.cmd == nil || n < v.next || n > v.next+int(v.fps) {
+		stopDecoder(v)
+		err := startDecoder(v, n)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	var pix []byte
+	for v.next <= n {
+		f, ok := <-v.frames
+		if !ok {
+			// ended before its duration, so showing the last frame
+			break
+		}
+		pix = f
+		v.next++
+	}
+	if pix != nil {
+		uploadVideoFrame(v, pix)
+	}
+	v.shown = n
+}
+
+func uploadVideoFrame(v *videoStream, pix []byte) {
+	v.pbo = (v.pbo + 1) % len(v.pbos)
+	size := len(pix)
+	v.pbos[v.pbo].Bind(gl.PIXEL_UNPACK_BUFFER)
+	defer gl.BindBuffer(gl.PIXEL_UNPACK_BUFFER, 0)
+	gl.BufferData(gl.PIXEL_UNPACK_BUFFER, size, nil, gl.STREAM_DRAW)
+	ptr := gl.MapBufferRange(gl.PIXEL_UNPACK_BUFFER, 0, size, gl.MAP_WRITE_BIT|gl.MAP_INVALIDATE_BUFFER_BIT)
+	if ptr == nil {
+		return
+	}
+	copy((*[1 << 30]byte)(ptr)[:size:size], pix)
+	gl.UnmapBuffer(gl.PIXEL_UNPACK_BUFFER)
+
+	v.tex.Bind(gl.TEXTURE_2D)
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, v.width, v.height, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/alotabits/shaderdev/internal/gx"
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+var nagaCommand = flag.String("naga", "naga", "command translating .wgsl shaders to GLSL for a preview in GL, naga from the wgpu project, run with the source and an output path whose extension names the stage; shaders aren't run through wgpu, so its validation and limits don't apply")
+var wgslEntry = flag.String("wgsl-entry", "", "entry points of .wgsl shaders declaring several of a stage, as PREFIX:NAME, comma separated, e.g. vs:vs_main,fs:fs_shaded")
+
+// isWGSL returns whether a shader path is a WebGPU shader, previewed by
+// translating it to GLSL when read. Its stages need 4.3, for the storage
+// buffers and bindings the translation uses.
+func isWGSL(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".wgsl"
+}
+
+// wgslExts are the stages WGSL has, by the extension naga takes them from.
+var wgslExts = map[uint32]string{
+	gl.VERTEX_SHADER:   "vert",
+	gl.FRAGMENT_SHADER: "frag",
+}
+
+// wgslEntryPoint matches the entry point declarations of WGSL, by stage
+// attribute and name.
+var wgslEntryPoint = regexp.MustCompile(`@(vertex|fragment|compute)\s+fn\s+([A-Za-z_][A-Za-z0-9_]*)`)
+
+var wgslStages = map[string]uint32{
+	"vertex":   gl.VERTEX_SHADER,
+	"fragment": gl.FRAGMENT_SHADER,
+}
+
+// parseWGSLEntries reads -wgsl-entry into entry point names by stage.
+func parseWGSLEntries(s string) (map[uint32]string, error) {
+	entries := make(map[uint32]string)
+	if s == "" {
+		return entries, nil
+	}
+	for _, e := range strings.Split(s, ",") {
+		parts := strings.SplitN(e, ":", 2)
+		if len(parts) < 2 || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid -wgsl-entry %v, expected PREFIX:NAME[,...]", s)
+		}
+		stage, ok := shaPrefixToStage[strings.TrimSpace(parts[0])]
+		if !ok {
+			return nil, fmt.Errorf("invalid -wgsl-entry %v: unknown prefix %v", s, parts[0])
+		}
+		entries[stage] = strings.TrimSpace(parts[1])
+	}
+	return entries, nil
+}
+
+// wgslEntryFor returns the entry point of a stage in a WGSL source, the one
+// named by -wgsl-entry or the only one there is. Compute entry points are
+// reported as such, having no stage to be previewed in.
+func wgslEntryFor(stage uint32, path string, src []byte) (string, error) {
+	entries, err := parseWGSLEntries(*wgslEntry)
+	if err != nil {
+		return "", err
+	}
+	var names, compute []string
+	for _, m := range wgslEntryPoint.FindAllSubmatch(src, -1) {
+		if string(m[1]) == "compute" {
+			compute = append(compute, string(m[2]))
+		} else if wgslStages[string(m[1])] == stage {
+			names = append(names, string(m[2]))
+		}
+	}
+
+	if name, ok := entries[stage]; ok {
+		for _, n := range names {
+			if n == name {
+				return name, nil
+			}
+		}
+		return "", fmt.Errorf("%v: no %v entry point %v, have %v", path, gx.StageStr(stage), name, strings.Join(names, ", "))
+	}
+	switch {
+	case len(names) == 1:
+		return names[0], nil
+	case len(names) > 1:
+		return "", fmt.Errorf("%v: %v entry points %v, choose one with -wgsl-entry", path, gx.StageStr(stage), strings.Join(names, ", "))
+	case len(compute) > 0:
+		return "", fmt.Errorf("%v: no %v entry point, and compute entry points %v can't be previewed", path, gx.StageStr(stage), strings.Join(compute, ", "))
+	}
+	return "", fmt.Errorf("%v: no %v entry point", path, gx.StageStr(stage))
+}
+
+// translateWGSL returns the GLSL of the entry point of a stage in the WGSL
+// file at path.
+func translateWGSL(stage uint32, path string) ([]byte, error) {
+	ext, ok := wgslExts[stage]
+	if !ok {
+		return nil, fmt.Errorf("%v: WGSL has no %v stage", path, gx.StageStr(stage))
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := wgslEntryFor(stage, path, src)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "shaderdev-wgsl")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out."+ext)
+
+	profile := "core430"
+	if gles {
+		profile = "es310"
+	}
+	b, err := exec.Command(*nagaCommand, "--profile", profile, "--entry-point", entry, path, out).CombinedOutput()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("%s", bytes.TrimSpace(b))
+		}
+		return nil, err
+	}
+	return ioutil.ReadFile(out)
+}